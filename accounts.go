@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ItemAccounts are the accounts belonging to a single linked item.
+type ItemAccounts struct {
+	Item     string              `json:"item"`
+	Accounts []plaid_cli.Account `json:"accounts"`
+}
+
+func GetAccounts(client *plaid.PlaidApiService, token string) ([]plaid_cli.Account, error) {
+	req := plaid.NewAccountsGetRequest(token)
+	apiReq := client.AccountsGet(context.Background())
+	apiReq = apiReq.AccountsGetRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return nil, err
+	}
+	return plaid_cli.AccountsFromPlaid(res.Accounts), nil
+}
+
+func GetBalances(client *plaid.PlaidApiService, token string) ([]plaid_cli.Account, error) {
+	req := plaid.NewAccountsBalanceGetRequest(token)
+	apiReq := client.AccountsBalanceGet(context.Background())
+	apiReq = apiReq.AccountsBalanceGetRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return nil, err
+	}
+	return plaid_cli.AccountsFromPlaid(res.Accounts), nil
+}
+
+// CacheAccounts remembers accounts fetched for an item, for
+// `accounts --offline` and account labels. Accounts that were cached before
+// but are no longer returned are remembered as missing, and archived if
+// cli.archive_missing_accounts is set.
+func CacheAccounts(data *plaid_cli.Data, itemID string, accounts []plaid_cli.Account) error {
+	now := time.Now()
+	archive := viper.GetBool("cli.archive_missing_accounts")
+	previous := data.AccountCache[itemID]
+
+	returned := make(map[string]bool)
+	for _, account := range accounts {
+		returned[account.AccountID] = true
+	}
+
+	var missing []plaid_cli.MissingAccount
+	for _, m := range previous.Missing {
+		if !returned[m.Account.AccountID] {
+			m.Archived = m.Archived || archive
+			missing = append(missing, m)
+		}
+	}
+	for _, account := range previous.Accounts {
+		if returned[account.AccountID] {
+			continue
+		}
+		log.Printf("⚠️  %s at %s is no longer returned by Plaid. It may have been closed, or deselected when relinking.", AccountLabel(account), ItemName(data, itemID))
+		missing = append(missing, plaid_cli.MissingAccount{Account: account, MissingSince: now, Archived: archive})
+	}
+
+	data.AccountCache[itemID] = plaid_cli.CachedAccounts{UpdatedAt: now, Accounts: accounts, Missing: missing}
+	return data.SaveAccountCache()
+}
+
+// MissingAccounts returns the accounts Plaid no longer returns for an item.
+func MissingAccounts(data *plaid_cli.Data, itemID string) []plaid_cli.MissingAccount {
+	return data.AccountCache[itemID].Missing
+}
+
+// AccountMetadata returns an item's accounts from the cache, fetching and
+// caching them if they haven't been fetched before. Use it where names and
+// masks are needed but balances aren't.
+func AccountMetadata(client *plaid.PlaidApiService, data *plaid_cli.Data, itemID string, token string) ([]plaid_cli.Account, error) {
+	if cached, ok := data.AccountCache[itemID]; ok {
+		// Missing accounts are included so their past transactions are
+		// still labelled.
+		accounts := cached.Accounts
+		for _, m := range cached.Missing {
+			accounts = append(accounts, m.Account)
+		}
+		return accounts, nil
+	}
+
+	accounts, err := GetAccounts(client, token)
+	if err != nil {
+		return nil, err
+	}
+	return accounts, CacheAccounts(data, itemID, accounts)
+}
+
+// OfflineAccounts returns an item's cached accounts.
+func OfflineAccounts(data *plaid_cli.Data, itemID string) ([]plaid_cli.Account, error) {
+	cached, ok := data.AccountCache[itemID]
+	if !ok {
+		return nil, fmt.Errorf("no cached accounts for %s. Run `plaid-cli accounts %s` once without --offline to cache them", ItemName(data, itemID), ItemName(data, itemID))
+	}
+	return cached.Accounts, nil
+}
+
+// AccountFilter selects accounts by Plaid's account type taxonomy. Empty
+// fields match any account.
+type AccountFilter struct {
+	Type    string
+	Subtype string
+}
+
+// Validate checks the filter against the account types and subtypes that
+// Plaid supports.
+func (f AccountFilter) Validate() error {
+	if f.Type != "" {
+		_, err := plaid.NewAccountTypeFromValue(f.Type)
+		if err != nil {
+			return err
+		}
+	}
+	if f.Subtype != "" {
+		_, err := plaid.NewAccountSubtypeFromValue(f.Subtype)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f AccountFilter) Filter(accounts []plaid_cli.Account) []plaid_cli.Account {
+	var filtered []plaid_cli.Account
+	for _, account := range accounts {
+		if f.Type != "" && account.Type != f.Type {
+			continue
+		}
+		if f.Subtype != "" && plaid_cli.Value(account.Subtype) != f.Subtype {
+			continue
+		}
+		filtered = append(filtered, account)
+	}
+	return filtered
+}
+
+// AddAccountDetailsFlag registers --with-account-details on commands that
+// write transactions.
+func AddAccountDetailsFlag(cmd *cobra.Command, withDetails *bool) {
+	cmd.Flags().BoolVar(withDetails, "with-account-details", false, "Label each transaction with its account's name and mask, e.g. \"Chase Checking ••1234\"")
+}
+
+// AccountLabel describes an account the way the user knows it: its official
+// name, or its name if the institution doesn't give one, followed by the
+// last digits of the account number.
+func AccountLabel(account plaid_cli.Account) string {
+	label := plaid_cli.Value(account.OfficialName)
+	if label == "" {
+		label = account.Name
+	}
+	if mask := plaid_cli.Value(account.Mask); mask != "" {
+		label += " ••" + mask
+	}
+	return label
+}
+
+// AccountLabels maps account IDs to their AccountLabel.
+func AccountLabels(accounts []plaid_cli.Account) map[string]string {
+	labels := make(map[string]string)
+	for _, account := range accounts {
+		labels[account.AccountID] = AccountLabel(account)
+	}
+	return labels
+}
+
+// ItemName returns the alias for an item if it has one, otherwise its ID.
+func ItemName(data *plaid_cli.Data, itemID string) string {
+	if alias, ok := data.BackAliases[itemID]; ok {
+		return alias
+	}
+	return itemID
+}
+
+// SortedItemIDs returns the IDs of all linked items ordered by their display
+// name.
+func SortedItemIDs(data *plaid_cli.Data) []string {
+	var itemIDs []string
+	for itemID := range data.Tokens {
+		itemIDs = append(itemIDs, itemID)
+	}
+	sort.Slice(itemIDs, func(i, j int) bool {
+		return ItemName(data, itemIDs[i]) < ItemName(data, itemIDs[j])
+	})
+	return itemIDs
+}
+
+func WriteAccounts(w io.Writer, items []ItemAccounts, format string) error {
+	switch format {
+	case "json":
+		// Always a list of items, even for one, so scripts can rely on the
+		// shape.
+		b, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "table":
+		return writeAccountsTable(w, items)
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+func WriteBalances(w io.Writer, items []ItemAccounts, format string) error {
+	switch format {
+	case "json":
+		return WriteAccounts(w, items, format)
+	case "table":
+		return writeBalancesTable(w, items)
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+func writeBalancesTable(w io.Writer, items []ItemAccounts) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "ITEM\tNAME\tTYPE\tSUBTYPE\tMASK\tCURRENT\tAVAILABLE\tCURRENCY")
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		for _, account := range item.Accounts {
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				item.Item,
+				account.Name,
+				account.Type,
+				plaid_cli.Value(account.Subtype),
+				plaid_cli.Value(account.Mask),
+				formatBalance(account.Balances.Current),
+				formatBalance(account.Balances.Available),
+				plaid_cli.Value(account.Balances.ISOCurrencyCode),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Flush()
+}
+
+func formatBalance(balance *float64) string {
+	if balance == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", *balance)
+}
+
+func writeAccountsTable(w io.Writer, items []ItemAccounts) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "ITEM\tNAME\tTYPE\tSUBTYPE\tMASK\tACCOUNT ID")
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		for _, account := range item.Accounts {
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				item.Item,
+				account.Name,
+				account.Type,
+				plaid_cli.Value(account.Subtype),
+				plaid_cli.Value(account.Mask),
+				account.AccountID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Flush()
+}
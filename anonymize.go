@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/cobra"
+)
+
+// AddAnonymizeFlag registers --anonymize on commands that write transactions.
+func AddAnonymizeFlag(cmd *cobra.Command, anonymize *bool) {
+	cmd.Flags().BoolVar(anonymize, "anonymize", false, "Hash IDs, mask merchant names and descriptions, and round amounts, for sharing sample data")
+}
+
+// Anonymizer disguises transactions so they can be shared in bug reports or
+// demos. The same account or merchant is always disguised the same way
+// within one export, so the data still hangs together, but with a key
+// chosen for each export, so the disguise can't be undone by hashing
+// guesses.
+type Anonymizer struct {
+	key []byte
+}
+
+func NewAnonymizer() (*Anonymizer, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Anonymizer{key: key}, nil
+}
+
+func (a *Anonymizer) hash(prefix string, s string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(prefix + "\x00" + s))
+	return prefix + "-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// AccountID returns the ID an account is disguised with.
+func (a *Anonymizer) AccountID(accountID string) string {
+	return a.hash("account", accountID)
+}
+
+// Transaction returns tx with its IDs hashed, merchant and description
+// replaced by pseudonyms, its amount rounded to a bucket, and details that
+// could identify the user, such as location and check numbers, removed.
+// Dates, categories and currencies are kept, since they're what makes
+// sample data useful.
+func (a *Anonymizer) Transaction(tx plaid_cli.Transaction) plaid_cli.Transaction {
+	anonymized := plaid_cli.Transaction{
+		AccountID:               a.AccountID(tx.AccountID),
+		TransactionID:           a.hash("transaction", tx.TransactionID),
+		Amount:                  bucketAmount(tx.Amount),
+		ISOCurrencyCode:         tx.ISOCurrencyCode,
+		UnofficialCurrencyCode:  tx.UnofficialCurrencyCode,
+		Category:                tx.Category,
+		CategoryID:              tx.CategoryID,
+		Date:                    tx.Date,
+		AuthorizedDate:          tx.AuthorizedDate,
+		Pending:                 tx.Pending,
+		PaymentChannel:          tx.PaymentChannel,
+		PersonalFinanceCategory: tx.PersonalFinanceCategory,
+		TransactionCode:         tx.TransactionCode,
+	}
+
+	if merchant := plaid_cli.Value(tx.MerchantName); merchant != "" {
+		anonymized.MerchantName = plaid_cli.Ptr(a.hash("merchant", merchant))
+		anonymized.Name = plaid_cli.Value(anonymized.MerchantName)
+	} else {
+		anonymized.Name = a.hash("description", tx.Name)
+	}
+	if pending := plaid_cli.Value(tx.PendingTransactionID); pending != "" {
+		anonymized.PendingTransactionID = plaid_cli.Ptr(a.hash("transaction", pending))
+	}
+	return anonymized
+}
+
+// Transactions anonymizes each of txs.
+func (a *Anonymizer) Transactions(txs []plaid_cli.Transaction) []plaid_cli.Transaction {
+	anonymized := make([]plaid_cli.Transaction, len(txs))
+	for i, tx := range txs {
+		anonymized[i] = a.Transaction(tx)
+	}
+	return anonymized
+}
+
+// bucketAmount rounds amount away from zero to the next step of 1, 2.5, 5,
+// 10, 25, 50 and so on, keeping its sign and rough size but not its value.
+func bucketAmount(amount float64) float64 {
+	magnitude := math.Abs(amount)
+	if magnitude == 0 {
+		return 0
+	}
+
+	scale := math.Pow(10, math.Floor(math.Log10(magnitude)))
+	bucket := 10 * scale
+	for _, step := range []float64{1, 2.5, 5} {
+		if magnitude <= step*scale {
+			bucket = step * scale
+			break
+		}
+	}
+	return math.Copysign(bucket, amount)
+}
+
+// anonymizingSerializer anonymizes transactions, and the account labels
+// they're annotated with, before another serializer writes them.
+type anonymizingSerializer struct {
+	TransactionSerializer
+	anonymizer *Anonymizer
+}
+
+// Anonymize wraps serializer so everything it writes is anonymized.
+func Anonymize(serializer TransactionSerializer) (TransactionSerializer, error) {
+	anonymizer, err := NewAnonymizer()
+	if err != nil {
+		return nil, err
+	}
+	return &anonymizingSerializer{TransactionSerializer: serializer, anonymizer: anonymizer}, nil
+}
+
+func (s *anonymizingSerializer) serialize(w io.Writer, txs []plaid_cli.Transaction) error {
+	return s.TransactionSerializer.serialize(w, s.anonymizer.Transactions(txs))
+}
+
+func (s *anonymizingSerializer) annotateItems(accountItems map[string]string) {
+	s.TransactionSerializer.annotateItems(s.rekey(accountItems, false))
+}
+
+// annotateAccounts replaces account names and masks with the accounts'
+// hashed IDs.
+func (s *anonymizingSerializer) annotateAccounts(accountLabels map[string]string) {
+	s.TransactionSerializer.annotateAccounts(s.rekey(accountLabels, true))
+}
+
+func (s *anonymizingSerializer) annotateOwners(accountOwners map[string]string) {
+	s.TransactionSerializer.annotateOwners(s.rekey(accountOwners, false))
+}
+
+// rekey looks annotations up by hashed account ID, replacing their values
+// with it if mask is set.
+func (s *anonymizingSerializer) rekey(annotations map[string]string, mask bool) map[string]string {
+	if annotations == nil {
+		return nil
+	}
+	rekeyed := make(map[string]string, len(annotations))
+	for accountID, value := range annotations {
+		id := s.anonymizer.AccountID(accountID)
+		if mask {
+			value = id
+		}
+		rekeyed[id] = value
+	}
+	return rekeyed
+}
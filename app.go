@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// App is what commands share: the data, Plaid client and linker for the
+// environment in use, the logs plaid-cli keeps, and the global flags. It's
+// attached to the context commands are run with, so a command reads it with
+// AppFrom rather than from variables shared by every command, and can be run
+// against an App of its own.
+type App struct {
+	// Data is loaded for the environment in use once it's known.
+	Data *plaid_cli.Data
+	// Client is configured once flags have been parsed, so that
+	// --environment can override the configured environment.
+	Client     *plaid.PlaidApiService
+	Linker     *plaid_cli.Linker
+	ItemClient *ItemClient
+
+	AuditLog *AuditLog
+	History  *History
+	Webhooks *WebhookStore
+
+	DataDir   string
+	Countries []plaid.CountryCode
+	Language  string
+	Products  []plaid.Products
+
+	// DryRun is set by --dry-run.
+	DryRun bool
+	// NoRelink is set by --no-relink.
+	NoRelink bool
+	// ItemFlags are the institutions passed with --item, and read from
+	// stdin with --stdin-items.
+	ItemFlags  []string
+	StdinItems bool
+	Partial    *PartialResults
+	Mask       *MaskPolicy
+	Production *ProductionGuard
+}
+
+// NewApp returns an App keeping its data and logs in dataDir. Its data and
+// client are empty until the environment is known and ConfigureClient and
+// LoadData are called.
+func NewApp(dataDir string, countries []plaid.CountryCode, lang string, products []plaid.Products) *App {
+	app := &App{
+		Data:       new(plaid_cli.Data),
+		Client:     new(plaid.PlaidApiService),
+		AuditLog:   &AuditLog{Path: filepath.Join(dataDir, "audit.log")},
+		History:    &History{Path: filepath.Join(dataDir, "history.log")},
+		Webhooks:   &WebhookStore{Dir: filepath.Join(dataDir, "webhooks")},
+		DataDir:    dataDir,
+		Countries:  countries,
+		Language:   lang,
+		Products:   products,
+		Partial:    &PartialResults{},
+		Mask:       &MaskPolicy{},
+		Production: &ProductionGuard{},
+	}
+	app.Linker = plaid_cli.NewLinker(app.Data, app.Client, countries, lang, products)
+	app.ItemClient = NewItemClient(app.Client, app.Data, app.Linker)
+	app.ItemClient.History = app.History
+	return app
+}
+
+// ConfigureClient points the client at the configured environment, which it
+// returns. Requests are recorded in the audit log against command.
+func (a *App) ConfigureClient(command string) string {
+	plaidEnvStr := strings.ToLower(viper.GetString("plaid.environment"))
+
+	var plaidEnv plaid.Environment
+	switch plaidEnvStr {
+	case "sandbox":
+		plaidEnv = plaid.Sandbox
+	case "production":
+		plaidEnv = plaid.Production
+	default:
+		FatalConfig("Invalid plaid environment. Valid plaid environments are 'sandbox' or 'production'.")
+	}
+
+	clientId := viper.GetString("plaid.client_id")
+	secret := viper.GetString("plaid.secret")
+
+	conf := plaid.NewConfiguration()
+	conf.AddDefaultHeader("PLAID-CLIENT-ID", clientId)
+	conf.AddDefaultHeader("PLAID-SECRET", secret)
+	conf.AddDefaultHeader("Plaid-Version", PlaidAPIVersion())
+	conf.Servers = plaid.ServerConfigurations{{URL: PlaidBaseURL(plaidEnv)}}
+	rateLimits, err := RateLimitsFromViper()
+	if err != nil {
+		Fatal(err)
+	}
+	opts := ClientOptions{
+		Timeout:    viper.GetDuration("cli.request_timeout"),
+		Retries:    viper.GetInt("cli.retries"),
+		RateLimits: rateLimits,
+		Verbose:    viper.GetBool("cli.verbose"),
+	}
+	if viper.GetBool("cli.audit") {
+		opts.Audit = func(base http.RoundTripper) http.RoundTripper {
+			return NewAuditTransport(base, a.AuditLog, a.Data, plaidEnvStr, command)
+		}
+	}
+	conf.HTTPClient = NewPlaidHTTPClient(opts)
+	*a.Client = *plaid.NewAPIClient(conf).PlaidApi
+
+	return plaidEnvStr
+}
+
+// SelectItems resolves the items a command should cover from its arguments
+// and --item, as the package-level SelectItems does.
+func (a *App) SelectItems(args []string) (itemIDs []string, all bool, err error) {
+	return SelectItems(a.Data, args, a.ItemFlags)
+}
+
+// ResolveItems resolves the items passed to a command as arguments or with
+// --item, as the package-level ResolveItems does.
+func (a *App) ResolveItems(args []string) ([]string, error) {
+	return ResolveItems(a.Data, args, a.ItemFlags)
+}
+
+// ResolveItem resolves an item ID or alias passed to a command.
+func (a *App) ResolveItem(itemOrAlias string) (string, error) {
+	return ResolveItem(a.Data, itemOrAlias)
+}
+
+type appKey struct{}
+
+// WithApp returns ctx with app attached, for running commands with.
+func WithApp(ctx context.Context, app *App) context.Context {
+	return context.WithValue(ctx, appKey{}, app)
+}
+
+// AppFrom returns the App cmd is being run with.
+func AppFrom(cmd *cobra.Command) *App {
+	app, ok := cmd.Context().Value(appKey{}).(*App)
+	if !ok {
+		panic("plaid-cli: " + cmd.CommandPath() + " was run without an App")
+	}
+	return app
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+type AssetReportStatus struct {
+	AssetReportID string `json:"asset_report_id"`
+	Status        string `json:"status"`
+}
+
+func CreateAssetReport(data *plaid_cli.Data, client *plaid.PlaidApiService, tokens []string, days int32) (plaid.AssetReportCreateResponse, error) {
+	req := plaid.NewAssetReportCreateRequest(days)
+	req.SetAccessTokens(tokens)
+
+	apiReq := client.AssetReportCreate(context.Background())
+	apiReq = apiReq.AssetReportCreateRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return res, err
+	}
+
+	data.AssetReports[res.AssetReportId] = res.AssetReportToken
+	err = data.SaveAssetReports()
+
+	return res, err
+}
+
+// ResolveAssetReportToken accepts either an asset report ID created by
+// plaid-cli or a raw asset report token.
+func ResolveAssetReportToken(data *plaid_cli.Data, idOrToken string) string {
+	if token, ok := data.AssetReports[idOrToken]; ok {
+		return token
+	}
+	return idOrToken
+}
+
+func GetAssetReport(client *plaid.PlaidApiService, token string) (plaid.AssetReportGetResponse, error) {
+	req := plaid.NewAssetReportGetRequest()
+	req.SetAssetReportToken(token)
+
+	apiReq := client.AssetReportGet(context.Background())
+	apiReq = apiReq.AssetReportGetRequest(*req)
+	res, _, err := apiReq.Execute()
+	return res, err
+}
+
+func GetAssetReportStatus(client *plaid.PlaidApiService, idOrToken string, token string) (AssetReportStatus, error) {
+	status := AssetReportStatus{AssetReportID: idOrToken}
+
+	_, err := GetAssetReport(client, token)
+	if err == nil {
+		status.Status = "ready"
+		return status, nil
+	}
+
+	if PlaidErrorCode(err) == "PRODUCT_NOT_READY" {
+		status.Status = "pending"
+		return status, nil
+	}
+
+	return status, err
+}
+
+func WriteAssetReportJSON(w io.Writer, client *plaid.PlaidApiService, token string) error {
+	res, err := GetAssetReport(client, token)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(res.Report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func WriteAssetReportPDF(w io.Writer, client *plaid.PlaidApiService, token string) (err error) {
+	req := plaid.NewAssetReportPDFGetRequest(token)
+
+	apiReq := client.AssetReportPdfGet(context.Background())
+	apiReq = apiReq.AssetReportPDFGetRequest(*req)
+	f, _, err := apiReq.Execute()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := f.Close()
+		removeErr := os.Remove(f.Name())
+		err = errors.Join(err, closeErr, removeErr)
+	}()
+
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// AuditEntry records a single request to the Plaid API. Access tokens are
+// never recorded, only the item they belong to.
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	Environment string    `json:"environment"`
+	Command     string    `json:"command"`
+	Item        string    `json:"item,omitempty"`
+	Endpoint    string    `json:"endpoint"`
+	RequestID   string    `json:"request_id,omitempty"`
+	Status      int       `json:"status,omitempty"`
+	// Outcome is "ok", the Plaid error code, or the error that stopped the
+	// request from completing.
+	Outcome string `json:"outcome"`
+}
+
+// AuditLog is an append-only log of Plaid API requests, one JSON entry per
+// line.
+type AuditLog struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (l *AuditLog) Append(entry AuditEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return errors.Join(err, f.Close())
+}
+
+// Read returns the entries in the log, oldest first.
+func (l *AuditLog) Read() ([]AuditEntry, error) {
+	f, err := os.Open(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var entry AuditEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", l.Path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Prune removes entries older than retention. The log is only rewritten when
+// something has expired.
+func (l *AuditLog) Prune(retention time.Duration) error {
+	if retention <= 0 {
+		return nil
+	}
+	_, err := l.PruneBefore(time.Now().Add(-retention), false)
+	return err
+}
+
+// PruneBefore removes entries from before cutoff, returning how many there
+// were. With dryRun set they're only counted.
+func (l *AuditLog) PruneBefore(cutoff time.Time, dryRun bool) (int, error) {
+	entries, err := l.Read()
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	expired := 0
+	for _, entry := range entries {
+		if entry.Time.Before(cutoff) {
+			expired++
+			continue
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(append(b, '\n'))
+	}
+	if expired == 0 || dryRun {
+		return expired, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tmp := l.Path + ".tmp"
+	err = os.WriteFile(tmp, buf.Bytes(), 0600)
+	if err != nil {
+		return 0, err
+	}
+	return expired, os.Rename(tmp, l.Path)
+}
+
+// AuditFilter selects audit entries to show.
+type AuditFilter struct {
+	Since time.Time
+	// Items, if set, are the item IDs to show.
+	Items []string
+}
+
+func (f AuditFilter) Filter(entries []AuditEntry) []AuditEntry {
+	var filtered []AuditEntry
+	for _, entry := range entries {
+		if entry.Time.Before(f.Since) {
+			continue
+		}
+		if len(f.Items) > 0 && !slices.Contains(f.Items, entry.Item) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
+
+func WriteAuditEntries(w io.Writer, entries []AuditEntry, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "TIME\tENVIRONMENT\tCOMMAND\tITEM\tENDPOINT\tREQUEST ID\tOUTCOME")
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Environment, e.Command, e.Item, e.Endpoint, e.RequestID, e.Outcome)
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+// auditTransport records every request made through it to an AuditLog.
+type auditTransport struct {
+	base        http.RoundTripper
+	log         *AuditLog
+	data        *plaid_cli.Data
+	environment string
+	command     string
+}
+
+// NewAuditTransport wraps base so that every Plaid request made by command
+// is recorded in log. data is used to work out which item an access token
+// belongs to.
+func NewAuditTransport(base http.RoundTripper, log *AuditLog, data *plaid_cli.Data, environment string, command string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &auditTransport{base: base, log: log, data: data, environment: environment, command: command}
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := AuditEntry{
+		Time:        time.Now().UTC(),
+		Environment: t.environment,
+		Command:     t.command,
+		Endpoint:    req.URL.Path,
+	}
+
+	entry.Item = t.itemForToken(requestAccessToken(req))
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		entry.Outcome = err.Error()
+		t.append(entry)
+		return res, err
+	}
+
+	entry.Status = res.StatusCode
+	fields, readErr := readResponseFields(res)
+	entry.RequestID = fields.RequestID
+
+	switch {
+	case readErr != nil:
+		entry.Outcome = readErr.Error()
+	case fields.ErrorCode != "":
+		entry.Outcome = fields.ErrorCode
+	case res.StatusCode >= 300:
+		entry.Outcome = res.Status
+	default:
+		entry.Outcome = "ok"
+	}
+
+	t.append(entry)
+	return res, readErr
+}
+
+func (t *auditTransport) itemForToken(token string) string {
+	if token == "" || t.data == nil {
+		return ""
+	}
+	for itemID, t := range t.data.Tokens {
+		if t == token {
+			return itemID
+		}
+	}
+	return ""
+}
+
+func (t *auditTransport) append(entry AuditEntry) {
+	err := t.log.Append(entry)
+	if err != nil {
+		log.Printf("⚠️  Failed to write to the audit log %s: %v\n", t.log.Path, err)
+	}
+}
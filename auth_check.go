@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// authCheckProducts are the products `auth-check` tries by default. Others,
+// such as payment_initiation, need more than a link token to try.
+var authCheckProducts = []plaid.Products{
+	plaid.PRODUCTS_TRANSACTIONS,
+	plaid.PRODUCTS_AUTH,
+	plaid.PRODUCTS_IDENTITY,
+	plaid.PRODUCTS_INVESTMENTS,
+	plaid.PRODUCTS_LIABILITIES,
+	plaid.PRODUCTS_ASSETS,
+}
+
+// ProductCheck is whether a product can be used with the configured
+// credentials.
+type ProductCheck struct {
+	Product string `json:"product"`
+	Enabled bool   `json:"enabled"`
+	// Detail is why the product can't be used, from Plaid.
+	Detail string `json:"detail,omitempty"`
+}
+
+// AuthCheck is the result of checking the configured credentials.
+type AuthCheck struct {
+	Environment string         `json:"environment"`
+	Products    []ProductCheck `json:"products"`
+}
+
+// CheckCredentials makes a minimal request with client, so a wrong client
+// ID or secret, or one for another environment, is found before anything
+// else is done with it.
+func CheckCredentials(client *plaid.PlaidApiService, countries []plaid.CountryCode) error {
+	req := plaid.NewInstitutionsGetRequest(1, 0, countries)
+	_, _, err := client.InstitutionsGet(context.Background()).InstitutionsGetRequest(*req).Execute()
+	return err
+}
+
+// CheckProducts tries to create a link token for each of products, which
+// Plaid refuses for products the account hasn't been enabled for, or that
+// aren't available in the configured countries.
+func CheckProducts(linker *plaid_cli.Linker, products []plaid.Products) ([]ProductCheck, error) {
+	var checks []ProductCheck
+	for _, product := range products {
+		check := ProductCheck{Product: string(product)}
+		_, err := linker.CreateLinkToken([]plaid.Products{product})
+		if err != nil {
+			pe, isPlaidErr := AsPlaidError(err)
+			if !isPlaidErr {
+				return nil, err
+			}
+			check.Detail = fmt.Sprintf("%s: %s", pe.ErrorCode, pe.ErrorMessage)
+		} else {
+			check.Enabled = true
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func WriteAuthCheck(w io.Writer, check AuthCheck, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(check, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "table":
+		_, err := fmt.Fprintf(w, "The client ID and secret are valid for %s.\n\n", check.Environment)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err = fmt.Fprintln(tw, "PRODUCT\tENABLED\tDETAIL")
+		if err != nil {
+			return err
+		}
+		for _, product := range check.Products {
+			enabled := "no"
+			if product.Enabled {
+				enabled = "yes"
+			}
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\n", product.Product, enabled, truncate(product.Detail, 100))
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
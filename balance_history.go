@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// DailyBalance is an account's estimated balance at the end of a day.
+type DailyBalance struct {
+	Date      string          `json:"date"`
+	Item      string          `json:"item"`
+	AccountID string          `json:"account_id"`
+	Account   string          `json:"account"`
+	Balance   plaid_cli.Money `json:"balance"`
+}
+
+// MatchAccount reports whether account is the one the user named, by
+// account ID, mask or name.
+func MatchAccount(account plaid_cli.Account, name string) bool {
+	return name == "" ||
+		account.AccountID == name ||
+		plaid_cli.Value(account.Mask) == name ||
+		strings.EqualFold(account.Name, name) ||
+		strings.EqualFold(plaid_cli.Value(account.OfficialName), name)
+}
+
+// ReconstructBalances estimates account's end-of-day balance for each day
+// from from to to, working backwards from its current balance by undoing
+// the posted transactions made since. txs must include every posted
+// transaction for the account from from up to today. Pending transactions
+// are skipped because they aren't part of the current balance yet.
+//
+// Plaid reports money leaving an account as a positive amount. That lowers
+// the balance of a depository account, but raises what's owed on credit
+// and loan accounts, whose balances are amounts owed.
+func ReconstructBalances(item string, account plaid_cli.Account, txs []plaid_cli.Transaction, from time.Time, to time.Time) []DailyBalance {
+	current := plaid_cli.MoneyFromFloat(plaid_cli.Value(account.Balances.Current))
+
+	owed := account.Type == plaid_cli.AccountTypeCredit || account.Type == plaid_cli.AccountTypeLoan
+
+	// changes[d] is the net effect of day d's transactions on the balance.
+	changes := make(map[string]plaid_cli.Money)
+	for _, tx := range txs {
+		if tx.AccountID != account.AccountID || tx.Pending {
+			continue
+		}
+		if owed {
+			changes[tx.Date] -= plaid_cli.MoneyFromFloat(tx.Amount)
+		} else {
+			changes[tx.Date] += plaid_cli.MoneyFromFloat(tx.Amount)
+		}
+	}
+
+	// Walk back from today, undoing each day's transactions to get the
+	// previous day's closing balance.
+	balance := current
+	balances := make(map[string]plaid_cli.Money)
+	today := truncateDay(time.Now())
+	for day := today; !day.Before(from); day = day.AddDate(0, 0, -1) {
+		date := day.Format("2006-01-02")
+		balances[date] = balance
+		balance += changes[date]
+	}
+
+	var daily []DailyBalance
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		b, ok := balances[date]
+		if !ok {
+			// Days after today have no transactions yet.
+			b = current
+		}
+		daily = append(daily, DailyBalance{
+			Date:      date,
+			Item:      item,
+			AccountID: account.AccountID,
+			Account:   AccountLabel(account),
+			Balance:   b,
+		})
+	}
+
+	return daily
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func WriteDailyBalances(w io.Writer, balances []DailyBalance, format string) error {
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write([]string{"Date", "Item", "Account ID", "Account", "Balance"})
+		if err != nil {
+			return err
+		}
+		for _, b := range balances {
+			err = writer.Write([]string{b.Date, b.Item, b.AccountID, b.Account, fmt.Sprintf("%.2f", b.Balance)})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "json":
+		b, err := json.MarshalIndent(balances, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
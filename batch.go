@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// BatchOperation is a single row of a batch file.
+type BatchOperation struct {
+	Line     int
+	Command  string
+	Item     string
+	Argument string
+}
+
+// BatchResult is the outcome of a batch operation.
+type BatchResult struct {
+	BatchOperation
+	Err error
+}
+
+// ReadBatchFile reads operations from a CSV file with command, item and
+// argument columns. A header row starting with "command" is skipped.
+func ReadBatchFile(path string) ([]BatchOperation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var ops []BatchOperation
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(ops) == 0 && strings.EqualFold(record[0], "command") {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected command,item[,argument]", path, line)
+		}
+
+		op := BatchOperation{
+			Line:    line,
+			Command: strings.ToLower(strings.TrimSpace(record[0])),
+			Item:    strings.TrimSpace(record[1]),
+		}
+		if len(record) > 2 {
+			op.Argument = strings.TrimSpace(record[2])
+		}
+
+		switch op.Command {
+		case "refresh":
+		case "webhook", "webhook set":
+			op.Command = "webhook set"
+			if op.Argument == "" {
+				return nil, fmt.Errorf("%s:%d: webhook set needs a webhook URL", path, line)
+			}
+		case "alias":
+			if op.Argument == "" {
+				return nil, fmt.Errorf("%s:%d: alias needs a name", path, line)
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown command %q. Use refresh, webhook set or alias", path, line, record[0])
+		}
+
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+// RunBatch runs each operation in turn, carrying on past failures so a single
+// broken item doesn't stop the rest.
+func RunBatch(client *ItemClient, ops []BatchOperation, dryRun bool) []BatchResult {
+	var results []BatchResult
+	for _, op := range ops {
+		results = append(results, BatchResult{
+			BatchOperation: op,
+			Err:            runBatchOperation(client, op, dryRun),
+		})
+	}
+	return results
+}
+
+func runBatchOperation(client *ItemClient, op BatchOperation, dryRun bool) error {
+	data := client.Data
+
+	if op.Command == "alias" {
+		if dryRun {
+			return nil
+		}
+		return SetAlias(data, op.Item, op.Argument)
+	}
+
+	itemID, err := ResolveItem(data, op.Item)
+	if err != nil {
+		return err
+	}
+
+	return client.Do(itemID, func(token string) error {
+		switch op.Command {
+		case "refresh":
+			req := plaid.NewTransactionsRefreshRequest(token)
+			if dryRun {
+				return plaid_cli.PrintDryRun("/transactions/refresh", req)
+			}
+			_, _, err := client.TransactionsRefresh(context.Background()).TransactionsRefreshRequest(*req).Execute()
+			return err
+		case "webhook set":
+			return UpdateWebhook(client, token, op.Argument, dryRun)
+		default:
+			return fmt.Errorf("unknown command %q", op.Command)
+		}
+	})
+}
+
+// BatchError summarizes the operations that failed.
+func BatchError(results []BatchResult) error {
+	var failed int
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return nil
+	case failed == len(results):
+		return fmt.Errorf("all %d operations failed", failed)
+	default:
+		return PartialError{Err: fmt.Errorf("%d of %d operations failed", failed, len(results))}
+	}
+}
+
+func WriteBatchResults(w io.Writer, results []BatchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "LINE\tCOMMAND\tITEM\tSTATUS\tERROR")
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		status := "ok"
+		message := ""
+		if r.Err != nil {
+			status = "failed"
+			message = r.Err.Error()
+		}
+		_, err = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", r.Line, r.Command, r.Item, status, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// personalFinanceCategories is Plaid's personal finance category taxonomy, as
+// published at https://plaid.com/documents/transactions-personal-finance-category-taxonomy.csv
+//
+//go:embed personal_finance_categories.csv
+var personalFinanceCategories string
+
+// PrimaryCategory is a top-level personal finance category and the detailed
+// categories within it.
+type PrimaryCategory struct {
+	Primary  string             `json:"primary"`
+	Detailed []DetailedCategory `json:"detailed"`
+}
+
+type DetailedCategory struct {
+	Detailed    string `json:"detailed"`
+	Description string `json:"description"`
+}
+
+// Categories returns the personal finance category taxonomy in the order Plaid
+// publishes it.
+func Categories() ([]PrimaryCategory, error) {
+	reader := csv.NewReader(strings.NewReader(personalFinanceCategories))
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []PrimaryCategory
+	// Skip the header row.
+	for _, record := range records[1:] {
+		primary := record[0]
+		if len(categories) == 0 || categories[len(categories)-1].Primary != primary {
+			categories = append(categories, PrimaryCategory{Primary: primary})
+		}
+
+		last := &categories[len(categories)-1]
+		last.Detailed = append(last.Detailed, DetailedCategory{
+			Detailed:    record[1],
+			Description: record[2],
+		})
+	}
+
+	return categories, nil
+}
+
+// FilterCategories returns the categories under primary, or all categories if
+// primary is empty.
+func FilterCategories(categories []PrimaryCategory, primary string) ([]PrimaryCategory, error) {
+	if primary == "" {
+		return categories, nil
+	}
+
+	var names []string
+	for _, c := range categories {
+		if strings.EqualFold(c.Primary, primary) {
+			return []PrimaryCategory{c}, nil
+		}
+		names = append(names, c.Primary)
+	}
+
+	return nil, fmt.Errorf("unknown primary category %q. Valid primary categories are: %s", primary, strings.Join(names, ", "))
+}
+
+func WriteCategories(w io.Writer, categories []PrimaryCategory, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(categories, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "PRIMARY\tDETAILED\tDESCRIPTION")
+		if err != nil {
+			return err
+		}
+		for _, c := range categories {
+			for _, d := range c.Detailed {
+				_, err = fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Primary, d.Detailed, d.Description)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+// CategoryExclusions are categories left out of spending reports, such as
+// transfers and credit card payments, which would otherwise be counted as
+// spending. Each is the name of a primary or detailed personal finance
+// category written in any case, with spaces for underscores: "Transfer Out"
+// matches TRANSFER_OUT and everything under it, and "Loan Payments Credit
+// Card Payment" matches LOAN_PAYMENTS_CREDIT_CARD_PAYMENT.
+type CategoryExclusions []string
+
+// AddExcludeCategoryFlag registers --exclude-category on reports.
+func AddExcludeCategoryFlag(cmd *cobra.Command, exclusions *[]string) {
+	cmd.Flags().StringSliceVar(exclusions, "exclude-category", nil, "Leave out transactions in these categories, e.g. \"Transfer,Credit Card Payment\" (default report.exclude_categories)")
+}
+
+// CategoryExclusionsFor returns the categories a report excludes: those
+// given with --exclude-category if it was passed, otherwise those in
+// report.exclude_categories.
+func CategoryExclusionsFor(cmd *cobra.Command, flag []string) (CategoryExclusions, error) {
+	names := viper.GetStringSlice("report.exclude_categories")
+	if cmd.Flags().Changed("exclude-category") {
+		names = flag
+	}
+	names = normalizeCategories(names)
+	err := CheckCategories(names)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --exclude-category: %w", err)
+	}
+	return CategoryExclusions(names), nil
+}
+
+// CheckCategories returns an error for the first of names, normalized as
+// normalizeCategories does, that isn't a primary or detailed personal
+// finance category.
+func CheckCategories(names []string) error {
+	categories, err := Categories()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	var primaries []string
+	for _, c := range categories {
+		known[c.Primary] = true
+		primaries = append(primaries, c.Primary)
+		for _, d := range c.Detailed {
+			known[d.Detailed] = true
+		}
+	}
+
+	for _, name := range names {
+		if known[name] {
+			continue
+		}
+		if suggestion := closestValue(name, primaries); suggestion != "" {
+			return fmt.Errorf("unknown category %q. Did you mean %s? See `plaid-cli transactions categories`", name, suggestion)
+		}
+		return fmt.Errorf("unknown category %q. See `plaid-cli transactions categories`", name)
+	}
+	return nil
+}
+
+// normalizeCategories writes category names the way Plaid does, in upper
+// case with underscores.
+func normalizeCategories(names []string) []string {
+	var normalized []string
+	for _, name := range names {
+		name = strings.ToUpper(strings.Join(strings.Fields(name), "_"))
+		if name != "" {
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized
+}
+
+// Excludes reports whether tx is in an excluded category.
+func (e CategoryExclusions) Excludes(tx plaid_cli.Transaction) bool {
+	return inCategories(tx, e)
+}
+
+// inCategories reports whether tx is in one of names, which match as
+// CategoryExclusions describes.
+func inCategories(tx plaid_cli.Transaction, names []string) bool {
+	pfc := tx.PersonalFinanceCategory
+	if pfc == nil {
+		return false
+	}
+	primary := strings.ToUpper(pfc.Primary)
+	detailed := strings.ToUpper(pfc.Detailed)
+	for _, name := range names {
+		if primary == name || detailed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter removes transactions in excluded categories.
+func (e CategoryExclusions) Filter(txs []plaid_cli.Transaction) []plaid_cli.Transaction {
+	if len(e) == 0 {
+		return txs
+	}
+	return keep(txs, func(tx plaid_cli.Transaction) bool {
+		return !e.Excludes(tx)
+	})
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plaid/plaid-go/v26/plaid"
+	"github.com/spf13/viper"
+)
+
+// PlaidBaseURL returns the URL of env's Plaid API, unless plaid.base_url
+// says to send requests somewhere else: a proxy, a corporate egress
+// gateway or the fake in pkg/fakeplaid.
+func PlaidBaseURL(env plaid.Environment) string {
+	if baseURL := viper.GetString("plaid.base_url"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	return string(env)
+}
+
+// CheckBaseURL returns an error if baseURL can't be used as plaid.base_url.
+// A path is allowed, for gateways that serve Plaid under one. Requests carry
+// the client ID, secret and access tokens, so plain http is only allowed to
+// this machine, such as for the fake Plaid API.
+func CheckBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q isn't an http:// or https:// URL", baseURL)
+	}
+	if u.Scheme == "http" && !isLoopback(u.Hostname()) {
+		return fmt.Errorf("%q must use https://, since requests carry credentials. Plain http:// is only allowed to localhost", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q can't have a query or fragment, since request paths are added to it", baseURL)
+	}
+	return nil
+}
+
+// isLoopback reports whether host is this machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// PlaidAPIVersion returns the Plaid-Version sent with every request:
+// plaid.api_version, to stay on a version known to work while Plaid rolls
+// out changes plaid-go hasn't caught up with, or else the version plaid-go
+// was generated for.
+func PlaidAPIVersion() string {
+	if version := viper.GetString("plaid.api_version"); version != "" {
+		return version
+	}
+	return plaid.NewConfiguration().DefaultHeader["Plaid-Version"]
+}
+
+// CheckAPIVersion returns an error if version isn't a Plaid API version.
+// Versions are the dates they were released, such as 2020-09-14.
+func CheckAPIVersion(version string) error {
+	_, err := time.Parse("2006-01-02", version)
+	if err != nil {
+		return fmt.Errorf("%q isn't a Plaid API version. Versions are dates, such as 2020-09-14", version)
+	}
+	return nil
+}
+
+// ClientOptions configure the HTTP client that every request to Plaid goes
+// through, whichever command makes it.
+type ClientOptions struct {
+	// Timeout bounds each request, including retries and their waits.
+	Timeout time.Duration
+	// Retries is how many times a read-only request is retried after a
+	// network error, a rate limit or a server error.
+	Retries int
+	// RateLimits are requests per minute per item, by product.
+	RateLimits map[string]int
+	// Audit, if set, wraps the transport to record every request.
+	Audit func(http.RoundTripper) http.RoundTripper
+	// Verbose logs every request with its status, duration and request ID.
+	Verbose bool
+}
+
+// NewPlaidHTTPClient builds the client for the Plaid API. Requests wait for
+// the rate limit, are retried if they're safe to retry, and are recorded in
+// the audit log and, with --verbose, logged; in that order, so each attempt
+// is recorded.
+func NewPlaidHTTPClient(opts ClientOptions) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if opts.Verbose {
+		transport = &loggingTransport{base: transport}
+	}
+	if opts.Audit != nil {
+		transport = opts.Audit(transport)
+	}
+	// A negative count would never be reached, retrying forever.
+	transport = &retryTransport{base: transport, retries: max(opts.Retries, 0)}
+	transport = NewRateLimitTransport(transport, opts.RateLimits)
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}
+}
+
+// retryTransport retries requests that fail for reasons that might go away:
+// network errors, rate limits and server errors. Only requests that read
+// data are retried, since repeating one that creates a transfer or payment
+// could do it twice.
+type retryTransport struct {
+	base    http.RoundTripper
+	retries int
+}
+
+// retryableSuffixes are the endpoints that only read data.
+var retryableSuffixes = []string{"/get", "/list", "/sync", "/search", "/get_by_id"}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isRetryable(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		res, err := t.base.RoundTrip(req)
+		if attempt == t.retries || !shouldRetry(res, err) || req.Context().Err() != nil {
+			return res, err
+		}
+
+		wait := delay
+		if res != nil {
+			if after, convErr := strconv.Atoi(res.Header.Get("Retry-After")); convErr == nil && after > 0 {
+				wait = time.Duration(after) * time.Second
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		delay *= 2
+	}
+}
+
+func isRetryable(req *http.Request) bool {
+	if req.GetBody == nil && req.Body != nil {
+		return false
+	}
+	for _, suffix := range retryableSuffixes {
+		if strings.HasSuffix(req.URL.Path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+// loggingTransport logs each request for --verbose.
+type loggingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		log.Printf("%s %s failed after %s: %v", req.Method, req.URL.Path, elapsed, err)
+		return res, err
+	}
+
+	fields, err := readResponseFields(res)
+	log.Printf("%s %s %d (%s, request ID %s)", req.Method, req.URL.Path, res.StatusCode, elapsed, fields.RequestID)
+	return res, err
+}
+
+// responseFields are the parts of a Plaid response body common to every
+// endpoint.
+type responseFields struct {
+	RequestID string `json:"request_id"`
+	ErrorCode string `json:"error_code"`
+}
+
+// readResponseFields reads the request ID and error code from res, leaving
+// its body to be read again.
+func readResponseFields(res *http.Response) (responseFields, error) {
+	var fields responseFields
+	b, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	_ = json.Unmarshal(b, &fields)
+	return fields, err
+}
+
+// APIError is an error returned by the Plaid API, described with the details
+// Plaid gives rather than just the HTTP status.
+type APIError struct {
+	plaid.PlaidError
+	err error
+}
+
+func (e APIError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.ErrorCode, e.ErrorMessage)
+	if e.RequestId != nil && *e.RequestId != "" {
+		msg += fmt.Sprintf(" (request ID %s)", *e.RequestId)
+	}
+	return msg
+}
+
+func (e APIError) Unwrap() error {
+	return e.err
+}
+
+// NormalizeError turns an error from the Plaid API into an APIError. Other
+// errors, including ones that wrap an API error with more context, are
+// returned unchanged.
+func NormalizeError(err error) error {
+	if _, ok := err.(plaid.GenericOpenAPIError); !ok {
+		return err
+	}
+
+	pe, ok := AsPlaidError(err)
+	if !ok {
+		return err
+	}
+	return APIError{PlaidError: pe, err: err}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/cobra"
+)
+
+// ExtraColumn is an optional group of transaction fields that can be added
+// to CSV output as columns, and to JSON output as flat fields alongside
+// Plaid's nested objects.
+type ExtraColumn struct {
+	Headers []string
+	Fields  []string
+	// Values returns one value per header. nil values are written as empty
+	// CSV cells and JSON nulls.
+	Values func(tx plaid_cli.Transaction) []interface{}
+	// Types are the JSON Schema types of the values, for `plaid-cli transactions schema`.
+	Types []string
+	// Nullable is whether values can be nil.
+	Nullable bool
+}
+
+var extraColumns = map[string]ExtraColumn{
+	"counterparty": {
+		Headers:  []string{"Counterparty", "Counterparty Type"},
+		Fields:   []string{"counterparty_name", "counterparty_type"},
+		Types:    []string{"string", "string"},
+		Nullable: true,
+		Values: func(tx plaid_cli.Transaction) []interface{} {
+			counterparties := tx.Counterparties
+			if len(counterparties) == 0 {
+				return []interface{}{nil, nil}
+			}
+			// Plaid lists the most relevant counterparty first.
+			return []interface{}{counterparties[0].Name, string(counterparties[0].Type)}
+		},
+	},
+	"category": {
+		Headers:  []string{"Category", "Detailed Category"},
+		Fields:   []string{"category", "detailed_category"},
+		Types:    []string{"string", "string"},
+		Nullable: true,
+		Values: func(tx plaid_cli.Transaction) []interface{} {
+			pfc := tx.PersonalFinanceCategory
+			if pfc == nil {
+				return []interface{}{nil, nil}
+			}
+			return []interface{}{pfc.Primary, pfc.Detailed}
+		},
+	},
+	"original_description": {
+		Headers:  []string{"Original Description"},
+		Fields:   []string{"original_description"},
+		Types:    []string{"string"},
+		Nullable: true,
+		Values: func(tx plaid_cli.Transaction) []interface{} {
+			return []interface{}{nullableValue(tx.OriginalDescription)}
+		},
+	},
+	"payment_channel": {
+		Headers: []string{"Payment Channel"},
+		Fields:  []string{"payment_channel"},
+		Types:   []string{"string"},
+		Values: func(tx plaid_cli.Transaction) []interface{} {
+			return []interface{}{tx.PaymentChannel}
+		},
+	},
+	"check_number": {
+		Headers:  []string{"Check Number"},
+		Fields:   []string{"check_number"},
+		Types:    []string{"string"},
+		Nullable: true,
+		Values: func(tx plaid_cli.Transaction) []interface{} {
+			return []interface{}{nullableValue(tx.CheckNumber)}
+		},
+	},
+	"payment_meta": {
+		Headers:  []string{"Reference Number", "Payer", "Payee", "By Order Of"},
+		Fields:   []string{"payment_reference_number", "payment_payer", "payment_payee", "payment_by_order_of"},
+		Types:    []string{"string", "string", "string", "string"},
+		Nullable: true,
+		Values: func(tx plaid_cli.Transaction) []interface{} {
+			return []interface{}{
+				nullableValue(tx.PaymentMeta.ReferenceNumber),
+				nullableValue(tx.PaymentMeta.Payer),
+				nullableValue(tx.PaymentMeta.Payee),
+				nullableValue(tx.PaymentMeta.ByOrderOf),
+			}
+		},
+	},
+	"location": {
+		Headers:  []string{"City", "Region", "Latitude", "Longitude"},
+		Fields:   []string{"location_city", "location_region", "location_lat", "location_lon"},
+		Types:    []string{"string", "string", "number", "number"},
+		Nullable: true,
+		Values: func(tx plaid_cli.Transaction) []interface{} {
+			return []interface{}{
+				nullableValue(tx.Location.City),
+				nullableValue(tx.Location.Region),
+				nullableValue(tx.Location.Lat),
+				nullableValue(tx.Location.Lon),
+			}
+		},
+	},
+}
+
+// AddColumnsFlag registers --columns on commands that write transactions.
+func AddColumnsFlag(cmd *cobra.Command, columns *[]string) {
+	cmd.Flags().StringSliceVar(columns, "columns", nil, fmt.Sprintf("Extra transaction columns to include (%s)", strings.Join(extraColumnNames(), ", ")))
+}
+
+// ParseExtraColumns looks up the extra columns named with --columns.
+func ParseExtraColumns(names []string) ([]ExtraColumn, error) {
+	var columns []ExtraColumn
+	for _, name := range names {
+		column, ok := extraColumns[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q. Available columns: %s", name, strings.Join(extraColumnNames(), ", "))
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func extraColumnNames() []string {
+	var names []string
+	for name := range extraColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nullableValue returns the value a Nullable field points to, or nil if it
+// isn't set.
+func nullableValue[T any](v *T) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func formatCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return fmt.Sprintf("%f", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/cobra"
+)
+
+// largestIncreasesCount is how many of the biggest increases a comparison
+// flags.
+const largestIncreasesCount = 3
+
+// AddCompareFlag registers --compare on reports that can be compared with an
+// earlier window.
+func AddCompareFlag(cmd *cobra.Command, compare *string) {
+	cmd.Flags().StringVar(compare, "compare", "", "Compare totals with the previous period (previous-period) or the same period a year earlier (previous-year)")
+}
+
+// ComparisonWindow returns the window that from to to is compared with. A
+// calendar month is compared with the previous calendar month, or the same
+// month a year earlier; any other window with the one of the same length
+// just before it.
+func ComparisonWindow(compare string, from time.Time, to time.Time) (time.Time, time.Time, error) {
+	switch compare {
+	case "previous-period":
+		if from.Day() == 1 && to.Equal(from.AddDate(0, 1, -1)) {
+			return from.AddDate(0, -1, 0), from.AddDate(0, 0, -1), nil
+		}
+		return from.Add(-to.Sub(from)), from.AddDate(0, 0, -1), nil
+	case "previous-year":
+		return from.AddDate(-1, 0, 0), to.AddDate(-1, 0, 0), nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid comparison %q. Use previous-period or previous-year", compare)
+	}
+}
+
+// Change is how a total moved from the window it's compared with.
+type Change struct {
+	Previous plaid_cli.Money `json:"previous"`
+	Change   plaid_cli.Money `json:"change"`
+	// Percent is the change as a percentage of Previous, or nil if there
+	// was nothing before.
+	Percent *float64 `json:"percent"`
+	// LargestIncrease flags the totals that grew the most.
+	LargestIncrease bool `json:"largest_increase,omitempty"`
+}
+
+// CompareTotals returns how each total in current changed from previous,
+// flagging the largest increases.
+func CompareTotals(current map[string]plaid_cli.Money, previous map[string]plaid_cli.Money) map[string]*Change {
+	changes := make(map[string]*Change)
+	var keys []string
+	for key, total := range current {
+		change := &Change{Previous: previous[key], Change: total - previous[key]}
+		if change.Previous != 0 {
+			percent := change.Change.Float64() / change.Previous.Float64() * 100
+			change.Percent = &percent
+		}
+		changes[key] = change
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if changes[keys[i]].Change != changes[keys[j]].Change {
+			return changes[keys[i]].Change > changes[keys[j]].Change
+		}
+		return keys[i] < keys[j]
+	})
+	for i, key := range keys {
+		if i == largestIncreasesCount || changes[key].Change <= 0 {
+			break
+		}
+		changes[key].LargestIncrease = true
+	}
+	return changes
+}
+
+// CompareMerchantSpending records how each merchant's spending changed from
+// previous.
+func CompareMerchantSpending(spending []MerchantSpend, previous []MerchantSpend) {
+	key := func(s MerchantSpend) string { return s.Owner + "\x00" + s.Merchant }
+
+	current := make(map[string]plaid_cli.Money)
+	for _, s := range spending {
+		current[key(s)] = s.Total
+	}
+	before := make(map[string]plaid_cli.Money)
+	for _, s := range previous {
+		before[key(s)] = s.Total
+	}
+
+	changes := CompareTotals(current, before)
+	for i := range spending {
+		spending[i].Change = changes[key(spending[i])]
+	}
+}
+
+// CompareMonthlyReports records how spending in each of report's categories
+// changed from previous, a report on the window described by comparedTo.
+func CompareMonthlyReports(report *MonthlyReport, previous MonthlyReport, comparedTo string) {
+	current := make(map[string]plaid_cli.Money)
+	for _, c := range report.Categories {
+		current[c.Category] = c.Total
+	}
+	before := make(map[string]plaid_cli.Money)
+	for _, c := range previous.Categories {
+		before[c.Category] = c.Total
+	}
+
+	changes := CompareTotals(current, before)
+	for i := range report.Categories {
+		report.Categories[i].Change = changes[report.Categories[i].Category]
+	}
+	report.ComparedTo = comparedTo
+	report.PreviousSpending = &previous.Spending
+}
+
+// formatChange describes a change for tables, with a marker on the largest
+// increases.
+func formatChange(c *Change) string {
+	if c == nil {
+		return ""
+	}
+	s := fmt.Sprintf("%+.2f", c.Change)
+	if c.Percent != nil {
+		s += fmt.Sprintf(" (%+.0f%%)", *c.Percent)
+	} else if c.Change != 0 {
+		s += " (new)"
+	}
+	if c.LargestIncrease {
+		s += " ▲"
+	}
+	return s
+}
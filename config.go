@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plaid/plaid-go/v26/plaid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// configKind is the type of value a setting takes.
+type configKind int
+
+const (
+	configString configKind = iota
+	configBool
+	configInt
+	configDuration
+	// configList settings take an array, or a single string.
+	configList
+)
+
+// configSchema is every setting the config file can have. A * matches any
+// one part of a key, such as the target in push.<target>.token.
+var configSchema = map[string]configKind{
+	"cli.archive_missing_accounts": configBool,
+	"cli.audit":                    configBool,
+	"cli.audit_retention_days":     configInt,
+	"cli.history":                  configBool,
+	"cli.history_retention_days":   configInt,
+	"cli.auto_relink":              configBool,
+	"cli.consent_warning_days":     configInt,
+	"cli.data_dir":                 configString,
+	"cli.language":                 configString,
+	"cli.page_size":                configInt,
+	"cli.plain_output":             configBool,
+	"cli.read_only":                configBool,
+	"cli.request_timeout":          configDuration,
+	"cli.retries":                  configInt,
+	"cli.token_encryption":         configString,
+	"cli.token_key_file":           configString,
+	"cli.verbose":                  configBool,
+
+	"household.members.*": configString,
+	"household.name":      configString,
+
+	"import.mappings.*.amount":            configString,
+	"import.mappings.*.category":          configString,
+	"import.mappings.*.credit":            configString,
+	"import.mappings.*.currency":          configString,
+	"import.mappings.*.date":              configString,
+	"import.mappings.*.date_format":       configString,
+	"import.mappings.*.decimal_separator": configString,
+	"import.mappings.*.debit":             configString,
+	"import.mappings.*.description":       configString,
+	"import.mappings.*.merchant":          configString,
+	"import.mappings.*.negate":            configBool,
+
+	"link.port": configString,
+
+	"notify.ntfy.server":      configString,
+	"notify.ntfy.token":       configString,
+	"notify.ntfy.topic":       configString,
+	"notify.pushover.token":   configString,
+	"notify.pushover.user":    configString,
+	"notify.webhook.secret":   configString,
+	"notify.webhook.template": configString,
+	"notify.webhook.url":      configString,
+
+	"plaid.api_version":         configString,
+	"plaid.base_url":            configString,
+	"plaid.client_id":           configString,
+	"plaid.client_id_command":   configString,
+	"plaid.client_id_encrypted": configString,
+	"plaid.countries":           configList,
+	"plaid.environment":         configString,
+	"plaid.language":            configString,
+	"plaid.products":            configList,
+	"plaid.secret":              configString,
+	"plaid.secret_command":      configString,
+	"plaid.secret_encrypted":    configString,
+	"plaid.secret_key_file":     configString,
+
+	"push.*.accounts.*": configString,
+	"push.*.budget_id":  configString,
+	"push.*.token":      configString,
+	"push.*.url":        configString,
+
+	"rate_limit.*": configInt,
+
+	"report.exclude_categories": configList,
+
+	"retention.balances":     configString,
+	"retention.transactions": configString,
+
+	"savings_rate.income_categories": configList,
+	"savings_rate.income_matches":    configList,
+
+	"serve.token": configString,
+
+	"smtp.from":     configString,
+	"smtp.host":     configString,
+	"smtp.password": configString,
+	"smtp.port":     configString,
+	"smtp.username": configString,
+
+	"tunnel.domain": configString,
+
+	"webhooks.exec":   configString,
+	"webhooks.verify": configBool,
+}
+
+// configProblem is something wrong with one setting in the config file.
+type configProblem struct {
+	line int
+	msg  string
+}
+
+// ValidateConfig checks the config file viper read against configSchema,
+// so a typo or a value of the wrong type is reported with where it is in
+// the file, rather than being ignored or failing a Plaid request later.
+func ValidateConfig(path string) error {
+	if path == "" {
+		return nil
+	}
+	lines, err := configKeyLines(path)
+	if err != nil {
+		return err
+	}
+
+	var problems []configProblem
+	report := func(key string, format string, args ...interface{}) {
+		problems = append(problems, configProblem{line: configLine(lines, key), msg: fmt.Sprintf(format, args...)})
+	}
+
+	for _, key := range viper.AllKeys() {
+		if !viper.InConfig(key) {
+			continue
+		}
+		value := viper.Get(key)
+		kind, ok := configKindOf(key)
+		if !ok {
+			if _, isTable := value.(map[string]interface{}); isTable && configIsTable(key) {
+				continue
+			}
+			if suggestion := suggestConfigKey(key); suggestion != "" {
+				report(key, "unknown setting %s. Did you mean %s?", key, suggestion)
+			} else {
+				report(key, "unknown setting %s", key)
+			}
+			continue
+		}
+		if msg := checkConfigValue(kind, value); msg != "" {
+			report(key, "%s %s, not %s", key, msg, formatConfigValue(value))
+			continue
+		}
+		if msg := checkConfigSetting(key); msg != "" {
+			report(key, "%s", msg)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].line < problems[j].line })
+	var b strings.Builder
+	fmt.Fprintf(&b, "⚠️  Invalid config file %s:", path)
+	for _, problem := range problems {
+		if problem.line > 0 {
+			fmt.Fprintf(&b, "\n  line %d: %s", problem.line, problem.msg)
+		} else {
+			fmt.Fprintf(&b, "\n  %s", problem.msg)
+		}
+	}
+	return ConfigError{msg: b.String()}
+}
+
+// validatesConfig reports whether cmd needs a valid config file. Help, and
+// the commands that set up or fix the config file, work without one.
+func validatesConfig(cmd *cobra.Command) bool {
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		switch c.Name() {
+		case "help", "init", "config":
+			return false
+		}
+	}
+	return true
+}
+
+func configKindOf(key string) (configKind, bool) {
+	if kind, ok := configSchema[key]; ok {
+		return kind, true
+	}
+	for pattern, kind := range configSchema {
+		if configKeyMatches(pattern, key) {
+			return kind, true
+		}
+	}
+	return 0, false
+}
+
+func configKeyMatches(pattern string, key string) bool {
+	patternParts := strings.Split(pattern, ".")
+	keyParts := strings.Split(key, ".")
+	if len(patternParts) != len(keyParts) {
+		return false
+	}
+	for i, part := range patternParts {
+		if part != "*" && part != keyParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// configIsTable reports whether key is a table of settings, such as an
+// empty [push.ynab.accounts].
+func configIsTable(key string) bool {
+	keyParts := strings.Split(key, ".")
+	for pattern := range configSchema {
+		patternParts := strings.Split(pattern, ".")
+		if len(patternParts) > len(keyParts) && configKeyMatches(strings.Join(patternParts[:len(keyParts)], "."), key) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestConfigKey returns the setting key was most likely meant to be, if
+// any is close enough.
+func suggestConfigKey(key string) string {
+	keyParts := strings.Split(key, ".")
+	best := ""
+	bestDistance := 0
+	for pattern := range configSchema {
+		patternParts := strings.Split(pattern, ".")
+		if len(patternParts) != len(keyParts) {
+			continue
+		}
+		// Wildcards take the key's own name, so push.ynab.tokn suggests
+		// push.ynab.token.
+		candidate := make([]string, len(patternParts))
+		for i, part := range patternParts {
+			if part == "*" {
+				part = keyParts[i]
+			}
+			candidate[i] = part
+		}
+		suggestion := strings.Join(candidate, ".")
+		distance := editDistance(key, suggestion)
+		if best == "" || distance < bestDistance || (distance == bestDistance && suggestion < best) {
+			best = suggestion
+			bestDistance = distance
+		}
+	}
+	if best == "" || bestDistance > 3 || bestDistance > len(keyParts[len(keyParts)-1]) {
+		return ""
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// checkConfigValue returns what's wrong with value for a setting of kind,
+// if anything. Strings are accepted wherever viper can convert them, as
+// they are from environment variables.
+func checkConfigValue(kind configKind, value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "must be a value, not a table"
+	}
+
+	switch kind {
+	case configString:
+		if _, isList := value.([]interface{}); isList {
+			return "must be a single value"
+		}
+	case configBool:
+		switch v := value.(type) {
+		case bool:
+		case string:
+			if _, err := strconv.ParseBool(v); err != nil {
+				return "must be true or false"
+			}
+		default:
+			return "must be true or false"
+		}
+	case configInt:
+		switch v := value.(type) {
+		case int, int64:
+		case string:
+			if _, err := strconv.Atoi(v); err != nil {
+				return "must be a whole number"
+			}
+		default:
+			return "must be a whole number"
+		}
+	case configDuration:
+		// A bare number would be read as nanoseconds.
+		v, ok := value.(string)
+		if !ok {
+			return `must be a duration such as "2m" or "30s"`
+		}
+		if _, err := time.ParseDuration(v); err != nil {
+			return `must be a duration such as "2m" or "30s"`
+		}
+	case configList:
+		switch v := value.(type) {
+		case string:
+		case []interface{}:
+			for _, item := range v {
+				if _, ok := item.(string); !ok {
+					return "must be a list of strings"
+				}
+			}
+		default:
+			return "must be a list of strings"
+		}
+	}
+	return ""
+}
+
+// checkConfigSetting checks settings that only take certain values.
+func checkConfigSetting(key string) string {
+	switch key {
+	case "plaid.environment":
+		env := strings.ToLower(viper.GetString(key))
+		switch env {
+		case "sandbox", "production":
+		case "development":
+			return "plaid.environment is development, which Plaid has retired. Use sandbox for test data, or production"
+		default:
+			if suggestion := closestValue(env, []string{"sandbox", "production"}); suggestion != "" {
+				return fmt.Sprintf("unknown plaid.environment %q. Did you mean %s?", env, suggestion)
+			}
+			return fmt.Sprintf("unknown plaid.environment %q. Use sandbox or production", env)
+		}
+	case "plaid.api_version":
+		if err := CheckAPIVersion(viper.GetString(key)); err != nil {
+			return fmt.Sprintf("invalid plaid.api_version: %v", err)
+		}
+	case "plaid.base_url":
+		if err := CheckBaseURL(viper.GetString(key)); err != nil {
+			return fmt.Sprintf("invalid plaid.base_url: %v", err)
+		}
+	case "plaid.countries":
+		var codes []string
+		for _, c := range viper.GetStringSlice(key) {
+			code := strings.ToUpper(c)
+			if _, err := CheckPlaidCountry(code); err != nil {
+				return fmt.Sprintf("invalid country code in plaid.countries: %v", err)
+			}
+			codes = append(codes, code)
+		}
+		for _, p := range viper.GetStringSlice("plaid.products") {
+			if strings.ToLower(p) == string(plaid.PRODUCTS_PAYMENT_INITIATION) {
+				for _, code := range codes {
+					if code == "US" || code == "CA" {
+						return fmt.Sprintf("plaid.products includes payment_initiation, which isn't available in %s. Use it with UK and European countries only", code)
+					}
+				}
+			}
+		}
+	case "plaid.products":
+		for _, p := range viper.GetStringSlice(key) {
+			if !plaid.Products(strings.ToLower(p)).IsValid() {
+				return fmt.Sprintf("unknown product %q in plaid.products", p)
+			}
+		}
+	case "plaid.language":
+		lang := viper.GetString(key)
+		if _, err := CheckPlaidLanguage(lang); err != nil {
+			return fmt.Sprintf("invalid plaid.language: %v", err)
+		}
+	case "cli.language":
+		lang := viper.GetString(key)
+		if !IsValidCLILanguage(lang) {
+			return fmt.Sprintf("unknown cli.language %q. Use one of: %s", lang, strings.Join(cliLanguages, ", "))
+		}
+	case "cli.token_encryption":
+		switch viper.GetString(key) {
+		case "", "none", "dpapi":
+		default:
+			return fmt.Sprintf("unknown cli.token_encryption %q. Use none or dpapi", viper.GetString(key))
+		}
+	case "report.exclude_categories", "savings_rate.income_categories":
+		if err := CheckCategories(normalizeCategories(viper.GetStringSlice(key))); err != nil {
+			return fmt.Sprintf("invalid %s: %v", key, err)
+		}
+	case "cli.retries":
+		if viper.GetInt(key) < 0 {
+			return fmt.Sprintf("cli.retries is %d. Use 0 to never retry, or a positive number", viper.GetInt(key))
+		}
+	case "retention.balances", "retention.transactions":
+		if period := viper.GetString(key); period != "" {
+			if _, err := ParsePeriod(period, time.Now()); err != nil {
+				return fmt.Sprintf("invalid %s: %v", key, err)
+			}
+		}
+	case "plaid.secret_command", "plaid.client_id_command", "plaid.secret_encrypted", "plaid.client_id_encrypted":
+		setting := strings.TrimSuffix(strings.TrimSuffix(key, "_command"), "_encrypted")
+		if viper.InConfig(setting) {
+			return fmt.Sprintf("both %s and %s are set, so %s is ignored. Remove one of them", setting, key, key)
+		}
+	}
+	return ""
+}
+
+func closestValue(value string, values []string) string {
+	for _, v := range values {
+		if editDistance(value, v) <= 2 || strings.HasPrefix(v, value) && value != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func formatConfigValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(value)
+}
+
+var (
+	tomlTable = regexp.MustCompile(`^\s*\[\[?\s*([^\]]+?)\s*\]\]?\s*(#.*)?$`)
+	tomlKey   = regexp.MustCompile(`^\s*((?:[A-Za-z0-9_-]+|"[^"]*"|'[^']*')(?:\s*\.\s*(?:[A-Za-z0-9_-]+|"[^"]*"|'[^']*'))*)\s*=`)
+)
+
+// configKeyLines returns the line each key in the TOML file at path is
+// set on, by its full lowercased key as viper has it. Tables are included,
+// so inline tables' keys can be found by their parent's line.
+func configKeyLines(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := make(map[string]int)
+	table := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if m := tomlTable.FindStringSubmatch(line); m != nil {
+			table = tomlKeyName(m[1])
+			if _, ok := lines[table]; !ok {
+				lines[table] = n
+			}
+			continue
+		}
+		if m := tomlKey.FindStringSubmatch(line); m != nil {
+			key := tomlKeyName(m[1])
+			if table != "" {
+				key = table + "." + key
+			}
+			lines[key] = n
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// tomlKeyName turns a dotted TOML key, with any quoted parts, into viper's
+// form.
+func tomlKeyName(key string) string {
+	var parts []string
+	for _, part := range strings.Split(key, ".") {
+		part = strings.Trim(strings.TrimSpace(part), `"'`)
+		parts = append(parts, strings.ToLower(part))
+	}
+	return strings.Join(parts, ".")
+}
+
+// configLine returns the line key is set on, or the line of the nearest
+// table it's in, or 0 if it can't be found.
+func configLine(lines map[string]int, key string) int {
+	for {
+		if n, ok := lines[key]; ok {
+			return n
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return 0
+		}
+		key = key[:i]
+	}
+}
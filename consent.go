@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+func GetItem(client *plaid.PlaidApiService, token string) (plaid_cli.Item, error) {
+	req := plaid.NewItemGetRequest(token)
+	apiReq := client.ItemGet(context.Background())
+	apiReq = apiReq.ItemGetRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return plaid_cli.Item{}, err
+	}
+	return plaid_cli.ItemFromPlaidResponse(res), nil
+}
+
+// RecordConsentExpiration stores the consent expiration time reported for an
+// item, forgetting it if the institution no longer reports one.
+func RecordConsentExpiration(data *plaid_cli.Data, item plaid_cli.Item) error {
+	if item.ConsentExpirationTime != nil {
+		data.ConsentExpirations[item.ItemID] = *item.ConsentExpirationTime
+	} else {
+		delete(data.ConsentExpirations, item.ItemID)
+	}
+
+	return data.SaveConsentExpirations()
+}
+
+func RefreshConsentExpiration(data *plaid_cli.Data, client *plaid.PlaidApiService, itemID string) error {
+	token, err := ItemToken(data, itemID)
+	if err != nil {
+		return err
+	}
+
+	item, err := GetItem(client, token)
+	if err != nil {
+		return err
+	}
+
+	return RecordConsentExpiration(data, item)
+}
+
+// ExpiringConsents returns the items whose consent expires within the given
+// window of now, or has already expired, sorted by item ID.
+func ExpiringConsents(data *plaid_cli.Data, within time.Duration, now time.Time) []string {
+	var itemIDs []string
+	for itemID, expiration := range data.ConsentExpirations {
+		if expiration.Sub(now) <= within {
+			itemIDs = append(itemIDs, itemID)
+		}
+	}
+	sort.Strings(itemIDs)
+	return itemIDs
+}
+
+// ReconsentResult is what renewing consent did for an item.
+type ReconsentResult struct {
+	ItemID string
+	Err    error
+}
+
+// ReconsentItems renews consent for each item through Link's update mode,
+// one after another, and records its new consent expiration. A failure
+// doesn't stop the rest.
+func ReconsentItems(client *plaid.PlaidApiService, linker *plaid_cli.Linker, itemIDs []string, port string) []ReconsentResult {
+	var results []ReconsentResult
+	for _, itemID := range itemIDs {
+		name := ItemName(linker.Data, itemID)
+		if len(itemIDs) > 1 {
+			log.Printf("Renewing consent for %s...\n", name)
+		}
+		result := ReconsentResult{ItemID: itemID}
+		result.Err = linker.Relink(itemID, port)
+		if result.Err == nil {
+			result.Err = RefreshConsentExpiration(linker.Data, client, itemID)
+		}
+		results = append(results, result)
+
+		switch {
+		case errors.Is(result.Err, plaid_cli.ErrDryRun):
+		case result.Err != nil:
+			log.Printf("⚠️  Renewing consent for %s failed: %v\n", name, result.Err)
+		default:
+			if expiration, ok := linker.Data.ConsentExpirations[itemID]; ok {
+				log.Printf("Consent for %s renewed until %s.\n", name, expiration.Format("2006-01-02"))
+			} else {
+				log.Printf("Consent for %s renewed!\n", name)
+			}
+		}
+	}
+	return results
+}
+
+// ReconsentError summarizes failed renewals as an error, or nil if there
+// were none. Some failing makes it a PartialError.
+func ReconsentError(results []ReconsentResult) error {
+	var failed int
+	for _, r := range results {
+		if r.Err != nil && !errors.Is(r.Err, plaid_cli.ErrDryRun) {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return nil
+	case failed == len(results):
+		return fmt.Errorf("renewing consent failed for all %d institutions", failed)
+	default:
+		return PartialError{Err: fmt.Errorf("renewing consent failed for %d of %d institutions", failed, len(results))}
+	}
+}
+
+// ConsentMessage describes when an item's consent expires, or expired, and
+// how to renew it.
+func ConsentMessage(data *plaid_cli.Data, itemID string, now time.Time) string {
+	name := ItemName(data, itemID)
+	expiration := data.ConsentExpirations[itemID]
+	if expiration.Before(now) {
+		return fmt.Sprintf("Consent for %s expired on %s. Run 'plaid-cli item reconsent %s' to keep pulling data.", name, expiration.Format("2006-01-02"), name)
+	}
+	return fmt.Sprintf("Consent for %s expires on %s. Run 'plaid-cli item reconsent %s' to keep pulling data.", name, expiration.Format("2006-01-02"), name)
+}
+
+// WarnExpiringConsents logs a warning for every item whose consent expires
+// within the given window.
+func WarnExpiringConsents(data *plaid_cli.Data, within time.Duration) {
+	now := time.Now()
+	for _, itemID := range ExpiringConsents(data, within, now) {
+		log.Printf("⚠️  %s\n", ConsentMessage(data, itemID, now))
+	}
+}
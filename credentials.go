@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/viper"
+)
+
+// credentialSettings are the API credentials that can be read from the
+// output of a command, configured as <setting>_command, or stored encrypted
+// as <setting>_encrypted, e.g.
+//
+//	[plaid]
+//	secret_command = "op read op://Private/Plaid/secret"
+var credentialSettings = []string{"plaid.client_id", "plaid.secret"}
+
+// ResolveCredentials runs the configured credential commands and decrypts
+// encrypted credentials, so they never need to be stored in plaintext. A
+// credential set directly, such as with PLAID_SECRET, takes precedence over
+// both.
+func ResolveCredentials() error {
+	// Both credentials are usually encrypted with the same passphrase, so
+	// it's only asked for once.
+	var passphrase string
+	askPassphrase := func() (string, error) {
+		if passphrase != "" {
+			return passphrase, nil
+		}
+		p, err := promptPassphrase()
+		passphrase = p
+		return p, err
+	}
+
+	for _, key := range credentialSettings {
+		if viper.IsSet(key) {
+			continue
+		}
+
+		if command := viper.GetString(key + "_command"); command != "" {
+			value, err := runCredentialCommand(command)
+			if err != nil {
+				return ConfigError{msg: fmt.Sprintf("⚠️  Failed to read %s from `%s` (%s_command): %v", key, command, key, err)}
+			}
+			if value == "" {
+				return ConfigError{msg: fmt.Sprintf("⚠️  `%s` (%s_command) printed nothing", command, key)}
+			}
+			viper.Set(key, value)
+			continue
+		}
+
+		if encrypted := viper.GetString(key + "_encrypted"); encrypted != "" {
+			value, err := DecryptSecret(encrypted, viper.GetString("plaid.secret_key_file"), askPassphrase)
+			if err != nil {
+				return ConfigError{msg: fmt.Sprintf("⚠️  Failed to decrypt %s_encrypted: %v", key, err)}
+			}
+			viper.Set(key, value)
+		}
+	}
+	return nil
+}
+
+// EncryptSecret encrypts secret with age for the identity in keyFile, or
+// with passphrase if there's no key file, and returns it base64 encoded for
+// use as a config value.
+func EncryptSecret(secret string, keyFile string, passphrase string) (string, error) {
+	var recipient age.Recipient
+	if keyFile != "" {
+		identities, err := readIdentities(keyFile)
+		if err != nil {
+			return "", err
+		}
+		x25519, ok := identities[0].(*age.X25519Identity)
+		if !ok {
+			return "", fmt.Errorf("%s does not contain an age X25519 identity", keyFile)
+		}
+		recipient = x25519.Recipient()
+	} else {
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return "", err
+		}
+		recipient = r
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipient)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.WriteString(w, secret)
+	if err != nil {
+		return "", err
+	}
+	err = w.Close()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecryptSecret decrypts a value produced by EncryptSecret, using the
+// identity in keyFile, or asking for the passphrase if there's no key file.
+func DecryptSecret(encrypted string, keyFile string, passphrase func() (string, error)) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encrypted))
+	if err != nil {
+		return "", fmt.Errorf("not a value produced by `plaid-cli config encrypt-secret`: %w", err)
+	}
+
+	var identities []age.Identity
+	if keyFile != "" {
+		identities, err = readIdentities(keyFile)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		p, err := passphrase()
+		if err != nil {
+			return "", err
+		}
+		identity, err := age.NewScryptIdentity(p)
+		if err != nil {
+			return "", err
+		}
+		identities = []age.Identity{identity}
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), identities...)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// GenerateKeyFile writes a new age identity to path, readable only by the
+// user.
+func GenerateKeyFile(path string) error {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	contents := fmt.Sprintf("# created by plaid-cli\n# public key: %s\n%s\n", identity.Recipient(), identity)
+	return os.WriteFile(path, []byte(contents), 0600)
+}
+
+func readIdentities(keyFile string) ([]age.Identity, error) {
+	f, err := os.Open(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return age.ParseIdentities(f)
+}
+
+func promptPassphrase() (string, error) {
+	prompt := promptui.Prompt{
+		Label: T("Passphrase for the Plaid API credentials"),
+		Mask:  '*',
+	}
+	return prompt.Run()
+}
+
+// runCredentialCommand runs command with the shell and returns what it
+// printed, without the trailing newline. The command can prompt on the
+// terminal, which password managers often do to unlock.
+func runCredentialCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// Daemon periodically checks linked items and notifies the user about new
+// transactions and problems that need their attention.
+type Daemon struct {
+	Client    *ItemClient
+	ItemIDs   []string
+	Notifiers []Notifier
+	// ConsentWarning is how far ahead of a consent expiring to alert.
+	ConsentWarning time.Duration
+	// AlertInterval is how long to wait before repeating an alert that
+	// hasn't been resolved.
+	AlertInterval time.Duration
+
+	alerted map[string]time.Time
+	// consentsRefreshed is when consent deadlines were last fetched from
+	// Plaid.
+	consentsRefreshed time.Time
+}
+
+// consentRefreshInterval is how often the daemon fetches consent deadlines
+// from Plaid. They only change when consent is renewed, which may have
+// happened on another machine.
+const consentRefreshInterval = 24 * time.Hour
+
+// Run checks every interval until the process is stopped. Failed checks are
+// logged and retried at the next interval.
+func (d *Daemon) Run(interval time.Duration) {
+	for {
+		err := d.Check()
+		if err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Check looks for new transactions and alerts once, sending notifications
+// for anything found. An item's sync cursor only moves on once all of its
+// new transactions have been delivered, so a notifier that's down means they
+// are sent again at the next check rather than lost.
+func (d *Daemon) Check() error {
+	data := d.Client.Data
+
+	var checks []itemCheck
+	var errs []error
+	for _, itemID := range d.ItemIDs {
+		check, err := d.checkItem(itemID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		checks = append(checks, check)
+	}
+	if time.Since(d.consentsRefreshed) >= consentRefreshInterval {
+		errs = append(errs, d.refreshConsents()...)
+	}
+	checks = append(checks, itemCheck{Events: d.consentAlerts()})
+
+	sent, total := 0, 0
+	advanced := false
+	for _, check := range checks {
+		delivered := true
+		for _, event := range check.Events {
+			total++
+			log.Printf("%s: %s", event.Title, event.Message)
+			err := NotifyAll(d.Notifiers, event)
+			if err != nil {
+				errs = append(errs, err)
+				delivered = false
+				continue
+			}
+			sent++
+		}
+		if check.Advance && delivered {
+			data.DaemonCursors[check.ItemID] = check.Cursor
+			advanced = true
+		}
+	}
+
+	if advanced {
+		err := data.SaveDaemonCursors()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	log.Printf("Checked %d institutions: %d of %d events delivered.", len(d.ItemIDs), sent, total)
+	return errors.Join(errs...)
+}
+
+// itemCheck is what checking an item found: events to send, and the sync
+// cursor to move on to once they have been.
+type itemCheck struct {
+	ItemID  string
+	Events  []Event
+	Cursor  string
+	Advance bool
+}
+
+func (d *Daemon) checkItem(itemID string) (itemCheck, error) {
+	data := d.Client.Data
+	name := ItemName(data, itemID)
+	check := itemCheck{ItemID: itemID}
+
+	cursor, seen := data.DaemonCursors[itemID]
+
+	var result TransactionsSyncResult
+	err := d.Client.Do(itemID, func(token string) error {
+		var err error
+		result, err = SyncTransactions(d.Client.PlaidApiService, token, cursor)
+		return err
+	})
+	if NeedsRelink(err) {
+		problem := T(relinkErrorCodes[PlaidErrorCode(err)])
+		check.Events = d.alert(itemID+":relink", Event{
+			Kind:    AlertEvent,
+			Title:   fmt.Sprintf("%s needs attention", name),
+			Message: T("%s: %s. Run `plaid-cli item relink %s` to log in again", name, problem, name),
+			Item:    name,
+		})
+		return check, nil
+	}
+	if err != nil {
+		return check, fmt.Errorf("%s: %w", name, err)
+	}
+	delete(d.alerted, itemID+":relink")
+
+	check.Cursor = result.Cursor
+	check.Advance = true
+
+	// The first check returns the item's whole history, which isn't news.
+	if !seen {
+		log.Printf("Started watching %s for new transactions.", name)
+		return check, nil
+	}
+
+	for _, tx := range SortTransactions(FilterTransactions(ActiveIgnores(data, false), result.Added)) {
+		check.Events = append(check.Events, Event{
+			Kind:        NewTransactionEvent,
+			Title:       fmt.Sprintf("New transaction at %s", name),
+			Message:     describeTransaction(tx.Name, tx.Amount, plaid_cli.Value(tx.ISOCurrencyCode)),
+			Item:        name,
+			Time:        time.Now(),
+			Transaction: &tx,
+		})
+	}
+	return check, nil
+}
+
+// refreshConsents fetches the consent deadlines of the watched items, so
+// items whose institutions require consent to be renewed, such as PSD2 banks
+// every 90 days, are tracked even if they were linked before plaid-cli
+// recorded deadlines, and renewals made elsewhere are picked up.
+func (d *Daemon) refreshConsents() []error {
+	var errs []error
+	for _, itemID := range d.ItemIDs {
+		err := RefreshConsentExpiration(d.Client.Data, d.Client.PlaidApiService, itemID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to check consent: %w", ItemName(d.Client.Data, itemID), NormalizeError(err)))
+		}
+	}
+	d.consentsRefreshed = time.Now()
+	return errs
+}
+
+// consentAlerts alerts for items whose consent expires within the warning
+// window.
+func (d *Daemon) consentAlerts() []Event {
+	data := d.Client.Data
+
+	var events []Event
+	now := time.Now()
+	for _, itemID := range ExpiringConsents(data, d.ConsentWarning, now) {
+		name := ItemName(data, itemID)
+		events = append(events, d.alert(itemID+":consent", Event{
+			Kind:    AlertEvent,
+			Title:   fmt.Sprintf("Consent for %s is expiring", name),
+			Message: ConsentMessage(data, itemID, now),
+			Item:    name,
+		})...)
+	}
+	return events
+}
+
+// alert returns event unless the same alert was sent within AlertInterval.
+func (d *Daemon) alert(key string, event Event) []Event {
+	if d.alerted == nil {
+		d.alerted = make(map[string]time.Time)
+	}
+	if last, ok := d.alerted[key]; ok && time.Since(last) < d.AlertInterval {
+		return nil
+	}
+
+	d.alerted[key] = time.Now()
+	event.Time = time.Now()
+	return []Event{event}
+}
+
+// describeTransaction formats a transaction for a notification. Plaid
+// reports money leaving an account as a positive amount.
+func describeTransaction(name string, amount float64, currency string) string {
+	if currency == "" {
+		currency = "USD"
+	}
+	direction := "spent at"
+	if amount < 0 {
+		direction = "received from"
+	}
+	return fmt.Sprintf("%.2f %s %s %s", math.Abs(amount), currency, direction, name)
+}
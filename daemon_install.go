@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	systemdUnitName = "plaid-cli.service"
+	launchdLabel    = "com.landakram.plaid-cli"
+)
+
+// envFilePrefixes are the environment variables copied into the daemon's
+// environment file, so credentials set in the shell reach the service.
+var envFilePrefixes = []string{"PLAID_", "CLI_", "SMTP_", "NOTIFY_"}
+
+// DaemonService describes the user-level service that runs `plaid-cli
+// daemon`.
+type DaemonService struct {
+	Executable string
+	Args       []string
+	// EnvFile holds credentials from the environment, readable only by the
+	// user, so they never appear in the unit file or plist.
+	EnvFile string
+	LogFile string
+}
+
+var systemdUnitTemplate = template.Must(template.New("systemd").Parse(`[Unit]
+Description=plaid-cli daemon
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+EnvironmentFile=-{{ .EnvFile }}
+ExecStart={{ .Command }}
+Restart=on-failure
+RestartSec=60
+
+[Install]
+WantedBy=default.target
+`))
+
+var launchdPlistTemplate = template.Must(template.New("launchd").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{ .Label }}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>/bin/sh</string>
+		<string>-c</string>
+		<string>{{ .Command }}</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>StandardOutPath</key>
+	<string>{{ .LogFile }}</string>
+	<key>StandardErrorPath</key>
+	<string>{{ .LogFile }}</string>
+</dict>
+</plist>
+`))
+
+// InstallDaemon writes the environment file and a systemd user unit (Linux)
+// or launchd agent (macOS) for svc, and starts it unless start is false.
+func InstallDaemon(svc DaemonService, start bool) error {
+	path, err := servicePath()
+	if err != nil {
+		return err
+	}
+
+	err = writeEnvFile(svc.EnvFile, os.Environ())
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch runtime.GOOS {
+	case "linux":
+		err = systemdUnitTemplate.Execute(&buf, map[string]string{
+			"EnvFile": svc.EnvFile,
+			"Command": systemdCommand(svc.Executable, svc.Args),
+		})
+	case "darwin":
+		// launchd has no environment files, so a shell loads it first.
+		command := fmt.Sprintf("set -a; [ -f %[1]s ] && . %[1]s; exec %[2]s", shellQuote(svc.EnvFile), shellCommand(svc.Executable, svc.Args))
+		err = launchdPlistTemplate.Execute(&buf, map[string]string{
+			"Label":   launchdLabel,
+			"Command": xmlEscape(command),
+			"LogFile": xmlEscape(svc.LogFile),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, buf.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote %s.", path)
+
+	if !start {
+		return nil
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		err = runServiceCommand("systemctl", "--user", "daemon-reload")
+		if err == nil {
+			err = runServiceCommand("systemctl", "--user", "enable", "--now", systemdUnitName)
+		}
+	case "darwin":
+		err = runServiceCommand("launchctl", "load", "-w", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Println("Started the plaid-cli daemon.")
+	return nil
+}
+
+// UninstallDaemon stops the daemon and removes its service file and
+// environment file.
+func UninstallDaemon(envFile string) error {
+	path, err := servicePath()
+	if err != nil {
+		return err
+	}
+
+	// Stopping fails if the service was never started, which is fine.
+	switch runtime.GOOS {
+	case "linux":
+		_ = runServiceCommand("systemctl", "--user", "disable", "--now", systemdUnitName)
+	case "darwin":
+		_ = runServiceCommand("launchctl", "unload", "-w", path)
+	}
+
+	for _, p := range []string{path, envFile} {
+		err = os.Remove(p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err == nil {
+			log.Printf("Removed %s.", p)
+		}
+	}
+
+	if runtime.GOOS == "linux" {
+		return runServiceCommand("systemctl", "--user", "daemon-reload")
+	}
+	return nil
+}
+
+func servicePath() (string, error) {
+	home := homeDir()
+	switch runtime.GOOS {
+	case "linux":
+		configDir := os.Getenv("XDG_CONFIG_HOME")
+		if configDir == "" {
+			configDir = filepath.Join(home, ".config")
+		}
+		return filepath.Join(configDir, "systemd", "user", systemdUnitName), nil
+	case "darwin":
+		return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"), nil
+	default:
+		return "", fmt.Errorf("daemon install supports systemd (Linux) and launchd (macOS). On %s, run `plaid-cli daemon` with your own scheduler", runtime.GOOS)
+	}
+}
+
+// writeEnvFile writes the plaid-cli settings from environ to path in a
+// format both systemd and sh can read.
+func writeEnvFile(path string, environ []string) error {
+	var lines []string
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		if !hasAnyPrefix(key, envFilePrefixes) {
+			continue
+		}
+		if strings.ContainsAny(value, "\"\\$`\n") {
+			return fmt.Errorf("%s contains characters that can't be written safely to %s. Set it in plaid-cli's config file instead", key, path)
+		}
+		lines = append(lines, fmt.Sprintf("%s=\"%s\"\n", key, value))
+	}
+	sort.Strings(lines)
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, []byte(strings.Join(lines, "")), 0600)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Wrote %d settings from the environment to %s.", len(lines), path)
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// systemdCommand quotes each argument for an ExecStart line.
+func systemdCommand(executable string, args []string) string {
+	var quoted []string
+	for _, arg := range append([]string{executable}, args...) {
+		quoted = append(quoted, "\""+strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "%", "%%").Replace(arg)+"\"")
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellCommand(executable string, args []string) string {
+	var quoted []string
+	for _, arg := range append([]string{executable}, args...) {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func runServiceCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
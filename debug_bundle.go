@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// debugBundleFailures is how many of the most recent failed requests a debug
+// bundle lists.
+const debugBundleFailures = 20
+
+// redactedSettings are words that, found in a setting's name, mean its value
+// is a credential and is left out of debug bundles.
+var redactedSettings = []string{"secret", "client_id", "token", "password", "passphrase", "key"}
+
+// redactedKeys are settings whose names don't say so but whose values grant
+// access or identify the user: anyone with a webhook URL or ntfy topic can
+// post to it or read it, and hosts point to the user's own servers.
+var redactedKeys = []string{"notify.webhook.url", "notify.ntfy.topic", "notify.pushover.user", "push.*.url", "smtp.host", "smtp.username"}
+
+// RedactSettings returns settings, as from viper.AllSettings, with the values
+// of credentials replaced by "REDACTED". Paths to key files are kept, since
+// they're often what's misconfigured.
+func RedactSettings(settings map[string]interface{}) map[string]interface{} {
+	return redactSettings("", settings)
+}
+
+func redactSettings(prefix string, settings map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(settings))
+	for name, value := range settings {
+		redacted[name] = redactSetting(prefix+name, value)
+	}
+	return redacted
+}
+
+// redactSetting redacts the setting key, recursing into tables and lists,
+// such as a list of webhook targets.
+func redactSetting(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactSettings(key+".", v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = redactSetting(key, item)
+		}
+		return list
+	}
+	if value != "" && isCredentialSetting(key) {
+		return "REDACTED"
+	}
+	return value
+}
+
+func isCredentialSetting(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range redactedKeys {
+		if configKeyMatches(pattern, key) {
+			return true
+		}
+	}
+
+	parts := strings.Split(key, ".")
+	name := parts[len(parts)-1]
+	if strings.HasSuffix(name, "_file") || strings.HasSuffix(name, "_path") {
+		return false
+	}
+	for _, word := range redactedSettings {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// DebugBundleInfo describes the machine and build a debug bundle came from.
+type DebugBundleInfo struct {
+	VersionInfo
+	OS          string    `json:"os"`
+	Arch        string    `json:"arch"`
+	Environment string    `json:"environment"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WriteDebugBundle writes a zip file for attaching to a bug report to path:
+// plaid-cli's version, its configuration with credentials redacted, the
+// audit log entries since since, and the most recent failed requests with
+// their Plaid request IDs, which Plaid support can look up. Access tokens
+// are never in any of them.
+func WriteDebugBundle(path string, auditLog *AuditLog, since time.Time, now time.Time) error {
+	entries, err := auditLog.Read()
+	if err != nil {
+		return err
+	}
+	recent := AuditFilter{Since: since}.Filter(entries)
+
+	var failures []AuditEntry
+	for i := len(entries) - 1; i >= 0 && len(failures) < debugBundleFailures; i-- {
+		if entries[i].Outcome != "ok" {
+			failures = append(failures, entries[i])
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Time.Before(failures[j].Time) })
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"version.json", DebugBundleInfo{
+			VersionInfo: BuildVersionInfo(),
+			OS:          runtime.GOOS,
+			Arch:        runtime.GOARCH,
+			Environment: viper.GetString("plaid.environment"),
+			CreatedAt:   now,
+		}},
+		{"config.json", RedactSettings(viper.AllSettings())},
+		{"audit.json", nonNil(recent)},
+		{"failed_requests.json", nonNil(failures)},
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(f)
+	for _, file := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			f.Close()
+			return err
+		}
+		b, err := json.MarshalIndent(file.content, "", "  ")
+		if err != nil {
+			f.Close()
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func nonNil(entries []AuditEntry) []AuditEntry {
+	if entries == nil {
+		return []AuditEntry{}
+	}
+	return entries
+}
+
+// DefaultDebugBundlePath names a debug bundle after when it was made.
+func DefaultDebugBundlePath(now time.Time) string {
+	return fmt.Sprintf("plaid-cli-debug-%s.zip", now.Format("20060102-150405"))
+}
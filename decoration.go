@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Messages are decorated for someone reading them at a terminal: warnings
+// start with ⚠️ and are shown in yellow, and errors in red. Logs collected by
+// cron or the systemd journal are easier to read and search without, so
+// cli.plain_output drops the emoji and color, and --no-color or NO_COLOR
+// (https://no-color.org) the color. Color is only used when stderr is a
+// terminal.
+
+// warningPrefix starts warnings.
+const warningPrefix = "⚠️  "
+
+const (
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiReset  = "\x1b[0m"
+)
+
+// Decoration decides how messages logged to stderr are decorated.
+type Decoration struct {
+	// NoColor is set by --no-color.
+	NoColor bool
+}
+
+// decoration is how log output is decorated. It's shared by the whole
+// process, like the log package, so that Fatal can use it.
+var decoration = &Decoration{}
+
+// AddNoColorFlag registers --no-color on cmd and its subcommands.
+func AddNoColorFlag(cmd *cobra.Command, d *Decoration) {
+	cmd.PersistentFlags().BoolVar(&d.NoColor, "no-color", false, "Don't color messages. Setting NO_COLOR does the same, and cli.plain_output also drops emoji")
+}
+
+// Plain reports whether messages are written without emoji or color.
+func (d *Decoration) Plain() bool {
+	return viper.GetBool("cli.plain_output")
+}
+
+// Color reports whether messages are colored.
+func (d *Decoration) Color() bool {
+	return !d.NoColor && os.Getenv("NO_COLOR") == "" && !d.Plain() && stderrIsTerminal()
+}
+
+// Emoji returns s, or an empty string if output is plain, for decorating
+// text other than log messages, such as help.
+func (d *Decoration) Emoji(s string) string {
+	if d.Plain() {
+		return ""
+	}
+	return s
+}
+
+// Line decorates a line logged to stderr. Plain warnings start with
+// "Warning:" instead of ⚠️.
+func (d *Decoration) Line(line string) string {
+	warning := strings.HasPrefix(line, warningPrefix)
+	if d.Plain() {
+		if warning {
+			line = T("Warning") + ": " + strings.TrimPrefix(line, warningPrefix)
+		}
+		return strings.ReplaceAll(line, warningPrefix, "")
+	}
+	if warning && d.Color() {
+		return colored(ansiYellow, line)
+	}
+	return line
+}
+
+// Error decorates an error message logged before exiting. Plain errors
+// aren't labelled as warnings, even if they start with ⚠️.
+func (d *Decoration) Error(msg string) string {
+	if d.Plain() {
+		return strings.TrimPrefix(msg, warningPrefix)
+	}
+	if d.Color() {
+		return colored(ansiRed, msg)
+	}
+	return msg
+}
+
+// colored wraps line in an ANSI color, leaving a trailing newline outside it.
+func colored(color string, line string) string {
+	text, newline := strings.CutSuffix(line, "\n")
+	colored := color + text + ansiReset
+	if newline {
+		colored += "\n"
+	}
+	return colored
+}
+
+// decoratedWriter decorates each line written to it, as the log package
+// writes them, before passing it on to w.
+type decoratedWriter struct {
+	w          io.Writer
+	decoration *Decoration
+}
+
+// NewDecoratedWriter returns a writer for the log package that decorates
+// messages as d says.
+func NewDecoratedWriter(w io.Writer, d *Decoration) io.Writer {
+	return decoratedWriter{w: w, decoration: d}
+}
+
+func (w decoratedWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(w.w, w.decoration.Line(string(p)))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// stderrIsTerminal reports whether messages are going to a terminal rather
+// than a pipe, file or journal.
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// EmailOptions control whether a report is emailed.
+type EmailOptions struct {
+	To []string
+}
+
+// AddEmailFlags registers the flags that populate opts on cmd.
+func AddEmailFlags(cmd *cobra.Command, opts *EmailOptions) {
+	cmd.Flags().StringSliceVar(&opts.To, "email-to", nil, "Email the report to these addresses using the smtp settings in the config file")
+}
+
+// SMTPConfig is the mail server used to send reports, configured under
+// [smtp] in the config file or with SMTP_* environment variables.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPConfigFromViper reads the [smtp] settings. smtp.from defaults to
+// smtp.username.
+func SMTPConfigFromViper() (SMTPConfig, error) {
+	config := SMTPConfig{
+		Host:     viper.GetString("smtp.host"),
+		Port:     viper.GetString("smtp.port"),
+		Username: viper.GetString("smtp.username"),
+		Password: viper.GetString("smtp.password"),
+		From:     viper.GetString("smtp.from"),
+	}
+
+	if config.Host == "" {
+		return config, ConfigError{msg: "⚠️  smtp.host is not set. Configure [smtp] in plaid-cli's config file (or SMTP_HOST) to email reports."}
+	}
+	if config.From == "" {
+		config.From = config.Username
+	}
+	if config.From == "" {
+		return config, ConfigError{msg: "⚠️  smtp.from is not set. Configure [smtp] in plaid-cli's config file (or SMTP_FROM) to email reports."}
+	}
+
+	return config, nil
+}
+
+// DeliverReport writes a report to the configured output. If email
+// recipients are given, the report is emailed instead of being printed to
+// stdout, and is also written to --output-file if one is set.
+func DeliverReport(output OutputOptions, email EmailOptions, subject string, format string, write func(w io.Writer) error) error {
+	if len(email.To) == 0 {
+		return WriteOutput(output, write)
+	}
+
+	config, err := SMTPConfigFromViper()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = write(&buf)
+	if err != nil {
+		return err
+	}
+
+	if !output.toStdout() {
+		err = WriteOutput(output, func(w io.Writer) error {
+			_, err := w.Write(buf.Bytes())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	msg, err := newReportEmail(config.From, email.To, subject, format, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = SendEmail(config, email.To, msg)
+	if err != nil {
+		return fmt.Errorf("sending email: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Emailed %s to %s.\n", subject, strings.Join(email.To, ", "))
+	return nil
+}
+
+// newReportEmail builds a MIME message. HTML and table reports are sent as
+// the message body; other formats are attached as a file.
+func newReportEmail(from string, to []string, subject string, format string, report []byte) ([]byte, error) {
+	var msg bytes.Buffer
+	header := func(key string, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", key, value)
+	}
+
+	header("From", from)
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	switch format {
+	case "html":
+		header("Content-Type", `text/html; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "base64")
+		msg.WriteString("\r\n")
+		writeBase64(&msg, report)
+		return msg.Bytes(), nil
+	case "table":
+		header("Content-Type", `text/plain; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "base64")
+		msg.WriteString("\r\n")
+		writeBase64(&msg, report)
+		return msg.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	header("Content-Type", fmt.Sprintf(`multipart/mixed; boundary="%s"`, writer.Boundary()))
+	msg.WriteString("\r\n")
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {`text/plain; charset="utf-8"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintf(part, "%s is attached.\r\n", subject)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := fmt.Sprintf("%s.%s", strings.ReplaceAll(strings.ToLower(subject), " ", "-"), format)
+	part, err = writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.TypeByExtension("." + format)},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": filename})},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(part, report)
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// writeBase64 writes b base64-encoded in 76 character lines, as required for
+// email bodies.
+func writeBase64(w io.Writer, b []byte) {
+	encoded := base64.StdEncoding.EncodeToString(b)
+	for len(encoded) > 76 {
+		fmt.Fprintf(w, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(w, "%s\r\n", encoded)
+}
+
+// SendEmail delivers msg over SMTP. Port 465 uses implicit TLS; other ports
+// upgrade to TLS with STARTTLS when the server supports it.
+func SendEmail(config SMTPConfig, to []string, msg []byte) error {
+	addr := net.JoinHostPort(config.Host, config.Port)
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	// The From header may include a display name, but the envelope sender
+	// must be a bare address.
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return fmt.Errorf("invalid smtp.from: %w", err)
+	}
+
+	if config.Port != "465" {
+		return smtp.SendMail(addr, auth, from.Address, to, msg)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: config.Host})
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if auth != nil {
+		err = c.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+	for _, addr := range to {
+		err = c.Rcpt(addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	err = errors.Join(err, w.Close())
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+)
+
+// encryptWriter returns a writer that encrypts everything written to it for
+// recipient before passing it on to w. age recipients ("age1…" or an SSH
+// public key) are handled natively; anything else is treated as a GPG key ID,
+// fingerprint or email and handed to the gpg binary.
+func encryptWriter(w io.Writer, recipient string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasPrefix(recipient, "age1"):
+		r, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+		return age.Encrypt(w, r)
+	case strings.HasPrefix(recipient, "ssh-"):
+		r, err := agessh.ParseRecipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+		return age.Encrypt(w, r)
+	default:
+		return gpgEncrypt(w, recipient)
+	}
+}
+
+type gpgWriter struct {
+	stdin io.WriteCloser
+	cmd   *exec.Cmd
+}
+
+func gpgEncrypt(w io.Writer, recipient string) (*gpgWriter, error) {
+	cmd := exec.Command("gpg", "--batch", "--encrypt", "--recipient", recipient, "--output", "-")
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("encrypting to %q requires gpg to be installed: %w", recipient, err)
+		}
+		return nil, err
+	}
+
+	return &gpgWriter{stdin: stdin, cmd: cmd}, nil
+}
+
+func (g *gpgWriter) Write(p []byte) (int, error) {
+	return g.stdin.Write(p)
+}
+
+func (g *gpgWriter) Close() error {
+	err := g.stdin.Close()
+	err = errors.Join(err, g.cmd.Wait())
+	if err != nil {
+		return fmt.Errorf("gpg encryption failed: %w", err)
+	}
+	return nil
+}
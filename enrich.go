@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// enrichBatchSize is the maximum number of transactions /transactions/enrich
+// accepts in one request.
+const enrichBatchSize = 100
+
+// EnrichInput is a transaction read from a file to be enriched. It accepts
+// both plaid-cli's own exports and files with Plaid's enrich field names.
+type EnrichInput struct {
+	ID              string  `json:"id"`
+	TransactionID   string  `json:"transaction_id"`
+	Description     string  `json:"description"`
+	Name            string  `json:"name"`
+	Amount          float64 `json:"amount"`
+	Direction       string  `json:"direction"`
+	IsoCurrencyCode string  `json:"iso_currency_code"`
+	DatePosted      string  `json:"date_posted"`
+	Date            string  `json:"date"`
+	Mcc             string  `json:"mcc"`
+}
+
+// ReadEnrichInput reads transactions to enrich from path, or stdin if path is
+// "-". format is "csv" or "ndjson".
+func ReadEnrichInput(path string, format string) ([]EnrichInput, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	switch format {
+	case "csv":
+		return readEnrichCSV(r)
+	case "ndjson":
+		return readEnrichNDJSON(r)
+	default:
+		return nil, fmt.Errorf("invalid input format: %s", format)
+	}
+}
+
+func readEnrichCSV(r io.Reader) ([]EnrichInput, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		name = strings.ReplaceAll(name, " ", "_")
+		columns[name] = i
+	}
+
+	field := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+		}
+		return ""
+	}
+
+	if _, ok := columns["description"]; !ok {
+		if _, ok := columns["name"]; !ok {
+			return nil, fmt.Errorf("CSV input needs a description column")
+		}
+	}
+	if _, ok := columns["amount"]; !ok {
+		return nil, fmt.Errorf("CSV input needs an amount column")
+	}
+
+	var inputs []EnrichInput
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		amount, err := strconv.ParseFloat(field(record, "amount"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid amount: %w", line, err)
+		}
+
+		inputs = append(inputs, EnrichInput{
+			ID:              field(record, "id", "transaction_id"),
+			Description:     field(record, "description", "name"),
+			Amount:          amount,
+			Direction:       field(record, "direction"),
+			IsoCurrencyCode: field(record, "iso_currency_code", "currency"),
+			DatePosted:      field(record, "date_posted", "date"),
+			Mcc:             field(record, "mcc"),
+		})
+	}
+
+	return inputs, nil
+}
+
+func readEnrichNDJSON(r io.Reader) ([]EnrichInput, error) {
+	var inputs []EnrichInput
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var input EnrichInput
+		err := json.Unmarshal(scanner.Bytes(), &input)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if input.ID == "" {
+			input.ID = input.TransactionID
+		}
+		if input.Description == "" {
+			input.Description = input.Name
+		}
+		if input.DatePosted == "" {
+			input.DatePosted = input.Date
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	return inputs, scanner.Err()
+}
+
+// NewClientProvidedTransactions converts inputs to the transactions sent to
+// Plaid. Following Plaid's convention, positive amounts without an explicit
+// direction are treated as money leaving the account.
+func NewClientProvidedTransactions(inputs []EnrichInput, defaultCurrency string) ([]plaid.ClientProvidedTransaction, error) {
+	var txs []plaid.ClientProvidedTransaction
+	for i, input := range inputs {
+		if input.Description == "" {
+			return nil, fmt.Errorf("transaction %d has no description", i+1)
+		}
+
+		id := input.ID
+		if id == "" {
+			id = strconv.Itoa(i + 1)
+		}
+
+		var direction plaid.EnrichTransactionDirection
+		switch {
+		case input.Direction != "":
+			d, err := plaid.NewEnrichTransactionDirectionFromValue(strings.ToUpper(input.Direction))
+			if err != nil {
+				return nil, fmt.Errorf("transaction %s: %w", id, err)
+			}
+			direction = *d
+		case input.Amount < 0:
+			direction = plaid.ENRICHTRANSACTIONDIRECTION_INFLOW
+		default:
+			direction = plaid.ENRICHTRANSACTIONDIRECTION_OUTFLOW
+		}
+
+		currency := input.IsoCurrencyCode
+		if currency == "" {
+			currency = defaultCurrency
+		}
+
+		tx := plaid.NewClientProvidedTransaction(id, input.Description, math.Abs(input.Amount), direction, strings.ToUpper(currency))
+		if input.DatePosted != "" {
+			tx.SetDatePosted(input.DatePosted)
+		}
+		if input.Mcc != "" {
+			tx.SetMcc(input.Mcc)
+		}
+
+		txs = append(txs, *tx)
+	}
+
+	return txs, nil
+}
+
+// EnrichTransactions sends txs to /transactions/enrich in batches.
+func EnrichTransactions(client *plaid.PlaidApiService, accountType string, txs []plaid.ClientProvidedTransaction) ([]plaid.ClientProvidedEnrichedTransaction, error) {
+	var enriched []plaid.ClientProvidedEnrichedTransaction
+	for start := 0; start < len(txs); start += enrichBatchSize {
+		end := min(start+enrichBatchSize, len(txs))
+
+		req := plaid.NewTransactionsEnrichRequest(accountType, txs[start:end])
+		apiReq := client.TransactionsEnrich(context.Background())
+		apiReq = apiReq.TransactionsEnrichRequest(*req)
+		res, _, err := apiReq.Execute()
+		if err != nil {
+			return enriched, err
+		}
+
+		enriched = append(enriched, res.EnrichedTransactions...)
+	}
+
+	return enriched, nil
+}
+
+func WriteEnrichedTransactions(w io.Writer, txs []plaid.ClientProvidedEnrichedTransaction, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(txs)
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, tx := range txs {
+			err := encoder.Encode(tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write([]string{"ID", "Description", "Amount", "Direction", "Merchant", "Primary Category", "Detailed Category", "Confidence", "Website"})
+		if err != nil {
+			return err
+		}
+		for _, tx := range txs {
+			var primary, detailed, confidence string
+			if pfc, ok := tx.Enrichments.GetPersonalFinanceCategoryOk(); ok && pfc != nil {
+				primary = pfc.Primary
+				detailed = pfc.Detailed
+				confidence = pfc.GetConfidenceLevel()
+			}
+
+			err = writer.Write([]string{
+				tx.Id,
+				tx.Description,
+				plaid_cli.MoneyFromFloat(tx.Amount).String(),
+				string(tx.GetDirection()),
+				tx.Enrichments.GetMerchantName(),
+				primary,
+				detailed,
+				confidence,
+				tx.Enrichments.GetWebsite(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
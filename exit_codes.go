@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// Exit codes let scripts branch on the kind of failure without parsing
+// stderr.
+const (
+	ExitOK                = 0
+	ExitError             = 1
+	ExitConfig            = 2
+	ExitAuth              = 3
+	ExitItemLoginRequired = 4
+	ExitRateLimited       = 5
+	ExitPartialSuccess    = 6
+	ExitNetwork           = 7
+	ExitUsage             = 8
+	ExitAborted           = 9
+)
+
+// ConfigError is a problem with plaid-cli's configuration.
+type ConfigError struct {
+	msg string
+}
+
+func (e ConfigError) Error() string {
+	return e.msg
+}
+
+// UsageError is a command run with missing, invalid or conflicting arguments
+// or flags.
+type UsageError struct {
+	msg string
+}
+
+func (e UsageError) Error() string {
+	return e.msg
+}
+
+// AbortedError reports that the user declined to go ahead at a confirmation
+// prompt.
+type AbortedError struct{}
+
+func (e AbortedError) Error() string {
+	return T("Aborted.")
+}
+
+// PartialError reports that a command produced some, but not all, of its
+// output.
+type PartialError struct {
+	Err error
+}
+
+func (e PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PartialError) Unwrap() error {
+	return e.Err
+}
+
+var authErrorCodes = map[string]bool{
+	"INVALID_API_KEYS":         true,
+	"UNAUTHORIZED_ENVIRONMENT": true,
+	"INVALID_ACCESS_TOKEN":     true,
+	"INVALID_PUBLIC_TOKEN":     true,
+	"INVALID_PRODUCT":          true,
+}
+
+func ExitCodeFor(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var configErr ConfigError
+	if errors.As(err, &configErr) {
+		return ExitConfig
+	}
+
+	var usageErr UsageError
+	if errors.As(err, &usageErr) {
+		return ExitUsage
+	}
+
+	var abortedErr AbortedError
+	if errors.As(err, &abortedErr) {
+		return ExitAborted
+	}
+
+	var partialErr PartialError
+	if errors.As(err, &partialErr) {
+		return ExitPartialSuccess
+	}
+
+	pe, ok := AsPlaidError(err)
+	if ok {
+		switch {
+		case relinkErrorCodes[pe.ErrorCode] != "":
+			return ExitItemLoginRequired
+		case pe.ErrorType == plaid.PLAIDERRORTYPE_RATE_LIMIT_EXCEEDED:
+			return ExitRateLimited
+		case authErrorCodes[pe.ErrorCode]:
+			return ExitAuth
+		}
+		return ExitError
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) {
+		return ExitNetwork
+	}
+
+	return ExitError
+}
+
+// AsPlaidError finds the Plaid API error in err's chain, if there is one.
+func AsPlaidError(err error) (plaid.PlaidError, bool) {
+	var apiErr plaid.GenericOpenAPIError
+	if !errors.As(err, &apiErr) {
+		return plaid.PlaidError{}, false
+	}
+
+	pe, convertErr := plaid.ToPlaidError(apiErr)
+	if convertErr != nil {
+		return plaid.PlaidError{}, false
+	}
+
+	return pe, true
+}
+
+// atExit, if set, is called with the exit code before Fatal exits.
+var atExit func(code int)
+
+// Fatal logs err and exits with the exit code for its kind of failure.
+func Fatal(err error) {
+	log.Println(decoration.Error(NormalizeError(err).Error()))
+	code := ExitCodeFor(err)
+	if atExit != nil {
+		atExit(code)
+	}
+	os.Exit(code)
+}
+
+// FatalConfig logs a configuration problem and exits with ExitConfig.
+func FatalConfig(msg string) {
+	Fatal(ConfigError{msg: msg})
+}
+
+// FatalUsage logs a problem with a command's arguments or flags and exits with
+// ExitUsage.
+func FatalUsage(msg string) {
+	Fatal(UsageError{msg: msg})
+}
+
+// FatalAborted logs that the user declined to go ahead and exits with
+// ExitAborted.
+func FatalAborted() {
+	Fatal(AbortedError{})
+}
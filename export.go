@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// TransactionsSyncResult holds the changes returned by /transactions/sync
+// since a cursor.
+type TransactionsSyncResult struct {
+	Added    []plaid_cli.Transaction
+	Modified []plaid_cli.Transaction
+	Removed  []plaid.RemovedTransaction
+	Cursor   string
+}
+
+// SyncTransactions pages through /transactions/sync starting at cursor. An
+// empty cursor fetches the item's full history.
+func SyncTransactions(client *plaid.PlaidApiService, token string, cursor string) (TransactionsSyncResult, error) {
+	for restarts := 0; ; restarts++ {
+		result, err := syncTransactions(client, token, cursor)
+		// Plaid asks us to restart from the original cursor if the item
+		// changed while we were paging.
+		if PlaidErrorCode(err) != "TRANSACTIONS_SYNC_MUTATION_DURING_PAGINATION" {
+			return result, err
+		}
+
+		if restarts == maxPaginationRestarts {
+			return TransactionsSyncResult{}, fmt.Errorf("transactions kept changing at Plaid while they were being synced; run the command again once the institution has finished updating: %w", err)
+		}
+		log.Println("Transactions changed while syncing. Restarting...")
+	}
+}
+
+func syncTransactions(client *plaid.PlaidApiService, token string, cursor string) (TransactionsSyncResult, error) {
+	result := TransactionsSyncResult{Cursor: cursor}
+
+	for {
+		req := plaid.NewTransactionsSyncRequest(token)
+		if result.Cursor != "" {
+			req.SetCursor(result.Cursor)
+		}
+
+		apiReq := client.TransactionsSync(context.Background())
+		apiReq = apiReq.TransactionsSyncRequest(*req)
+		res, _, err := apiReq.Execute()
+		if err != nil {
+			return result, err
+		}
+
+		result.Added = append(result.Added, plaid_cli.TransactionsFromPlaid(res.Added)...)
+		result.Modified = append(result.Modified, plaid_cli.TransactionsFromPlaid(res.Modified)...)
+		result.Removed = append(result.Removed, res.Removed...)
+		result.Cursor = res.NextCursor
+
+		if !res.HasMore {
+			return result, nil
+		}
+	}
+}
+
+// ExportKey identifies an incremental export of an item to a destination.
+func ExportKey(itemID string, destination string) string {
+	return itemID + " " + destination
+}
+
+// IncrementalExport appends the transactions added to an item since the last
+// export to destination, and records the new cursor once they are safely on
+// disk. Ignored transactions are skipped. With typed, transactions are
+// written as typed CSV or NDJSON.
+func IncrementalExport(client *ItemClient, itemID string, token string, destination string, format string, typed bool, ignored plaid_cli.Ignored) error {
+	data := client.Data
+
+	if format != "csv" && format != "ndjson" {
+		return fmt.Errorf("incremental exports must be csv or ndjson, not %s", format)
+	}
+
+	destination, err := filepath.Abs(destination)
+	if err != nil {
+		return err
+	}
+
+	key := ExportKey(itemID, destination)
+	state, ok := data.Exports[key]
+	if ok {
+		_, err = os.Stat(destination)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s was exported to before but no longer exists. Run `plaid-cli export %s --incremental --reset -O %s` to export everything again", destination, ItemName(data, itemID), destination)
+		}
+	} else {
+		state = plaid_cli.ExportState{Item: itemID, Destination: destination}
+	}
+
+	result, err := SyncTransactions(client.PlaidApiService, token, state.Cursor)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Modified) > 0 || len(result.Removed) > 0 {
+		log.Printf("⚠️  %d transactions were modified and %d removed since the last export. Append-only exports only include new transactions.", len(result.Modified), len(result.Removed))
+	}
+
+	err = appendTransactions(destination, format, typed, ApplySplits(data.Splits, FilterTransactions(ignored, result.Added)))
+	if err != nil {
+		return err
+	}
+
+	state.Cursor = result.Cursor
+	if len(result.Added) > 0 {
+		added := SortTransactions(result.Added)
+		state.LastTransactionID = added[len(added)-1].TransactionID
+	}
+	state.UpdatedAt = time.Now()
+	data.Exports[key] = state
+
+	log.Printf("Appended %d transactions to %s.", len(result.Added), destination)
+	client.History.AddRows(len(result.Added))
+
+	return data.SaveExports()
+}
+
+// ResetExport forgets the state of an incremental export so the next run
+// starts from the beginning of the item's history.
+func ResetExport(data *plaid_cli.Data, itemID string, destination string) error {
+	destination, err := filepath.Abs(destination)
+	if err != nil {
+		return err
+	}
+
+	delete(data.Exports, ExportKey(itemID, destination))
+	return data.SaveExports()
+}
+
+func appendTransactions(path string, format string, typed bool, txs []plaid_cli.Transaction) (err error) {
+	var f *os.File
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var serializer TransactionSerializer
+	switch {
+	case format == "csv" && typed:
+		serializer = &TypedCSVSerializer{NoHeader: info.Size() > 0}
+	case format == "csv":
+		serializer = &CSVSerializer{NoHeader: info.Size() > 0}
+	case format == "ndjson" && typed:
+		serializer = &TypedNDJSONSerializer{}
+	case format == "ndjson":
+		serializer = &NDJSONSerializer{}
+	}
+
+	err = serializer.serialize(f, txs)
+	if err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
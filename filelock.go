@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// withFileLock runs f holding an exclusive lock on path's lock file, so
+// other plaid-cli processes appending to or rewriting path wait for it. The
+// lock is on a file of its own because path may be replaced while f runs.
+func withFileLock(path string, f func() error) error {
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	err = lockFile(lock)
+	if err != nil {
+		return err
+	}
+	err = f()
+	return errors.Join(err, unlockFile(lock))
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/fakeplaid"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// Output is compared with the golden files in testdata/golden. After a
+// deliberate change to an output format, rewrite them with
+//
+//	go test -run Golden -update
+//
+// and review the diff.
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, got, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run with -update to accept it)\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+// goldenNow is "now" for output that depends on the date.
+var goldenNow = time.Date(2024, 2, 10, 9, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// Tables show times in the local time zone.
+	time.Local = time.UTC
+	os.Exit(m.Run())
+}
+
+func fixtureTransactions() []plaid_cli.Transaction {
+	return plaid_cli.TransactionsFromPlaid(fakeplaid.FixtureItem().Transactions)
+}
+
+func fixtureAccounts() []ItemAccounts {
+	return []ItemAccounts{{
+		Item:     "fake",
+		Accounts: plaid_cli.AccountsFromPlaid(fakeplaid.FixtureItem().Accounts),
+	}}
+}
+
+func TestGoldenTransactionSerializers(t *testing.T) {
+	accountItems := map[string]string{"acc-checking": "fake", "acc-credit": "fake"}
+	accountLabels := AccountLabels(fixtureAccounts()[0].Accounts)
+	columns, err := ParseExtraColumns([]string{"category", "payment_channel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		annotate func(s TransactionSerializer)
+	}{
+		{"plain", func(s TransactionSerializer) {}},
+		{"annotated", func(s TransactionSerializer) {
+			s.annotateItems(accountItems)
+			s.annotateAccounts(accountLabels)
+			s.addColumns(columns)
+		}},
+	}
+	for _, c := range cases {
+		for _, format := range []string{"csv", "json", "ndjson"} {
+			t.Run(c.name+"."+format, func(t *testing.T) {
+				serializer, err := NewTransactionSerializer(format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.annotate(serializer)
+
+				var buf bytes.Buffer
+				err = serializer.serialize(&buf, fixtureTransactions())
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertGolden(t, filepath.Join("transactions", c.name+"."+format), buf.Bytes())
+			})
+		}
+	}
+}
+
+func TestGoldenWriters(t *testing.T) {
+	txs := fixtureTransactions()
+	items := fixtureAccounts()
+	month := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		formats []string
+		write   func(w io.Writer, format string) error
+	}{
+		{"accounts", []string{"json", "table"}, func(w io.Writer, format string) error {
+			return WriteAccounts(w, items, format)
+		}},
+		{"balances", []string{"json", "table"}, func(w io.Writer, format string) error {
+			return WriteBalances(w, items, format)
+		}},
+		{"daily_balances", []string{"csv", "json"}, func(w io.Writer, format string) error {
+			from := time.Date(2024, 1, 28, 0, 0, 0, 0, time.UTC)
+			to := time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)
+			return WriteDailyBalances(w, ReconstructBalances("fake", items[0].Accounts[0], txs, from, to), format)
+		}},
+		{"merchants", []string{"csv", "json", "table"}, func(w io.Writer, format string) error {
+			return WriteMerchantSpending(w, MerchantSpending(txs, nil), format, false)
+		}},
+		{"monthly", []string{"html", "json"}, func(w io.Writer, format string) error {
+			return WriteMonthlyReport(w, BuildMonthlyReport(month, items, txs, goldenNow), format)
+		}},
+		{"subscriptions", []string{"csv", "json", "table"}, func(w io.Writer, format string) error {
+			return WriteSubscriptions(w, DetectSubscriptions(txs, goldenNow), format, false)
+		}},
+		{"categories", []string{"json", "table"}, func(w io.Writer, format string) error {
+			categories, err := Categories()
+			if err != nil {
+				return err
+			}
+			categories, err = FilterCategories(categories, "FOOD_AND_DRINK")
+			if err != nil {
+				return err
+			}
+			return WriteCategories(w, categories, format)
+		}},
+		{"auth_check", []string{"json", "table"}, func(w io.Writer, format string) error {
+			return WriteAuthCheck(w, AuthCheck{
+				Environment: "sandbox",
+				Products: []ProductCheck{
+					{Product: "transactions", Enabled: true},
+					{Product: "assets", Enabled: false, Detail: "INVALID_PRODUCT"},
+				},
+			}, format)
+		}},
+		{"history", []string{"json", "table"}, func(w io.Writer, format string) error {
+			return WriteHistory(w, []HistoryEntry{
+				{Time: goldenNow, Environment: "sandbox", Command: "plaid-cli export", Items: []string{fakeplaid.ItemID}, Rows: 8, DurationMS: 1250},
+				{Time: goldenNow.Add(time.Minute), Command: "plaid-cli categories"},
+				{Time: goldenNow.Add(2 * time.Minute), Environment: "sandbox", Command: "plaid-cli transactions", DurationMS: 30, ExitCode: 4},
+			}, format)
+		}},
+		{"schema", []string{"csv", "json", "ndjson"}, func(w io.Writer, format string) error {
+			schema, err := TransactionSchema(format, SchemaOptions{})
+			if err != nil {
+				return err
+			}
+			return WriteSchema(w, schema)
+		}},
+		{"schema_annotated", []string{"csv", "json", "ndjson"}, func(w io.Writer, format string) error {
+			columns, err := ParseExtraColumns([]string{"location", "payment_channel"})
+			if err != nil {
+				return err
+			}
+			schema, err := TransactionSchema(format, SchemaOptions{Item: true, Account: true, Columns: columns})
+			if err != nil {
+				return err
+			}
+			return WriteSchema(w, schema)
+		}},
+		{"schema_typed", []string{"csv", "ndjson"}, func(w io.Writer, format string) error {
+			columns, err := ParseExtraColumns([]string{"location"})
+			if err != nil {
+				return err
+			}
+			schema, err := TransactionSchema(format, SchemaOptions{Account: true, Columns: columns, Typed: true})
+			if err != nil {
+				return err
+			}
+			return WriteSchema(w, schema)
+		}},
+		{"typed", []string{"csv", "ndjson"}, func(w io.Writer, format string) error {
+			serializer, err := NewTypedTransactionSerializer(format)
+			if err != nil {
+				return err
+			}
+			serializer.annotateAccounts(AccountLabels(items[0].Accounts))
+			columns, err := ParseExtraColumns([]string{"location", "category"})
+			if err != nil {
+				return err
+			}
+			serializer.addColumns(columns)
+			return serializer.serialize(w, txs)
+		}},
+		{"items", []string{"json", "table", "ids"}, func(w io.Writer, format string) error {
+			return WriteItems(w, []ItemInfo{{
+				Alias:       "fake",
+				Institution: "First Platypus Bank",
+				ItemID:      fakeplaid.ItemID,
+				Environment: "sandbox",
+				Products:    []string{"transactions"},
+				Health:      "ok",
+				LastSync:    &fakeplaid.Updated,
+			}}, format)
+		}},
+		{"items_oauth_migration", []string{"json"}, func(w io.Writer, format string) error {
+			deadline := fakeplaid.Updated.Add(oauthMigrationNotice)
+			return WriteItems(w, []ItemInfo{{
+				Alias:          "fake",
+				Institution:    "First Platypus Bank",
+				ItemID:         fakeplaid.ItemID,
+				Environment:    "sandbox",
+				Products:       []string{"transactions"},
+				Health:         "ok",
+				OAuthMigration: &OAuthMigration{OAuthInstitutionID: "ins_oauth", Deadline: &deadline},
+			}}, format)
+		}},
+	}
+	for _, c := range cases {
+		for _, format := range c.formats {
+			t.Run(c.name+"."+format, func(t *testing.T) {
+				var buf bytes.Buffer
+				err := c.write(&buf, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertGolden(t, filepath.Join("writers", c.name+"."+format), buf.Bytes())
+			})
+		}
+	}
+}
+
+// TestGoldenCommands runs plaid-cli against the fake Plaid API, with a data
+// directory holding the fake's item, aliased "fake".
+func TestGoldenCommands(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds plaid-cli")
+	}
+
+	dir := t.TempDir()
+	bin := buildPlaidCLI(t, dir)
+
+	server := httptest.NewServer(fakeplaid.New())
+	defer server.Close()
+
+	dataDir := filepath.Join(dir, "data")
+	saveGoldenItems(t, dataDir, map[string]string{"fake": fakeplaid.ItemID}, map[string]string{fakeplaid.ItemID: fakeplaid.AccessToken})
+	env := goldenEnv(server.URL, dataDir)
+
+	cases := []struct {
+		name string
+		args []string
+	}{
+		{"accounts.json", []string{"accounts", "fake"}},
+		{"accounts.table", []string{"accounts", "--all"}},
+		{"balances.table", []string{"balances"}},
+		{"balances.json", []string{"balances", "-o", "json"}},
+		{"reconstruct.csv", []string{"balances", "reconstruct", "--from", "2024-01-28", "--to", "2024-02-02"}},
+		{"transactions.json", []string{"transactions", "fake", "--from", "2024-01-01", "--to", "2024-01-31"}},
+		{"transactions.csv", []string{"transactions", "fake", "--from", "2024-01-01", "--to", "2024-01-31", "-o", "csv"}},
+		{"transactions.ndjson", []string{"transactions", "fake", "--from", "2024-01-01", "--to", "2024-01-15", "-o", "ndjson", "--page-size", "2"}},
+		{"transactions.typed.csv", []string{"transactions", "fake", "--from", "2024-01-01", "--to", "2024-01-31", "-o", "csv", "--typed"}},
+		{"items.json", []string{"item", "list", "-o", "json"}},
+		{"items.flat.json", []string{"items", "--json"}},
+		{"items.ids", []string{"item", "list", "--filter", "status=ok", "-o", "ids"}},
+		{"relink.table", []string{"item", "relink", "--all-broken"}},
+		{"webhooks_set.table", []string{"webhooks", "set", "--all", "https://example.com/plaid-webhook"}},
+		{"tokens.json", []string{"item", "tokens"}},
+		{"categories.table", []string{"transactions", "categories", "--primary", "INCOME"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cmd := exec.Command(bin, c.args...)
+			cmd.Dir = dir
+			cmd.Env = env
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+			if err != nil {
+				t.Fatalf("plaid-cli %s: %v\n%s", strings.Join(c.args, " "), err, stderr.String())
+			}
+			assertGolden(t, filepath.Join("commands", c.name), stdout.Bytes())
+		})
+	}
+}
+
+// TestGoldenRelinkSessions relinks two broken items in one run, standing in
+// for the browser at each item's Link page.
+func TestGoldenRelinkSessions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds plaid-cli")
+	}
+
+	dir := t.TempDir()
+	bin := buildPlaidCLI(t, dir)
+
+	fake := fakeplaid.New()
+	second := fakeplaid.FixtureItem()
+	second.Item.ItemId = "item-second"
+	fake.Items["access-sandbox-second"] = second
+	tokens := map[string]string{"fake": fakeplaid.AccessToken, "second": "access-sandbox-second"}
+	for _, token := range tokens {
+		fake.ResetLogin(token)
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dataDir := filepath.Join(dir, "data")
+	saveGoldenItems(t, dataDir,
+		map[string]string{"fake": fakeplaid.ItemID, "second": "item-second"},
+		map[string]string{fakeplaid.ItemID: fakeplaid.AccessToken, "item-second": "access-sandbox-second"})
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, "item", "relink", "--all-broken")
+	cmd.Dir = dir
+	// With nothing on the PATH, opening a browser fails, and the test
+	// visits the page instead.
+	cmd.Env = append(goldenEnv(server.URL, dataDir), "PATH="+dir, fmt.Sprintf("LINK_PORT=%d", port))
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	relinking := regexp.MustCompile(`Relinking (\w+)\.\.\.`)
+	visit := regexp.MustCompile(`please visit (\S+) to continue`)
+	var output strings.Builder
+	item := ""
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		output.WriteString(line + "\n")
+		if m := relinking.FindStringSubmatch(line); m != nil {
+			item = m[1]
+		}
+		if m := visit.FindStringSubmatch(line); m != nil {
+			err = finishRelink(m[1], func() { fake.FinishUpdate(tokens[item]) })
+			if err != nil {
+				t.Fatalf("relinking %s: %v\n%s", item, err, output.String())
+			}
+		}
+	}
+	err = cmd.Wait()
+	if err != nil {
+		t.Fatalf("plaid-cli item relink --all-broken: %v\n%s", err, output.String())
+	}
+	assertGolden(t, filepath.Join("commands", "relink_sessions.table"), stdout.Bytes())
+}
+
+// finishRelink does what the browser does at the relink page at pageURL:
+// loads it, logs in again with finish, and tells plaid-cli Link is done.
+func finishRelink(pageURL string, finish func()) error {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	browser := &http.Client{Jar: jar}
+
+	res, err := browser.Get(pageURL)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", pageURL, res.Status)
+	}
+
+	finish()
+
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return err
+	}
+	done := &url.URL{Scheme: page.Scheme, Host: page.Host, Path: page.Path}
+	res, err = browser.PostForm(done.String(), url.Values{"error": {""}})
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST %s: %s", done, res.Status)
+	}
+	return nil
+}
+
+// buildPlaidCLI builds plaid-cli into dir, returning its path.
+func buildPlaidCLI(t *testing.T, dir string) string {
+	t.Helper()
+	bin := filepath.Join(dir, "plaid-cli")
+	build := exec.Command("go", "build", "-o", bin, ".")
+	build.Stderr = os.Stderr
+	err := build.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+// saveGoldenItems saves the sandbox items in dataDir, with their aliases
+// and access tokens.
+func saveGoldenItems(t *testing.T, dataDir string, aliases map[string]string, tokens map[string]string) {
+	t.Helper()
+	data, err := plaid_cli.LoadData(dataDir, "sandbox", goldenTokenKeyFile(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for itemID, token := range tokens {
+		data.Tokens[itemID] = token
+	}
+	for alias, itemID := range aliases {
+		data.Aliases[alias] = itemID
+		data.BackAliases[itemID] = alias
+	}
+	err = data.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// goldenEnv is the environment plaid-cli runs in for golden tests, talking
+// to the fake at serverURL and keeping its data in dataDir.
+// goldenTokenKeyFile is where the key tokens in dataDir are signed with is
+// kept, next to it rather than in the user's config directory.
+func goldenTokenKeyFile(dataDir string) string {
+	return filepath.Join(filepath.Dir(dataDir), "tokens.key")
+}
+
+func goldenEnv(serverURL string, dataDir string) []string {
+	var env []string
+	for _, v := range os.Environ() {
+		if !strings.HasPrefix(v, "PLAID_") && !strings.HasPrefix(v, "CLI_") {
+			env = append(env, v)
+		}
+	}
+	return append(env,
+		"PLAID_BASE_URL="+serverURL,
+		"PLAID_CLIENT_ID=client",
+		"PLAID_SECRET=secret",
+		"PLAID_ENVIRONMENT=sandbox",
+		"PLAID_COUNTRIES=US",
+		"PLAID_LANGUAGE=en",
+		"CLI_LANGUAGE=en",
+		"CLI_DATA_DIR="+dataDir,
+		"CLI_TOKEN_KEY_FILE="+goldenTokenKeyFile(dataDir),
+		"TZ=UTC",
+	)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// HistoryEntry records one run of a command. Only what was run is recorded,
+// never what was fetched, and the history never leaves this machine.
+type HistoryEntry struct {
+	Time        time.Time `json:"time"`
+	Environment string    `json:"environment,omitempty"`
+	Command     string    `json:"command"`
+	// Items are the IDs of the items the command used.
+	Items []string `json:"items,omitempty"`
+	// Rows is how many transactions, accounts or other records the command
+	// output, exported, imported or pushed.
+	Rows       int   `json:"rows"`
+	DurationMS int64 `json:"duration_ms"`
+	ExitCode   int   `json:"exit_code"`
+}
+
+// History is the local history of commands run, one JSON entry per line.
+// The command being run is recorded with Start and added once it finishes.
+type History struct {
+	Path string
+	mu   sync.Mutex
+	run  *HistoryEntry
+}
+
+// Start begins recording a run of command.
+func (h *History) Start(command string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.run = &HistoryEntry{Time: time.Now().UTC(), Command: command}
+}
+
+// SetEnvironment records the Plaid environment the command is using.
+func (h *History) SetEnvironment(environment string) {
+	h.update(func(run *HistoryEntry) {
+		run.Environment = environment
+	})
+}
+
+// UseItem records that the command used itemID.
+func (h *History) UseItem(itemID string) {
+	h.update(func(run *HistoryEntry) {
+		if !slices.Contains(run.Items, itemID) {
+			run.Items = append(run.Items, itemID)
+		}
+	})
+}
+
+// AddRows adds n to the records the command has output.
+func (h *History) AddRows(n int) {
+	h.update(func(run *HistoryEntry) {
+		run.Rows += n
+	})
+}
+
+func (h *History) update(f func(run *HistoryEntry)) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.run != nil {
+		f(h.run)
+	}
+}
+
+// Finish appends the command being recorded, if any, to the history.
+func (h *History) Finish(exitCode int) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.run == nil {
+		return nil
+	}
+	run := *h.run
+	h.run = nil
+
+	run.ExitCode = exitCode
+	run.DurationMS = time.Since(run.Time).Milliseconds()
+	b, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	return withFileLock(h.Path, func() error {
+		f, err := os.OpenFile(h.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(b, '\n'))
+		return errors.Join(err, f.Close())
+	})
+}
+
+// Read returns the entries in the history, oldest first. Lines that aren't
+// entries, such as one cut short by a full disk, are skipped with a warning
+// rather than hiding the rest of the history.
+func (h *History) Read() ([]HistoryEntry, error) {
+	entries, damaged, err := h.read()
+	if damaged > 0 {
+		log.Printf("⚠️  Skipped %d damaged lines in %s.\n", damaged, h.Path)
+	}
+	return entries, err
+}
+
+// read returns the entries in the history, and how many lines weren't
+// entries.
+func (h *History) read() ([]HistoryEntry, int, error) {
+	f, err := os.Open(h.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	damaged := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			damaged++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, damaged, scanner.Err()
+}
+
+// Prune removes entries older than retention, and any damaged lines. The
+// history is only rewritten when there's something to remove, and other
+// plaid-cli processes can't add to it while it is.
+func (h *History) Prune(retention time.Duration) error {
+	if retention <= 0 {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return withFileLock(h.Path, func() error {
+		entries, damaged, err := h.read()
+		if err != nil {
+			return err
+		}
+
+		cutoff := time.Now().Add(-retention)
+		var buf bytes.Buffer
+		expired := 0
+		for _, entry := range entries {
+			if entry.Time.Before(cutoff) {
+				expired++
+				continue
+			}
+			b, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			buf.Write(append(b, '\n'))
+		}
+		if expired == 0 && damaged == 0 {
+			return nil
+		}
+		if damaged > 0 {
+			log.Printf("⚠️  Removed %d damaged lines from %s.\n", damaged, h.Path)
+		}
+
+		tmp := h.Path + ".tmp"
+		err = os.WriteFile(tmp, buf.Bytes(), 0600)
+		if err != nil {
+			return err
+		}
+		return os.Rename(tmp, h.Path)
+	})
+}
+
+// HistoryFilter selects history entries to show.
+type HistoryFilter struct {
+	Since time.Time
+	// Command, if set, matches commands it's part of, so "export" matches
+	// "plaid-cli export".
+	Command string
+	// Items, if set, are the item IDs to show.
+	Items []string
+}
+
+func (f HistoryFilter) Filter(entries []HistoryEntry) []HistoryEntry {
+	var filtered []HistoryEntry
+	for _, entry := range entries {
+		if entry.Time.Before(f.Since) {
+			continue
+		}
+		if f.Command != "" && !strings.Contains(entry.Command, f.Command) {
+			continue
+		}
+		if len(f.Items) > 0 && !slices.ContainsFunc(entry.Items, func(item string) bool {
+			return slices.Contains(f.Items, item)
+		}) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
+
+func WriteHistory(w io.Writer, entries []HistoryEntry, format string) error {
+	switch format {
+	case "json":
+		if entries == nil {
+			entries = []HistoryEntry{}
+		}
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "TIME\tENVIRONMENT\tCOMMAND\tITEMS\tROWS\tDURATION\tEXIT")
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			duration := (time.Duration(e.DurationMS) * time.Millisecond).Round(100 * time.Millisecond)
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%d\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Environment, e.Command, strings.Join(e.Items, ","), e.Rows, duration, e.ExitCode)
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
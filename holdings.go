@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// HoldingPosition is a single security held in an investment account.
+type HoldingPosition struct {
+	Item       string   `json:"item"`
+	Account    string   `json:"account"`
+	Security   string   `json:"security"`
+	Ticker     string   `json:"ticker,omitempty"`
+	Quantity   float64  `json:"quantity"`
+	Price      float64  `json:"price"`
+	Value      float64  `json:"value"`
+	CostBasis  *float64 `json:"cost_basis"`
+	Gain       *float64 `json:"gain"`
+	GainPct    *float64 `json:"gain_pct"`
+	Allocation float64  `json:"allocation_pct"`
+}
+
+// HoldingsTotal sums the value and performance of a group of positions. Gains
+// only include positions with a known cost basis.
+type HoldingsTotal struct {
+	Item       string          `json:"item,omitempty"`
+	Account    string          `json:"account,omitempty"`
+	Value      plaid_cli.Money `json:"value"`
+	CostBasis  plaid_cli.Money `json:"cost_basis"`
+	Gain       plaid_cli.Money `json:"gain"`
+	GainPct    float64         `json:"gain_pct"`
+	Allocation float64         `json:"allocation_pct"`
+}
+
+type HoldingsReport struct {
+	Positions []HoldingPosition `json:"positions"`
+	Accounts  []HoldingsTotal   `json:"accounts"`
+	Total     HoldingsTotal     `json:"total"`
+}
+
+func GetHoldings(client *plaid.PlaidApiService, token string) (*plaid.InvestmentsHoldingsGetResponse, error) {
+	req := plaid.NewInvestmentsHoldingsGetRequest(token)
+	apiReq := client.InvestmentsHoldingsGet(context.Background())
+	apiReq = apiReq.InvestmentsHoldingsGetRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// HoldingPositions flattens a holdings response into positions labelled with
+// item and account names.
+func HoldingPositions(itemName string, res *plaid.InvestmentsHoldingsGetResponse) []HoldingPosition {
+	accounts := make(map[string]string, len(res.Accounts))
+	for _, account := range res.Accounts {
+		accounts[account.AccountId] = account.Name
+	}
+
+	securities := make(map[string]plaid.Security, len(res.Securities))
+	for _, security := range res.Securities {
+		securities[security.SecurityId] = security
+	}
+
+	var positions []HoldingPosition
+	for _, holding := range res.Holdings {
+		security := securities[holding.SecurityId]
+		name := security.GetName()
+		if name == "" {
+			name = holding.SecurityId
+		}
+
+		position := HoldingPosition{
+			Item:     itemName,
+			Account:  accounts[holding.AccountId],
+			Security: name,
+			Ticker:   security.GetTickerSymbol(),
+			Quantity: holding.Quantity,
+			Price:    holding.InstitutionPrice,
+			Value:    holding.InstitutionValue,
+		}
+
+		if costBasis := holding.CostBasis.Get(); costBasis != nil {
+			gain := (plaid_cli.MoneyFromFloat(holding.InstitutionValue) - plaid_cli.MoneyFromFloat(*costBasis)).Float64()
+			position.CostBasis = costBasis
+			position.Gain = &gain
+			if *costBasis != 0 {
+				pct := gain / *costBasis * 100
+				position.GainPct = &pct
+			}
+		}
+
+		positions = append(positions, position)
+	}
+
+	return positions
+}
+
+// NewHoldingsReport totals positions per account and overall, and works out
+// each position's and account's share of the total value.
+func NewHoldingsReport(positions []HoldingPosition) HoldingsReport {
+	report := HoldingsReport{}
+
+	for _, p := range positions {
+		report.Total.Value += plaid_cli.MoneyFromFloat(p.Value)
+	}
+
+	byAccount := make(map[string]*HoldingsTotal)
+	var accountKeys []string
+	for _, p := range positions {
+		if report.Total.Value != 0 {
+			p.Allocation = p.Value / report.Total.Value.Float64() * 100
+		}
+		report.Positions = append(report.Positions, p)
+
+		key := p.Item + "\x00" + p.Account
+		total, ok := byAccount[key]
+		if !ok {
+			total = &HoldingsTotal{Item: p.Item, Account: p.Account}
+			byAccount[key] = total
+			accountKeys = append(accountKeys, key)
+		}
+
+		total.Value += plaid_cli.MoneyFromFloat(p.Value)
+		total.Allocation += p.Allocation
+		if p.CostBasis != nil {
+			costBasis := plaid_cli.MoneyFromFloat(*p.CostBasis)
+			gain := plaid_cli.MoneyFromFloat(*p.Gain)
+			total.CostBasis += costBasis
+			total.Gain += gain
+			report.Total.CostBasis += costBasis
+			report.Total.Gain += gain
+		}
+	}
+
+	for _, key := range accountKeys {
+		total := byAccount[key]
+		if total.CostBasis != 0 {
+			total.GainPct = total.Gain.Float64() / total.CostBasis.Float64() * 100
+		}
+		report.Accounts = append(report.Accounts, *total)
+	}
+
+	if report.Total.CostBasis != 0 {
+		report.Total.GainPct = report.Total.Gain.Float64() / report.Total.CostBasis.Float64() * 100
+	}
+	if report.Total.Value != 0 {
+		report.Total.Allocation = 100
+	}
+
+	sort.Slice(report.Positions, func(i, j int) bool {
+		return report.Positions[i].Value > report.Positions[j].Value
+	})
+	sort.Slice(report.Accounts, func(i, j int) bool {
+		return report.Accounts[i].Value > report.Accounts[j].Value
+	})
+
+	return report
+}
+
+func WriteHoldingsReport(w io.Writer, report HoldingsReport, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "csv":
+		return writeHoldingsCSV(w, report)
+	case "table":
+		return writeHoldingsTable(w, report)
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+func formatOptionalAmount(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", *v)
+}
+
+// writeHoldingsCSV writes positions followed by per-account and overall
+// totals, distinguished by the Row column so they can be filtered in a
+// spreadsheet.
+func writeHoldingsCSV(w io.Writer, report HoldingsReport) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"Row", "Item", "Account", "Security", "Ticker", "Quantity", "Price", "Value", "Cost Basis", "Gain", "Gain %", "Allocation %"})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range report.Positions {
+		err = writer.Write([]string{
+			"position",
+			p.Item,
+			p.Account,
+			p.Security,
+			p.Ticker,
+			fmt.Sprintf("%g", p.Quantity),
+			fmt.Sprintf("%.2f", p.Price),
+			fmt.Sprintf("%.2f", p.Value),
+			formatOptionalAmount(p.CostBasis),
+			formatOptionalAmount(p.Gain),
+			formatOptionalAmount(p.GainPct),
+			fmt.Sprintf("%.2f", p.Allocation),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	totals := append(report.Accounts, report.Total)
+	for i, t := range totals {
+		row := "account"
+		if i == len(totals)-1 {
+			row = "total"
+		}
+		err = writer.Write([]string{
+			row,
+			t.Item,
+			t.Account,
+			"",
+			"",
+			"",
+			"",
+			fmt.Sprintf("%.2f", t.Value),
+			fmt.Sprintf("%.2f", t.CostBasis),
+			fmt.Sprintf("%.2f", t.Gain),
+			fmt.Sprintf("%.2f", t.GainPct),
+			fmt.Sprintf("%.2f", t.Allocation),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeHoldingsTable(w io.Writer, report HoldingsReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "ITEM\tACCOUNT\tSECURITY\tTICKER\tQUANTITY\tVALUE\tCOST BASIS\tGAIN\tGAIN %\tALLOCATION %")
+	if err != nil {
+		return err
+	}
+
+	for _, p := range report.Positions {
+		_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%g\t%.2f\t%s\t%s\t%s\t%.2f\n",
+			p.Item,
+			p.Account,
+			p.Security,
+			p.Ticker,
+			p.Quantity,
+			p.Value,
+			formatOptionalAmount(p.CostBasis),
+			formatOptionalAmount(p.Gain),
+			formatOptionalAmount(p.GainPct),
+			p.Allocation,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w)
+	if err != nil {
+		return err
+	}
+
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, err = fmt.Fprintln(tw, "ITEM\tACCOUNT\tVALUE\tCOST BASIS\tGAIN\tGAIN %\tALLOCATION %")
+	if err != nil {
+		return err
+	}
+
+	for _, t := range append(report.Accounts, report.Total) {
+		item := t.Item
+		if item == "" {
+			item = "TOTAL"
+		}
+		_, err = fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n", item, t.Account, t.Value, t.CostBasis, t.Gain, t.GainPct, t.Allocation)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
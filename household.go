@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// HouseholdMember is someone whose linked items are included in household
+// reports: the user, or someone whose data dir they can read, such as a
+// partner's synced through a file share.
+type HouseholdMember struct {
+	Name    string
+	Client  *ItemClient
+	ItemIDs []string
+	// Imported includes the member's imported transactions, which belong
+	// to no item.
+	Imported bool
+}
+
+// HouseholdOptions choose whose items a command covers.
+type HouseholdOptions struct {
+	// Household includes every household member's items.
+	Household bool
+	// Owner only includes items belonging to this owner.
+	Owner string
+}
+
+// AddHouseholdFlags registers --household and --owner on commands that can
+// combine several people's items.
+func AddHouseholdFlags(cmd *cobra.Command, opts *HouseholdOptions) {
+	cmd.Flags().BoolVar(&opts.Household, "household", false, "Include every household member's institutions, labelled with their owner")
+	cmd.Flags().StringVar(&opts.Owner, "owner", "", "Only include institutions belonging to this owner (see 'plaid-cli item set-owner')")
+}
+
+// HouseholdMembers returns the user with itemIDs, and their imported
+// transactions if all their items were selected. With opts.Household set,
+// the user is named by household.name and followed by each member under
+// [household.members] with all of their items. Members' data is only read,
+// and their items are never relinked, since only they can log in to their
+// institutions. Their items are fetched with the user's Plaid credentials,
+// since access tokens only work with the client that created them, so the
+// household must share one Plaid client. With
+// opts.Owner set, only items belonging to that owner are kept, and no
+// imported transactions.
+func HouseholdMembers(client *plaid.PlaidApiService, self *ItemClient, itemIDs []string, all bool, opts HouseholdOptions) ([]HouseholdMember, error) {
+	members := []HouseholdMember{{
+		Client:   self,
+		ItemIDs:  itemIDs,
+		Imported: all,
+	}}
+	if !opts.Household {
+		return filterOwner(members, opts.Owner), nil
+	}
+	members[0].Name = viper.GetString("household.name")
+
+	dirs := viper.GetStringMapString("household.members")
+	var names []string
+	for name := range dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == members[0].Name {
+			return nil, ConfigError{msg: fmt.Sprintf("⚠️  Household member %q has the same name as you (household.name). Choose another name for one of you.", name)}
+		}
+		dir := dirs[name]
+		data, err := plaid_cli.LoadDataReadOnly(dir, self.Data.Environment)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s's data from %s: %w", name, dir, err)
+		}
+
+		memberClient := NewItemClient(client, data, nil)
+		memberClient.History = self.History
+		members = append(members, HouseholdMember{
+			Name:     name,
+			Client:   memberClient,
+			ItemIDs:  SortedItemIDs(data),
+			Imported: true,
+		})
+	}
+	return filterOwner(members, opts.Owner), nil
+}
+
+// Owner returns who one of the member's items belongs to: the owner it's
+// tagged with, otherwise the member.
+func (m HouseholdMember) Owner(itemID string) string {
+	if owner := ItemOwner(m.Client.Data, itemID); owner != "" {
+		return owner
+	}
+	return m.Name
+}
+
+func filterOwner(members []HouseholdMember, owner string) []HouseholdMember {
+	if owner == "" {
+		return members
+	}
+	for i, member := range members {
+		members[i].Imported = false
+		members[i].ItemIDs = keep(member.ItemIDs, func(itemID string) bool {
+			return strings.EqualFold(member.Owner(itemID), owner)
+		})
+	}
+	return members
+}
+
+// HouseholdTransactions fetches the transactions between from and to for
+// every member's items, and their imported transactions, leaving out what
+// each member has ignored unless includeIgnored is set. It also returns who
+// owns each account.
+func HouseholdTransactions(members []HouseholdMember, from time.Time, to time.Time, includeIgnored bool, partial *PartialResults) ([]plaid_cli.Transaction, map[string]string, error) {
+	var transactions []plaid_cli.Transaction
+	owners := make(map[string]string)
+	for _, member := range members {
+		for _, itemID := range member.ItemIDs {
+			txs, err := ReportTransactions(member.Client, []string{itemID}, from, to, partial)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, tx := range txs {
+				owners[tx.AccountID] = member.Owner(itemID)
+			}
+			transactions = append(transactions, FilterTransactions(ActiveIgnores(member.Client.Data, includeIgnored), txs)...)
+		}
+		if member.Imported {
+			txs := ImportedTransactions(member.Client.Data, from, to)
+			for _, tx := range txs {
+				owners[tx.AccountID] = member.Name
+			}
+			transactions = append(transactions, FilterTransactions(ActiveIgnores(member.Client.Data, includeIgnored), txs)...)
+		}
+	}
+	return transactions, owners, nil
+}
+
+// HouseholdSplits combines every member's split transactions.
+func HouseholdSplits(members []HouseholdMember) map[string][]plaid_cli.SplitPart {
+	splits := make(map[string][]plaid_cli.SplitPart)
+	for _, member := range members {
+		for id, parts := range member.Client.Data.Splits {
+			splits[id] = parts
+		}
+	}
+	return splits
+}
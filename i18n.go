@@ -0,0 +1,409 @@
+package main
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// cliLanguages are the languages plaid-cli's own messages are available in.
+// They match the languages Plaid Link supports, so plaid.language and
+// cli.language can usually be left to the same detected locale.
+var cliLanguages = []string{"en", "fr", "es", "nl"}
+
+func IsValidCLILanguage(lang string) bool {
+	return sliceToMap(cliLanguages)[lang]
+}
+
+// translations maps each English message to its translations. Messages are
+// looked up by their English text, so anything missing here is printed in
+// English.
+var translations = map[string]map[string]string{
+	// Prompts and errors
+	"⚠️  PLAID_CLIENT_ID not set. Please see the configuration instructions below.": {
+		"fr": "⚠️  PLAID_CLIENT_ID n'est pas défini. Consultez les instructions de configuration ci-dessous.",
+		"es": "⚠️  PLAID_CLIENT_ID no está configurado. Consulte las instrucciones de configuración a continuación.",
+		"nl": "⚠️  PLAID_CLIENT_ID is niet ingesteld. Zie de configuratie-instructies hieronder.",
+	},
+	"⚠️  PLAID_SECRET not set. Please see the configuration instructions below.": {
+		"fr": "⚠️  PLAID_SECRET n'est pas défini. Consultez les instructions de configuration ci-dessous.",
+		"es": "⚠️  PLAID_SECRET no está configurado. Consulte las instrucciones de configuración a continuación.",
+		"nl": "⚠️  PLAID_SECRET is niet ingesteld. Zie de configuratie-instructies hieronder.",
+	},
+	"Passphrase for the Plaid API credentials": {
+		"fr": "Phrase secrète des identifiants de l'API Plaid",
+		"es": "Frase de contraseña de las credenciales de la API de Plaid",
+		"nl": "Wachtwoordzin voor de Plaid API-gegevens",
+	},
+	"Aborted.": {
+		"fr": "Annulé.",
+		"es": "Cancelado.",
+		"nl": "Afgebroken.",
+	},
+	"No items on stdin, nothing to do.": {
+		"fr": "Aucun élément sur l'entrée standard, rien à faire.",
+		"es": "No hay elementos en la entrada estándar, no hay nada que hacer.",
+		"nl": "Geen items op stdin, niets te doen.",
+	},
+	"login expired": {
+		"fr": "la connexion a expiré",
+		"es": "el inicio de sesión ha caducado",
+		"nl": "de aanmelding is verlopen",
+	},
+	"account is locked after too many failed login attempts": {
+		"fr": "le compte est verrouillé après trop de tentatives de connexion échouées",
+		"es": "la cuenta está bloqueada tras demasiados intentos de inicio de sesión fallidos",
+		"nl": "het account is geblokkeerd na te veel mislukte aanmeldpogingen",
+	},
+	"username changed": {
+		"fr": "le nom d'utilisateur a changé",
+		"es": "el nombre de usuario ha cambiado",
+		"nl": "de gebruikersnaam is gewijzigd",
+	},
+	"%s: %s. Open a browser to log in again": {
+		"fr": "%s : %s. Ouvrir un navigateur pour vous reconnecter",
+		"es": "%s: %s. Abrir un navegador para volver a iniciar sesión",
+		"nl": "%s: %s. Een browser openen om opnieuw aan te melden",
+	},
+	"%s: %s. Run `plaid-cli item relink %s` to log in again": {
+		"fr": "%s : %s. Lancez `plaid-cli item relink %s` pour vous reconnecter",
+		"es": "%s: %s. Ejecute `plaid-cli item relink %s` para volver a iniciar sesión",
+		"nl": "%s: %s. Voer `plaid-cli item relink %s` uit om opnieuw aan te melden",
+	},
+	"%s: %s and relinking was declined": {
+		"fr": "%s : %s et la reconnexion a été refusée",
+		"es": "%s: %s y se rechazó volver a vincular",
+		"nl": "%s: %s en opnieuw koppelen is geweigerd",
+	},
+	"relinking %s failed": {
+		"fr": "la reconnexion de %s a échoué",
+		"es": "no se pudo volver a vincular %s",
+		"nl": "opnieuw koppelen van %s is mislukt",
+	},
+	"Relinking %s...": {
+		"fr": "Reconnexion de %s...",
+		"es": "Volviendo a vincular %s...",
+		"nl": "%s opnieuw koppelen...",
+	},
+	"Re-running action...": {
+		"fr": "Nouvelle exécution de l'action...",
+		"es": "Volviendo a ejecutar la acción...",
+		"nl": "Actie wordt opnieuw uitgevoerd...",
+	},
+	"%s: %s even after relinking. Run `plaid-cli item relink %s` to try again": {
+		"fr": "%s : %s même après la reconnexion. Lancez `plaid-cli item relink %s` pour réessayer",
+		"es": "%s: %s incluso después de volver a vincular. Ejecute `plaid-cli item relink %s` para intentarlo de nuevo",
+		"nl": "%s: %s zelfs na opnieuw koppelen. Voer `plaid-cli item relink %s` uit om het opnieuw te proberen",
+	},
+	"Authorize a %s of %s via %s for account %s": {
+		"fr": "Autoriser un %s de %s via %s pour le compte %s",
+		"es": "Autorizar un %s de %s mediante %s para la cuenta %s",
+		"nl": "Een %s van %s via %s autoriseren voor rekening %s",
+	},
+	"Create transfer for authorization %s": {
+		"fr": "Créer le virement pour l'autorisation %s",
+		"es": "Crear la transferencia para la autorización %s",
+		"nl": "Overboeking aanmaken voor autorisatie %s",
+	},
+	"Cancel transfer %s": {
+		"fr": "Annuler le virement %s",
+		"es": "Cancelar la transferencia %s",
+		"nl": "Overboeking %s annuleren",
+	},
+	"Pay %s %s to recipient %s": {
+		"fr": "Payer %s %s au bénéficiaire %s",
+		"es": "Pagar %s %s al beneficiario %s",
+		"nl": "%s %s betalen aan ontvanger %s",
+	},
+	"Run '%s' against production": {
+		"fr": "Exécuter '%s' en production",
+		"es": "Ejecutar '%s' en producción",
+		"nl": "'%s' uitvoeren in productie",
+	},
+	"Show %s in full": {
+		"fr": "Afficher les %s en entier",
+		"es": "Mostrar los %s completos",
+		"nl": "De %s volledig tonen",
+	},
+	"access tokens": {
+		"fr": "jetons d'accès",
+		"es": "tokens de acceso",
+		"nl": "toegangstokens",
+	},
+
+	// Help text
+	"Link bank accounts and get transactions from the command line.": {
+		"fr": "Liez des comptes bancaires et récupérez les transactions depuis la ligne de commande.",
+		"es": "Vincule cuentas bancarias y obtenga transacciones desde la línea de comandos.",
+		"nl": "Koppel bankrekeningen en haal transacties op vanaf de opdrachtregel.",
+	},
+	"Link an institution so plaid-cli can pull transactions": {
+		"fr": "Lier un établissement pour que plaid-cli puisse récupérer les transactions",
+		"es": "Vincular una institución para que plaid-cli pueda obtener transacciones",
+		"nl": "Een instelling koppelen zodat plaid-cli transacties kan ophalen",
+	},
+	"List access tokens": {
+		"fr": "Lister les jetons d'accès",
+		"es": "Listar los tokens de acceso",
+		"nl": "Toegangstokens weergeven",
+	},
+	"Give a linked institution a friendly name": {
+		"fr": "Donner un nom convivial à un établissement lié",
+		"es": "Dar un nombre descriptivo a una institución vinculada",
+		"nl": "Een gekoppelde instelling een herkenbare naam geven",
+	},
+	"List aliases": {
+		"fr": "Lister les alias",
+		"es": "Listar los alias",
+		"nl": "Aliassen weergeven",
+	},
+	"Exclude transactions or accounts from reports and exports": {
+		"fr": "Exclure des transactions ou des comptes des rapports et des exports",
+		"es": "Excluir transacciones o cuentas de los informes y exportaciones",
+		"nl": "Transacties of rekeningen uitsluiten van rapporten en exports",
+	},
+	"Split a transaction into categorized parts": {
+		"fr": "Diviser une transaction en parties catégorisées",
+		"es": "Dividir una transacción en partes categorizadas",
+		"nl": "Een transactie opsplitsen in gecategoriseerde delen",
+	},
+	"List accounts for a given institution, or for all institutions": {
+		"fr": "Lister les comptes d'un établissement, ou de tous les établissements",
+		"es": "Listar las cuentas de una institución, o de todas las instituciones",
+		"nl": "Rekeningen van een instelling, of van alle instellingen, weergeven",
+	},
+	"Get real-time balances for a given institution, or for all institutions": {
+		"fr": "Obtenir les soldes en temps réel d'un établissement, ou de tous les établissements",
+		"es": "Obtener los saldos en tiempo real de una institución, o de todas las instituciones",
+		"nl": "Actuele saldi van een instelling, of van alle instellingen, ophalen",
+	},
+	"List transactions for a given institution": {
+		"fr": "Lister les transactions d'un établissement",
+		"es": "Listar las transacciones de una institución",
+		"nl": "Transacties van een instelling weergeven",
+	},
+	"Export an institution's full transaction history": {
+		"fr": "Exporter l'historique complet des transactions d'un établissement",
+		"es": "Exportar el historial completo de transacciones de una institución",
+		"nl": "De volledige transactiegeschiedenis van een instelling exporteren",
+	},
+	"Get information about an institution": {
+		"fr": "Obtenir des informations sur un établissement",
+		"es": "Obtener información sobre una institución",
+		"nl": "Informatie over een instelling ophalen",
+	},
+	"Create and download asset reports": {
+		"fr": "Créer et télécharger des rapports d'actifs",
+		"es": "Crear y descargar informes de activos",
+		"nl": "Vermogensrapporten maken en downloaden",
+	},
+	"Verify income using Plaid Bank Income": {
+		"fr": "Vérifier les revenus avec Plaid Bank Income",
+		"es": "Verificar ingresos con Plaid Bank Income",
+		"nl": "Inkomen verifiëren met Plaid Bank Income",
+	},
+	"Move money using Plaid Transfer": {
+		"fr": "Transférer de l'argent avec Plaid Transfer",
+		"es": "Mover dinero con Plaid Transfer",
+		"nl": "Geld overmaken met Plaid Transfer",
+	},
+	"Initiate payments using Plaid Payment Initiation (UK and Europe)": {
+		"fr": "Initier des paiements avec Plaid Payment Initiation (Royaume-Uni et Europe)",
+		"es": "Iniciar pagos con Plaid Payment Initiation (Reino Unido y Europa)",
+		"nl": "Betalingen starten met Plaid Payment Initiation (VK en Europa)",
+	},
+	"Renew consent for an institution": {
+		"fr": "Renouveler le consentement pour un établissement",
+		"es": "Renovar el consentimiento de una institución",
+		"nl": "Toestemming voor een instelling vernieuwen",
+	},
+	"Run operations on many institutions from a CSV file": {
+		"fr": "Exécuter des opérations sur plusieurs établissements à partir d'un fichier CSV",
+		"es": "Ejecutar operaciones en varias instituciones desde un archivo CSV",
+		"nl": "Bewerkingen op meerdere instellingen uitvoeren vanuit een CSV-bestand",
+	},
+	"Print version and build information": {
+		"fr": "Afficher la version et les informations de compilation",
+		"es": "Mostrar la versión y la información de compilación",
+		"nl": "Versie- en buildinformatie weergeven",
+	},
+	"List Plaid's personal finance categories": {
+		"fr": "Lister les catégories de finances personnelles de Plaid",
+		"es": "Listar las categorías de finanzas personales de Plaid",
+		"nl": "De persoonlijke financiële categorieën van Plaid weergeven",
+	},
+	"Add merchant and category data to transactions from a file": {
+		"fr": "Ajouter des données de commerçant et de catégorie aux transactions d'un fichier",
+		"es": "Añadir datos de comercio y categoría a las transacciones de un archivo",
+		"nl": "Handelaars- en categoriegegevens toevoegen aan transacties uit een bestand",
+	},
+	"Summarize spending and account data": {
+		"fr": "Résumer les dépenses et les données des comptes",
+		"es": "Resumir los gastos y los datos de las cuentas",
+		"nl": "Uitgaven en rekeninggegevens samenvatten",
+	},
+	"List active subscriptions and what they cost each month": {
+		"fr": "Lister les abonnements actifs et leur coût mensuel",
+		"es": "Listar las suscripciones activas y su coste mensual",
+		"nl": "Actieve abonnementen en hun maandelijkse kosten weergeven",
+	},
+	"List linked institutions and their health": {
+		"fr": "Lister les établissements liés et leur état",
+		"es": "Listar las instituciones vinculadas y su estado",
+		"nl": "Gekoppelde instellingen en hun status weergeven",
+	},
+	"Import transactions from outside Plaid": {
+		"fr": "Importer des transactions provenant d'ailleurs que Plaid",
+		"es": "Importar transacciones de fuera de Plaid",
+		"nl": "Transacties van buiten Plaid importeren",
+	},
+	"Track accounts Plaid can't link, such as a house or car": {
+		"fr": "Suivre des comptes que Plaid ne peut pas lier, comme une maison ou une voiture",
+		"es": "Seguir cuentas que Plaid no puede vincular, como una casa o un coche",
+		"nl": "Rekeningen bijhouden die Plaid niet kan koppelen, zoals een huis of auto",
+	},
+	"Delete local financial data older than a period": {
+		"fr": "Supprimer les données financières locales plus anciennes qu'une période",
+		"es": "Eliminar los datos financieros locales anteriores a un periodo",
+		"nl": "Lokale financiële gegevens ouder dan een periode verwijderen",
+	},
+	"Collect diagnostics to attach to a bug report": {
+		"fr": "Rassembler des diagnostics à joindre à un rapport de bogue",
+		"es": "Recopilar diagnósticos para adjuntar a un informe de error",
+		"nl": "Diagnostische gegevens verzamelen voor een bugrapport",
+	},
+	"Send transactions to a budgeting tool": {
+		"fr": "Envoyer les transactions vers un outil de budget",
+		"es": "Enviar transacciones a una herramienta de presupuesto",
+		"nl": "Transacties naar een budgetteringstool sturen",
+	},
+	"Choose which budgeting tool account each account is pushed to": {
+		"fr": "Choisir le compte de l'outil de budget vers lequel chaque compte est envoyé",
+		"es": "Elegir a qué cuenta de la herramienta de presupuesto se envía cada cuenta",
+		"nl": "Kiezen naar welke rekening in de budgetteringstool elke rekening wordt gestuurd",
+	},
+	"Save the account mapping for %s": {
+		"fr": "Enregistrer la correspondance des comptes pour %s",
+		"es": "Guardar la asignación de cuentas para %s",
+		"nl": "De rekeningkoppeling voor %s opslaan",
+	},
+	"Receive, list and replay webhooks from Plaid": {
+		"fr": "Recevoir, lister et rejouer les webhooks de Plaid",
+		"es": "Recibir, listar y reproducir los webhooks de Plaid",
+		"nl": "Webhooks van Plaid ontvangen, weergeven en opnieuw afspelen",
+	},
+	"Set up plaid-cli with your Plaid API credentials": {
+		"fr": "Configurer plaid-cli avec vos identifiants de l'API Plaid",
+		"es": "Configurar plaid-cli con sus credenciales de la API de Plaid",
+		"nl": "plaid-cli instellen met uw Plaid API-gegevens",
+	},
+	"Link an institution now": {
+		"fr": "Lier un établissement maintenant",
+		"es": "Vincular una institución ahora",
+		"nl": "Nu een instelling koppelen",
+	},
+	"Check the Plaid credentials and which products they can use": {
+		"fr": "Vérifier les identifiants Plaid et les produits qu'ils permettent d'utiliser",
+		"es": "Comprobar las credenciales de Plaid y qué productos pueden usar",
+		"nl": "De Plaid-gegevens controleren en welke producten ze kunnen gebruiken",
+	},
+	"Show the commands plaid-cli has run": {
+		"fr": "Afficher les commandes exécutées par plaid-cli",
+		"es": "Mostrar los comandos que ha ejecutado plaid-cli",
+		"nl": "De opdrachten tonen die plaid-cli heeft uitgevoerd",
+	},
+	"Print a JSON Schema for plaid-cli's output": {
+		"fr": "Afficher un schéma JSON de la sortie de plaid-cli",
+		"es": "Mostrar un esquema JSON de la salida de plaid-cli",
+		"nl": "Een JSON Schema van de uitvoer van plaid-cli tonen",
+	},
+	"Relink institutions whose login needs fixing": {
+		"fr": "Reconnecter les établissements dont la connexion doit être réparée",
+		"es": "Volver a vincular las instituciones cuyo inicio de sesión debe repararse",
+		"nl": "Instellingen opnieuw koppelen waarvan de aanmelding hersteld moet worden",
+	},
+	"Create and break test institutions in Plaid's sandbox": {
+		"fr": "Créer et casser des établissements de test dans le sandbox de Plaid",
+		"es": "Crear y romper instituciones de prueba en el sandbox de Plaid",
+		"nl": "Testinstellingen aanmaken en laten falen in de sandbox van Plaid",
+	},
+	"Link a sandbox institution without opening Link": {
+		"fr": "Lier un établissement du sandbox sans ouvrir Link",
+		"es": "Vincular una institución del sandbox sin abrir Link",
+		"nl": "Een sandbox-instelling koppelen zonder Link te openen",
+	},
+	"Make a sandbox institution's login expire": {
+		"fr": "Faire expirer la connexion d'un établissement du sandbox",
+		"es": "Hacer que caduque el inicio de sesión de una institución del sandbox",
+		"nl": "De aanmelding van een sandbox-instelling laten verlopen",
+	},
+	"Institutions and accounts:": {
+		"fr": "Établissements et comptes :",
+		"es": "Instituciones y cuentas:",
+		"nl": "Instellingen en rekeningen:",
+	},
+	"Transactions and reports:": {
+		"fr": "Transactions et rapports :",
+		"es": "Transacciones e informes:",
+		"nl": "Transacties en rapporten:",
+	},
+	"Plaid products:": {
+		"fr": "Produits Plaid :",
+		"es": "Productos de Plaid:",
+		"nl": "Plaid-producten:",
+	},
+	"Automation:": {
+		"fr": "Automatisation :",
+		"es": "Automatización:",
+		"nl": "Automatisering:",
+	},
+	"Setup and troubleshooting:": {
+		"fr": "Configuration et dépannage :",
+		"es": "Configuración y solución de problemas:",
+		"nl": "Instellen en problemen oplossen:",
+	},
+	"Warning": {
+		"fr": "Attention",
+		"es": "Advertencia",
+		"nl": "Waarschuwing",
+	},
+	"Link and manage institutions": {
+		"fr": "Lier et gérer des établissements",
+		"es": "Vincular y gestionar instituciones",
+		"nl": "Instellingen koppelen en beheren",
+	},
+	"Show the log of requests made to Plaid": {
+		"fr": "Afficher le journal des requêtes envoyées à Plaid",
+		"es": "Mostrar el registro de solicitudes enviadas a Plaid",
+		"nl": "Het logboek van verzoeken aan Plaid weergeven",
+	},
+	"Manage plaid-cli's configuration": {
+		"fr": "Gérer la configuration de plaid-cli",
+		"es": "Gestionar la configuración de plaid-cli",
+		"nl": "De configuratie van plaid-cli beheren",
+	},
+}
+
+var printer = message.NewPrinter(language.English)
+
+// SetLanguage makes T translate messages into lang, one of cliLanguages.
+func SetLanguage(lang string) {
+	builder := catalog.NewBuilder(catalog.Fallback(language.English))
+	for key, msgs := range translations {
+		for l, msg := range msgs {
+			// The keys and languages above are fixed, so this can only fail
+			// on a programming error.
+			err := builder.SetString(language.Make(l), key, msg)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	printer = message.NewPrinter(language.Make(lang), message.Catalog(builder))
+}
+
+// T formats a user-facing message in the configured cli.language.
+func T(format string, args ...interface{}) string {
+	return printer.Sprintf(format, args...)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+	"github.com/spf13/cobra"
+)
+
+// AddIncludeIgnoredFlag registers --include-ignored on commands that exclude
+// ignored transactions and accounts by default.
+func AddIncludeIgnoredFlag(cmd *cobra.Command, include *bool) {
+	cmd.Flags().BoolVar(include, "include-ignored", false, "Include transactions and accounts hidden with 'plaid-cli transactions ignore'")
+}
+
+// ActiveIgnores returns what should be excluded, which is nothing when
+// include is set. Archived accounts are excluded as if they were ignored.
+func ActiveIgnores(data *plaid_cli.Data, include bool) plaid_cli.Ignored {
+	if include {
+		return plaid_cli.Ignored{}
+	}
+
+	ignored := data.Ignored
+	copied := false
+	for _, cached := range data.AccountCache {
+		for _, m := range cached.Missing {
+			if !m.Archived {
+				continue
+			}
+			// Copy before adding, so data.Ignored isn't changed.
+			if !copied {
+				ignored.Accounts = make(map[string]time.Time)
+				for id, t := range data.Ignored.Accounts {
+					ignored.Accounts[id] = t
+				}
+				copied = true
+			}
+			ignored.Accounts[m.Account.AccountID] = m.MissingSince
+		}
+	}
+	return ignored
+}
+
+func keep[T any](items []T, ok func(T) bool) []T {
+	var kept []T
+	for _, item := range items {
+		if ok(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+func isIgnoredAccount(ignored plaid_cli.Ignored, accountID string) bool {
+	_, ok := ignored.Accounts[accountID]
+	return ok
+}
+
+// FilterTransactions removes ignored transactions and transactions in ignored
+// accounts.
+func FilterTransactions(ignored plaid_cli.Ignored, txs []plaid_cli.Transaction) []plaid_cli.Transaction {
+	if len(ignored.Transactions) == 0 && len(ignored.Accounts) == 0 {
+		return txs
+	}
+	return keep(txs, func(tx plaid_cli.Transaction) bool {
+		_, ok := ignored.Transactions[tx.TransactionID]
+		return !ok && !isIgnoredAccount(ignored, tx.AccountID)
+	})
+}
+
+func FilterAccounts(ignored plaid_cli.Ignored, accounts []plaid_cli.Account) []plaid_cli.Account {
+	return keep(accounts, func(account plaid_cli.Account) bool {
+		return !isIgnoredAccount(ignored, account.AccountID)
+	})
+}
+
+// FilterHoldings removes holdings in ignored accounts from res.
+func FilterHoldings(ignored plaid_cli.Ignored, res *plaid.InvestmentsHoldingsGetResponse) {
+	res.Holdings = keep(res.Holdings, func(h plaid.Holding) bool {
+		return !isIgnoredAccount(ignored, h.AccountId)
+	})
+}
+
+// FilterLiabilities removes liabilities of ignored accounts from res.
+func FilterLiabilities(ignored plaid_cli.Ignored, res *plaid.LiabilitiesGetResponse) {
+	res.Liabilities.Credit = keep(res.Liabilities.Credit, func(l plaid.CreditCardLiability) bool {
+		return !isIgnoredAccount(ignored, l.GetAccountId())
+	})
+	res.Liabilities.Mortgage = keep(res.Liabilities.Mortgage, func(l plaid.MortgageLiability) bool {
+		return !isIgnoredAccount(ignored, l.AccountId)
+	})
+	res.Liabilities.Student = keep(res.Liabilities.Student, func(l plaid.StudentLoan) bool {
+		return !isIgnoredAccount(ignored, l.GetAccountId())
+	})
+}
+
+func FilterSubscriptions(ignored plaid_cli.Ignored, subscriptions []Subscription) []Subscription {
+	return keep(subscriptions, func(s Subscription) bool {
+		return !isIgnoredAccount(ignored, s.AccountID)
+	})
+}
+
+// UpdateIgnored ignores, or with remove stops ignoring, the given
+// transaction or account IDs.
+func UpdateIgnored(data *plaid_cli.Data, kind string, ids []string, remove bool) error {
+	entries := data.Ignored.Transactions
+	if kind == "account" {
+		entries = data.Ignored.Accounts
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		if remove {
+			if _, ok := entries[id]; !ok {
+				return fmt.Errorf("%s %s isn't ignored", kind, id)
+			}
+			delete(entries, id)
+			continue
+		}
+		entries[id] = now
+	}
+
+	return data.SaveIgnored()
+}
+
+// IgnoredEntry is a single ignored transaction or account.
+type IgnoredEntry struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	IgnoredAt time.Time `json:"ignored_at"`
+}
+
+func IgnoredEntries(ignored plaid_cli.Ignored) []IgnoredEntry {
+	var entries []IgnoredEntry
+	for id, at := range ignored.Accounts {
+		entries = append(entries, IgnoredEntry{Kind: "account", ID: id, IgnoredAt: at})
+	}
+	for id, at := range ignored.Transactions {
+		entries = append(entries, IgnoredEntry{Kind: "transaction", ID: id, IgnoredAt: at})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+func WriteIgnored(w io.Writer, entries []IgnoredEntry, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "KIND\tID\tIGNORED AT")
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Kind, e.ID, e.IgnoredAt.Format("2006-01-02"))
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// manualAccountPrefix starts the names of accounts that plaid-cli keeps
+// itself rather than fetching from Plaid, so they can't be mistaken for
+// Plaid account IDs.
+const manualAccountPrefix = "manual:"
+
+// ValidateManualAccount checks that account is named like manual:cash.
+func ValidateManualAccount(account string) error {
+	name, ok := strings.CutPrefix(account, manualAccountPrefix)
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid account %q. Manual accounts are named like manual:cash", account)
+	}
+	return nil
+}
+
+// ImportMapping says which columns of a CSV file hold which transaction
+// fields. Column names are matched ignoring case.
+type ImportMapping struct {
+	Date        string
+	Description string
+	// Amount holds amounts, or Debit and Credit hold money out and in
+	// separately, as some banks export them.
+	Amount   string
+	Debit    string
+	Credit   string
+	Merchant string
+	Category string
+	Currency string
+	// DateFormat is a Go time layout, e.g. 01/02/2006.
+	DateFormat string
+	// Negate flips the sign of amounts, for files where spending is
+	// negative. plaid-cli, like Plaid, treats money going out as positive.
+	Negate bool
+	// DecimalSeparator is "." or ",", as in 1,234.56 or 1.234,56. The other
+	// one may separate thousands.
+	DecimalSeparator string
+}
+
+// ImportMappingFromViper returns the mapping named name under
+// [import.mappings] in the config file, or the default mapping, which
+// expects Date, Description and Amount columns, if name is empty.
+func ImportMappingFromViper(name string) (ImportMapping, error) {
+	key := "import.mappings." + name
+	if name != "" && !viper.IsSet(key) {
+		return ImportMapping{}, ConfigError{msg: fmt.Sprintf("⚠️  No import mapping named %q. Define its columns under [import.mappings.%s] in the config file.", name, name)}
+	}
+
+	mapping := ImportMapping{
+		Date:             "Date",
+		Description:      "Description",
+		Amount:           "Amount",
+		DateFormat:       "2006-01-02",
+		DecimalSeparator: ".",
+	}
+	if name == "" {
+		return mapping, nil
+	}
+
+	sub := viper.Sub(key)
+	set := func(field *string, k string) {
+		if sub.IsSet(k) {
+			*field = sub.GetString(k)
+		}
+	}
+	set(&mapping.Date, "date")
+	set(&mapping.Description, "description")
+	set(&mapping.Amount, "amount")
+	set(&mapping.Debit, "debit")
+	set(&mapping.Credit, "credit")
+	set(&mapping.Merchant, "merchant")
+	set(&mapping.Category, "category")
+	set(&mapping.Currency, "currency")
+	set(&mapping.DateFormat, "date_format")
+	set(&mapping.DecimalSeparator, "decimal_separator")
+	if mapping.DecimalSeparator != "." && mapping.DecimalSeparator != "," {
+		return ImportMapping{}, ConfigError{msg: fmt.Sprintf("⚠️  import.mappings.%s.decimal_separator is %q. Use \".\" or \",\".", name, mapping.DecimalSeparator)}
+	}
+	mapping.Negate = sub.GetBool("negate")
+	if mapping.Debit != "" || mapping.Credit != "" {
+		if !sub.IsSet("amount") {
+			mapping.Amount = ""
+		}
+	}
+	return mapping, nil
+}
+
+// ReadImportCSV reads transactions for account from a CSV file, or stdin if
+// path is "-". Each transaction's ID is derived from its contents, so
+// importing an overlapping file again doesn't duplicate transactions.
+func ReadImportCSV(path string, account string, mapping ImportMapping) ([]plaid_cli.Transaction, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := columns[strings.ToLower(name)]
+		if !ok {
+			return -1, fmt.Errorf("the CSV file has no %q column. Its columns are: %s", name, strings.Join(header, ", "))
+		}
+		return i, nil
+	}
+	var indexes [8]int
+	for i, name := range []string{mapping.Date, mapping.Description, mapping.Amount, mapping.Debit, mapping.Credit, mapping.Merchant, mapping.Category, mapping.Currency} {
+		indexes[i], err = column(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dateCol, descriptionCol, amountCol, debitCol, creditCol, merchantCol, categoryCol, currencyCol := indexes[0], indexes[1], indexes[2], indexes[3], indexes[4], indexes[5], indexes[6], indexes[7]
+	if dateCol < 0 || descriptionCol < 0 || (amountCol < 0 && debitCol < 0 && creditCol < 0) {
+		return nil, fmt.Errorf("an import mapping needs date, description and either amount or debit and credit columns")
+	}
+
+	field := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var txs []plaid_cli.Transaction
+	seen := make(map[string]int)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		date, err := time.Parse(mapping.DateFormat, field(record, dateCol))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q. Set date_format in the import mapping if the file uses another format", line, field(record, dateCol))
+		}
+
+		var amount plaid_cli.Money
+		if amountCol >= 0 {
+			amount, err = parseImportAmount(field(record, amountCol), mapping.DecimalSeparator)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid amount: %w", line, err)
+			}
+		} else {
+			debit, err := parseImportAmount(field(record, debitCol), mapping.DecimalSeparator)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid debit: %w", line, err)
+			}
+			credit, err := parseImportAmount(field(record, creditCol), mapping.DecimalSeparator)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid credit: %w", line, err)
+			}
+			amount = debit.Abs() - credit.Abs()
+		}
+		if mapping.Negate {
+			amount = -amount
+		}
+
+		tx := plaid_cli.Transaction{
+			AccountID: account,
+			Amount:    amount.Float64(),
+			Date:      date.Format("2006-01-02"),
+			Name:      field(record, descriptionCol),
+		}
+		if merchant := field(record, merchantCol); merchant != "" {
+			tx.MerchantName = plaid_cli.Ptr(merchant)
+		}
+		if currency := field(record, currencyCol); currency != "" {
+			tx.ISOCurrencyCode = plaid_cli.Ptr(strings.ToUpper(currency))
+		}
+		// Categories are written the way Plaid writes them, so a file's
+		// "Food and drink" is reported, and excluded, with FOOD_AND_DRINK.
+		if category := normalizeCategories([]string{field(record, categoryCol)}); len(category) > 0 {
+			tx.PersonalFinanceCategory = &plaid_cli.PersonalFinanceCategory{Primary: category[0], Detailed: category[0]}
+		}
+
+		// Identical rows on the same day, such as two coffees, are told
+		// apart by how many came before them.
+		content := fmt.Sprintf("%s|%s|%.2f|%s", account, tx.Date, tx.Amount, tx.Name)
+		tx.TransactionID = importedTransactionID(content, seen[content])
+		seen[content]++
+
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// parseImportAmount parses an amount written with decimal as its decimal
+// separator, such as $1,234.56 or 1.234,56 €. The other separator may only
+// group thousands, so an amount that would mean something else with the
+// separators swapped, such as 12,50 with ".", is rejected rather than read
+// as 1250.
+func parseImportAmount(s string, decimal string) (plaid_cli.Money, error) {
+	original := s
+	s = strings.NewReplacer("$", "", "£", "", "€", "", " ", "", "\u00a0", "", "\u202f", "").Replace(s)
+	if s == "" {
+		return 0, nil
+	}
+	// Some banks write negative amounts in parentheses.
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		s = "-" + s[1:len(s)-1]
+	}
+	s = strings.TrimPrefix(s, "+")
+
+	thousands := ","
+	if decimal == "," {
+		thousands = "."
+	}
+	whole, fraction, hasFraction := strings.Cut(s, decimal)
+	if strings.Contains(fraction, decimal) || strings.Contains(fraction, thousands) {
+		return 0, fmt.Errorf("%q has more than one decimal separator %q", original, decimal)
+	}
+	if groups := strings.Split(whole, thousands); len(groups) > 1 {
+		for _, group := range groups[1:] {
+			if len(group) != 3 {
+				return 0, fmt.Errorf("%q is ambiguous: the import mapping's decimal separator is %q, so %q can only group thousands. Set decimal_separator in the import mapping if the file uses %q for decimals", original, decimal, thousands, thousands)
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+	if hasFraction {
+		s = whole + "." + fraction
+	} else {
+		s = whole
+	}
+
+	amount, err := plaid_cli.ParseMoney(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a decimal amount", original)
+	}
+	return amount, nil
+}
+
+func importedTransactionID(content string, occurrence int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", content, occurrence)))
+	return "import-" + hex.EncodeToString(sum[:12])
+}
+
+// ImportTransactions adds txs to account's imported transactions, skipping
+// ones already imported, or replaces them all if replace is set. It returns
+// how many were added. Remembered savings rates are forgotten, since the
+// import may have changed any month.
+func ImportTransactions(data *plaid_cli.Data, account string, txs []plaid_cli.Transaction, replace bool) (int, error) {
+	existing := data.Imported[account]
+	if replace {
+		existing = nil
+	}
+
+	ids := make(map[string]bool)
+	for _, tx := range existing {
+		ids[tx.TransactionID] = true
+	}
+	added := 0
+	for _, tx := range txs {
+		if ids[tx.TransactionID] {
+			continue
+		}
+		existing = append(existing, tx)
+		ids[tx.TransactionID] = true
+		added++
+	}
+
+	data.Imported[account] = SortTransactions(existing)
+	err := data.SaveImported()
+	if err != nil {
+		return 0, err
+	}
+	data.SavingsHistory = make(map[string]plaid_cli.SavingsMonth)
+	return added, data.SaveSavingsHistory()
+}
+
+// ImportedTransactions returns the imported transactions, in every manual
+// account, dated from from to to.
+func ImportedTransactions(data *plaid_cli.Data, from time.Time, to time.Time) []plaid_cli.Transaction {
+	start := from.Format("2006-01-02")
+	end := to.Format("2006-01-02")
+
+	var accounts []string
+	for account := range data.Imported {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	var txs []plaid_cli.Transaction
+	for _, account := range accounts {
+		for _, tx := range data.Imported[account] {
+			if tx.Date >= start && tx.Date <= end {
+				txs = append(txs, tx)
+			}
+		}
+	}
+	return txs
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// IncomeStream is a flattened view of a Bank Income source suitable for
+// record-keeping.
+type IncomeStream struct {
+	Institution      string          `json:"institution"`
+	AccountID        string          `json:"account_id"`
+	Employer         string          `json:"employer"`
+	Category         string          `json:"category"`
+	Frequency        string          `json:"frequency"`
+	StartDate        string          `json:"start_date"`
+	EndDate          string          `json:"end_date"`
+	TransactionCount int32           `json:"transaction_count"`
+	TotalAmount      plaid_cli.Money `json:"total_amount"`
+	AverageAmount    plaid_cli.Money `json:"average_amount"`
+}
+
+// EnsureUserToken creates a Plaid user for this installation the first time
+// a user-based product is used and persists its token.
+func EnsureUserToken(data *plaid_cli.Data, client *plaid.PlaidApiService) (string, error) {
+	if data.UserToken != "" {
+		return data.UserToken, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+
+	req := plaid.NewUserCreateRequest(fmt.Sprintf("plaid-cli-%s", hostname))
+	apiReq := client.UserCreate(context.Background())
+	apiReq = apiReq.UserCreateRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return "", err
+	}
+
+	data.UserToken = res.UserToken
+	err = data.SaveUserToken()
+
+	return data.UserToken, err
+}
+
+func GetBankIncome(client *plaid.PlaidApiService, userToken string) ([]plaid.CreditBankIncome, error) {
+	req := plaid.NewCreditBankIncomeGetRequest()
+	req.SetUserToken(userToken)
+
+	apiReq := client.CreditBankIncomeGet(context.Background())
+	apiReq = apiReq.CreditBankIncomeGetRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	return res.GetBankIncome(), nil
+}
+
+func IncomeStreams(reports []plaid.CreditBankIncome) []IncomeStream {
+	var streams []IncomeStream
+	for _, report := range reports {
+		for _, item := range report.GetItems() {
+			for _, source := range item.GetBankIncomeSources() {
+				stream := IncomeStream{
+					Institution:      item.GetInstitutionName(),
+					AccountID:        source.GetAccountId(),
+					Employer:         source.GetIncomeDescription(),
+					Category:         string(source.GetIncomeCategory()),
+					Frequency:        string(source.GetPayFrequency()),
+					StartDate:        source.GetStartDate(),
+					EndDate:          source.GetEndDate(),
+					TransactionCount: source.GetTransactionCount(),
+					TotalAmount:      plaid_cli.MoneyFromFloat32(source.GetTotalAmount()),
+				}
+				if stream.TransactionCount > 0 {
+					stream.AverageAmount = stream.TotalAmount.Div(int(stream.TransactionCount))
+				}
+				streams = append(streams, stream)
+			}
+		}
+	}
+
+	return streams
+}
+
+func WriteIncomeStreams(w io.Writer, streams []IncomeStream, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(streams)
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write([]string{"Institution", "Account ID", "Employer", "Category", "Frequency", "Start Date", "End Date", "Transactions", "Total Amount", "Average Amount"})
+		if err != nil {
+			return err
+		}
+		for _, s := range streams {
+			err = writer.Write([]string{
+				s.Institution,
+				s.AccountID,
+				s.Employer,
+				s.Category,
+				s.Frequency,
+				s.StartDate,
+				s.EndDate,
+				fmt.Sprintf("%d", s.TransactionCount),
+				s.TotalAmount.String(),
+				s.AverageAmount.String(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
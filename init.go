@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// InitConfig is what `plaid-cli init` asks for.
+type InitConfig struct {
+	ClientID    string
+	Secret      string
+	Environment string
+	Countries   []string
+	Language    string
+}
+
+// CountryCodes returns config's countries as Plaid's country codes.
+func (c InitConfig) CountryCodes() []plaid.CountryCode {
+	var codes []plaid.CountryCode
+	for _, country := range c.Countries {
+		codes = append(codes, plaid.CountryCode(country))
+	}
+	return codes
+}
+
+// PromptInitConfig asks for each setting, offering defaults's values.
+// The client ID and secret are asked for with PromptCredentials.
+func PromptInitConfig(defaults InitConfig) (InitConfig, error) {
+	config := defaults
+
+	environments := []string{"sandbox", "production"}
+	cursor := 0
+	if defaults.Environment == "production" {
+		cursor = 1
+	}
+	environmentPrompt := promptui.Select{
+		Label:     "Plaid environment (sandbox uses test data)",
+		Items:     environments,
+		CursorPos: cursor,
+	}
+	_, environment, err := environmentPrompt.Run()
+	if err != nil {
+		return config, err
+	}
+	config.Environment = environment
+
+	countriesPrompt := promptui.Prompt{
+		Label:   "Countries of your institutions, separated by commas",
+		Default: strings.Join(defaults.Countries, ","),
+		Validate: func(input string) error {
+			for _, c := range splitList(input) {
+				if _, err := CheckPlaidCountry(strings.ToUpper(c)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	countries, err := countriesPrompt.Run()
+	if err != nil {
+		return config, err
+	}
+	config.Countries = nil
+	for _, c := range splitList(countries) {
+		config.Countries = append(config.Countries, strings.ToUpper(c))
+	}
+
+	cursor = 0
+	for i, lang := range plaidLinkLanguages {
+		if lang == defaults.Language {
+			cursor = i
+		}
+	}
+	languagePrompt := promptui.Select{
+		Label:     "Language of Plaid Link",
+		Items:     plaidLinkLanguages,
+		CursorPos: cursor,
+	}
+	_, config.Language, err = languagePrompt.Run()
+	if err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// PromptCredentials asks for the Plaid client ID and secret for
+// config.Environment, offering the client ID already configured.
+func PromptCredentials(config InitConfig) (InitConfig, error) {
+	clientIDPrompt := promptui.Prompt{
+		Label:   "Plaid client ID",
+		Default: config.ClientID,
+		Validate: func(input string) error {
+			if strings.TrimSpace(input) == "" {
+				return errors.New("the client ID is on https://dashboard.plaid.com/team/keys")
+			}
+			return nil
+		},
+	}
+	clientID, err := clientIDPrompt.Run()
+	if err != nil {
+		return config, err
+	}
+	config.ClientID = strings.TrimSpace(clientID)
+
+	secretPrompt := promptui.Prompt{
+		Label: fmt.Sprintf("Plaid %s secret", config.Environment),
+		Mask:  '*',
+		Validate: func(input string) error {
+			if strings.TrimSpace(input) == "" {
+				return errors.New("the secret is on https://dashboard.plaid.com/team/keys")
+			}
+			return nil
+		},
+	}
+	secret, err := secretPrompt.Run()
+	if err != nil {
+		return config, err
+	}
+	config.Secret = strings.TrimSpace(secret)
+	return config, nil
+}
+
+// NewCredentialsClient returns a client for config's environment that
+// authenticates with config's client ID and secret.
+func NewCredentialsClient(config InitConfig) *plaid.PlaidApiService {
+	conf := plaid.NewConfiguration()
+	conf.AddDefaultHeader("PLAID-CLIENT-ID", config.ClientID)
+	conf.AddDefaultHeader("PLAID-SECRET", config.Secret)
+	conf.AddDefaultHeader("Plaid-Version", PlaidAPIVersion())
+	env := plaid.Sandbox
+	if config.Environment == "production" {
+		env = plaid.Production
+	}
+	conf.Servers = plaid.ServerConfigurations{{URL: PlaidBaseURL(env)}}
+	conf.HTTPClient = NewPlaidHTTPClient(ClientOptions{Timeout: 30 * time.Second, Retries: 1})
+	return plaid.NewAPIClient(conf).PlaidApi
+}
+
+// WriteInitConfig saves config under [plaid] in the config file at path,
+// readable only by the user. Only the settings init asks for are changed,
+// in place, so the rest of the file is kept as it was, comments and all. A
+// credential stored as a command or encrypted is removed, since the one
+// entered takes its place.
+func WriteInitConfig(path string, config InitConfig) error {
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	keys := []string{"client_id", "secret", "environment", "countries", "language"}
+	values := map[string]interface{}{
+		"client_id":   config.ClientID,
+		"secret":      config.Secret,
+		"environment": config.Environment,
+		"countries":   config.Countries,
+		"language":    config.Language,
+	}
+	removed := map[string]bool{
+		"client_id_command":   true,
+		"client_id_encrypted": true,
+		"secret_command":      true,
+		"secret_encrypted":    true,
+	}
+
+	var lines []string
+	if len(b) > 0 {
+		lines = strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	}
+	var out []string
+	table := ""
+	plaidEnd := -1
+	written := make(map[string]bool)
+	// open is how many brackets of a multi-line array being dropped are
+	// still open.
+	open := 0
+	for _, line := range lines {
+		if open > 0 {
+			open += openBrackets(line)
+			continue
+		}
+		if m := tomlTable.FindStringSubmatch(line); m != nil {
+			table = tomlKeyName(m[1])
+			out = append(out, line)
+			if table == "plaid" {
+				plaidEnd = len(out)
+			}
+			continue
+		}
+		m := tomlKey.FindStringSubmatch(line)
+		if table != "plaid" || m == nil {
+			out = append(out, line)
+			continue
+		}
+		key := tomlKeyName(m[1])
+		value, replaced := values[key]
+		if replaced || removed[key] {
+			open = max(openBrackets(line[len(m[0]):]), 0)
+			if replaced && !written[key] {
+				indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+				setting, err := tomlSetting(key, value)
+				if err != nil {
+					return err
+				}
+				out = append(out, indent+setting)
+				written[key] = true
+			}
+		} else {
+			out = append(out, line)
+		}
+		plaidEnd = len(out)
+	}
+
+	var missing []string
+	for _, key := range keys {
+		if written[key] {
+			continue
+		}
+		setting, err := tomlSetting(key, values[key])
+		if err != nil {
+			return err
+		}
+		missing = append(missing, setting)
+	}
+	if plaidEnd < 0 {
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, "[plaid]")
+		out = append(out, missing...)
+	} else {
+		out = append(out[:plaidEnd], append(missing, out[plaidEnd:]...)...)
+	}
+	b = []byte(strings.Join(out, "\n") + "\n")
+
+	// The file is edited a line at a time, so check the result says what
+	// was meant before replacing the old one.
+	var check struct {
+		Plaid struct {
+			ClientID    string   `toml:"client_id"`
+			Secret      string   `toml:"secret"`
+			Environment string   `toml:"environment"`
+			Countries   []string `toml:"countries"`
+			Language    string   `toml:"language"`
+		} `toml:"plaid"`
+	}
+	err = toml.Unmarshal(b, &check)
+	if err != nil || check.Plaid.ClientID != config.ClientID || check.Plaid.Secret != config.Secret ||
+		check.Plaid.Environment != config.Environment || !slices.Equal(check.Plaid.Countries, config.Countries) ||
+		check.Plaid.Language != config.Language {
+		return fmt.Errorf("couldn't update the [plaid] settings in %s without rewriting it. Edit them by hand, or move the file aside and run init again", path)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// tomlSetting formats key = value as a line of TOML.
+func tomlSetting(key string, value interface{}) (string, error) {
+	b, err := toml.Marshal(map[string]interface{}{key: value})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+var tomlStringOrComment = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'[^']*'|#.*`)
+
+// openBrackets returns how many more brackets line opens than it closes,
+// ignoring those in strings and comments.
+func openBrackets(line string) int {
+	line = tomlStringOrComment.ReplaceAllString(line, "")
+	return strings.Count(line, "[") - strings.Count(line, "]")
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// ItemInfo describes a linked item for `plaid-cli item list`.
+type ItemInfo struct {
+	Alias       string   `json:"alias,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Institution string   `json:"institution"`
+	ItemID      string   `json:"item_id"`
+	Environment string   `json:"environment"`
+	Products    []string `json:"products"`
+	// Health is "ok", or the error Plaid reports for the item, such as
+	// ITEM_LOGIN_REQUIRED.
+	Health string `json:"health"`
+	// LastSync is when Plaid last successfully updated the item's
+	// transactions.
+	LastSync *time.Time `json:"last_sync,omitempty"`
+	// MissingAccounts are accounts Plaid has stopped returning since they
+	// were last fetched.
+	MissingAccounts []MissingAccountInfo `json:"missing_accounts,omitempty"`
+	// OAuthMigration is set if Plaid has said it will disconnect the item
+	// because its institution is moving to OAuth, or if the institution was
+	// checked for an OAuth version and may have one.
+	OAuthMigration *OAuthMigration `json:"oauth_migration,omitempty"`
+}
+
+// MissingAccountInfo describes an account that has disappeared from an item.
+type MissingAccountInfo struct {
+	AccountID    string    `json:"account_id"`
+	Name         string    `json:"name"`
+	MissingSince time.Time `json:"missing_since"`
+	Archived     bool      `json:"archived"`
+}
+
+// ListItems describes each item. Items are looked up without relinking, so
+// one whose login has expired is reported rather than fixed. disconnects are
+// the items Plaid has said it will disconnect for an OAuth migration, from
+// PendingDisconnects. Their institutions' OAuth versions are looked up by
+// name, and with checkOAuth, so are every other item's, which takes a
+// search request per institution.
+func ListItems(client *plaid.PlaidApiService, data *plaid_cli.Data, itemIDs []string, countries []plaid.CountryCode, disconnects map[string]time.Time, checkOAuth bool) []ItemInfo {
+	institutions := make(map[string]plaid.Institution)
+	migrations := make(map[string]string)
+
+	var items []ItemInfo
+	for _, itemID := range itemIDs {
+		info := ItemInfo{
+			Alias:       data.BackAliases[itemID],
+			Owner:       ItemOwner(data, itemID),
+			ItemID:      itemID,
+			Environment: data.Environment,
+			Products:    []string{},
+		}
+		for _, m := range MissingAccounts(data, itemID) {
+			info.MissingAccounts = append(info.MissingAccounts, MissingAccountInfo{
+				AccountID:    m.Account.AccountID,
+				Name:         AccountLabel(m.Account),
+				MissingSince: m.MissingSince,
+				Archived:     m.Archived,
+			})
+		}
+
+		token, err := ItemToken(data, itemID)
+		if err == nil {
+			var item plaid_cli.Item
+			item, err = GetItem(client, token)
+			if err == nil {
+				describeItem(&info, item)
+				var institution plaid.Institution
+				institution, err = lookupInstitution(client, plaid_cli.Value(item.InstitutionID), countries, institutions)
+				info.Institution = institution.Name
+				_, disconnecting := disconnects[itemID]
+				if err == nil && (checkOAuth || disconnecting) {
+					info.OAuthMigration = checkOAuthMigration(client, institution, countries, migrations)
+				}
+			}
+		}
+		if err != nil && info.Health == "" {
+			info.Health = itemHealth(err)
+		}
+		if deadline, ok := disconnects[itemID]; ok {
+			if info.OAuthMigration == nil {
+				info.OAuthMigration = &OAuthMigration{}
+			}
+			info.OAuthMigration.Deadline = &deadline
+		}
+
+		items = append(items, info)
+	}
+	return items
+}
+
+func describeItem(info *ItemInfo, item plaid_cli.Item) {
+	info.Products = append(info.Products, item.Products...)
+	if len(info.Products) == 0 {
+		info.Products = append(info.Products, item.BilledProducts...)
+	}
+
+	info.Health = "ok"
+	if item.ErrorCode != nil {
+		info.Health = *item.ErrorCode
+	}
+
+	info.LastSync = item.LastTransactionsUpdate
+}
+
+// lookupInstitution looks up an institution, remembering it in institutions
+// so items at the same institution only look it up once.
+func lookupInstitution(client *plaid.PlaidApiService, institutionID string, countries []plaid.CountryCode, institutions map[string]plaid.Institution) (plaid.Institution, error) {
+	if institutionID == "" {
+		return plaid.Institution{}, nil
+	}
+	if institution, ok := institutions[institutionID]; ok {
+		return institution, nil
+	}
+
+	req := plaid.NewInstitutionsGetByIdRequest(institutionID, countries)
+	apiReq := client.InstitutionsGetById(context.Background())
+	apiReq = apiReq.InstitutionsGetByIdRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return plaid.Institution{}, err
+	}
+
+	institutions[institutionID] = res.Institution
+	return res.Institution, nil
+}
+
+// checkOAuthMigration checks whether institution has an OAuth version,
+// remembering the answer in migrations. Failing to check isn't worth failing
+// the listing for, so it's only logged.
+func checkOAuthMigration(client *plaid.PlaidApiService, institution plaid.Institution, countries []plaid.CountryCode, migrations map[string]string) *OAuthMigration {
+	oauthID, ok := migrations[institution.InstitutionId]
+	if !ok {
+		var err error
+		oauthID, err = oauthInstitution(client, institution, countries)
+		if err != nil {
+			log.Printf("⚠️  Failed to check whether %s has moved to OAuth: %v", institution.Name, err)
+		}
+		migrations[institution.InstitutionId] = oauthID
+	}
+	if oauthID == "" {
+		return nil
+	}
+	return &OAuthMigration{OAuthInstitutionID: oauthID}
+}
+
+func itemHealth(err error) string {
+	if code := PlaidErrorCode(err); code != "" {
+		return code
+	}
+	return "error: " + err.Error()
+}
+
+// shortItemID abbreviates an item ID for display; the full ID is in the JSON
+// output.
+func shortItemID(itemID string) string {
+	if len(itemID) <= 10 {
+		return itemID
+	}
+	return itemID[:8] + "…"
+}
+
+func WriteItems(w io.Writer, items []ItemInfo, format string) error {
+	switch format {
+	case "json":
+		if items == nil {
+			items = []ItemInfo{}
+		}
+		b, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "ALIAS\tOWNER\tINSTITUTION\tITEM ID\tENVIRONMENT\tPRODUCTS\tHEALTH\tLAST SYNC\tMISSING ACCOUNTS")
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			lastSync := ""
+			if item.LastSync != nil {
+				lastSync = item.LastSync.Local().Format("2006-01-02 15:04")
+			}
+			var missing []string
+			for _, m := range item.MissingAccounts {
+				if m.Archived {
+					missing = append(missing, m.Name+" (archived)")
+				} else {
+					missing = append(missing, m.Name)
+				}
+			}
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", item.Alias, item.Owner, item.Institution, shortItemID(item.ItemID), item.Environment, strings.Join(item.Products, ","), item.Health, lastSync, strings.Join(missing, ", "))
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	case "ids":
+		for _, item := range items {
+			_, err := fmt.Fprintln(w, item.ItemID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+// FilterItems keeps the items matching every filter, each KEY=VALUE:
+// status=ok, status=error, or status= an error code such as
+// ITEM_LOGIN_REQUIRED; owner=NAME; or product=PRODUCT.
+func FilterItems(items []ItemInfo, filters []string) ([]ItemInfo, error) {
+	type itemFilter struct{ key, value string }
+	var parsed []itemFilter
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("invalid filter %q. Use KEY=VALUE, e.g. status=error", filter)
+		case key != "status" && key != "owner" && key != "product":
+			return nil, fmt.Errorf("invalid filter %q. Filter on status, owner or product", filter)
+		}
+		parsed = append(parsed, itemFilter{key, strings.TrimSpace(value)})
+	}
+
+	matches := func(item ItemInfo, f itemFilter) bool {
+		switch f.key {
+		case "status":
+			switch strings.ToLower(f.value) {
+			case "ok":
+				return item.Health == "ok"
+			case "error":
+				return item.Health != "ok"
+			default:
+				return strings.EqualFold(item.Health, f.value)
+			}
+		case "owner":
+			return strings.EqualFold(item.Owner, f.value)
+		default:
+			for _, product := range item.Products {
+				if strings.EqualFold(product, f.value) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	var filtered []ItemInfo
+	for _, item := range items {
+		keep := true
+		for _, f := range parsed {
+			keep = keep && matches(item, f)
+		}
+		if keep {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// ResolveItem turns an item ID or alias into the ID of a linked item. If no
+// linked item matches, the error lists the available aliases and suggests
+// the closest one.
+func ResolveItem(data *plaid_cli.Data, itemOrAlias string) (string, error) {
+	if itemID, ok := data.Aliases[itemOrAlias]; ok {
+		itemOrAlias = itemID
+	}
+
+	if token := data.Tokens[itemOrAlias]; token != "" {
+		return itemOrAlias, nil
+	}
+
+	return "", unknownItemError(data, itemOrAlias)
+}
+
+// ResolveToken turns an item ID or alias into the ID of a linked item and
+// its access token.
+func ResolveToken(data *plaid_cli.Data, itemOrAlias string) (itemID string, token string, err error) {
+	itemID, err = ResolveItem(data, itemOrAlias)
+	if err != nil {
+		return "", "", err
+	}
+	token, err = ItemToken(data, itemID)
+	return itemID, token, err
+}
+
+// ItemToken returns the access token for a linked item. Every request for
+// an item gets its token here, so a missing one is an error rather than an
+// empty token sent to Plaid.
+func ItemToken(data *plaid_cli.Data, itemID string) (string, error) {
+	token := data.Tokens[itemID]
+	if token == "" {
+		return "", unknownItemError(data, itemID)
+	}
+	return token, nil
+}
+
+// ResolveItems resolves items named as positional arguments or with --item.
+// "all" selects every linked item. It returns nil when no items were named,
+// leaving the default to the command.
+func ResolveItems(data *plaid_cli.Data, args []string, itemFlags []string) ([]string, error) {
+	var itemIDs []string
+	seen := make(map[string]bool)
+	for _, itemOrAlias := range append(append([]string{}, args...), itemFlags...) {
+		if itemOrAlias == "all" {
+			return SortedItemIDs(data), nil
+		}
+
+		itemID, err := ResolveItem(data, itemOrAlias)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[itemID] {
+			seen[itemID] = true
+			itemIDs = append(itemIDs, itemID)
+		}
+	}
+
+	return itemIDs, nil
+}
+
+// ReadItemList reads item IDs or aliases from r, one per line, as written by
+// `plaid-cli item list --ids-only`. Blank lines and lines starting with # are
+// skipped.
+func ReadItemList(r io.Reader) ([]string, error) {
+	var items []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	return items, scanner.Err()
+}
+
+// SelectItems resolves the items a command should cover, defaulting to every
+// linked item. all reports whether every item was selected, implicitly or
+// with --item all, in which case items that don't support a product can be
+// skipped rather than failing the command.
+func SelectItems(data *plaid_cli.Data, args []string, itemFlags []string) (itemIDs []string, all bool, err error) {
+	itemIDs, err = ResolveItems(data, args, itemFlags)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, itemOrAlias := range append(append([]string{}, args...), itemFlags...) {
+		if itemOrAlias == "all" {
+			all = true
+		}
+	}
+
+	if len(itemIDs) == 0 {
+		return SortedItemIDs(data), true, nil
+	}
+	return itemIDs, all, nil
+}
+
+func unknownItemError(data *plaid_cli.Data, itemOrAlias string) error {
+	var aliases []string
+	for alias := range data.Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	msg := fmt.Sprintf("unknown item or alias %q.", itemOrAlias)
+
+	if suggestion, ok := closestMatch(itemOrAlias, aliases); ok {
+		msg += fmt.Sprintf(" Did you mean %q?", suggestion)
+	}
+
+	switch {
+	case len(aliases) > 0:
+		msg += fmt.Sprintf(" Available aliases: %s. Run `plaid-cli item list` to list linked institutions.", strings.Join(aliases, ", "))
+	case len(data.Tokens) > 0:
+		msg += " Run `plaid-cli item list` to list linked institutions."
+	default:
+		msg += " Run `plaid-cli item link` to link an institution."
+	}
+
+	return errors.New(msg)
+}
+
+// closestMatch returns the candidate with the smallest edit distance to s,
+// provided it is close enough to plausibly be a typo.
+func closestMatch(s string, candidates []string) (string, bool) {
+	best := ""
+	bestDistance := -1
+	for _, c := range candidates {
+		d := levenshtein(strings.ToLower(s), strings.ToLower(c))
+		if bestDistance == -1 || d < bestDistance {
+			best = c
+			bestDistance = d
+		}
+	}
+
+	maxDistance := len(s) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	if bestDistance == -1 || bestDistance > maxDistance {
+		return "", false
+	}
+
+	return best, true
+}
+
+func levenshtein(a string, b string) int {
+	ar := []rune(a)
+	br := []rune(b)
+
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(br)]
+}
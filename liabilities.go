@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// maxPayoffMonths bounds payoff estimates. Debts that would take longer than
+// this to pay off at the current payment are reported as never paid off.
+const maxPayoffMonths = 50 * 12
+
+// Liability summarizes a credit card or loan and estimates how long it will
+// take to pay off at its current payment.
+type Liability struct {
+	Item           string   `json:"item"`
+	Account        string   `json:"account"`
+	Type           string   `json:"type"`
+	Balance        float64  `json:"balance"`
+	APR            *float64 `json:"apr"`
+	MinimumPayment *float64 `json:"minimum_payment"`
+	NextDueDate    string   `json:"next_due_date,omitempty"`
+	Overdue        bool     `json:"overdue"`
+	PayoffMonths   *int     `json:"payoff_months"`
+	NeverPaidOff   bool     `json:"never_paid_off"`
+	PayoffDate     string   `json:"payoff_date,omitempty"`
+	TotalInterest  *float64 `json:"total_interest"`
+}
+
+func GetLiabilities(client *plaid.PlaidApiService, token string) (*plaid.LiabilitiesGetResponse, error) {
+	req := plaid.NewLiabilitiesGetRequest(token)
+	apiReq := client.LiabilitiesGet(context.Background())
+	apiReq = apiReq.LiabilitiesGetRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Liabilities flattens a liabilities response. extraPayment is added to each
+// monthly payment when estimating payoff.
+func Liabilities(itemName string, res *plaid.LiabilitiesGetResponse, extraPayment float64, now time.Time) []Liability {
+	accounts := make(map[string]plaid_cli.Account, len(res.Accounts))
+	for _, account := range res.Accounts {
+		accounts[account.AccountId] = plaid_cli.AccountFromPlaid(account)
+	}
+
+	newLiability := func(accountID string, kind string) Liability {
+		account := accounts[accountID]
+		l := Liability{
+			Item:    itemName,
+			Account: account.Name,
+			Type:    kind,
+		}
+		if current := account.Balances.Current; current != nil {
+			l.Balance = *current
+		}
+		return l
+	}
+
+	var liabilities []Liability
+
+	for _, credit := range res.Liabilities.Credit {
+		l := newLiability(credit.GetAccountId(), "credit")
+		l.APR = purchaseAPR(credit.Aprs)
+		l.MinimumPayment = credit.MinimumPaymentAmount.Get()
+		l.NextDueDate = credit.GetNextPaymentDueDate()
+		l.Overdue = credit.GetIsOverdue()
+		l.estimatePayoff(extraPayment, now)
+		liabilities = append(liabilities, l)
+	}
+
+	for _, mortgage := range res.Liabilities.Mortgage {
+		l := newLiability(mortgage.AccountId, "mortgage")
+		l.APR = mortgage.InterestRate.Percentage.Get()
+		l.MinimumPayment = mortgage.NextMonthlyPayment.Get()
+		l.NextDueDate = mortgage.GetNextPaymentDueDate()
+		l.Overdue = mortgage.GetPastDueAmount() > 0
+		l.estimatePayoff(extraPayment, now)
+		liabilities = append(liabilities, l)
+	}
+
+	for _, student := range res.Liabilities.Student {
+		l := newLiability(student.GetAccountId(), "student")
+		apr := student.InterestRatePercentage
+		l.APR = &apr
+		l.MinimumPayment = student.MinimumPaymentAmount.Get()
+		l.NextDueDate = student.GetNextPaymentDueDate()
+		l.Overdue = student.GetIsOverdue()
+		l.estimatePayoff(extraPayment, now)
+		liabilities = append(liabilities, l)
+	}
+
+	return liabilities
+}
+
+// purchaseAPR returns the APR charged on purchases, falling back to the
+// highest APR on the card.
+func purchaseAPR(aprs []plaid.APR) *float64 {
+	var highest *float64
+	for _, apr := range aprs {
+		percentage := apr.AprPercentage
+		if apr.AprType == "purchase_apr" {
+			return &percentage
+		}
+		if highest == nil || percentage > *highest {
+			highest = &percentage
+		}
+	}
+	return highest
+}
+
+// estimatePayoff works out how many monthly payments it takes to pay off the
+// balance, assuming interest compounds monthly at the APR and the payment
+// stays the same.
+func (l *Liability) estimatePayoff(extraPayment float64, now time.Time) {
+	if l.Balance <= 0 {
+		months := 0
+		interest := 0.0
+		l.PayoffMonths = &months
+		l.TotalInterest = &interest
+		return
+	}
+	if l.APR == nil || l.MinimumPayment == nil {
+		return
+	}
+
+	payment := *l.MinimumPayment + extraPayment
+	if payment <= 0 {
+		return
+	}
+
+	rate := *l.APR / 100 / 12
+	var months float64
+	if rate == 0 {
+		months = math.Ceil(l.Balance / payment)
+	} else {
+		// The payment doesn't cover the interest, so the balance never goes
+		// down.
+		if payment <= l.Balance*rate {
+			l.NeverPaidOff = true
+			return
+		}
+		months = math.Ceil(-math.Log(1-rate*l.Balance/payment) / math.Log(1+rate))
+	}
+
+	if months > maxPayoffMonths {
+		l.NeverPaidOff = true
+		return
+	}
+
+	n := int(months)
+	interest := math.Max(0, totalPaid(l.Balance, rate, payment, n)-l.Balance)
+	l.PayoffMonths = &n
+	l.PayoffDate = now.AddDate(0, n, 0).Format("2006-01")
+	l.TotalInterest = &interest
+}
+
+// totalPaid simulates n monthly payments, with the last payment only covering
+// what's left.
+func totalPaid(balance float64, rate float64, payment float64, n int) float64 {
+	var paid float64
+	for i := 0; i < n && balance > 0; i++ {
+		balance += balance * rate
+		p := math.Min(payment, balance)
+		balance -= p
+		paid += p
+	}
+	return paid
+}
+
+func WriteLiabilities(w io.Writer, liabilities []Liability, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(liabilities, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write([]string{"Item", "Account", "Type", "Balance", "APR", "Minimum Payment", "Next Due Date", "Overdue", "Payoff Months", "Payoff Date", "Total Interest"})
+		if err != nil {
+			return err
+		}
+		for _, l := range liabilities {
+			err = writer.Write([]string{
+				l.Item,
+				l.Account,
+				l.Type,
+				fmt.Sprintf("%.2f", l.Balance),
+				formatOptionalAmount(l.APR),
+				formatOptionalAmount(l.MinimumPayment),
+				l.NextDueDate,
+				strconv.FormatBool(l.Overdue),
+				formatPayoffMonths(l),
+				l.PayoffDate,
+				formatOptionalAmount(l.TotalInterest),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "ITEM\tACCOUNT\tTYPE\tBALANCE\tAPR\tMIN PAYMENT\tNEXT DUE\tPAYOFF\tINTEREST")
+		if err != nil {
+			return err
+		}
+		var balance, minimum plaid_cli.Money
+		for _, l := range liabilities {
+			balance += plaid_cli.MoneyFromFloat(l.Balance)
+			if l.MinimumPayment != nil {
+				minimum += plaid_cli.MoneyFromFloat(*l.MinimumPayment)
+			}
+
+			nextDue := l.NextDueDate
+			if l.Overdue {
+				nextDue += " (overdue)"
+			}
+
+			payoff := l.PayoffDate
+			switch {
+			case l.PayoffMonths != nil && *l.PayoffMonths == 0:
+				payoff = "paid off"
+			case payoff == "":
+				payoff = formatPayoffMonths(l)
+			}
+
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\t%s\t%s\t%s\t%s\t%s\n",
+				l.Item,
+				l.Account,
+				l.Type,
+				l.Balance,
+				formatOptionalAmount(l.APR),
+				formatOptionalAmount(l.MinimumPayment),
+				nextDue,
+				payoff,
+				formatOptionalAmount(l.TotalInterest),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(tw, "TOTAL\t\t\t%.2f\t\t%.2f\t\t\t\n", balance, minimum)
+		if err != nil {
+			return err
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+func formatPayoffMonths(l Liability) string {
+	switch {
+	case l.NeverPaidOff:
+		return "never"
+	case l.PayoffMonths == nil:
+		return ""
+	default:
+		return strconv.Itoa(*l.PayoffMonths)
+	}
+}
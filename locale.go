@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/plaid/plaid-go/v26/plaid"
+	"golang.org/x/text/language"
+)
+
+// plaidLinkLanguages are the languages Plaid Link supports, as listed in
+// the documentation of link/token/create's language field. plaid-go has no
+// enum of them to check against, as it does for countries, so this list is
+// kept by hand and may fall behind Plaid's.
+var plaidLinkLanguages = []string{"da", "de", "en", "es", "et", "fr", "it", "lt", "lv", "nl", "no", "pl", "pt", "ro", "sv"}
+
+// CheckPlaidLanguage returns an error if lang isn't a language code at all,
+// and whether Plaid Link is known to support it. A code plaid-cli doesn't
+// know is still sent to Plaid, which has the final say, so a language Plaid
+// adds works without a new release of plaid-cli.
+func CheckPlaidLanguage(lang string) (bool, error) {
+	if sliceToMap(plaidLinkLanguages)[lang] {
+		return true, nil
+	}
+	base, err := language.ParseBase(lang)
+	if err != nil || base.String() != lang {
+		return false, fmt.Errorf("%q isn't a two-letter language code. Plaid Link supports: %s", lang, strings.Join(plaidLinkLanguages, ", "))
+	}
+	return false, nil
+}
+
+// CheckPlaidCountry returns an error if code isn't a country code at all,
+// and whether Plaid is known to support it, from plaid-go's CountryCode.
+// Like languages, countries Plaid adds are sent to it before plaid-go
+// knows them.
+func CheckPlaidCountry(code string) (bool, error) {
+	if plaid.CountryCode(code).IsValid() {
+		return true, nil
+	}
+	if code == "UK" {
+		return false, fmt.Errorf("use GB rather than UK for the United Kingdom")
+	}
+	region, err := language.ParseRegion(code)
+	if err != nil || !region.IsCountry() || region.String() != code {
+		return false, fmt.Errorf("%q isn't a two-letter country code, such as US, GB or FR. Plaid's countries are listed at https://plaid.com/global/", code)
+	}
+	return false, nil
+}
+
+// DefaultPlaidLocale returns the country and Link language to use when
+// they aren't configured: the system's, if Plaid supports them, or else
+// the US and English.
+func DefaultPlaidLocale(tag language.Tag) (string, string) {
+	country := "US"
+	if region, _ := tag.Region(); region.IsCountry() && plaid.CountryCode(region.String()).IsValid() {
+		country = region.String()
+	}
+	lang := "en"
+	if base, _ := tag.Base(); sliceToMap(plaidLinkLanguages)[base.String()] {
+		lang = base.String()
+	}
+	return country, lang
+}
@@ -1,23 +1,29 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
 	"os"
-	"os/user"
+	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/landakram/plaid-cli/pkg/plaid_cli"
 	"github.com/manifoldco/promptui"
 	"github.com/plaid/plaid-go/v26/plaid"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/spf13/viper"
 
@@ -33,146 +39,218 @@ func sliceToMap(slice []string) map[string]bool {
 	return set
 }
 
-var plaidSupportedLanguages = []string{"en", "fr", "es", "nl"}
+// standaloneAnnotation marks commands that work without Plaid credentials or
+// linked items, so setup is skipped for them.
+const standaloneAnnotation = "standalone"
 
-func IsValidLanguageCode(lang string) bool {
-	supportedLanguages := sliceToMap(plaidSupportedLanguages)
-	return supportedLanguages[lang]
-}
+// mutatingAnnotation marks commands that change state at Plaid or write
+// access tokens, which read-only mode refuses to run.
+const mutatingAnnotation = "mutating"
 
 func main() {
 	log.SetFlags(0)
+	log.SetOutput(NewDecoratedWriter(os.Stderr, decoration))
+
+	// Environment variables are read before the config file, so that
+	// CLI_DATA_DIR can say where to find it.
+	viper.SetEnvPrefix("")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+	viper.AutomaticEnv()
 
-	usr, _ := user.Current()
-	dir := usr.HomeDir
-	viper.SetDefault("cli.data_dir", filepath.Join(dir, ".plaid-cli"))
+	viper.SetDefault("cli.data_dir", defaultDataDir())
 
 	dataDir := viper.GetString("cli.data_dir")
-	data, err := plaid_cli.LoadData(dataDir)
-
-	if err != nil {
-		log.Fatal(err)
-	}
 
 	viper.SetConfigName("config")
 	viper.SetConfigType("toml")
 	viper.AddConfigPath(dataDir)
 	viper.AddConfigPath(".")
-	allowedErr := viper.ConfigFileNotFoundError{}
-	err = viper.ReadInConfig()
-	if err != nil && !errors.Is(err, allowedErr) {
-		log.Fatal(err)
+	var notFoundErr viper.ConfigFileNotFoundError
+	err := viper.ReadInConfig()
+	if err != nil && !errors.As(err, &notFoundErr) {
+		FatalConfig(err.Error())
 	}
-
-	viper.SetEnvPrefix("")
-	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
-	viper.AutomaticEnv()
-
 	tag, err := locale.Detect()
 	if err != nil {
 		tag = language.AmericanEnglish
 	}
 
-	region, _ := tag.Region()
 	base, _ := tag.Base()
-
-	var country string
-	if region.IsCountry() {
-		country = region.String()
-	} else {
-		country = "US"
-	}
-
-	lang := base.String()
+	country, lang := DefaultPlaidLocale(tag)
 
 	viper.SetDefault("plaid.countries", []string{country})
 	countriesOpt := viper.GetStringSlice("plaid.countries")
 	var countries []plaid.CountryCode
 	for _, c := range countriesOpt {
 		uc := strings.ToUpper(c)
-		cc, err := plaid.NewCountryCodeFromValue(uc)
+		known, err := CheckPlaidCountry(uc)
 		if err != nil {
-			log.Fatalf("⚠️  Invalid country code %s. Please configure `plaid.countries` (using an envvar, PLAID_COUNTRIES, or in plaid-cli's config file) to a subset of countries that Plaid supports: %v\n", c, err)
+			FatalConfig(fmt.Sprintf("⚠️  Invalid country code %s in `plaid.countries` (set using an envvar, PLAID_COUNTRIES, or in plaid-cli's config file): %v", c, err))
+		}
+		if !known {
+			log.Printf("⚠️  plaid-go doesn't list %s as a country Plaid supports, so Plaid will decide whether it's supported.\n", uc)
 		}
-		countries = append(countries, *cc)
+		countries = append(countries, plaid.CountryCode(uc))
 	}
 
 	viper.SetDefault("plaid.language", lang)
 	lang = viper.GetString("plaid.language")
 
-	if !IsValidLanguageCode(lang) {
-		log.Fatalln("⚠️  Invalid language code. Please configure `plaid.language` (using an envvar, PLAID_LANGUAGE, or in plaid-cli's config file) to a language that Plaid supports. Plaid supports the following languages: ", plaidSupportedLanguages)
+	// A language plaid-cli doesn't list is still sent to Plaid, which has the
+	// final say. auth-check shows whether Plaid accepts it.
+	_, err = CheckPlaidLanguage(lang)
+	if err != nil {
+		FatalConfig(fmt.Sprintf("⚠️  Invalid language code in `plaid.language` (set using an envvar, PLAID_LANGUAGE, or in plaid-cli's config file): %v", err))
 	}
 
-	viper.SetDefault("plaid.environment", "development")
-	plaidEnvStr := strings.ToLower(viper.GetString("plaid.environment"))
+	if baseURL := viper.GetString("plaid.base_url"); baseURL != "" {
+		err = CheckBaseURL(baseURL)
+		if err != nil {
+			FatalConfig(fmt.Sprintf("⚠️  Invalid `plaid.base_url` (set using an envvar, PLAID_BASE_URL, or in plaid-cli's config file): %v", err))
+		}
+	}
 
-	var plaidEnv plaid.Environment
-	switch plaidEnvStr {
-	case "sandbox":
-		plaidEnv = plaid.Sandbox
-	case "production":
-		plaidEnv = plaid.Production
-	default:
-		log.Fatalln("Invalid plaid environment. Valid plaid environments are 'sandbox' or 'production'.")
+	if apiVersion := viper.GetString("plaid.api_version"); apiVersion != "" {
+		err = CheckAPIVersion(apiVersion)
+		if err != nil {
+			FatalConfig(fmt.Sprintf("⚠️  Invalid `plaid.api_version` (set using an envvar, PLAID_API_VERSION, or in plaid-cli's config file): %v", err))
+		}
+	}
+
+	// plaid-cli's own messages default to the detected locale too, falling
+	// back to English.
+	if IsValidCLILanguage(base.String()) {
+		viper.SetDefault("cli.language", base.String())
+	} else {
+		viper.SetDefault("cli.language", "en")
+	}
+	cliLang := viper.GetString("cli.language")
+	if !IsValidCLILanguage(cliLang) {
+		FatalConfig(fmt.Sprint("⚠️  Invalid language code. Please configure `cli.language` (using an envvar, CLI_LANGUAGE, or in plaid-cli's config file) to one of: ", cliLanguages))
+	}
+	SetLanguage(cliLang)
+
+	viper.SetDefault("cli.consent_warning_days", 7)
+	viper.SetDefault("smtp.port", "587")
+	viper.SetDefault("cli.auto_relink", true)
+	viper.SetDefault("cli.audit", true)
+	viper.SetDefault("cli.audit_retention_days", 365)
+	viper.SetDefault("cli.history", true)
+	viper.SetDefault("cli.history_retention_days", 365)
+	viper.SetDefault("cli.token_key_file", defaultTokenKeyFile())
+	viper.SetDefault("cli.page_size", 100)
+	viper.SetDefault("cli.plain_output", false)
+	viper.SetDefault("cli.archive_missing_accounts", false)
+	viper.SetDefault("webhooks.verify", true)
+	viper.SetDefault("household.name", "me")
+	viper.SetDefault("savings_rate.income_categories", []string{"INCOME"})
+	viper.SetDefault("cli.retries", 3)
+	viper.SetDefault("cli.request_timeout", "2m")
+
+	viper.SetDefault("plaid.environment", "sandbox")
+
+	var products []plaid.Products
+	for _, p := range viper.GetStringSlice("plaid.products") {
+		product, err := plaid.NewProductsFromValue(strings.ToLower(p))
+		if err != nil {
+			FatalConfig(fmt.Sprintf("⚠️  Invalid product %s. Please configure `plaid.products` (using an envvar, PLAID_PRODUCTS, or in plaid-cli's config file) to products that Plaid supports: %v", p, err))
+		}
+		products = append(products, *product)
 	}
 
-	clientId := viper.GetString("plaid.client_id")
-	secret := viper.GetString("plaid.secret")
+	app := NewApp(dataDir, countries, lang, products)
 
-	conf := plaid.NewConfiguration()
-	conf.AddDefaultHeader("PLAID-CLIENT-ID", clientId)
-	conf.AddDefaultHeader("PLAID-SECRET", secret)
-	conf.UseEnvironment(plaidEnv)
-	client := plaid.NewAPIClient(conf).PlaidApi
+	rootCommand := newRootCommand(app)
 
+	atExit = func(code int) {
+		_ = app.History.Finish(code)
+	}
+	err = rootCommand.ExecuteContext(WithApp(context.Background(), app))
 	if err != nil {
-		log.Fatal(err)
+		Fatal(err)
 	}
+}
+
+// newRootCommand builds plaid-cli's commands for running with app. Flags that
+// set app's fields are bound to it, so the commands must be run with the
+// same App, attached with WithApp.
+func newRootCommand(app *App) *cobra.Command {
+	var err error
 
-	linker := plaid_cli.NewLinker(data, client, countries, lang)
+	var outputOpts OutputOptions
+	var emailOpts EmailOptions
+	var includeIgnoredFlag bool
+	var withAccountDetailsFlag bool
+	var columnsFlag []string
+	var anonymizeFlag bool
+	var typedFlag bool
+	var transactionFilter TransactionFilter
 
+	var linkTunnelFlag string
 	linkCommand := &cobra.Command{
-		Use:   "link [ITEM-ID-OR-ALIAS]",
-		Short: "Link an institution so plaid-cli can pull transactions",
-		Long:  "Link an institution so plaid-cli can pull transactions. An item ID or alias can be passed to initiate a relink.",
-		Args:  cobra.MaximumNArgs(1),
+		Use:         "link [ITEM-ID-OR-ALIAS]",
+		Short:       T("Link an institution so plaid-cli can pull transactions"),
+		Long:        "Link an institution so plaid-cli can pull transactions. An item ID or alias can be passed to relink it whatever its status; `plaid-cli item relink` only relinks institutions that need it.\n\nInstitutions that log in with OAuth need a redirect URI registered with Plaid. With --tunnel, a public URL is made with ngrok or cloudflared, and OAuth institutions redirect to its /oauth page, which sends the browser back to Link on localhost. Nothing else is served through the tunnel.",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{mutatingAnnotation: "true"},
 		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
 			port := viper.GetString("link.port")
 
+			if linkTunnelFlag != "" {
+				tunnel, err := StartTunnel(linkTunnelFlag, port)
+				if err != nil {
+					Fatal(err)
+				}
+				defer tunnel.Close()
+				app.Linker.PublicURL = tunnel.URL
+				log.Printf("Plaid only redirects to registered URIs. If %s/oauth isn't one, add it under Allowed redirect URIs at https://dashboard.plaid.com/developers/api.", tunnel.URL)
+			}
+
 			var tokenPair *plaid_cli.TokenPair
 
 			var err error
 
 			if len(args) > 0 && len(args[0]) > 0 {
-				itemOrAlias := args[0]
-
-				itemID, ok := data.Aliases[itemOrAlias]
-				if ok {
-					itemOrAlias = itemID
+				var itemID string
+				itemID, err = app.ResolveItem(args[0])
+				if err != nil {
+					Fatal(err)
 				}
 
-				err = linker.Relink(itemOrAlias, port)
-				if err == nil {
-					log.Println("Institution relinked!")
+				err = app.Linker.Relink(itemID, port)
+				if errors.Is(err, plaid_cli.ErrDryRun) {
+					return
+				}
+				if err != nil {
+					Fatal(err)
 				}
+				log.Println("Institution relinked!")
+				return
 			} else {
-				tokenPair, err = linker.Link(port)
+				tokenPair, err = app.Linker.Link(port)
+				if errors.Is(err, plaid_cli.ErrDryRun) {
+					return
+				}
 				if err != nil {
-					log.Fatalln(err)
+					Fatal(err)
+				}
+				app.Data.Tokens[tokenPair.ItemID] = tokenPair.AccessToken
+				err = app.Data.Save()
+				if err != nil {
+					Fatal(err)
 				}
-				data.Tokens[tokenPair.ItemID] = tokenPair.AccessToken
-				err = data.Save()
-			}
 
-			if err != nil {
-				log.Fatalln(err)
+				err = RefreshConsentExpiration(app.Data, app.Client, tokenPair.ItemID)
+				if err != nil {
+					log.Printf("Failed to check consent expiration: %v\n", err)
+				}
 			}
 
 			log.Println("Institution linked!")
 			log.Printf("Item ID: %s\n", tokenPair.ItemID)
 
-			if alias, ok := data.BackAliases[tokenPair.ItemID]; ok {
+			if alias, ok := app.Data.BackAliases[tokenPair.ItemID]; ok {
 				log.Printf("Alias: %s\n", alias)
 				return
 			}
@@ -198,13 +276,13 @@ func main() {
 
 			input, err := prompt.Run()
 			if err != nil {
-				log.Fatalln(err)
+				Fatal(err)
 			}
 
 			if input != "" {
-				err = SetAlias(data, tokenPair.ItemID, input)
+				err = SetAlias(app.Data, tokenPair.ItemID, input)
 				if err != nil {
-					log.Fatalln(err)
+					Fatal(err)
 				}
 			}
 		},
@@ -213,16 +291,71 @@ func main() {
 	linkCommand.Flags().StringP("port", "p", "8080", "Port on which to serve Plaid Link")
 	err = viper.BindPFlag("link.port", linkCommand.Flags().Lookup("port"))
 	if err != nil {
-		log.Fatalln(err)
+		Fatal(err)
+	}
+	AddTunnelFlag(linkCommand, &linkTunnelFlag)
+	linkCommand.Flags().BoolVar(&app.Linker.Resume, "resume", false, "Resume an interrupted Link session with its link token, if it hasn't expired, instead of starting a new one")
+
+	var relinkAllBrokenFlag bool
+	var relinkTunnelFlag string
+	relinkCommand := &cobra.Command{
+		Use:         "relink [ITEM-ID-OR-ALIAS]...",
+		Short:       T("Relink institutions whose login needs fixing"),
+		Long:        "Check the status of the named institutions, or all of them with --all-broken, and open Plaid Link to log in again to those whose login has expired, is locked or whose username has changed. Healthy institutions are left alone. A table of which institutions were fixed is printed at the end, and the command exits with code 6 if only some of them could be.",
+		Annotations: map[string]string{mutatingAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, err := app.ResolveItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+			if relinkAllBrokenFlag {
+				itemIDs = SortedItemIDs(app.Data)
+			}
+			if len(itemIDs) == 0 {
+				FatalUsage("Name the institutions to relink, or use --all-broken to relink every one that needs it.")
+			}
+
+			if relinkTunnelFlag != "" {
+				tunnel, err := StartTunnel(relinkTunnelFlag, viper.GetString("link.port"))
+				if err != nil {
+					Fatal(err)
+				}
+				defer tunnel.Close()
+				app.Linker.PublicURL = tunnel.URL
+				log.Printf("Plaid only redirects to registered URIs. If %s/oauth isn't one, add it under Allowed redirect URIs at https://dashboard.plaid.com/developers/api.", tunnel.URL)
+			}
+
+			results := RelinkItems(app.Client, app.Linker, itemIDs, viper.GetString("link.port"))
+
+			err = WriteRelinkResults(os.Stdout, app.Data, results)
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = RelinkError(results)
+			if err != nil {
+				Fatal(err)
+			}
+		},
 	}
+	relinkCommand.Flags().BoolVar(&relinkAllBrokenFlag, "all-broken", false, "Check every linked institution and relink the ones that need it")
+	AddTunnelFlag(relinkCommand, &relinkTunnelFlag)
+	relinkCommand.Flags().BoolVar(&app.Linker.Resume, "resume", false, "Resume interrupted Link sessions with their link tokens, if they haven't expired, instead of starting new ones")
 
 	tokensCommand := &cobra.Command{
 		Use:   "tokens",
-		Short: "List access tokens",
+		Short: T("List access tokens"),
+		Long:  "List access tokens by item alias or ID. Tokens are masked unless you pass --unmask and confirm.",
 		Run: func(cmd *cobra.Command, args []string) {
-			resolved := make(map[string]string, len(data.Tokens))
-			for itemID, token := range data.Tokens {
-				if alias, ok := data.BackAliases[itemID]; ok {
+			app := AppFrom(cmd)
+			resolved := make(map[string]string, len(app.Data.Tokens))
+			for itemID, token := range app.Data.Tokens {
+				token, err := app.Mask.Mask("access tokens", token)
+				if err != nil {
+					Fatal(err)
+				}
+				if alias, ok := app.Data.BackAliases[itemID]; ok {
 					resolved[alias] = token
 				} else {
 					resolved[itemID] = token
@@ -231,336 +364,3887 @@ func main() {
 
 			printJSON, err := json.MarshalIndent(resolved, "", "  ")
 			if err != nil {
-				log.Fatalln(err)
+				Fatal(err)
 			}
 			fmt.Println(string(printJSON))
 		},
 	}
 
-	aliasCommand := &cobra.Command{
-		Use:   "alias [ITEM-ID] [NAME]",
-		Short: "Give a linked institution a friendly name",
-		Long:  "Give a linked institution a friendly name. You can use this name instead of the idem ID in most commands.",
-		Args:  cobra.ExactArgs(2),
+	var itemsJSONFlag bool
+	var itemsIDsOnlyFlag bool
+	var itemsOutputFormat string
+	var itemsFilterFlags []string
+	var itemsCheckOAuthFlag bool
+	itemsCommand := &cobra.Command{
+		Use:   "list",
+		Short: T("List linked institutions and their health"),
+		Long:  "List linked institutions with their alias, institution name, item ID, environment, products, health and when Plaid last synced their transactions. Institutions whose login has expired are reported, not relinked. Institutions Plaid has said it will disconnect because they're moving to OAuth, and so have to be relinked with a redirect URI, are warned about. With --check-oauth, institutions that may have an OAuth version are mentioned too.",
+		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			itemID := args[0]
-			alias := args[1]
+			app := AppFrom(cmd)
+			itemIDs, _, err := app.SelectItems(nil)
+			if err != nil {
+				Fatal(err)
+			}
+
+			format := itemsOutputFormat
+			if itemsJSONFlag {
+				format = "json"
+			}
+			if itemsIDsOnlyFlag {
+				format = "ids"
+			}
 
-			err := SetAlias(data, itemID, alias)
+			disconnects, err := PendingDisconnects(app.Webhooks, time.Now())
 			if err != nil {
-				log.Fatalln(err)
+				Fatal(err)
+			}
+			items := ListItems(app.Client, app.Data, itemIDs, app.Countries, disconnects, itemsCheckOAuthFlag)
+			WarnOAuthMigrations(items)
+			items, err = FilterItems(items, itemsFilterFlags)
+			if err != nil {
+				Fatal(err)
+			}
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteItems(w, items, format)
+			})
+			if err != nil {
+				Fatal(err)
 			}
 		},
 	}
+	itemsCommand.Flags().StringVarP(&itemsOutputFormat, "output-format", "o", "table", "Output format (table, json or ids)")
+	itemsCommand.Flags().BoolVar(&itemsJSONFlag, "json", false, "Print JSON instead of a table")
+	err = itemsCommand.Flags().MarkDeprecated("json", "use -o json instead")
+	if err != nil {
+		Fatal(err)
+	}
+	itemsCommand.Flags().BoolVar(&itemsIDsOnlyFlag, "ids-only", false, "Print only item IDs, one per line, e.g. to pipe into another command's --stdin-items")
+	itemsCommand.Flags().BoolVar(&itemsCheckOAuthFlag, "check-oauth", false, "Look up whether each institution may have an OAuth version, with a search request per institution")
+	itemsCommand.Flags().StringArrayVar(&itemsFilterFlags, "filter", nil, "Only list items matching KEY=VALUE: status=ok, status=error or an error code, owner=NAME or product=PRODUCT. Repeat to match several")
+	AddOutputFlags(itemsCommand, &outputOpts)
 
-	aliasesCommand := &cobra.Command{
-		Use:   "aliases",
-		Short: "List aliases",
+	itemCommand := &cobra.Command{
+		Use:   "item",
+		Short: T("Link and manage institutions"),
+	}
+
+	itemSetOwnerCommand := &cobra.Command{
+		Use:   "set-owner ITEM-ID-OR-ALIAS [OWNER]",
+		Short: "Record who a linked institution belongs to",
+		Long:  "Record who a linked institution belongs to, so reports and exports can be filtered with --owner or grouped by owner. Leave out OWNER to remove it.",
+		Args:  cobra.RangeArgs(1, 2),
 		Run: func(cmd *cobra.Command, args []string) {
-			printJSON, err := json.MarshalIndent(data.Aliases, "", "  ")
+			app := AppFrom(cmd)
+			itemID, err := app.ResolveItem(args[0])
 			if err != nil {
-				log.Fatalln(err)
+				Fatal(err)
+			}
+			owner := ""
+			if len(args) > 1 {
+				owner = strings.TrimSpace(args[1])
+			}
+
+			if app.DryRun {
+				log.Printf("Dry run: would set the owner of %s to %q.\n", ItemName(app.Data, itemID), owner)
+				return
+			}
+
+			err = SetItemOwner(app.Data, itemID, owner)
+			if err != nil {
+				Fatal(err)
 			}
-			fmt.Println(string(printJSON))
 		},
 	}
+	itemCommand.AddCommand(itemSetOwnerCommand)
 
-	accountsCommand := &cobra.Command{
-		Use:   "accounts [ITEM-ID-OR-ALIAS]",
-		Short: "List accounts for a given institution",
-		Long:  "List accounts for a given institution. An account ID returned from this command can be used as a filter when listing transactions.",
-		Args:  cobra.ExactArgs(1),
+	importCommand := &cobra.Command{
+		Use:   "import",
+		Short: T("Import transactions from outside Plaid"),
+	}
+
+	var importAccountFlag string
+	var importMappingFlag string
+	var importReplaceFlag bool
+	importCSVCommand := &cobra.Command{
+		Use:   "csv FILE",
+		Short: "Import transactions from a CSV file into a manual account",
+		Long: `Import transactions from a CSV file, or stdin if FILE is -, into a manual account such as manual:cash, for spending Plaid can't see: cash, or a bank Plaid doesn't support. Imported transactions are included in reports that cover every linked institution.
+
+Columns are read with the mapping named by --mapping under [import.mappings] in the config file, or Date, Description and Amount columns by default. Amounts are positive for money going out, as Plaid's are; set negate in the mapping for files where spending is negative. Importing the same rows again doesn't duplicate them.`,
+		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			itemOrAlias := args[0]
-			itemID, ok := data.Aliases[itemOrAlias]
-			if ok {
-				itemOrAlias = itemID
+			app := AppFrom(cmd)
+			err := ValidateManualAccount(importAccountFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			mapping, err := ImportMappingFromViper(importMappingFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			txs, err := ReadImportCSV(args[0], importAccountFlag, mapping)
+			if err != nil {
+				Fatal(err)
 			}
 
-			err := WithRelinkOnAuthError(itemOrAlias, linker, func() error {
-				token := data.Tokens[itemOrAlias]
-				ctx := context.Background()
-				req := plaid.NewAccountsGetRequest(token)
-				apiReq := client.AccountsGet(ctx)
-				apiReq = apiReq.AccountsGetRequest(*req)
-				res, _, err := apiReq.Execute()
-				if err != nil {
-					return err
-				}
+			if app.DryRun {
+				log.Printf("Dry run: would import %d transactions into %s.\n", len(txs), importAccountFlag)
+				return
+			}
+
+			added, err := ImportTransactions(app.Data, importAccountFlag, txs, importReplaceFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			log.Printf("Imported %d new transactions into %s (%d already imported).\n", added, importAccountFlag, len(txs)-added)
+			app.History.AddRows(added)
+		},
+	}
+	importCSVCommand.Flags().StringVar(&importAccountFlag, "account", "", "Manual account to import into, e.g. manual:cash (required)")
+	importCSVCommand.Flags().StringVar(&importMappingFlag, "mapping", "", "Column mapping to read the file with, from [import.mappings] in the config file")
+	importCSVCommand.Flags().BoolVar(&importReplaceFlag, "replace", false, "Replace the account's imported transactions instead of adding to them")
+	err = importCSVCommand.MarkFlagRequired("account")
+	if err != nil {
+		Fatal(err)
+	}
+	importCommand.AddCommand(importCSVCommand)
+
+	manualCommand := &cobra.Command{
+		Use:   "manual",
+		Short: T("Track accounts Plaid can't link, such as a house or car"),
+	}
 
-				b, err := json.MarshalIndent(res.Accounts, "", "  ")
+	var manualDateFlag string
+	var manualTypeFlag string
+	var manualCurrencyFlag string
+	manualSetBalanceCommand := &cobra.Command{
+		Use:   "set-balance NAME AMOUNT",
+		Short: "Record a manual account's balance",
+		Long:  "Record the balance of a manually tracked account, such as a house, car or cash, creating the account if it's new. Manual accounts are named like manual:house (the manual: prefix can be left out) and appear in `balances` and `report net-worth` alongside linked accounts. Use --type credit or --type loan for something owed, such as a mortgage.",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			id, err := ManualAccountID(args[0])
+			if err != nil {
+				Fatal(err)
+			}
+			balance, err := plaid_cli.ParseMoney(args[1])
+			if err != nil {
+				FatalUsage(fmt.Sprintf("Invalid amount %q.", args[1]))
+			}
+			day := time.Now()
+			if manualDateFlag != "" {
+				day, err = time.Parse("2006-01-02", manualDateFlag)
 				if err != nil {
-					return err
+					FatalUsage("Invalid --date. Use YYYY-MM-DD.")
 				}
+			}
 
-				fmt.Println(string(b))
+			if app.DryRun {
+				log.Printf("Dry run: would set the balance of %s to %.2f on %s.\n", id, balance, day.Format("2006-01-02"))
+				return
+			}
 
-				return nil
-			})
+			err = SetManualBalance(app.Data, id, balance, day, manualTypeFlag, manualCurrencyFlag)
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	manualSetBalanceCommand.Flags().StringVar(&manualDateFlag, "date", "", "Day the balance applies from (default today)")
+	manualSetBalanceCommand.Flags().StringVar(&manualTypeFlag, "type", "", "Account type: depository, investment, credit, loan or other (default other for new accounts)")
+	manualSetBalanceCommand.Flags().StringVar(&manualCurrencyFlag, "currency", "", "ISO currency code of the balance, e.g. USD")
 
+	var manualListOutputFormat string
+	manualListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List manual accounts and their latest balances",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			err := WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteBalances(w, []ItemAccounts{ManualAccounts(app.Data)}, manualListOutputFormat)
+			})
 			if err != nil {
-				log.Fatalln(err)
+				Fatal(err)
 			}
 		},
 	}
+	manualListCommand.Flags().StringVarP(&manualListOutputFormat, "output-format", "o", "table", "Output format (json or table)")
+	AddOutputFlags(manualListCommand, &outputOpts)
 
-	var fromFlag string
-	var toFlag string
-	var accountID string
-	var outputFormat string
-	transactionsCommand := &cobra.Command{
-		Use:   "transactions [ITEM-ID-OR-ALIAS]",
-		Short: "List transactions for a given institution",
+	manualRemoveCommand := &cobra.Command{
+		Use:   "remove NAME",
+		Short: "Remove a manual account and its balance history",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			itemOrAlias := args[0]
-			itemID, ok := data.Aliases[itemOrAlias]
-			if ok {
-				itemOrAlias = itemID
+			app := AppFrom(cmd)
+			id, err := ManualAccountID(args[0])
+			if err != nil {
+				Fatal(err)
 			}
 
-			err := WithRelinkOnAuthError(itemOrAlias, linker, func() error {
-				token := data.Tokens[itemOrAlias]
-
-				var accountIDs []string
-				if len(accountID) > 0 {
-					accountIDs = append(accountIDs, accountID)
-				}
-				count := int32(100)
-				offset := int32(0)
-
-				req := plaid.NewTransactionsGetRequest(token, fromFlag, toFlag)
-				req.SetOptions(plaid.TransactionsGetRequestOptions{
-					AccountIds: &accountIDs,
-					Count:      &count,
-					Offset:     &offset,
-				})
-
-				transactions, err := AllTransactions(*req, client)
-				if err != nil {
-					return err
-				}
-
-				serializer, err := NewTransactionSerializer(outputFormat)
-				if err != nil {
-					return err
-				}
+			if app.DryRun {
+				log.Printf("Dry run: would remove %s.\n", id)
+				return
+			}
 
-				b, err := serializer.serialize(transactions)
-				if err != nil {
-					return err
-				}
+			err = RemoveManualAccount(app.Data, id)
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	manualCommand.AddCommand(manualSetBalanceCommand)
+	manualCommand.AddCommand(manualListCommand)
+	manualCommand.AddCommand(manualRemoveCommand)
 
-				fmt.Println(string(b))
+	aliasCommand := &cobra.Command{
+		Use:   "alias [ITEM-ID] [NAME]",
+		Short: T("Give a linked institution a friendly name"),
+		Long:  "Give a linked institution a friendly name. You can use this name instead of the idem ID in most commands.",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemID := args[0]
+			alias := args[1]
 
-				return nil
-			})
+			if app.DryRun {
+				log.Printf("Dry run: would alias %s to %s.\n", itemID, alias)
+				return
+			}
 
+			err := SetAlias(app.Data, itemID, alias)
 			if err != nil {
-				log.Fatalln(err)
+				Fatal(err)
 			}
 		},
 	}
-	transactionsCommand.Flags().StringVarP(&fromFlag, "from", "f", "", "Date of first transaction (required)")
-	err = transactionsCommand.MarkFlagRequired("from")
-	if err != nil {
-		log.Fatalln(err)
+
+	aliasesCommand := &cobra.Command{
+		Use:   "aliases",
+		Short: T("List aliases"),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			printJSON, err := json.MarshalIndent(app.Data.Aliases, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(printJSON))
+		},
 	}
 
-	transactionsCommand.Flags().StringVarP(&toFlag, "to", "t", "", "Date of last transaction (required)")
-	err = transactionsCommand.MarkFlagRequired("to")
-	if err != nil {
-		log.Fatalln(err)
+	var removeIgnoreFlag bool
+	ignoreCommand := &cobra.Command{
+		Use:   "ignore",
+		Short: T("Exclude transactions or accounts from reports and exports"),
+		Long:  "Exclude transactions, such as refunds or test transactions, or whole accounts, such as an old closed account, from reports and exports. Pass --include-ignored to those commands to see everything.",
 	}
+	newIgnoreCommand := func(kind string) *cobra.Command {
+		return &cobra.Command{
+			Use:   fmt.Sprintf("%s [%s-ID]...", kind, strings.ToUpper(kind)),
+			Short: fmt.Sprintf("Ignore a %s in reports and exports", kind),
+			Args:  cobra.MinimumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				app := AppFrom(cmd)
+				if app.DryRun {
+					action := "ignore"
+					if removeIgnoreFlag {
+						action = "stop ignoring"
+					}
+					log.Printf("Dry run: would %s %s %s.\n", action, kind, strings.Join(args, ", "))
+					return
+				}
 
-	transactionsCommand.Flags().StringVarP(&outputFormat, "output-format", "o", "json", "Output format")
-	transactionsCommand.Flags().StringVarP(&accountID, "account-id", "a", "", "Fetch transactions for this account ID only.")
+				err := UpdateIgnored(app.Data, kind, args, removeIgnoreFlag)
+				if err != nil {
+					Fatal(err)
+				}
+			},
+		}
+	}
+	ignoreTransactionCommand := newIgnoreCommand("transaction")
+	ignoreTransactionCommand.Flags().BoolVar(&removeIgnoreFlag, "remove", false, "Stop ignoring the transactions")
+	ignoreAccountCommand := newIgnoreCommand("account")
+	ignoreAccountCommand.Flags().BoolVar(&removeIgnoreFlag, "remove", false, "Stop ignoring the accounts")
 
-	var withStatusFlag bool
-	var withOptionalMetadataFlag bool
-	insitutionCommand := &cobra.Command{
-		Use:   "institution [ITEM-ID-OR-ALIAS]",
-		Short: "Get information about an institution",
-		Long:  "Get information about an institution. Status can be reported using a flag.",
-		Args:  cobra.ExactArgs(1),
+	var ignoredOutputFormat string
+	ignoreListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List ignored transactions and accounts",
+		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			itemOrAlias := args[0]
-			itemID, ok := data.Aliases[itemOrAlias]
-			if ok {
-				itemOrAlias = itemID
+			app := AppFrom(cmd)
+			err := WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteIgnored(w, IgnoredEntries(app.Data.Ignored), ignoredOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
 			}
+		},
+	}
+	ignoreListCommand.Flags().StringVarP(&ignoredOutputFormat, "output-format", "o", "table", "Output format (table or json)")
+	AddOutputFlags(ignoreListCommand, &outputOpts)
 
-			err := WithRelinkOnAuthError(itemOrAlias, linker, func() error {
-				token := data.Tokens[itemOrAlias]
+	ignoreCommand.AddCommand(ignoreTransactionCommand)
+	ignoreCommand.AddCommand(ignoreAccountCommand)
+	ignoreCommand.AddCommand(ignoreListCommand)
 
-				itemReq := plaid.NewItemGetRequest(token)
-				ctx := context.Background()
-				itemApiReq := client.ItemGet(ctx)
-				itemApiReq = itemApiReq.ItemGetRequest(*itemReq)
-				itemResp, _, err := itemApiReq.Execute()
+	var removeSplitFlag bool
+	splitCommand := &cobra.Command{
+		Use:   "split [TRANSACTION-ID] [AMOUNT=CATEGORY]...",
+		Short: T("Split a transaction into categorized parts"),
+		Long:  "Split a transaction into parts with their own categories, e.g. `plaid-cli transactions split TX-ID 40=Groceries 20=Household`. Reports and exports count each part in its own category. The transaction must be one of the last two years' transactions, or an imported one. Any amount not covered by the parts keeps the transaction's category. With only a transaction ID, the current split is shown, and with no arguments every split is listed.",
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			if len(args) == 0 {
+				printJSON, err := json.MarshalIndent(app.Data.Splits, "", "  ")
 				if err != nil {
-					return err
+					Fatal(err)
 				}
+				fmt.Println(string(printJSON))
+				return
+			}
 
-				instID := *itemResp.Item.InstitutionId.Get()
-
-				req := plaid.NewInstitutionsGetByIdRequest(instID, countries)
-				req.SetOptions(plaid.InstitutionsGetByIdRequestOptions{
-					IncludeOptionalMetadata: &withOptionalMetadataFlag,
-					IncludeStatus:           &withStatusFlag,
-				})
-				apiReq := client.InstitutionsGetById(ctx)
-				apiReq = apiReq.InstitutionsGetByIdRequest(*req)
-				resp, _, err := apiReq.Execute()
+			txID := args[0]
+			if len(args) == 1 && !removeSplitFlag {
+				parts, ok := app.Data.Splits[txID]
+				if !ok {
+					Fatal(fmt.Errorf("Transaction %s isn't split.", txID))
+				}
+				printJSON, err := json.MarshalIndent(parts, "", "  ")
 				if err != nil {
-					return err
+					Fatal(err)
 				}
+				fmt.Println(string(printJSON))
+				return
+			}
 
-				b, err := json.MarshalIndent(resp.Institution, "", "  ")
+			if removeSplitFlag {
+				if len(args) > 1 {
+					FatalUsage("--remove takes only a transaction ID.")
+				}
+				if app.DryRun {
+					log.Printf("Dry run: would remove the split of %s.\n", txID)
+					return
+				}
+				delete(app.Data.Splits, txID)
+				err := app.Data.SaveSplits()
 				if err != nil {
-					return err
+					Fatal(err)
 				}
+				return
+			}
 
-				fmt.Println(string(b))
+			parts, err := ParseSplitParts(args[1:])
+			if err != nil {
+				Fatal(err)
+			}
 
-				return nil
-			})
+			itemIDs, _, err := app.SelectItems(nil)
+			if err != nil {
+				Fatal(err)
+			}
+			tx, err := FindTransaction(app.ItemClient, itemIDs, txID, time.Now(), app.Partial)
+			if err != nil {
+				Fatal(err)
+			}
+			var total plaid_cli.Money
+			for _, part := range parts {
+				total += part.Amount
+			}
+			if (plaid_cli.MoneyFromFloat(tx.Amount).Abs() - total).Round(2) < 0 {
+				FatalUsage(fmt.Sprintf("The parts add up to %s, more than the transaction's amount of %s.", total, plaid_cli.MoneyFromFloat(tx.Amount).Abs().Round(2)))
+			}
+
+			if app.DryRun {
+				log.Printf("Dry run: would split %s into %d parts.\n", txID, len(parts))
+				return
+			}
 
+			app.Data.Splits[txID] = parts
+			err = app.Data.SaveSplits()
 			if err != nil {
-				log.Fatalln(err)
+				Fatal(err)
+			}
+		},
+	}
+	splitCommand.Flags().BoolVar(&removeSplitFlag, "remove", false, "Remove the transaction's split")
+
+	var allAccountsFlag bool
+	var accountsOfflineFlag bool
+	var accountsOutputFormat string
+	var accountFilter AccountFilter
+	accountsCommand := &cobra.Command{
+		Use:   "accounts [ITEM-ID-OR-ALIAS]",
+		Short: T("List accounts for a given institution, or for all institutions"),
+		Long:  "List accounts for a given institution, or for all institutions when no item is given. An account ID returned from this command can be used as a filter when listing transactions. Accounts are cached as they are fetched; --offline lists them from the cache without calling Plaid.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			err := accountFilter.Validate()
+			if err != nil {
+				Fatal(err)
+			}
+
+			itemIDs, allItems, err := app.SelectItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+			if allAccountsFlag {
+				itemIDs = SortedItemIDs(app.Data)
+				allItems = true
+			}
+
+			format := accountsOutputFormat
+			if format == "" {
+				format = "json"
+				if allItems || len(itemIDs) > 1 {
+					format = "table"
+				}
+			}
+
+			var items []ItemAccounts
+			for _, itemID := range itemIDs {
+				if accountsOfflineFlag {
+					accounts, err := OfflineAccounts(app.Data, itemID)
+					if err != nil {
+						Fatal(err)
+					}
+					items = append(items, ItemAccounts{
+						Item:     ItemName(app.Data, itemID),
+						Accounts: accountFilter.Filter(accounts),
+					})
+					continue
+				}
+
+				err := app.ItemClient.Do(itemID, func(token string) error {
+					accounts, err := GetAccounts(app.Client, token)
+					if err != nil {
+						return err
+					}
+					err = CacheAccounts(app.Data, itemID, accounts)
+					if err != nil {
+						return err
+					}
+
+					items = append(items, ItemAccounts{
+						Item:     ItemName(app.Data, itemID),
+						Accounts: accountFilter.Filter(accounts),
+					})
+
+					return nil
+				})
+
+				if err != nil {
+					Fatal(err)
+				}
+			}
+
+			for _, item := range items {
+				app.History.AddRows(len(item.Accounts))
+			}
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteAccounts(w, items, format)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	AddOutputFlags(accountsCommand, &outputOpts)
+	accountsCommand.Flags().BoolVar(&allAccountsFlag, "all", false, "List accounts for all linked institutions")
+	accountsCommand.Flags().BoolVar(&accountsOfflineFlag, "offline", false, "List accounts cached from the last time they were fetched, without calling Plaid")
+	accountsCommand.Flags().StringVarP(&accountsOutputFormat, "output-format", "o", "", "Output format (json or table). Defaults to json for a single institution and table otherwise.")
+	accountsCommand.Flags().StringVar(&accountFilter.Type, "type", "", "Only list accounts of this type, e.g. depository or credit")
+	accountsCommand.Flags().StringVar(&accountFilter.Subtype, "subtype", "", "Only list accounts of this subtype, e.g. checking or \"credit card\"")
+
+	var balancesOutputFormat string
+	var balanceFilter AccountFilter
+	balancesCommand := &cobra.Command{
+		Use:   "balances [ITEM-ID-OR-ALIAS]",
+		Short: T("Get real-time balances for a given institution, or for all institutions"),
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			err := balanceFilter.Validate()
+			if err != nil {
+				Fatal(err)
+			}
+
+			itemIDs, all, err := app.SelectItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+
+			var items []ItemAccounts
+			for _, itemID := range itemIDs {
+				err := app.ItemClient.Do(itemID, func(token string) error {
+					accounts, err := GetBalances(app.Client, token)
+					if err != nil {
+						return err
+					}
+					err = CacheAccounts(app.Data, itemID, accounts)
+					if err != nil {
+						return err
+					}
+					err = RecordBalances(app.Data, itemID, accounts, time.Now())
+					if err != nil {
+						return err
+					}
+
+					items = append(items, ItemAccounts{
+						Item:     ItemName(app.Data, itemID),
+						Accounts: balanceFilter.Filter(accounts),
+					})
+
+					return nil
+				})
+
+				if err != nil {
+					Fatal(err)
+				}
+			}
+			if manual := ManualAccounts(app.Data); all && len(manual.Accounts) > 0 {
+				manual.Accounts = balanceFilter.Filter(manual.Accounts)
+				items = append(items, manual)
+			}
+
+			for _, item := range items {
+				app.History.AddRows(len(item.Accounts))
+			}
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteBalances(w, items, balancesOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	AddOutputFlags(balancesCommand, &outputOpts)
+	balancesCommand.Flags().StringVarP(&balancesOutputFormat, "output-format", "o", "table", "Output format (json or table)")
+	balancesCommand.Flags().StringVar(&balanceFilter.Type, "type", "", "Only include accounts of this type, e.g. depository or credit")
+	balancesCommand.Flags().StringVar(&balanceFilter.Subtype, "subtype", "", "Only include accounts of this subtype, e.g. checking or \"credit card\"")
+
+	var reconstructFromFlag string
+	var reconstructToFlag string
+	var reconstructOutputFormat string
+	balancesReconstructCommand := &cobra.Command{
+		Use:   "reconstruct [ACCOUNT]",
+		Short: "Estimate daily balances over a past period",
+		Long:  "Estimate each account's end-of-day balance for every day from --from to --to, working backwards from its current balance using the transactions posted since. ACCOUNT can be an account ID, mask or name; without it, every account is included. Use --item to limit the institutions searched.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			from, err := time.Parse("2006-01-02", reconstructFromFlag)
+			if err != nil {
+				FatalUsage("Invalid --from date. Use YYYY-MM-DD.")
+			}
+			to := truncateDay(time.Now())
+			if reconstructToFlag != "" {
+				to, err = time.Parse("2006-01-02", reconstructToFlag)
+				if err != nil {
+					FatalUsage("Invalid --to date. Use YYYY-MM-DD.")
+				}
+			}
+			if to.Before(from) {
+				FatalUsage("--to must not be before --from.")
+			}
+
+			var accountName string
+			if len(args) > 0 {
+				accountName = args[0]
+			}
+
+			itemIDs, _, err := app.SelectItems(nil)
+			if err != nil {
+				Fatal(err)
+			}
+
+			var balances []DailyBalance
+			for _, itemID := range itemIDs {
+				var accounts []plaid_cli.Account
+				err := app.ItemClient.Do(itemID, func(token string) error {
+					var err error
+					accounts, err = GetBalances(app.Client, token)
+					return err
+				})
+				if err != nil {
+					Fatal(err)
+				}
+
+				var matched []plaid_cli.Account
+				for _, account := range FilterAccounts(ActiveIgnores(app.Data, includeIgnoredFlag), accounts) {
+					if MatchAccount(account, accountName) {
+						matched = append(matched, account)
+					}
+				}
+				if len(matched) == 0 {
+					continue
+				}
+
+				// Balances are reconstructed from today backwards, so
+				// transactions are needed up to today whatever --to is.
+				txs, err := ReportTransactions(app.ItemClient, []string{itemID}, from, time.Now(), app.Partial)
+				if err != nil {
+					Fatal(err)
+				}
+
+				for _, account := range matched {
+					balances = append(balances, ReconstructBalances(ItemName(app.Data, itemID), account, txs, from, to)...)
+				}
+			}
+
+			if len(balances) == 0 && accountName != "" {
+				Fatal(fmt.Errorf("No account matching %q found.", accountName))
+			}
+
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteDailyBalances(w, balances, reconstructOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+			if err := app.Partial.Err(); err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	balancesReconstructCommand.Flags().StringVarP(&reconstructFromFlag, "from", "f", "", "First day to estimate a balance for (required)")
+	err = balancesReconstructCommand.MarkFlagRequired("from")
+	if err != nil {
+		Fatal(err)
+	}
+	balancesReconstructCommand.Flags().StringVarP(&reconstructToFlag, "to", "t", "", "Last day to estimate a balance for (default today)")
+	balancesReconstructCommand.Flags().StringVarP(&reconstructOutputFormat, "output-format", "o", "csv", "Output format (csv or json)")
+	AddOutputFlags(balancesReconstructCommand, &outputOpts)
+	AddIncludeIgnoredFlag(balancesReconstructCommand, &includeIgnoredFlag)
+	balancesCommand.AddCommand(balancesReconstructCommand)
+
+	var fromFlag string
+	var toFlag string
+	var requestOptions TransactionRequestOptions
+	var outputFormat string
+	var waitFlag time.Duration
+	var householdOpts HouseholdOptions
+	transactionsCommand := &cobra.Command{
+		Use:   "transactions [ITEM-ID-OR-ALIAS]",
+		Short: T("List transactions for a given institution"),
+		Long: `List transactions for a given institution. Use --item (repeatable, or --item all) to merge transactions from several institutions, labelled with the institution each came from.
+
+Some flags are sent to Plaid with the request, so only what's asked for is fetched: --from, --to, --account-id, --with-category, --with-original-description and --page-size. The rest (--check-number, --reference-number, --party and ignored transactions) filter what Plaid returns, so every transaction in the date range is still fetched.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, err := app.ResolveItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+			if len(itemIDs) == 0 && (householdOpts.Household || householdOpts.Owner != "") {
+				itemIDs = SortedItemIDs(app.Data)
+			}
+			if len(itemIDs) == 0 {
+				FatalUsage("An item ID or alias is required. Pass one as an argument or with --item.")
+			}
+
+			members, err := HouseholdMembers(app.Client, app.ItemClient, itemIDs, false, householdOpts)
+			if err != nil {
+				Fatal(err)
+			}
+
+			var transactions []plaid_cli.Transaction
+			accountItems := make(map[string]string)
+			accountLabels := make(map[string]string)
+			accountOwners := make(map[string]string)
+			for _, member := range members {
+				memberData := member.Client.Data
+				for _, itemID := range member.ItemIDs {
+					err := member.Client.Do(itemID, func(token string) error {
+						req := plaid.NewTransactionsGetRequest(token, fromFlag, toFlag)
+						req.SetOptions(requestOptions.Options())
+
+						var txs []plaid_cli.Transaction
+						err := WaitForProduct(waitFlag, func() error {
+							var err error
+							txs, err = AllTransactions(*req, app.Client)
+							return err
+						})
+						if err != nil && !(len(txs) > 0 && app.Partial.Tolerate(fmt.Errorf("%s: fetched %d transactions before: %w", ItemName(memberData, itemID), len(txs), err))) {
+							return err
+						}
+
+						for _, tx := range txs {
+							accountItems[tx.AccountID] = ItemName(memberData, itemID)
+							accountOwners[tx.AccountID] = member.Owner(itemID)
+						}
+						transactions = append(transactions, FilterTransactions(ActiveIgnores(memberData, includeIgnoredFlag), txs)...)
+
+						if withAccountDetailsFlag {
+							accounts, err := AccountMetadata(app.Client, memberData, itemID, token)
+							if err != nil {
+								return err
+							}
+							for id, label := range AccountLabels(accounts) {
+								accountLabels[id] = label
+							}
+						}
+						return nil
+					})
+					if err != nil {
+						err = fmt.Errorf("%s: %w", ItemName(memberData, itemID), err)
+						if app.Partial.Tolerate(err) {
+							continue
+						}
+						Fatal(err)
+					}
+				}
+			}
+			transactions = transactionFilter.Filter(ApplySplits(HouseholdSplits(members), transactions))
+			app.History.AddRows(len(transactions))
+
+			newSerializer := NewTransactionSerializer
+			if typedFlag {
+				newSerializer = NewTypedTransactionSerializer
+			}
+			serializer, err := newSerializer(outputFormat)
+			if err != nil {
+				Fatal(err)
+			}
+			if anonymizeFlag {
+				serializer, err = Anonymize(serializer)
+				if err != nil {
+					Fatal(err)
+				}
+			}
+			if len(itemIDs) > 1 || householdOpts.Household {
+				serializer.annotateItems(accountItems)
+			}
+			if withAccountDetailsFlag {
+				serializer.annotateAccounts(accountLabels)
+			}
+			if anyOwner(accountOwners) {
+				serializer.annotateOwners(accountOwners)
+			}
+			columns, err := ParseExtraColumns(columnsFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			serializer.addColumns(columns)
+
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return serializer.serialize(w, transactions)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+			if err := app.Partial.Err(); err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	transactionsCommand.Flags().StringVarP(&fromFlag, "from", "f", "", "Date of first transaction (required)")
+	err = transactionsCommand.MarkFlagRequired("from")
+	if err != nil {
+		Fatal(err)
+	}
+
+	transactionsCommand.Flags().StringVarP(&toFlag, "to", "t", "", "Date of last transaction (required)")
+	err = transactionsCommand.MarkFlagRequired("to")
+	if err != nil {
+		Fatal(err)
+	}
+
+	transactionsCommand.Flags().StringVarP(&outputFormat, "output-format", "o", "json", "Output format (json, ndjson or csv)")
+	AddOutputFlags(transactionsCommand, &outputOpts)
+	transactionsCommand.Flags().DurationVarP(&waitFlag, "wait", "w", 2*time.Minute, "How long to wait for Plaid to finish preparing transactions for a newly linked institution")
+	AddIncludeIgnoredFlag(transactionsCommand, &includeIgnoredFlag)
+	AddAccountDetailsFlag(transactionsCommand, &withAccountDetailsFlag)
+	AddColumnsFlag(transactionsCommand, &columnsFlag)
+	AddTransactionRequestFlags(transactionsCommand, &requestOptions)
+	AddHouseholdFlags(transactionsCommand, &householdOpts)
+	AddTransactionFilterFlags(transactionsCommand, &transactionFilter)
+	AddAnonymizeFlag(transactionsCommand, &anonymizeFlag)
+	AddTypedFlag(transactionsCommand, &typedFlag)
+
+	var exportFormat string
+	var incrementalFlag bool
+	var resetFlag bool
+	exportCommand := &cobra.Command{
+		Use:   "export [ITEM-ID-OR-ALIAS]",
+		Short: T("Export an institution's full transaction history"),
+		Long:  "Export an institution's full transaction history. With --household or --owner, every institution of the household or owner is exported together, labelled with its institution and owner. With --incremental, only transactions added since the last export to the same file are appended, so the export is safe to run from cron.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			household := householdOpts.Household || householdOpts.Owner != ""
+			if len(args) == 0 && !household {
+				FatalUsage("An item ID or alias is required, unless --household or --owner is given.")
+			}
+
+			if !incrementalFlag {
+				if resetFlag {
+					FatalUsage("--reset can only be used with --incremental.")
+				}
+
+				itemIDs, _, err := app.SelectItems(args)
+				if err != nil {
+					Fatal(err)
+				}
+				members, err := HouseholdMembers(app.Client, app.ItemClient, itemIDs, false, householdOpts)
+				if err != nil {
+					Fatal(err)
+				}
+
+				var transactions []plaid_cli.Transaction
+				accountItems := make(map[string]string)
+				accountLabels := make(map[string]string)
+				accountOwners := make(map[string]string)
+				items := 0
+				for _, member := range members {
+					memberData := member.Client.Data
+					for _, itemID := range member.ItemIDs {
+						items++
+						err := member.Client.Do(itemID, func(token string) error {
+							result, err := SyncTransactions(app.Client, token, "")
+							if err != nil {
+								return err
+							}
+							for _, tx := range result.Added {
+								accountItems[tx.AccountID] = ItemName(memberData, itemID)
+								accountOwners[tx.AccountID] = member.Owner(itemID)
+							}
+							transactions = append(transactions, FilterTransactions(ActiveIgnores(memberData, includeIgnoredFlag), result.Added)...)
+
+							if withAccountDetailsFlag {
+								accounts, err := AccountMetadata(app.Client, memberData, itemID, token)
+								if err != nil {
+									return err
+								}
+								for id, label := range AccountLabels(accounts) {
+									accountLabels[id] = label
+								}
+							}
+							return nil
+						})
+						if err != nil {
+							Fatal(fmt.Errorf("%s: %w", ItemName(memberData, itemID), err))
+						}
+					}
+				}
+
+				newSerializer := NewTransactionSerializer
+				if typedFlag {
+					newSerializer = NewTypedTransactionSerializer
+				}
+				serializer, err := newSerializer(exportFormat)
+				if err != nil {
+					Fatal(err)
+				}
+				if anonymizeFlag {
+					serializer, err = Anonymize(serializer)
+					if err != nil {
+						Fatal(err)
+					}
+				}
+				if items > 1 || householdOpts.Household {
+					serializer.annotateItems(accountItems)
+				}
+				if withAccountDetailsFlag {
+					serializer.annotateAccounts(accountLabels)
+				}
+				if anyOwner(accountOwners) {
+					serializer.annotateOwners(accountOwners)
+				}
+				columns, err := ParseExtraColumns(columnsFlag)
+				if err != nil {
+					Fatal(err)
+				}
+				serializer.addColumns(columns)
+
+				txs := transactionFilter.Filter(ApplySplits(HouseholdSplits(members), transactions))
+				app.History.AddRows(len(txs))
+				err = WriteOutput(outputOpts, func(w io.Writer) error {
+					return serializer.serialize(w, txs)
+				})
+				if err != nil {
+					Fatal(err)
+				}
+				return
+			}
+
+			if household {
+				FatalUsage("--household and --owner can't be used with --incremental, which exports a single institution.")
+			}
+			itemID, err := app.ResolveItem(args[0])
+			if err != nil {
+				Fatal(err)
+			}
+
+			if outputOpts.toStdout() || isObjectStoragePath(outputOpts.Path) {
+				FatalUsage("--incremental requires a local --output-file to append to.")
+			}
+			if withAccountDetailsFlag || len(columnsFlag) > 0 {
+				FatalUsage("--with-account-details and --columns can't be used with --incremental, which appends to a file with fixed columns.")
+			}
+			if transactionFilter != (TransactionFilter{}) {
+				FatalUsage("Transaction filters can't be used with --incremental, which must record every transaction it has seen.")
+			}
+			if anonymizeFlag {
+				FatalUsage("--anonymize can't be used with --incremental, since each export is anonymized differently.")
+			}
+			compression, err := outputOpts.compression()
+			if err != nil {
+				Fatal(err)
+			}
+			if compression != "none" || outputOpts.EncryptTo != "" {
+				FatalUsage("--incremental exports can't be compressed or encrypted.")
+			}
+
+			if resetFlag {
+				err = ResetExport(app.Data, itemID, outputOpts.Path)
+				if err != nil {
+					Fatal(err)
+				}
+			}
+
+			err = app.ItemClient.Do(itemID, func(token string) error {
+				return IncrementalExport(app.ItemClient, itemID, token, outputOpts.Path, exportFormat, typedFlag, ActiveIgnores(app.Data, includeIgnoredFlag))
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	exportCommand.Flags().StringVarP(&exportFormat, "output-format", "o", "csv", "Output format (json, ndjson or csv)")
+	exportCommand.Flags().BoolVar(&incrementalFlag, "incremental", false, "Only append transactions added since the last export to --output-file")
+	exportCommand.Flags().BoolVar(&resetFlag, "reset", false, "Forget previous incremental exports to --output-file and start over")
+	AddOutputFlags(exportCommand, &outputOpts)
+	AddIncludeIgnoredFlag(exportCommand, &includeIgnoredFlag)
+	AddAccountDetailsFlag(exportCommand, &withAccountDetailsFlag)
+	AddColumnsFlag(exportCommand, &columnsFlag)
+	AddTransactionFilterFlags(exportCommand, &transactionFilter)
+	AddAnonymizeFlag(exportCommand, &anonymizeFlag)
+	AddTypedFlag(exportCommand, &typedFlag)
+	AddHouseholdFlags(exportCommand, &householdOpts)
+
+	var withStatusFlag bool
+	var withOptionalMetadataFlag bool
+	insitutionCommand := &cobra.Command{
+		Use:   "institution [ITEM-ID-OR-ALIAS]",
+		Short: T("Get information about an institution"),
+		Long:  "Get information about an institution. Status can be reported using a flag.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemID, err := app.ResolveItem(args[0])
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = app.ItemClient.Do(itemID, func(token string) error {
+				item, err := GetItem(app.Client, token)
+				if err != nil {
+					return err
+				}
+
+				err = RecordConsentExpiration(app.Data, item)
+				if err != nil {
+					return err
+				}
+
+				instID := plaid_cli.Value(item.InstitutionID)
+				ctx := context.Background()
+
+				req := plaid.NewInstitutionsGetByIdRequest(instID, app.Countries)
+				req.SetOptions(plaid.InstitutionsGetByIdRequestOptions{
+					IncludeOptionalMetadata: &withOptionalMetadataFlag,
+					IncludeStatus:           &withStatusFlag,
+				})
+				apiReq := app.Client.InstitutionsGetById(ctx)
+				apiReq = apiReq.InstitutionsGetByIdRequest(*req)
+				resp, _, err := apiReq.Execute()
+				if err != nil {
+					return err
+				}
+
+				b, err := json.MarshalIndent(resp.Institution, "", "  ")
+				if err != nil {
+					return err
+				}
+
+				fmt.Println(string(b))
+
+				return nil
+			})
+
+			if err != nil {
+				Fatal(err)
 			}
 		},
 	}
 	insitutionCommand.Flags().BoolVarP(&withStatusFlag, "status", "s", false, "Fetch institution status")
 	insitutionCommand.Flags().BoolVarP(&withOptionalMetadataFlag, "optional-metadata", "m", false, "Fetch optional metadata like logo and URL")
 
-	rootCommand := &cobra.Command{
-		Use:   "plaid-cli",
-		Short: "Link bank accounts and get transactions from the command line.",
-		Long: `plaid-cli 🤑
+	assetsCommand := &cobra.Command{
+		Use:   "assets",
+		Short: T("Create and download asset reports"),
+		Long:  "Create and download asset reports. Institutions must be linked with the assets product (see PLAID_PRODUCTS).",
+	}
+
+	var daysFlag int32
+	assetsCreateCommand := &cobra.Command{
+		Use:         "create [ITEM-ID-OR-ALIAS]...",
+		Short:       "Create an asset report for one or more institutions",
+		Long:        "Create an asset report for one or more institutions. Asset reports are generated asynchronously; use 'assets status' to check when the report is ready.",
+		Args:        cobra.MinimumNArgs(1),
+		Annotations: map[string]string{mutatingAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			var tokens []string
+			for _, itemOrAlias := range args {
+				_, token, err := ResolveToken(app.Data, itemOrAlias)
+				if err != nil {
+					Fatal(err)
+				}
+				tokens = append(tokens, token)
+			}
+
+			if app.DryRun {
+				req := plaid.NewAssetReportCreateRequest(daysFlag)
+				req.SetAccessTokens(tokens)
+				err := plaid_cli.PrintDryRun("/asset_report/create", req)
+				if err != nil {
+					Fatal(err)
+				}
+				return
+			}
+
+			res, err := CreateAssetReport(app.Data, app.Client, tokens, daysFlag)
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(res, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+	assetsCreateCommand.Flags().Int32VarP(&daysFlag, "days", "d", 90, "Days of history to include in the report")
+
+	assetsStatusCommand := &cobra.Command{
+		Use:   "status [ASSET-REPORT-ID-OR-TOKEN]",
+		Short: "Check whether an asset report is ready",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			token := ResolveAssetReportToken(app.Data, args[0])
+
+			status, err := GetAssetReportStatus(app.Client, args[0], token)
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+
+	var assetsFormat string
+	assetsDownloadCommand := &cobra.Command{
+		Use:   "download [ASSET-REPORT-ID-OR-TOKEN]",
+		Short: "Download an asset report as JSON or PDF",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			token := ResolveAssetReportToken(app.Data, args[0])
+
+			err := WriteOutput(outputOpts, func(w io.Writer) error {
+				switch assetsFormat {
+				case "json":
+					return WriteAssetReportJSON(w, app.Client, token)
+				case "pdf":
+					return WriteAssetReportPDF(w, app.Client, token)
+				default:
+					return fmt.Errorf("invalid output format: %s", assetsFormat)
+				}
+			})
+
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	assetsDownloadCommand.Flags().StringVarP(&assetsFormat, "output-format", "o", "json", "Output format (json or pdf)")
+	AddOutputFlags(assetsDownloadCommand, &outputOpts)
+
+	assetsCommand.AddCommand(assetsCreateCommand)
+	assetsCommand.AddCommand(assetsStatusCommand)
+	assetsCommand.AddCommand(assetsDownloadCommand)
+
+	incomeCommand := &cobra.Command{
+		Use:   "income",
+		Short: T("Verify income using Plaid Bank Income"),
+	}
+
+	var incomeDaysFlag int32
+	incomeLinkCommand := &cobra.Command{
+		Use:         "link",
+		Short:       "Link accounts for Bank Income",
+		Long:        "Link accounts for Bank Income. Plaid will detect income streams from the linked accounts' deposits.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{mutatingAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			port := viper.GetString("link.port")
+
+			if app.DryRun && app.Data.UserToken == "" {
+				log.Println("Dry run: would call /user/create to create a Bank Income user.")
+				return
+			}
+
+			userToken, err := EnsureUserToken(app.Data, app.Client)
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = app.Linker.LinkBankIncome(port, userToken, incomeDaysFlag)
+			if errors.Is(err, plaid_cli.ErrDryRun) {
+				return
+			}
+			if err != nil {
+				Fatal(err)
+			}
+
+			log.Println("Bank Income linked! Run 'plaid-cli income summary' to see detected income.")
+		},
+	}
+	incomeLinkCommand.Flags().Int32VarP(&incomeDaysFlag, "days", "d", 90, "Days of history to search for income")
+
+	incomeGetCommand := &cobra.Command{
+		Use:   "get",
+		Short: "Get the full Bank Income report",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			if app.Data.UserToken == "" {
+				Fatal(errors.New("No Bank Income user found. Run 'plaid-cli income link' first."))
+			}
+
+			reports, err := GetBankIncome(app.Client, app.Data.UserToken)
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(reports, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+
+	var incomeOutputFormat string
+	incomeSummaryCommand := &cobra.Command{
+		Use:   "summary",
+		Short: "Summarize detected income streams",
+		Long:  "Summarize detected income streams, including employer, pay frequency and average amount.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			if app.Data.UserToken == "" {
+				Fatal(errors.New("No Bank Income user found. Run 'plaid-cli income link' first."))
+			}
+
+			reports, err := GetBankIncome(app.Client, app.Data.UserToken)
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteIncomeStreams(w, IncomeStreams(reports), incomeOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	incomeSummaryCommand.Flags().StringVarP(&incomeOutputFormat, "output-format", "o", "json", "Output format (json or csv)")
+	AddOutputFlags(incomeSummaryCommand, &outputOpts)
+
+	incomeCommand.AddCommand(incomeLinkCommand)
+	incomeCommand.AddCommand(incomeGetCommand)
+	incomeCommand.AddCommand(incomeSummaryCommand)
+
+	transferCommand := &cobra.Command{
+		Use:   "transfer",
+		Short: T("Move money using Plaid Transfer"),
+		Long:  "Move money using Plaid Transfer. Your Plaid account must have Transfer enabled.",
+	}
+
+	var transferOpts TransferAuthorizationOptions
+	transferAuthorizationCommand := &cobra.Command{
+		Use:   "authorization",
+		Short: "Work with transfer authorizations",
+	}
+
+	transferAuthorizationCreateCommand := &cobra.Command{
+		Use:         "create [ITEM-ID-OR-ALIAS]",
+		Short:       "Create a transfer authorization",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{mutatingAnnotation: "true", confirmsAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemID, token, err := ResolveToken(app.Data, args[0])
+			if err != nil {
+				Fatal(err)
+			}
+
+			req, err := NewTransferAuthorizationRequest(token, transferOpts)
+			if err != nil {
+				Fatal(err)
+			}
+
+			if app.DryRun {
+				err = plaid_cli.PrintDryRun("/transfer/authorization/create", req)
+				if err != nil {
+					Fatal(err)
+				}
+				return
+			}
+
+			confirmed, err := app.Production.Confirm(describeTransfer(transferOpts))
+			if err != nil {
+				Fatal(err)
+			}
+			if !confirmed {
+				FatalAborted()
+			}
+
+			var authorization plaid.TransferAuthorization
+			err = app.ItemClient.Do(itemID, func(token string) error {
+				req.SetAccessToken(token)
+				authorization, err = CreateTransferAuthorization(app.Client, req)
+				return err
+			})
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(authorization, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+	transferAuthorizationCreateCommand.Flags().StringVarP(&transferOpts.AccountID, "account-id", "a", "", "Account to debit or credit (required)")
+	transferAuthorizationCreateCommand.Flags().StringVarP(&transferOpts.Type, "type", "t", "debit", "Transfer type (debit or credit)")
+	transferAuthorizationCreateCommand.Flags().StringVarP(&transferOpts.Network, "network", "n", "ach", "Transfer network (ach, same-day-ach, rtp or wire)")
+	transferAuthorizationCreateCommand.Flags().StringVar(&transferOpts.Amount, "amount", "", "Amount as a decimal string, e.g. 12.34 (required)")
+	transferAuthorizationCreateCommand.Flags().StringVar(&transferOpts.ACHClass, "ach-class", "ppd", "ACH class (ccd, ppd, tel or web)")
+	transferAuthorizationCreateCommand.Flags().StringVar(&transferOpts.LegalName, "legal-name", "", "Legal name of the account owner (required)")
+	for _, flag := range []string{"account-id", "amount", "legal-name"} {
+		err = transferAuthorizationCreateCommand.MarkFlagRequired(flag)
+		if err != nil {
+			Fatal(err)
+		}
+	}
+
+	var transferAccountID string
+	var transferAuthorizationID string
+	var transferDescription string
+	transferCreateCommand := &cobra.Command{
+		Use:         "create [ITEM-ID-OR-ALIAS]",
+		Short:       "Create a transfer from an approved authorization",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{mutatingAnnotation: "true", confirmsAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemID, token, err := ResolveToken(app.Data, args[0])
+			if err != nil {
+				Fatal(err)
+			}
+
+			req, err := NewTransferCreateRequest(token, transferAccountID, transferAuthorizationID, transferDescription)
+			if err != nil {
+				Fatal(err)
+			}
+
+			if app.DryRun {
+				err = plaid_cli.PrintDryRun("/transfer/create", req)
+				if err != nil {
+					Fatal(err)
+				}
+				return
+			}
+
+			confirmed, err := app.Production.Confirm(T("Create transfer for authorization %s", transferAuthorizationID))
+			if err != nil {
+				Fatal(err)
+			}
+			if !confirmed {
+				FatalAborted()
+			}
+
+			var transfer plaid.Transfer
+			err = app.ItemClient.Do(itemID, func(token string) error {
+				req.SetAccessToken(token)
+				transfer, err = CreateTransfer(app.Client, req)
+				return err
+			})
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(transfer, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+	transferCreateCommand.Flags().StringVarP(&transferAccountID, "account-id", "a", "", "Account to debit or credit (required)")
+	transferCreateCommand.Flags().StringVar(&transferAuthorizationID, "authorization-id", "", "ID of an approved transfer authorization (required)")
+	transferCreateCommand.Flags().StringVarP(&transferDescription, "description", "d", "", "Description shown on the bank statement, up to 15 characters (required)")
+	for _, flag := range []string{"account-id", "authorization-id", "description"} {
+		err = transferCreateCommand.MarkFlagRequired(flag)
+		if err != nil {
+			Fatal(err)
+		}
+	}
+
+	var transferCount int32
+	transferListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List recent transfers",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			transfers, err := ListTransfers(app.Client, transferCount)
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(transfers, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+	transferListCommand.Flags().Int32VarP(&transferCount, "count", "c", 25, "Number of transfers to list")
+
+	transferCancelCommand := &cobra.Command{
+		Use:         "cancel [TRANSFER-ID]",
+		Short:       "Cancel a pending transfer",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{mutatingAnnotation: "true", confirmsAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			req := plaid.NewTransferCancelRequest(args[0])
+
+			if app.DryRun {
+				err := plaid_cli.PrintDryRun("/transfer/cancel", req)
+				if err != nil {
+					Fatal(err)
+				}
+				return
+			}
+
+			confirmed, err := app.Production.Confirm(T("Cancel transfer %s", args[0]))
+			if err != nil {
+				Fatal(err)
+			}
+			if !confirmed {
+				FatalAborted()
+			}
+
+			err = CancelTransfer(app.Client, req)
+			if err != nil {
+				Fatal(err)
+			}
+
+			log.Printf("Cancelled transfer %s.\n", args[0])
+		},
+	}
+
+	transferEventsCommand := &cobra.Command{
+		Use:   "events",
+		Short: "Work with transfer events",
+	}
+
+	var transferAfterID int32
+	transferEventsSyncCommand := &cobra.Command{
+		Use:   "sync",
+		Short: "List transfer events since the last sync",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			afterID := app.Data.TransferEventCursor
+			if cmd.Flags().Changed("after-id") {
+				afterID = transferAfterID
+			}
+
+			events, err := SyncTransferEvents(app.Data, app.Client, afterID)
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(events, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+	transferEventsSyncCommand.Flags().Int32Var(&transferAfterID, "after-id", 0, "Sync events after this event ID instead of the last synced event")
+
+	transferAuthorizationCommand.AddCommand(transferAuthorizationCreateCommand)
+	transferEventsCommand.AddCommand(transferEventsSyncCommand)
+	transferCommand.AddCommand(transferAuthorizationCommand)
+	transferCommand.AddCommand(transferCreateCommand)
+	transferCommand.AddCommand(transferListCommand)
+	transferCommand.AddCommand(transferCancelCommand)
+	transferCommand.AddCommand(transferEventsCommand)
+
+	paymentCommand := &cobra.Command{
+		Use:   "payment",
+		Short: T("Initiate payments using Plaid Payment Initiation (UK and Europe)"),
+	}
+
+	paymentRecipientCommand := &cobra.Command{
+		Use:   "recipient",
+		Short: "Work with payment recipients",
+	}
+
+	var recipientOpts RecipientOptions
+	paymentRecipientCreateCommand := &cobra.Command{
+		Use:         "create",
+		Short:       "Create a payment recipient",
+		Long:        "Create a payment recipient. Recipients are identified by IBAN, or by BACS account number and sort code in the UK.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{mutatingAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			if recipientOpts.IBAN == "" && recipientOpts.BACSAccount == "" {
+				FatalUsage("Either --iban or --bacs-account and --bacs-sort-code are required.")
+			}
+
+			req := NewRecipientCreateRequest(recipientOpts)
+			if app.DryRun {
+				err := plaid_cli.PrintDryRun("/payment_initiation/recipient/create", req)
+				if err != nil {
+					Fatal(err)
+				}
+				return
+			}
+
+			res, err := CreateRecipient(app.Client, req)
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(res, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+	paymentRecipientCreateCommand.Flags().StringVar(&recipientOpts.Name, "name", "", "Name of the recipient (required)")
+	paymentRecipientCreateCommand.Flags().StringVar(&recipientOpts.IBAN, "iban", "", "IBAN of the recipient")
+	paymentRecipientCreateCommand.Flags().StringVar(&recipientOpts.BACSAccount, "bacs-account", "", "BACS account number of the recipient")
+	paymentRecipientCreateCommand.Flags().StringVar(&recipientOpts.BACSSortCode, "bacs-sort-code", "", "BACS sort code of the recipient")
+	err = paymentRecipientCreateCommand.MarkFlagRequired("name")
+	if err != nil {
+		Fatal(err)
+	}
+
+	var paymentRecipientID string
+	var paymentReference string
+	var paymentAmount string
+	var paymentCurrency string
+	paymentCreateCommand := &cobra.Command{
+		Use:         "create",
+		Short:       "Create a payment and authorise it with your bank",
+		Long:        "Create a payment and authorise it with your bank. Plaid Link will open so you can choose your bank and approve the payment.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{mutatingAnnotation: "true", confirmsAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			amount, err := ParsePaymentAmount(paymentAmount)
+			if err != nil {
+				Fatal(err)
+			}
+			req, err := NewPaymentCreateRequest(paymentRecipientID, paymentReference, amount, paymentCurrency)
+			if err != nil {
+				Fatal(err)
+			}
+
+			if app.DryRun {
+				err = plaid_cli.PrintDryRun("/payment_initiation/payment/create", req)
+				if err != nil {
+					Fatal(err)
+				}
+				return
+			}
+
+			confirmed, err := app.Production.Confirm(T("Pay %s %s to recipient %s", amount.String(), strings.ToUpper(paymentCurrency), paymentRecipientID))
+			if err != nil {
+				Fatal(err)
+			}
+			if !confirmed {
+				FatalAborted()
+			}
+
+			res, err := CreatePayment(app.Client, req)
+			if err != nil {
+				Fatal(err)
+			}
+			log.Printf("Payment ID: %s\n", res.PaymentId)
+
+			port := viper.GetString("link.port")
+			err = app.Linker.LinkPaymentInitiation(port, res.PaymentId)
+			if err != nil {
+				Fatal(err)
+			}
+
+			payment, err := GetPayment(app.Client, res.PaymentId)
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(payment, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+	paymentCreateCommand.Flags().StringVar(&paymentRecipientID, "recipient-id", "", "Recipient to pay (required)")
+	paymentCreateCommand.Flags().StringVar(&paymentReference, "reference", "", "Payment reference shown to the recipient (required)")
+	paymentCreateCommand.Flags().StringVar(&paymentAmount, "amount", "", "Amount to pay, e.g. 12.34 (required)")
+	paymentCreateCommand.Flags().StringVar(&paymentCurrency, "currency", "GBP", "Currency of the payment")
+	for _, flag := range []string{"recipient-id", "reference", "amount"} {
+		err = paymentCreateCommand.MarkFlagRequired(flag)
+		if err != nil {
+			Fatal(err)
+		}
+	}
+
+	var paymentCount int32
+	paymentListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List recent payments",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			payments, err := ListPayments(app.Client, paymentCount)
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(payments, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+	paymentListCommand.Flags().Int32VarP(&paymentCount, "count", "c", 10, "Number of payments to list")
+
+	paymentGetCommand := &cobra.Command{
+		Use:   "get [PAYMENT-ID]",
+		Short: "Get the status of a payment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			payment, err := GetPayment(app.Client, args[0])
+			if err != nil {
+				Fatal(err)
+			}
+
+			b, err := json.MarshalIndent(payment, "", "  ")
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+
+	paymentRecipientCommand.AddCommand(paymentRecipientCreateCommand)
+	paymentCommand.AddCommand(paymentRecipientCommand)
+	paymentCommand.AddCommand(paymentCreateCommand)
+	paymentCommand.AddCommand(paymentListCommand)
+	paymentCommand.AddCommand(paymentGetCommand)
+
+	var reconsentExpiringFlag bool
+	reconsentCommand := &cobra.Command{
+		Use:         "reconsent [ITEM-ID-OR-ALIAS]",
+		Short:       T("Renew consent for an institution"),
+		Long:        "Renew consent for an institution. Some institutions, particularly European banks subject to PSD2, require consent to be renewed periodically, typically every 90 days. With --expiring, consent is renewed for every institution whose consent expires within cli.consent_warning_days, one after another. A failure doesn't stop the rest, and the command exits with code 6 if only some of them could be renewed.",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{mutatingAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			var itemIDs []string
+			switch {
+			case reconsentExpiringFlag && len(args) > 0:
+				FatalUsage("Name an institution or use --expiring, not both.")
+			case reconsentExpiringFlag:
+				days := viper.GetInt("cli.consent_warning_days")
+				itemIDs = ExpiringConsents(app.Data, time.Duration(days)*24*time.Hour, time.Now())
+				if len(itemIDs) == 0 {
+					log.Printf("No consent expires in the next %d days.\n", days)
+					return
+				}
+			case len(args) == 0:
+				FatalUsage("Name the institution to renew consent for, or use --expiring to renew every one that's expiring.")
+			default:
+				itemID, err := app.ResolveItem(args[0])
+				if err != nil {
+					Fatal(err)
+				}
+				itemIDs = []string{itemID}
+			}
+
+			results := ReconsentItems(app.Client, app.Linker, itemIDs, viper.GetString("link.port"))
+			err := ReconsentError(results)
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	reconsentCommand.Flags().BoolVar(&reconsentExpiringFlag, "expiring", false, "Renew consent for every institution whose consent expires within cli.consent_warning_days")
+
+	var batchFileFlag string
+	batchCommand := &cobra.Command{
+		Use:   "batch",
+		Short: T("Run operations on many institutions from a CSV file"),
+		Long: `Run operations on many institutions from a CSV file with command, item and argument
+columns, then print a summary of which succeeded. Supported commands are:
+
+  refresh,ITEM-ID-OR-ALIAS          Ask Plaid to check for new transactions
+  webhook set,ITEM-ID-OR-ALIAS,URL  Change the item's webhook
+  alias,ITEM-ID,NAME                Give the item a friendly name
+
+A failing row doesn't stop the rest of the batch.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{mutatingAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			ops, err := ReadBatchFile(batchFileFlag)
+			if err != nil {
+				Fatal(err)
+			}
+
+			results := RunBatch(app.ItemClient, ops, app.DryRun)
+
+			err = WriteBatchResults(os.Stdout, results)
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = BatchError(results)
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	batchCommand.Flags().StringVarP(&batchFileFlag, "file", "f", "", "CSV file of operations (required)")
+	err = batchCommand.MarkFlagRequired("file")
+	if err != nil {
+		Fatal(err)
+	}
+
+	var daemonIntervalFlag time.Duration
+	var daemonOnceFlag bool
+	daemonCommand := &cobra.Command{
+		Use:   "daemon",
+		Short: "Watch institutions and send notifications",
+		Long:  "Check linked institutions every --interval and send notifications for new transactions and for alerts, such as an expired login or expiring consent, to the targets configured under [notify]. Use --item to limit the institutions watched.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, _, err := app.SelectItems(nil)
+			if err != nil {
+				Fatal(err)
+			}
+
+			notifiers, err := NotifiersFromViper()
+			if err != nil {
+				Fatal(err)
+			}
+			if len(notifiers) == 0 {
+				log.Println("⚠️  No notification targets are configured under [notify]. Changes will only be logged.")
+			}
+
+			// Relinking needs someone at a browser, so it's reported as an
+			// alert instead.
+			viper.Set("cli.auto_relink", false)
+
+			daemon := &Daemon{
+				Client:         app.ItemClient,
+				ItemIDs:        itemIDs,
+				Notifiers:      notifiers,
+				ConsentWarning: time.Duration(viper.GetInt("cli.consent_warning_days")) * 24 * time.Hour,
+				AlertInterval:  24 * time.Hour,
+			}
+
+			if daemonOnceFlag {
+				err = daemon.Check()
+				if err != nil {
+					Fatal(err)
+				}
+				return
+			}
+
+			log.Printf("Watching %d institutions every %s.", len(itemIDs), daemonIntervalFlag)
+			daemon.Run(daemonIntervalFlag)
+		},
+	}
+	daemonCommand.Flags().DurationVar(&daemonIntervalFlag, "interval", time.Hour, "How often to check for changes")
+	daemonCommand.Flags().BoolVar(&daemonOnceFlag, "once", false, "Check once and exit, e.g. when run from cron")
+
+	daemonTestCommand := &cobra.Command{
+		Use:         "test",
+		Short:       "Send a test notification to every configured target",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			notifiers, err := NotifiersFromViper()
+			if err != nil {
+				Fatal(err)
+			}
+			if len(notifiers) == 0 {
+				FatalConfig("⚠️  No notification targets are configured under [notify].")
+			}
+
+			err = NotifyAll(notifiers, Event{
+				Kind:    AlertEvent,
+				Title:   "plaid-cli test notification",
+				Message: "Notifications from plaid-cli are working.",
+				Time:    time.Now(),
+			})
+			if err != nil {
+				Fatal(err)
+			}
+			log.Printf("Sent a test notification to %d targets.", len(notifiers))
+		},
+	}
+	daemonCommand.AddCommand(daemonTestCommand)
+
+	var noStartFlag bool
+	daemonInstallCommand := &cobra.Command{
+		Use:         "install",
+		Short:       "Install the daemon as a systemd user service or launchd agent",
+		Long:        "Install `plaid-cli daemon` as a systemd user service (Linux) or launchd agent (macOS) and start it. PLAID_*, CLI_*, SMTP_* and NOTIFY_* environment variables are copied into an environment file readable only by you, so credentials set in your shell reach the service.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			executable, err := os.Executable()
+			if err != nil {
+				Fatal(err)
+			}
+
+			daemonArgs := []string{"daemon", "--interval", daemonIntervalFlag.String()}
+			if cmd.Flag("environment").Changed {
+				daemonArgs = append(daemonArgs, "--environment", viper.GetString("plaid.environment"))
+			}
+			for _, item := range app.ItemFlags {
+				daemonArgs = append(daemonArgs, "--item", item)
+			}
+
+			err = InstallDaemon(DaemonService{
+				Executable: executable,
+				Args:       daemonArgs,
+				EnvFile:    filepath.Join(app.DataDir, "daemon.env"),
+				LogFile:    filepath.Join(app.DataDir, "daemon.log"),
+			}, !noStartFlag)
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	daemonInstallCommand.Flags().DurationVar(&daemonIntervalFlag, "interval", time.Hour, "How often the daemon checks for changes")
+	daemonInstallCommand.Flags().BoolVar(&noStartFlag, "no-start", false, "Write the service files without starting the service")
+	daemonCommand.AddCommand(daemonInstallCommand)
+
+	daemonUninstallCommand := &cobra.Command{
+		Use:         "uninstall",
+		Short:       "Stop and remove the daemon service",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			err := UninstallDaemon(filepath.Join(app.DataDir, "daemon.env"))
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	daemonCommand.AddCommand(daemonUninstallCommand)
+
+	var serveAddrFlag string
+	var serveCacheTTLFlag time.Duration
+	serveCommand := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve balances and transactions to Grafana",
+		Long:  "Serve balances and transactions over HTTP for Grafana's SimpleJSON and Infinity datasources. Set serve.token (SERVE_TOKEN) to require it as a bearer token. Use --item to limit the institutions served.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, _, err := app.SelectItems(nil)
+			if err != nil {
+				Fatal(err)
+			}
+
+			// Nobody is at the terminal to answer a relink prompt when a
+			// request comes in.
+			viper.Set("cli.auto_relink", false)
+
+			server := &Server{
+				Client:   app.ItemClient,
+				ItemIDs:  itemIDs,
+				Token:    viper.GetString("serve.token"),
+				CacheTTL: serveCacheTTLFlag,
+			}
+
+			log.Printf("Serving %d institutions on http://%s", len(itemIDs), serveAddrFlag)
+			err = http.ListenAndServe(serveAddrFlag, server.Handler())
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	serveCommand.Flags().StringVar(&serveAddrFlag, "addr", "localhost:8090", "Address to listen on")
+	serveCommand.Flags().DurationVar(&serveCacheTTLFlag, "cache-ttl", 15*time.Minute, "How long to reuse data fetched from Plaid")
+
+	webhooksCommand := &cobra.Command{
+		Use:         "webhooks",
+		Short:       T("Receive, list and replay webhooks from Plaid"),
+		Long:        "Receive webhooks from Plaid and hand each to a hook command, configured as webhooks.exec in the config file or with --exec. Every webhook is stored in ~/.plaid-cli/webhooks before its hook runs, and ones whose hook fails are kept as dead letters until they're replayed.",
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+	}
+
+	var webhooksAddrFlag string
+	var webhooksExecFlag string
+	var webhooksTunnelFlag string
+	var webhooksRegisterFlag bool
+	webhooksListenCommand := &cobra.Command{
+		Use:   "listen",
+		Short: "Receive webhooks from Plaid",
+		Long:  "Receive webhooks from Plaid on --addr, storing each one and then running the hook command with its body on stdin and PLAID_WEBHOOK_ID, PLAID_WEBHOOK_TYPE, PLAID_WEBHOOK_CODE and PLAID_ITEM_ID set. Webhooks are acknowledged once stored, so Plaid doesn't send them again if the hook fails; run `webhooks replay` to retry those. Webhooks not signed by Plaid in the last 5 minutes are rejected, unless webhooks.verify is false.\n\nWith --tunnel, a public URL is made for the receiver with ngrok or cloudflared, whichever is installed, and with --register it's set as the webhook URL of the institutions selected with --item (or all of them).",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			if webhooksRegisterFlag && webhooksTunnelFlag == "" {
+				Fatal(errors.New("--register needs --tunnel, to have a public URL to register"))
+			}
+			if webhooksExecFlag == "" {
+				log.Println("No hook command is set (webhooks.exec or --exec), so webhooks will only be stored.")
+			}
+
+			if webhooksTunnelFlag != "" {
+				_, port, err := net.SplitHostPort(webhooksAddrFlag)
+				if err != nil {
+					Fatal(err)
+				}
+				tunnel, err := StartTunnel(webhooksTunnelFlag, port)
+				if err != nil {
+					Fatal(err)
+				}
+				defer tunnel.Close()
+				log.Printf("Webhooks can be sent to %s", tunnel.URL)
+
+				if webhooksRegisterFlag {
+					if viper.GetBool("cli.read_only") && !app.DryRun {
+						Fatal(errors.New("--register changes state at Plaid, and plaid-cli is in read-only mode (--read-only or cli.read_only)"))
+					}
+					itemIDs, _, err := app.SelectItems(nil)
+					if err != nil {
+						Fatal(err)
+					}
+					err = RegisterWebhook(app.ItemClient, itemIDs, tunnel.URL, app.DryRun)
+					if err != nil {
+						Fatal(err)
+					}
+					if !app.DryRun {
+						log.Printf("Registered %s as the webhook URL for %d institutions.", tunnel.URL, len(itemIDs))
+					}
+				}
+			}
+
+			receiver := &WebhookReceiver{Store: app.Webhooks, Hook: webhooksExecFlag}
+			if viper.GetBool("webhooks.verify") {
+				receiver.Verifier = &WebhookVerifier{Client: app.Client, Data: app.Data}
+			} else {
+				log.Println("⚠️  webhooks.verify is off, so webhooks aren't checked to be from Plaid.")
+			}
+			log.Printf("Receiving webhooks on http://%s", webhooksAddrFlag)
+			err := http.ListenAndServe(webhooksAddrFlag, receiver)
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	webhooksListenCommand.Flags().StringVar(&webhooksAddrFlag, "addr", "localhost:8091", "Address to listen on")
+	webhooksListenCommand.Flags().StringVar(&webhooksExecFlag, "exec", viper.GetString("webhooks.exec"), "Command to run for each webhook")
+	AddTunnelFlag(webhooksListenCommand, &webhooksTunnelFlag)
+	webhooksListenCommand.Flags().BoolVar(&webhooksRegisterFlag, "register", false, "Set the tunnel's URL as the webhook URL of the selected institutions at Plaid")
+
+	var webhooksSetAllFlag bool
+	webhooksSetCommand := &cobra.Command{
+		Use:         "set URL",
+		Short:       "Change the webhook URL of linked institutions",
+		Long:        "Set URL as the webhook URL of the institutions selected with --item, or of every linked institution with --all, e.g. when the receiver moves to another host. Progress is logged as each institution is updated, and a summary is printed at the end. A failing institution doesn't stop the rest, and the command exits with code 6 if only some of them failed.",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{mutatingAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			webhookURL, err := ParseWebhookURL(args[0])
+			if err != nil {
+				Fatal(err)
+			}
+
+			itemIDs, err := app.ResolveItems(nil)
+			if err != nil {
+				Fatal(err)
+			}
+			if webhooksSetAllFlag {
+				itemIDs = SortedItemIDs(app.Data)
+			}
+			if len(itemIDs) == 0 {
+				FatalUsage("Select the institutions to update with --item, or use --all to update every one.")
+			}
+
+			results := SetWebhooks(app.ItemClient, itemIDs, webhookURL, app.DryRun)
+			if app.DryRun {
+				return
+			}
+
+			err = WriteWebhookUpdateResults(os.Stdout, app.Data, results)
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = WebhookUpdateError(results)
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	webhooksSetCommand.Flags().BoolVar(&webhooksSetAllFlag, "all", false, "Update every linked institution")
+
+	var webhooksFailedFlag bool
+	var webhooksOutputFormat string
+	webhooksListCommand := &cobra.Command{
+		Use:         "list",
+		Short:       "List the webhooks received",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			var webhooks []Webhook
+			var err error
+			if webhooksFailedFlag {
+				webhooks, err = app.Webhooks.DeadLetters(time.Now())
+			} else {
+				webhooks, err = app.Webhooks.List()
+			}
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteWebhooks(w, webhooks, webhooksOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	webhooksListCommand.Flags().BoolVar(&webhooksFailedFlag, "failed", false, "Only list dead letters: webhooks whose hook failed, or that were never handled")
+	webhooksListCommand.Flags().StringVarP(&webhooksOutputFormat, "output-format", "o", "table", "Output format (table or json)")
+	AddOutputFlags(webhooksListCommand, &outputOpts)
+
+	webhooksReplayCommand := &cobra.Command{
+		Use:         "replay [ID]",
+		Short:       "Run the hook again for a webhook, or for every dead letter",
+		Long:        "Run the hook command again for the webhook with ID, or for every dead letter if no ID is given. Webhooks that fail again stay dead letters.",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			if webhooksExecFlag == "" {
+				FatalConfig("⚠️  No hook command is set. Set webhooks.exec in plaid-cli's config file or pass --exec.")
+			}
+
+			var webhooks []Webhook
+			if len(args) == 1 {
+				webhook, err := app.Webhooks.Get(args[0])
+				if err != nil {
+					Fatal(err)
+				}
+				webhooks = append(webhooks, webhook)
+			} else {
+				var err error
+				webhooks, err = app.Webhooks.DeadLetters(time.Now())
+				if err != nil {
+					Fatal(err)
+				}
+				if len(webhooks) == 0 {
+					log.Println("No dead letters to replay.")
+					return
+				}
+			}
+
+			if app.DryRun {
+				log.Printf("Dry run: would replay %d webhooks with `%s`.\n", len(webhooks), webhooksExecFlag)
+				return
+			}
+
+			failed := 0
+			for _, webhook := range webhooks {
+				err := app.Webhooks.Deliver(webhook, webhooksExecFlag)
+				if err != nil {
+					log.Printf("⚠️  Webhook %s failed again: %v", webhook.ID, err)
+					failed++
+				}
+			}
+			log.Printf("Replayed %d webhooks.\n", len(webhooks)-failed)
+			if failed > 0 {
+				Fatal(fmt.Errorf("%d webhooks failed again and are still dead letters", failed))
+			}
+		},
+	}
+	webhooksReplayCommand.Flags().StringVar(&webhooksExecFlag, "exec", viper.GetString("webhooks.exec"), "Command to run for each webhook")
+
+	var webhooksFileFlag string
+	var webhooksJWTFlag string
+	var webhooksOfflineFlag bool
+	webhooksVerifyCommand := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that a captured webhook was signed by Plaid",
+		Long:  "Check that a webhook saved to --file was signed by Plaid. The file can be one stored by `webhooks listen`, which keeps each webhook's signature, or just the webhook's body, with the Plaid-Verification header it came with passed as --jwt. Webhooks are checked against the key that signed them however long ago that was; only `webhooks listen` rejects old ones. With --offline, only keys cached from earlier verifications are used.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			b, err := os.ReadFile(webhooksFileFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			body, token := CapturedWebhook(b, webhooksJWTFlag)
+			if token == "" {
+				Fatal(fmt.Errorf("%s has no signature. Pass the webhook's Plaid-Verification header as --jwt", webhooksFileFlag))
+			}
+
+			verifier := &WebhookVerifier{Client: app.Client, Data: app.Data, Offline: webhooksOfflineFlag}
+			err = verifier.Verify(body, token, time.Now(), 0)
+			if err != nil {
+				Fatal(err)
+			}
+			log.Printf("%s was signed by Plaid.\n", webhooksFileFlag)
+		},
+	}
+	webhooksVerifyCommand.Flags().StringVar(&webhooksFileFlag, "file", "", "File the webhook was saved to")
+	webhooksVerifyCommand.Flags().StringVar(&webhooksJWTFlag, "jwt", "", "The webhook's Plaid-Verification header, if the file doesn't have it")
+	webhooksVerifyCommand.Flags().BoolVar(&webhooksOfflineFlag, "offline", false, "Only use cached keys, without calling Plaid")
+	err = webhooksVerifyCommand.MarkFlagRequired("file")
+	if err != nil {
+		Fatal(err)
+	}
+
+	webhooksCommand.AddCommand(webhooksListenCommand)
+	webhooksCommand.AddCommand(webhooksListCommand)
+	webhooksCommand.AddCommand(webhooksSetCommand)
+	webhooksCommand.AddCommand(webhooksReplayCommand)
+	webhooksCommand.AddCommand(webhooksVerifyCommand)
+
+	sandboxCommand := &cobra.Command{
+		Use:   "sandbox",
+		Short: T("Create and break test institutions in Plaid's sandbox"),
+	}
+
+	var sandboxInstitutionFlag string
+	var sandboxAliasFlag string
+	sandboxLinkCommand := &cobra.Command{
+		Use:         "link",
+		Short:       T("Link a sandbox institution without opening Link"),
+		Long:        "Link a sandbox institution without opening Link, with the configured products. Its test accounts and transactions can then be used with every other command, e.g. to try out a config or script before linking real institutions.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{mutatingAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			err := RequireSandbox(app.Data.Environment)
+			if err != nil {
+				Fatal(err)
+			}
+
+			tokenPair, err := app.Linker.LinkSandbox(sandboxInstitutionFlag)
+			if errors.Is(err, plaid_cli.ErrDryRun) {
+				return
+			}
+			if err != nil {
+				Fatal(err)
+			}
+			app.Data.Tokens[tokenPair.ItemID] = tokenPair.AccessToken
+			err = app.Data.Save()
+			if err != nil {
+				Fatal(err)
+			}
+
+			log.Println("Institution linked!")
+			log.Printf("Item ID: %s\n", tokenPair.ItemID)
+			if sandboxAliasFlag != "" {
+				err = SetAlias(app.Data, tokenPair.ItemID, sandboxAliasFlag)
+				if err != nil {
+					Fatal(err)
+				}
+			}
+		},
+	}
+	sandboxLinkCommand.Flags().StringVar(&sandboxInstitutionFlag, "institution", DefaultSandboxInstitution, "Sandbox institution ID to link")
+	sandboxLinkCommand.Flags().StringVar(&sandboxAliasFlag, "alias", "", "Alias to give the linked institution")
+
+	sandboxResetLoginCommand := &cobra.Command{
+		Use:         "reset-login ITEM-ID-OR-ALIAS",
+		Short:       T("Make a sandbox institution's login expire"),
+		Long:        "Make a sandbox institution's login expire, putting it in the ITEM_LOGIN_REQUIRED state, so that relinking, `item list` health and daemon alerts can be tried out.",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{mutatingAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			err := RequireSandbox(app.Data.Environment)
+			if err != nil {
+				Fatal(err)
+			}
+			itemID, err := app.ResolveItem(args[0])
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = ResetSandboxLogin(app.Client, app.Data, itemID, app.DryRun)
+			if err != nil {
+				Fatal(err)
+			}
+			if !app.DryRun {
+				log.Printf("%s now needs relinking. Run `plaid-cli item relink %s` to fix it.\n", ItemName(app.Data, itemID), args[0])
+			}
+		},
+	}
+	sandboxCommand.AddCommand(sandboxLinkCommand)
+	sandboxCommand.AddCommand(sandboxResetLoginCommand)
+
+	var checkFlag bool
+	versionCommand := &cobra.Command{
+		Use:         "version",
+		Short:       T("Print version and build information"),
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			info := BuildVersionInfo()
+			err := WriteVersionInfo(os.Stdout, info)
+			if err != nil {
+				Fatal(err)
+			}
+
+			if !checkFlag {
+				return
+			}
+
+			latest, url, err := LatestRelease()
+			if err != nil {
+				Fatal(err)
+			}
+			if newerVersion(info.Version, latest) {
+				fmt.Printf("\nA newer version, %s, is available: %s\n", latest, url)
+			} else {
+				fmt.Printf("\nYou're up to date. The latest release is %s.\n", latest)
+			}
+		},
+	}
+	versionCommand.Flags().BoolVar(&checkFlag, "check", false, "Check GitHub for a newer release")
+
+	var categoriesOutputFormat string
+	var primaryFlag string
+	categoriesCommand := &cobra.Command{
+		Use:         "categories",
+		Short:       T("List Plaid's personal finance categories"),
+		Long:        "List Plaid's personal finance category taxonomy, for use when writing category rules or budgets.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			categories, err := Categories()
+			if err != nil {
+				Fatal(err)
+			}
+
+			categories, err = FilterCategories(categories, primaryFlag)
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = WriteCategories(os.Stdout, categories, categoriesOutputFormat)
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	categoriesCommand.Flags().StringVarP(&categoriesOutputFormat, "output-format", "o", "table", "Output format (json or table)")
+	categoriesCommand.Flags().StringVar(&primaryFlag, "primary", "", "Only list detailed categories under this primary category, e.g. FOOD_AND_DRINK")
+
+	var schemaFormatFlag string
+	var schemaOutputFormat string
+	var schemaColumnsFlag []string
+	var schemaOpts SchemaOptions
+	schemaCommand := &cobra.Command{
+		Use:         "schema",
+		Short:       T("Print a JSON Schema for plaid-cli's output"),
+		Long:        "Print a JSON Schema describing the fields transactions are written with in an output format, for validating files produced by plaid-cli. Pass the same --columns and --with-* flags the files were written with.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if schemaFormatFlag != "json-schema" {
+				FatalUsage(fmt.Sprintf("Unknown schema format %q. Only json-schema is supported.", schemaFormatFlag))
+			}
+
+			columns, err := ParseExtraColumns(schemaColumnsFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			opts := schemaOpts
+			opts.Columns = columns
+			schema, err := TransactionSchema(schemaOutputFormat, opts)
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = WriteSchema(os.Stdout, schema)
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	schemaCommand.Flags().StringVar(&schemaFormatFlag, "format", "json-schema", "Schema format (json-schema)")
+	schemaCommand.Flags().StringVarP(&schemaOutputFormat, "output-format", "o", "json", "Output format to describe (json, ndjson or csv)")
+	schemaCommand.Flags().BoolVar(&schemaOpts.Item, "with-item", false, "Include the item field, written when transactions from several institutions or a household are merged")
+	AddAccountDetailsFlag(schemaCommand, &schemaOpts.Account)
+	schemaCommand.Flags().BoolVar(&schemaOpts.Owner, "with-owner", false, "Include the owner field, written when items are tagged with owners")
+	AddColumnsFlag(schemaCommand, &schemaColumnsFlag)
+	schemaCommand.Flags().BoolVar(&schemaOpts.Typed, "typed", false, "Describe --typed output")
+
+	var fromCSVFlag string
+	var fromNDJSONFlag string
+	var enrichAccountType string
+	var enrichCurrency string
+	var enrichOutputFormat string
+	enrichCommand := &cobra.Command{
+		Use:   "enrich",
+		Short: T("Add merchant and category data to transactions from a file"),
+		Long:  "Add merchant and category data to transactions from a CSV or NDJSON file using Plaid Enrich. This is useful for cleaning up exports from banks Plaid can't link. CSV input needs a header with description and amount columns, and may include id, direction, date, currency and mcc columns.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			var inputs []EnrichInput
+			var err error
+			switch {
+			case fromCSVFlag != "" && fromNDJSONFlag != "":
+				FatalUsage("Use only one of --from-csv and --from-ndjson.")
+			case fromCSVFlag != "":
+				inputs, err = ReadEnrichInput(fromCSVFlag, "csv")
+			case fromNDJSONFlag != "":
+				inputs, err = ReadEnrichInput(fromNDJSONFlag, "ndjson")
+			default:
+				FatalUsage("One of --from-csv or --from-ndjson is required. Use - to read from stdin.")
+			}
+			if err != nil {
+				Fatal(err)
+			}
+
+			txs, err := NewClientProvidedTransactions(inputs, enrichCurrency)
+			if err != nil {
+				Fatal(err)
+			}
+
+			enriched, err := EnrichTransactions(app.Client, enrichAccountType, txs)
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteEnrichedTransactions(w, enriched, enrichOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	enrichCommand.Flags().StringVar(&fromCSVFlag, "from-csv", "", "Read transactions from this CSV file (- for stdin)")
+	enrichCommand.Flags().StringVar(&fromNDJSONFlag, "from-ndjson", "", "Read transactions from this NDJSON file (- for stdin)")
+	enrichCommand.Flags().StringVar(&enrichAccountType, "account-type", "depository", "Type of account the transactions are from (depository or credit)")
+	enrichCommand.Flags().StringVar(&enrichCurrency, "currency", "USD", "Currency of transactions that don't specify one")
+	enrichCommand.Flags().StringVarP(&enrichOutputFormat, "output-format", "o", "json", "Output format (json, ndjson or csv)")
+	AddOutputFlags(enrichCommand, &outputOpts)
+
+	var pushLastFlag string
+	var pushRetryFailedFlag bool
+	pushCommand := &cobra.Command{
+		Use:       "push TARGET",
+		Short:     T("Send transactions to a budgeting tool"),
+		Long:      "Send posted transactions from the last --last (30 days by default) to YNAB (ynab), Firefly III (firefly) or Lunch Money (lunchmoney), configured under [push.<target>] in the config file. Only accounts mapped with `map-accounts`, or under [push.<target>.accounts], are pushed. Transactions that fail to push are recorded in a journal; --retry-failed sends just those again.",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: PushTargets,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			target, err := PushTargetFromViper(args[0])
+			if err != nil {
+				Fatal(err)
+			}
+			accounts, err := PushAccountMapping(app.Data, target.Name())
+			if err != nil {
+				Fatal(err)
+			}
+
+			var records []PushRecord
+			if pushRetryFailedFlag {
+				records = FailedPushes(app.Data, target.Name())
+				if len(records) == 0 {
+					log.Printf("No failed pushes to %s to retry.\n", target.Name())
+					return
+				}
+			} else {
+				now := time.Now()
+				from, err := ParsePeriod(pushLastFlag, now)
+				if err != nil {
+					Fatal(err)
+				}
+				itemIDs, _, err := app.SelectItems(nil)
+				if err != nil {
+					Fatal(err)
+				}
+				txs, err := ReportTransactions(app.ItemClient, itemIDs, from, now, app.Partial)
+				if err != nil {
+					Fatal(err)
+				}
+				records = PushRecords(FilterTransactions(ActiveIgnores(app.Data, false), txs), accounts)
+			}
+
+			if app.DryRun {
+				log.Printf("Dry run: would push %d transactions to %s.\n", len(records), target.Name())
+				return
+			}
+
+			result, err := Push(app.Data, target, records, time.Now())
+			log.Printf("Pushed %d transactions to %s (%d already pushed).\n", result.Pushed, target.Name(), result.AlreadyPushed)
+			app.History.AddRows(result.Pushed)
+			if err != nil {
+				Fatal(err)
+			}
+			if err := app.Partial.Err(); err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	pushCommand.Flags().StringVar(&pushLastFlag, "last", "30d", "Period to push transactions from, e.g. 7d, 4w or 3m")
+	pushCommand.Flags().BoolVar(&pushRetryFailedFlag, "retry-failed", false, "Only push the transactions that failed to push before")
+
+	mapAccountsCommand := &cobra.Command{
+		Use:       "map-accounts TARGET",
+		Short:     T("Choose which budgeting tool account each account is pushed to"),
+		Long:      "For each account at the institutions selected with --item (or all of them), pick the account in YNAB (ynab), Firefly III (firefly) or Lunch Money (lunchmoney) its transactions are pushed to, from the accounts listed by the tool, or choose not to push it. The mapping is shown side by side and saved once confirmed, and takes precedence over [push.<target>.accounts] in the config file.",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: PushTargets,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			target, err := PushTargetFromViper(args[0])
+			if err != nil {
+				Fatal(err)
+			}
+			destinations, err := target.Accounts()
+			if err != nil {
+				Fatal(err)
+			}
+			if len(destinations) == 0 {
+				Fatal(fmt.Errorf("No open accounts found in %s. Create the accounts to push to there first.", target.Name()))
+			}
+
+			itemIDs, _, err := app.SelectItems(nil)
+			if err != nil {
+				Fatal(err)
+			}
+			var items []ItemAccounts
+			for _, itemID := range itemIDs {
+				err := app.ItemClient.Do(itemID, func(token string) error {
+					accounts, err := GetAccounts(app.Client, token)
+					if err != nil {
+						return err
+					}
+					err = CacheAccounts(app.Data, itemID, accounts)
+					if err != nil {
+						return err
+					}
+
+					items = append(items, ItemAccounts{
+						Item:     ItemName(app.Data, itemID),
+						Accounts: FilterAccounts(ActiveIgnores(app.Data, false), accounts),
+					})
+					return nil
+				})
+				if err != nil {
+					Fatal(err)
+				}
+			}
+
+			mapping, err := ChooseAccountMapping(target.Name(), items, destinations, accountMapping(app.Data, target.Name()))
+			if err != nil {
+				Fatal(err)
+			}
+			err = WriteAccountMapping(os.Stdout, target.Name(), items, destinations, mapping)
+			if err != nil {
+				Fatal(err)
+			}
+
+			if app.DryRun {
+				log.Printf("Dry run: would save the account mapping for %s.\n", target.Name())
+				return
+			}
+			ok, err := Confirm(T("Save the account mapping for %s", target.Name()))
+			if err != nil {
+				Fatal(err)
+			}
+			if !ok {
+				return
+			}
+			err = SaveAccountMapping(app.Data, target.Name(), mapping)
+			if err != nil {
+				Fatal(err)
+			}
+			log.Printf("Saved the account mapping for %s. Run `plaid-cli export push %s` to push transactions.\n", target.Name(), target.Name())
+		},
+	}
+
+	var purgeOlderThanFlag string
+	var purgeRemoveItemsFlag bool
+	purgeCommand := &cobra.Command{
+		Use:   "purge",
+		Short: T("Delete local financial data older than a period"),
+		Long:  "Delete imported transactions, recorded balances, cached accounts, savings history and audit log entries older than --older-than, for data-minimization requirements. With --remove-items, the institutions given with --item (use --item all for every one) are also removed at Plaid with /item/remove and forgotten locally, which can't be undone; they have to be linked again to be used. Use --dry-run to see what would be deleted.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			cutoff, err := ParsePeriod(purgeOlderThanFlag, time.Now())
+			if err != nil {
+				Fatal(err)
+			}
+			// Removing every institution by default would be too easy a
+			// mistake to make, so they have to be named, or --item all given.
+			if purgeRemoveItemsFlag && len(app.ItemFlags) == 0 {
+				FatalUsage("--remove-items needs the institutions to remove: pass --item, once for each, or --item all.")
+			}
+			// Everything that could stop the institutions being removed is
+			// checked first, so nothing is deleted locally unless the whole
+			// purge can go ahead.
+			var itemIDs []string
+			if purgeRemoveItemsFlag {
+				if viper.GetBool("cli.read_only") && !app.DryRun {
+					Fatal(fmt.Errorf("'%s --remove-items' changes state at Plaid, and plaid-cli is in read-only mode (--read-only or cli.read_only). Use --dry-run to see what it would do", cmd.CommandPath()))
+				}
+				itemIDs, err = app.ResolveItems(nil)
+				if err != nil {
+					Fatal(err)
+				}
+				if !app.DryRun {
+					confirmed, err := app.Production.Require(cmd.CommandPath() + " --remove-items")
+					if err != nil {
+						Fatal(err)
+					}
+					if !confirmed {
+						FatalAborted()
+					}
+				}
+			}
+
+			var summary PurgeSummary
+			err = PurgeTransactions(app.Data, cutoff, app.DryRun, &summary)
+			if err != nil {
+				Fatal(err)
+			}
+			err = PurgeBalances(app.Data, cutoff, app.DryRun, &summary)
+			if err != nil {
+				Fatal(err)
+			}
+			summary.AuditEntries, err = app.AuditLog.PruneBefore(cutoff, app.DryRun)
+			if err != nil {
+				Fatal(err)
+			}
+			if app.DryRun {
+				log.Printf("Dry run: would delete %s from before %s.\n", summary, cutoff.Format("2006-01-02"))
+			} else {
+				log.Printf("Deleted %s from before %s.\n", summary, cutoff.Format("2006-01-02"))
+			}
+
+			if !purgeRemoveItemsFlag {
+				return
+			}
+			for _, itemID := range itemIDs {
+				if app.DryRun {
+					log.Printf("Dry run: would remove %s at Plaid and forget it.\n", ItemName(app.Data, itemID))
+					continue
+				}
+				err := RemoveItem(app.Client, app.Data, itemID)
+				if err != nil {
+					err = fmt.Errorf("%s: %w", ItemName(app.Data, itemID), err)
+					if app.Partial.Tolerate(err) {
+						continue
+					}
+					Fatal(err)
+				}
+			}
+			if err := app.Partial.Err(); err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	purgeCommand.Flags().StringVar(&purgeOlderThanFlag, "older-than", "", "Delete data older than this period, e.g. 90d, 6m or 2y (required)")
+	purgeCommand.Flags().BoolVar(&purgeRemoveItemsFlag, "remove-items", false, "Also remove institutions at Plaid with /item/remove and forget them")
+	err = purgeCommand.MarkFlagRequired("older-than")
+	if err != nil {
+		Fatal(err)
+	}
+
+	reportCommand := &cobra.Command{
+		Use:   "report",
+		Short: T("Summarize spending and account data"),
+	}
+
+	var lastFlag string
+	var topFlag int
+	var byOwnerFlag bool
+	var excludeCategoryFlag []string
+	var compareFlag string
+	var merchantsOutputFormat string
+	reportMerchantsCommand := &cobra.Command{
+		Use:   "merchants [ITEM-ID-OR-ALIAS]",
+		Short: "Rank merchants by total spend",
+		Long:  "Rank merchants by total spend across all linked institutions, or a single institution if one is given. Merchants are grouped by Plaid's merchant name, falling back to a cleaned-up transaction description.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, all, err := app.SelectItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+
+			now := time.Now()
+			from, err := ParsePeriod(lastFlag, now)
+			if err != nil {
+				Fatal(err)
+			}
+			var previousFrom, previousTo time.Time
+			if compareFlag != "" {
+				previousFrom, previousTo, err = ComparisonWindow(compareFlag, from, now)
+				if err != nil {
+					Fatal(err)
+				}
+			}
+
+			members, err := HouseholdMembers(app.Client, app.ItemClient, itemIDs, all, householdOpts)
+			if err != nil {
+				Fatal(err)
+			}
+			exclusions, err := CategoryExclusionsFor(cmd, excludeCategoryFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			splits := HouseholdSplits(members)
+			transactions, owners, err := HouseholdTransactions(members, from, now, includeIgnoredFlag, app.Partial)
+			if err != nil {
+				Fatal(err)
+			}
+			transactions = exclusions.Filter(ApplySplits(splits, transactions))
+
+			if !byOwnerFlag {
+				owners = nil
+			}
+			spending := MerchantSpending(transactions, owners)
+			if compareFlag != "" {
+				previous, _, err := HouseholdTransactions(members, previousFrom, previousTo, includeIgnoredFlag, app.Partial)
+				if err != nil {
+					Fatal(err)
+				}
+				CompareMerchantSpending(spending, MerchantSpending(exclusions.Filter(ApplySplits(splits, previous)), owners))
+			}
+			spending = TopMerchants(spending, topFlag)
+
+			err = DeliverReport(outputOpts, emailOpts, "Merchant spending", merchantsOutputFormat, func(w io.Writer) error {
+				return WriteMerchantSpending(w, spending, merchantsOutputFormat, byOwnerFlag)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+			if err := app.Partial.Err(); err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	reportMerchantsCommand.Flags().StringVar(&lastFlag, "last", "12m", "Period to report on, e.g. 30d, 6w, 12m or 1y")
+	reportMerchantsCommand.Flags().IntVar(&topFlag, "top", 0, "Only show the top N merchants")
+	reportMerchantsCommand.Flags().StringVarP(&merchantsOutputFormat, "output-format", "o", "table", "Output format (table, json or csv)")
+	AddOutputFlags(reportMerchantsCommand, &outputOpts)
+	AddEmailFlags(reportMerchantsCommand, &emailOpts)
+	AddIncludeIgnoredFlag(reportMerchantsCommand, &includeIgnoredFlag)
+	AddHouseholdFlags(reportMerchantsCommand, &householdOpts)
+	AddExcludeCategoryFlag(reportMerchantsCommand, &excludeCategoryFlag)
+	AddCompareFlag(reportMerchantsCommand, &compareFlag)
+	reportMerchantsCommand.Flags().BoolVar(&byOwnerFlag, "by-owner", false, "Rank merchants separately for each owner")
+
+	var holdingsOutputFormat string
+	reportHoldingsCommand := &cobra.Command{
+		Use:   "holdings [ITEM-ID-OR-ALIAS]",
+		Short: "Summarize investment holdings, gains and allocation",
+		Long:  "Summarize investment holdings across all linked institutions, or a single institution if one is given, with unrealized gain or loss and allocation for each security and account.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, allItems, err := app.SelectItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+
+			var positions []HoldingPosition
+			for _, itemID := range itemIDs {
+				err := app.ItemClient.Do(itemID, func(token string) error {
+					res, err := GetHoldings(app.Client, token)
+					if err != nil {
+						return err
+					}
+					FilterHoldings(ActiveIgnores(app.Data, includeIgnoredFlag), res)
+					positions = append(positions, HoldingPositions(ItemName(app.Data, itemID), res)...)
+					return nil
+				})
+				if allItems && IsProductUnavailable(err) {
+					log.Printf("Skipping %s: %s\n", ItemName(app.Data, itemID), PlaidErrorCode(err))
+					continue
+				}
+				if err != nil {
+					Fatal(fmt.Errorf("%s: %w", ItemName(app.Data, itemID), err))
+				}
+			}
+
+			err = DeliverReport(outputOpts, emailOpts, "Holdings", holdingsOutputFormat, func(w io.Writer) error {
+				return WriteHoldingsReport(w, NewHoldingsReport(positions), holdingsOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	reportHoldingsCommand.Flags().StringVarP(&holdingsOutputFormat, "output-format", "o", "table", "Output format (table, json or csv)")
+	AddOutputFlags(reportHoldingsCommand, &outputOpts)
+	AddEmailFlags(reportHoldingsCommand, &emailOpts)
+	AddIncludeIgnoredFlag(reportHoldingsCommand, &includeIgnoredFlag)
+
+	var liabilitiesOutputFormat string
+	var extraPaymentFlag float64
+	reportLiabilitiesCommand := &cobra.Command{
+		Use:   "liabilities [ITEM-ID-OR-ALIAS]",
+		Short: "Summarize credit cards and loans with estimated payoff dates",
+		Long:  "Summarize APRs, minimum payments and due dates for credit cards, mortgages and student loans across all linked institutions, or a single institution if one is given, with an estimate of when each will be paid off at its current payment.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, allItems, err := app.SelectItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+
+			now := time.Now()
+			var liabilities []Liability
+			for _, itemID := range itemIDs {
+				err := app.ItemClient.Do(itemID, func(token string) error {
+					res, err := GetLiabilities(app.Client, token)
+					if err != nil {
+						return err
+					}
+					FilterLiabilities(ActiveIgnores(app.Data, includeIgnoredFlag), res)
+					liabilities = append(liabilities, Liabilities(ItemName(app.Data, itemID), res, extraPaymentFlag, now)...)
+					return nil
+				})
+				if allItems && IsProductUnavailable(err) {
+					log.Printf("Skipping %s: %s\n", ItemName(app.Data, itemID), PlaidErrorCode(err))
+					continue
+				}
+				if err != nil {
+					Fatal(fmt.Errorf("%s: %w", ItemName(app.Data, itemID), err))
+				}
+			}
+
+			err = DeliverReport(outputOpts, emailOpts, "Liabilities", liabilitiesOutputFormat, func(w io.Writer) error {
+				return WriteLiabilities(w, liabilities, liabilitiesOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	reportLiabilitiesCommand.Flags().StringVarP(&liabilitiesOutputFormat, "output-format", "o", "table", "Output format (table, json or csv)")
+	reportLiabilitiesCommand.Flags().Float64Var(&extraPaymentFlag, "extra-payment", 0, "Extra amount to pay each month on top of the minimum when estimating payoff")
+	AddOutputFlags(reportLiabilitiesCommand, &outputOpts)
+	AddEmailFlags(reportLiabilitiesCommand, &emailOpts)
+	AddIncludeIgnoredFlag(reportLiabilitiesCommand, &includeIgnoredFlag)
+
+	var monthFlag string
+	var monthlyOutputFormat string
+	reportMonthlyCommand := &cobra.Command{
+		Use:   "monthly [ITEM-ID-OR-ALIAS]",
+		Short: "Write a statement-style report for a month",
+		Long:  "Write a self-contained, statement-style report for a month covering income, spending by category, the largest transactions and current balances, across all linked institutions or a single institution if one is given.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, all, err := app.SelectItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+
+			now := time.Now()
+			from, to, err := ParseMonth(monthFlag, now)
+			if err != nil {
+				Fatal(err)
+			}
+			var previousFrom, previousTo time.Time
+			if compareFlag != "" {
+				previousFrom, previousTo, err = ComparisonWindow(compareFlag, from, to)
+				if err != nil {
+					Fatal(err)
+				}
+			}
+
+			members, err := HouseholdMembers(app.Client, app.ItemClient, itemIDs, all, householdOpts)
+			if err != nil {
+				Fatal(err)
+			}
+			exclusions, err := CategoryExclusionsFor(cmd, excludeCategoryFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			splits := HouseholdSplits(members)
+			transactions, _, err := HouseholdTransactions(members, from, to, includeIgnoredFlag, app.Partial)
+			if err != nil {
+				Fatal(err)
+			}
+			transactions = exclusions.Filter(ApplySplits(splits, transactions))
+
+			var items []ItemAccounts
+			for _, member := range members {
+				memberData := member.Client.Data
+				for _, itemID := range member.ItemIDs {
+					err = member.Client.Do(itemID, func(token string) error {
+						accounts, err := GetBalances(app.Client, token)
+						if err != nil {
+							return err
+						}
+						accounts = FilterAccounts(ActiveIgnores(memberData, includeIgnoredFlag), accounts)
+						name := ItemName(memberData, itemID)
+						if owner := member.Owner(itemID); owner != "" {
+							name = owner + ": " + name
+						}
+						items = append(items, ItemAccounts{Item: name, Accounts: accounts})
+						return nil
+					})
+					if err != nil {
+						Fatal(fmt.Errorf("%s: %w", ItemName(memberData, itemID), err))
+					}
+				}
+			}
+
+			report := BuildMonthlyReport(from, items, transactions, now)
+			if compareFlag != "" {
+				previous, _, err := HouseholdTransactions(members, previousFrom, previousTo, includeIgnoredFlag, app.Partial)
+				if err != nil {
+					Fatal(err)
+				}
+				previous = exclusions.Filter(ApplySplits(splits, previous))
+				CompareMonthlyReports(&report, BuildMonthlyReport(previousFrom, nil, previous, now), previousFrom.Format("2006-01"))
+			}
+
+			err = DeliverReport(outputOpts, emailOpts, fmt.Sprintf("%s statement", from.Format("January 2006")), monthlyOutputFormat, func(w io.Writer) error {
+				return WriteMonthlyReport(w, report, monthlyOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+			if err := app.Partial.Err(); err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	reportMonthlyCommand.Flags().StringVar(&monthFlag, "month", "", "Month to report on, e.g. 2024-05 (defaults to last month)")
+	reportMonthlyCommand.Flags().StringVarP(&monthlyOutputFormat, "output-format", "o", "html", "Output format (html or json)")
+	reportMonthlyCommand.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		// Accept --format, which reads more naturally for documents.
+		if name == "format" {
+			name = "output-format"
+		}
+		return pflag.NormalizedName(name)
+	})
+	AddOutputFlags(reportMonthlyCommand, &outputOpts)
+	AddEmailFlags(reportMonthlyCommand, &emailOpts)
+	AddIncludeIgnoredFlag(reportMonthlyCommand, &includeIgnoredFlag)
+	AddHouseholdFlags(reportMonthlyCommand, &householdOpts)
+	AddExcludeCategoryFlag(reportMonthlyCommand, &excludeCategoryFlag)
+	AddCompareFlag(reportMonthlyCommand, &compareFlag)
+
+	var savingsMonthsFlag int
+	var savingsRefreshFlag bool
+	var savingsOutputFormat string
+	reportSavingsRateCommand := &cobra.Command{
+		Use:   "savings-rate [ITEM-ID-OR-ALIAS]",
+		Short: "Track how much of your income you save each month",
+		Long:  "Show income, spending and the share of income saved for each of the last few complete months, across all linked institutions or a single institution if one is given. Which inflows count as income is set under [savings_rate] in the config file. Months are remembered once worked out, so tracking the rate over time doesn't fetch them again.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, all, err := app.SelectItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+			if savingsMonthsFlag < 1 {
+				FatalUsage("--months must be at least 1.")
+			}
+
+			members, err := HouseholdMembers(app.Client, app.ItemClient, itemIDs, all, householdOpts)
+			if err != nil {
+				Fatal(err)
+			}
+			exclusions, err := CategoryExclusionsFor(cmd, excludeCategoryFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			opts := SavingsOptions{
+				Rules:          IncomeRulesFromViper(),
+				Exclusions:     exclusions,
+				IncludeIgnored: includeIgnoredFlag,
+				Refresh:        savingsRefreshFlag,
+			}
+			rates, err := SavingsRates(members, savingsMonthsFlag, time.Now(), opts, app.Partial)
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = DeliverReport(outputOpts, emailOpts, "Savings rate", savingsOutputFormat, func(w io.Writer) error {
+				return WriteSavingsRates(w, rates, savingsOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+			if err := app.Partial.Err(); err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	reportSavingsRateCommand.Flags().IntVar(&savingsMonthsFlag, "months", 12, "Number of complete months to show")
+	reportSavingsRateCommand.Flags().BoolVar(&savingsRefreshFlag, "refresh", false, "Fetch every month again instead of using the ones remembered")
+	reportSavingsRateCommand.Flags().StringVarP(&savingsOutputFormat, "output-format", "o", "table", "Output format (table, json or csv)")
+	AddOutputFlags(reportSavingsRateCommand, &outputOpts)
+	AddEmailFlags(reportSavingsRateCommand, &emailOpts)
+	AddIncludeIgnoredFlag(reportSavingsRateCommand, &includeIgnoredFlag)
+	AddHouseholdFlags(reportSavingsRateCommand, &householdOpts)
+	AddExcludeCategoryFlag(reportSavingsRateCommand, &excludeCategoryFlag)
+
+	var netWorthLastFlag string
+	var netWorthRefreshFlag bool
+	var netWorthOutputFormat string
+	reportNetWorthCommand := &cobra.Command{
+		Use:   "net-worth",
+		Short: "Track net worth over time",
+		Long:  "Show assets, liabilities and net worth on each day balances were recorded, from linked institutions (every time `balances` runs) and manual accounts (see `plaid-cli manual`). Credit cards and loans count as liabilities. Pass --refresh to fetch and record every institution's current balances first.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			now := time.Now()
+			from, err := ParsePeriod(netWorthLastFlag, now)
+			if err != nil {
+				Fatal(err)
+			}
+
+			if netWorthRefreshFlag {
+				for _, itemID := range SortedItemIDs(app.Data) {
+					err := app.ItemClient.Do(itemID, func(token string) error {
+						accounts, err := GetBalances(app.Client, token)
+						if err != nil {
+							return err
+						}
+						return RecordBalances(app.Data, itemID, accounts, now)
+					})
+					if err != nil {
+						err = fmt.Errorf("%s: %w", ItemName(app.Data, itemID), err)
+						if app.Partial.Tolerate(err) {
+							continue
+						}
+						Fatal(err)
+					}
+				}
+			}
+
+			history := NetWorthHistory(app.Data, from, ActiveIgnores(app.Data, includeIgnoredFlag))
+			err = DeliverReport(outputOpts, emailOpts, "Net worth", netWorthOutputFormat, func(w io.Writer) error {
+				return WriteNetWorth(w, history, netWorthOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+			if err := app.Partial.Err(); err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	reportNetWorthCommand.Flags().StringVar(&netWorthLastFlag, "last", "12m", "Period to report on, e.g. 30d, 6w, 12m or 1y")
+	reportNetWorthCommand.Flags().BoolVar(&netWorthRefreshFlag, "refresh", false, "Fetch and record current balances for every institution first")
+	reportNetWorthCommand.Flags().StringVarP(&netWorthOutputFormat, "output-format", "o", "table", "Output format (table, json or csv)")
+	AddOutputFlags(reportNetWorthCommand, &outputOpts)
+	AddEmailFlags(reportNetWorthCommand, &emailOpts)
+	AddIncludeIgnoredFlag(reportNetWorthCommand, &includeIgnoredFlag)
+
+	reportCommand.AddCommand(reportMerchantsCommand)
+	reportCommand.AddCommand(reportHoldingsCommand)
+	reportCommand.AddCommand(reportLiabilitiesCommand)
+	reportCommand.AddCommand(reportMonthlyCommand)
+	reportCommand.AddCommand(reportNetWorthCommand)
+	reportCommand.AddCommand(reportSavingsRateCommand)
+
+	var historyFlag string
+	var subscriptionsOutputFormat string
+	subscriptionsCommand := &cobra.Command{
+		Use:   "subscriptions [ITEM-ID-OR-ALIAS]",
+		Short: T("List active subscriptions and what they cost each month"),
+		Long:  "List active subscriptions and what they cost each month. Recurring payments detected by Plaid are combined with plaid-cli's own detection over recent transaction history, which catches subscriptions Plaid hasn't picked up yet.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			itemIDs, all, err := app.SelectItems(args)
+			if err != nil {
+				Fatal(err)
+			}
+
+			now := time.Now()
+			from, err := ParsePeriod(historyFlag, now)
+			if err != nil {
+				Fatal(err)
+			}
+
+			members, err := HouseholdMembers(app.Client, app.ItemClient, itemIDs, all, householdOpts)
+			if err != nil {
+				Fatal(err)
+			}
+			var fromPlaid []Subscription
+			for _, member := range members {
+				memberData := member.Client.Data
+				for _, itemID := range member.ItemIDs {
+					err = member.Client.Do(itemID, func(token string) error {
+						streams, err := GetRecurringOutflows(app.Client, token)
+						if err != nil {
+							return err
+						}
+						subscriptions := PlaidSubscriptions(streams)
+						fromPlaid = append(fromPlaid, FilterSubscriptions(ActiveIgnores(memberData, includeIgnoredFlag), subscriptions)...)
+						return nil
+					})
+					if err != nil {
+						Fatal(fmt.Errorf("%s: %w", ItemName(memberData, itemID), err))
+					}
+				}
+			}
+
+			transactions, owners, err := HouseholdTransactions(members, from, now, includeIgnoredFlag, app.Partial)
+			if err != nil {
+				Fatal(err)
+			}
+
+			subscriptions := LabelSubscriptionOwners(MergeSubscriptions(fromPlaid, DetectSubscriptions(transactions, now)), owners)
+			byOwner := anyOwner(owners)
+
+			err = DeliverReport(outputOpts, emailOpts, "Subscriptions", subscriptionsOutputFormat, func(w io.Writer) error {
+				return WriteSubscriptions(w, subscriptions, subscriptionsOutputFormat, byOwner)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+			if err := app.Partial.Err(); err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	subscriptionsCommand.Flags().StringVar(&historyFlag, "history", "13m", "How much transaction history to search for recurring payments, e.g. 6m or 2y")
+	subscriptionsCommand.Flags().StringVarP(&subscriptionsOutputFormat, "output-format", "o", "table", "Output format (table, json or csv)")
+	AddOutputFlags(subscriptionsCommand, &outputOpts)
+	AddEmailFlags(subscriptionsCommand, &emailOpts)
+	AddIncludeIgnoredFlag(subscriptionsCommand, &includeIgnoredFlag)
+	AddHouseholdFlags(subscriptionsCommand, &householdOpts)
+
+	var historySinceFlag string
+	var historyCommandFlag string
+	var historyOutputFormat string
+	historyCommand := &cobra.Command{
+		Use:         "history",
+		Short:       T("Show the commands plaid-cli has run"),
+		Long:        "Show the commands plaid-cli has run: when, in which environment, the institutions they used, how many transactions, accounts or other records they output, how long they took and their exit code. The history is only kept on this machine, in history.log in the data directory, and records what was run, never what was fetched. Use --item to show a single institution, e.g. to find when it was last exported. Entries older than cli.history_retention_days are removed; set cli.history to false to stop recording.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			filter := HistoryFilter{Command: historyCommandFlag}
+			if historySinceFlag != "" {
+				since, err := ParsePeriod(historySinceFlag, time.Now())
+				if err != nil {
+					Fatal(err)
+				}
+				filter.Since = since
+			}
+
+			if len(app.ItemFlags) > 0 {
+				// As for the audit log, aliases are resolved with the
+				// current environment's data, and removed items are
+				// matched by ID.
+				environment := strings.ToLower(viper.GetString("plaid.environment"))
+				loaded, err := plaid_cli.LoadData(app.DataDir, environment, viper.GetString("cli.token_key_file"))
+				if err != nil {
+					Fatal(err)
+				}
+				for _, itemOrAlias := range app.ItemFlags {
+					itemID, err := ResolveItem(loaded, itemOrAlias)
+					if err != nil {
+						itemID = itemOrAlias
+					}
+					filter.Items = append(filter.Items, itemID)
+				}
+			}
+
+			entries, err := app.History.Read()
+			if err != nil {
+				Fatal(err)
+			}
+
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteHistory(w, filter.Filter(entries), historyOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	historyCommand.Flags().StringVar(&historySinceFlag, "since", "", "Only show commands run this long ago, e.g. 7d, 4w or 3m")
+	historyCommand.Flags().StringVar(&historyCommandFlag, "command", "", "Only show runs of this command, e.g. export")
+	historyCommand.Flags().StringVarP(&historyOutputFormat, "output-format", "o", "table", "Output format (table or json)")
+	AddOutputFlags(historyCommand, &outputOpts)
+
+	rootCommand := &cobra.Command{
+		Use:   "plaid-cli",
+		Short: T("Link bank accounts and get transactions from the command line."),
+		Long: "plaid-cli" + decoration.Emoji(" 🤑") + `
+
+plaid-cli is a CLI tool for working with the Plaid API.
+
+You can use plaid-cli to link bank accounts and pull transactions in multiple 
+output formats from the comfort of the command line.
+
+Configuration:
+  To get started, you'll need Plaid API credentials, which you can get by visiting
+  https://dashboard.plaid.com/team/keys after signing up for free.
+  
+  plaid-cli will look at the following environment variables for API credentials:
+  
+    PLAID_CLIENT_ID=<client id>
+    PLAID_SECRET=<sandbox or production secret>
+    PLAID_ENVIRONMENT=sandbox # or production
+    PLAID_LANGUAGE=en  # optional, detected using system's locale
+    PLAID_COUNTRIES=US # optional, detected using system's locale
+    PLAID_PRODUCTS=transactions,auth # optional, products to request when linking
+  
+  I recommend setting and exporting these on shell startup.
+  
+  API credentials can also be specified using a config file located at 
+  ~/.plaid-cli/config.toml:
+  
+    [plaid]
+    client_id = "<client id>"
+    secret = "<sandbox or production secret>"
+    environment = "sandbox"
+  
+  After setting those API credentials, plaid-cli is ready to use! 
+  You'll probably want to run 'plaid-cli item link' next.
+  
+  Please see the README (https://github.com/landakram/plaid-cli/blob/master/README.md) 
+  for more detailed usage instructions.
+
+  Made by @landakram.
+`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			if validatesConfig(cmd) {
+				err := ValidateConfig(viper.ConfigFileUsed())
+				if err != nil {
+					Fatal(err)
+				}
+			}
+
+			// Looking at the history isn't worth recording in it.
+			if viper.GetBool("cli.history") && cmd != historyCommand {
+				retention := time.Duration(viper.GetInt("cli.history_retention_days")) * 24 * time.Hour
+				err := app.History.Prune(retention)
+				if err != nil {
+					log.Printf("⚠️  Failed to prune the command history %s: %v", app.History.Path, err)
+				}
+				app.History.Start(cmd.CommandPath())
+			}
+
+			if app.StdinItems {
+				stdinItems, err := ReadItemList(os.Stdin)
+				if err != nil {
+					Fatal(err)
+				}
+				// An empty list, e.g. when no items matched a filter,
+				// mustn't fall back to every item.
+				if len(stdinItems) == 0 {
+					log.Println(T("No items on stdin, nothing to do."))
+					err = app.History.Finish(ExitOK)
+					if err != nil {
+						log.Printf("⚠️  Failed to write to the command history %s: %v", app.History.Path, err)
+					}
+					os.Exit(ExitOK)
+				}
+				app.ItemFlags = append(app.ItemFlags, stdinItems...)
+			}
+
+			if cmd.Annotations[standaloneAnnotation] == "true" {
+				return
+			}
+
+			err := ResolveCredentials()
+			if err != nil {
+				Fatal(err)
+			}
+
+			if !viper.IsSet("plaid.client_id") {
+				log.Println(T("⚠️  PLAID_CLIENT_ID not set. Please see the configuration instructions below."))
+				err := cmd.Root().Help()
+				if err != nil {
+					Fatal(err)
+				}
+				os.Exit(ExitConfig)
+			}
+			if !viper.IsSet("plaid.secret") {
+				log.Println(T("⚠️  PLAID_SECRET not set. Please see the configuration instructions below."))
+				err := cmd.Root().Help()
+				if err != nil {
+					Fatal(err)
+				}
+				os.Exit(ExitConfig)
+			}
+
+			environment := app.ConfigureClient(cmd.CommandPath())
+			app.Production.Environment = environment
+			app.History.SetEnvironment(environment)
+			if cmd.Flag("environment").Changed {
+				// Legacy data belongs to the configured environment, not
+				// one chosen for this command.
+				legacy, err := plaid_cli.HasLegacyData(app.DataDir)
+				if err != nil {
+					Fatal(err)
+				}
+				if legacy {
+					log.Printf("⚠️  Data saved before environments were kept separate is still in %s. Run a command without --environment to move it to the configured plaid.environment.", filepath.Join(app.DataDir, "data"))
+				}
+			} else {
+				err := plaid_cli.MigrateLegacyData(app.DataDir, environment)
+				if err != nil {
+					Fatal(err)
+				}
+			}
+			loaded, err := plaid_cli.LoadData(app.DataDir, environment, viper.GetString("cli.token_key_file"))
+			if err != nil {
+				Fatal(err)
+			}
+			*app.Data = *loaded
+
+			if viper.GetBool("cli.audit") {
+				retention := time.Duration(viper.GetInt("cli.audit_retention_days")) * 24 * time.Hour
+				err = app.AuditLog.Prune(retention)
+				if err != nil {
+					log.Printf("⚠️  Failed to prune the audit log %s: %v", app.AuditLog.Path, err)
+				}
+			}
+
+			if !app.DryRun {
+				_, err = ApplyRetention(app.Data, time.Now())
+				if err != nil {
+					Fatal(err)
+				}
+			}
+
+			if pageSize := viper.GetInt("cli.page_size"); pageSize < 1 || pageSize > MaxTransactionsPageSize {
+				FatalConfig(fmt.Sprintf("⚠️  Invalid page size %d. --page-size (or cli.page_size) must be between 1 and %d.", pageSize, MaxTransactionsPageSize))
+			}
+
+			readOnly := viper.GetBool("cli.read_only")
+			if readOnly && cmd.Annotations[mutatingAnnotation] == "true" && !app.DryRun {
+				Fatal(fmt.Errorf("'%s' changes state at Plaid, and plaid-cli is in read-only mode (--read-only or cli.read_only). Use --dry-run to see what it would do", cmd.CommandPath()))
+			}
+			app.Data.ReadOnly = readOnly
+
+			if cmd.Annotations[mutatingAnnotation] == "true" && cmd.Annotations[confirmsAnnotation] != "true" && !app.DryRun {
+				confirmed, err := app.Production.Require(cmd.CommandPath())
+				if err != nil {
+					Fatal(err)
+				}
+				if !confirmed {
+					FatalAborted()
+				}
+			}
+
+			err = app.Data.SetTokenEncryption(viper.GetString("cli.token_encryption"))
+			if err != nil {
+				FatalConfig(err.Error())
+			}
+
+			app.Linker.DryRun = app.DryRun
+			// Relinking writes a new access token.
+			if app.NoRelink || readOnly {
+				viper.Set("cli.auto_relink", false)
+			}
+
+			days := viper.GetInt("cli.consent_warning_days")
+			WarnExpiringConsents(app.Data, time.Duration(days)*24*time.Hour)
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			err := app.History.Finish(0)
+			if err != nil {
+				log.Printf("⚠️  Failed to write to the command history %s: %v", app.History.Path, err)
+			}
+		},
+	}
+	rootCommand.PersistentFlags().BoolVar(&app.DryRun, "dry-run", false, "Print the Plaid requests that mutating commands would make instead of sending them")
+	rootCommand.PersistentFlags().StringArrayVar(&app.ItemFlags, "item", nil, "Institution (item ID or alias) to use. Repeat for several, or use all")
+	rootCommand.PersistentFlags().BoolVar(&app.StdinItems, "stdin-items", false, "Also use the institutions (item IDs or aliases) read from stdin, one per line")
+	rootCommand.PersistentFlags().String("environment", "", "Plaid environment to use for this command (sandbox or production), overriding plaid.environment")
+	err = viper.BindPFlag("plaid.environment", rootCommand.PersistentFlags().Lookup("environment"))
+	if err != nil {
+		Fatal(err)
+	}
+	rootCommand.PersistentFlags().BoolVar(&app.NoRelink, "no-relink", false, "Fail instead of offering to relink institutions whose login has expired")
+	rootCommand.PersistentFlags().Bool("verbose", false, "Log every request to Plaid with its status, duration and request ID")
+	err = viper.BindPFlag("cli.verbose", rootCommand.PersistentFlags().Lookup("verbose"))
+	if err != nil {
+		Fatal(err)
+	}
+	rootCommand.PersistentFlags().Int("page-size", 100, fmt.Sprintf("Transactions to fetch per request, up to %d", MaxTransactionsPageSize))
+	err = viper.BindPFlag("cli.page_size", rootCommand.PersistentFlags().Lookup("page-size"))
+	if err != nil {
+		Fatal(err)
+	}
+	AddUnmaskFlag(rootCommand, app.Mask)
+	AddYesFlag(rootCommand, app.Production)
+	AddNoColorFlag(rootCommand, decoration)
+	rootCommand.PersistentFlags().BoolVar(&app.Partial.Allow, "allow-partial", false, "If fetching transactions fails partway, output what was fetched and exit with code 6 instead of failing")
+	rootCommand.PersistentFlags().Bool("read-only", false, "Refuse to run commands that change state at Plaid or write access tokens")
+	err = viper.BindPFlag("cli.read_only", rootCommand.PersistentFlags().Lookup("read-only"))
+	if err != nil {
+		Fatal(err)
+	}
+
+	var auditSinceFlag string
+	var auditOutputFormat string
+	auditCommand := &cobra.Command{
+		Use:         "audit",
+		Short:       T("Show the log of requests made to Plaid"),
+		Long:        "Show the log of requests plaid-cli has made to Plaid: when, from which command, for which institution, the endpoint, Plaid's request ID and the outcome. Access tokens are never logged. Use --item to show a single institution. Entries older than cli.audit_retention_days are removed.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			filter := AuditFilter{}
+			if auditSinceFlag != "" {
+				since, err := ParsePeriod(auditSinceFlag, time.Now())
+				if err != nil {
+					Fatal(err)
+				}
+				filter.Since = since
+			}
 
-plaid-cli is a CLI tool for working with the Plaid API.
+			if len(app.ItemFlags) > 0 {
+				// Aliases can only be resolved once data is loaded, which
+				// standalone commands otherwise skip. Items that have since
+				// been removed are matched by ID.
+				environment := strings.ToLower(viper.GetString("plaid.environment"))
+				loaded, err := plaid_cli.LoadData(app.DataDir, environment, viper.GetString("cli.token_key_file"))
+				if err != nil {
+					Fatal(err)
+				}
+				for _, itemOrAlias := range app.ItemFlags {
+					itemID, err := ResolveItem(loaded, itemOrAlias)
+					if err != nil {
+						itemID = itemOrAlias
+					}
+					filter.Items = append(filter.Items, itemID)
+				}
+			}
 
-You can use plaid-cli to link bank accounts and pull transactions in multiple 
-output formats from the comfort of the command line.
+			entries, err := app.AuditLog.Read()
+			if err != nil {
+				Fatal(err)
+			}
 
-Configuration:
-  To get started, you'll need Plaid API credentials, which you can get by visiting
-  https://dashboard.plaid.com/team/keys after signing up for free.
-  
-  plaid-cli will look at the following environment variables for API credentials:
-  
-    PLAID_CLIENT_ID=<client id>
-    PLAID_SECRET=<devlopment secret>
-    PLAID_ENVIRONMENT=development
-    PLAID_LANGUAGE=en  # optional, detected using system's locale
-    PLAID_COUNTRIES=US # optional, detected using system's locale
-  
-  I recommend setting and exporting these on shell startup.
-  
-  API credentials can also be specified using a config file located at 
-  ~/.plaid-cli/config.toml:
-  
-    [plaid]
-    client_id = "<client id>"
-    secret = "<development secret>"
-    environment = "development"
-  
-  After setting those API credentials, plaid-cli is ready to use! 
-  You'll probably want to run 'plaid-cli link' next.
-  
-  Please see the README (https://github.com/landakram/plaid-cli/blob/master/README.md) 
-  for more detailed usage instructions.
+			err = WriteOutput(outputOpts, func(w io.Writer) error {
+				return WriteAuditEntries(w, filter.Filter(entries), auditOutputFormat)
+			})
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+	auditCommand.Flags().StringVar(&auditSinceFlag, "since", "", "Only show requests from this long ago, e.g. 7d, 4w or 3m")
+	auditCommand.Flags().StringVarP(&auditOutputFormat, "output-format", "o", "table", "Output format (table or json)")
+	AddOutputFlags(auditCommand, &outputOpts)
 
-  Made by @landakram.
-`,
+	var debugBundleSinceFlag string
+	var debugBundleOutputFlag string
+	debugBundleCommand := &cobra.Command{
+		Use:         "debug-bundle",
+		Short:       T("Collect diagnostics to attach to a bug report"),
+		Long:        "Write a zip file to attach to a GitHub issue, with plaid-cli's version, its configuration with credentials redacted, recent audit log entries and the most recent failed requests with their Plaid request IDs. Access tokens are never included. Look inside before sharing it: item IDs, institution names and file paths from the config file are kept.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			now := time.Now()
+			since, err := ParsePeriod(debugBundleSinceFlag, now)
+			if err != nil {
+				Fatal(err)
+			}
+			path := debugBundleOutputFlag
+			if path == "" {
+				path = DefaultDebugBundlePath(now)
+			}
+
+			err = WriteDebugBundle(path, app.AuditLog, since, now)
+			if err != nil {
+				Fatal(err)
+			}
+			log.Printf("Wrote %s. Attach it to your issue at https://github.com/landakram/plaid-cli/issues.\n", path)
+		},
 	}
-	rootCommand.AddCommand(linkCommand)
-	rootCommand.AddCommand(tokensCommand)
-	rootCommand.AddCommand(aliasCommand)
-	rootCommand.AddCommand(aliasesCommand)
-	rootCommand.AddCommand(accountsCommand)
-	rootCommand.AddCommand(transactionsCommand)
-	rootCommand.AddCommand(insitutionCommand)
-
-	if !viper.IsSet("plaid.client_id") {
-		log.Println("⚠️  PLAID_CLIENT_ID not set. Please see the configuration instructions below.")
-		err = rootCommand.Help()
-		if err != nil {
-			log.Fatalln(err)
+	debugBundleCommand.Flags().StringVar(&debugBundleSinceFlag, "since", "7d", "Include audit log entries from this long ago, e.g. 7d, 4w or 3m")
+	debugBundleCommand.Flags().StringVarP(&debugBundleOutputFlag, "output-file", "O", "", "File to write the bundle to (default plaid-cli-debug-<time>.zip)")
+
+	configCommand := &cobra.Command{
+		Use:         "config",
+		Short:       T("Manage plaid-cli's configuration"),
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+	}
+
+	var keyFileFlag string
+	var encryptClientIDFlag bool
+	encryptSecretCommand := &cobra.Command{
+		Use:   "encrypt-secret",
+		Short: "Encrypt the Plaid secret for the config file",
+		Long: `Encrypt the Plaid secret (or client ID, with --client-id) and print a secret_encrypted setting to paste under [plaid] in the config file.
+
+By default the secret is encrypted with a passphrase, which plaid-cli asks for whenever it talks to Plaid. With --key-file, it's encrypted for an age key instead, which is created if it doesn't exist; set plaid.secret_key_file to the same path so plaid-cli can decrypt it without asking.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			setting := "secret"
+			if encryptClientIDFlag {
+				setting = "client_id"
+			}
+
+			secretPrompt := promptui.Prompt{Label: fmt.Sprintf("Plaid %s", strings.ReplaceAll(setting, "_", " ")), Mask: '*'}
+			secret, err := secretPrompt.Run()
+			if err != nil {
+				Fatal(err)
+			}
+
+			var passphrase string
+			if keyFileFlag != "" {
+				_, err = os.Stat(keyFileFlag)
+				if errors.Is(err, os.ErrNotExist) {
+					err = GenerateKeyFile(keyFileFlag)
+					if err != nil {
+						Fatal(err)
+					}
+					log.Printf("Created a new key in %s. Keep a backup of it: the secret can't be decrypted without it.", keyFileFlag)
+				}
+			} else {
+				passphrase, err = promptPassphrase()
+				if err != nil {
+					Fatal(err)
+				}
+				confirmPrompt := promptui.Prompt{Label: "Confirm passphrase", Mask: '*'}
+				confirmation, err := confirmPrompt.Run()
+				if err != nil {
+					Fatal(err)
+				}
+				if confirmation != passphrase {
+					Fatal(errors.New("Passphrases don't match."))
+				}
+			}
+
+			encrypted, err := EncryptSecret(secret, keyFileFlag, passphrase)
+			if err != nil {
+				Fatal(err)
+			}
+			fmt.Printf("%s_encrypted = %q\n", setting, encrypted)
+		},
+	}
+	encryptSecretCommand.Flags().StringVar(&keyFileFlag, "key-file", viper.GetString("plaid.secret_key_file"), "age key file to encrypt for instead of a passphrase. Created if it doesn't exist")
+	encryptSecretCommand.Flags().BoolVar(&encryptClientIDFlag, "client-id", false, "Encrypt the client ID instead of the secret")
+	configCommand.AddCommand(encryptSecretCommand)
+
+	initCommand := &cobra.Command{
+		Use:   "init",
+		Short: T("Set up plaid-cli with your Plaid API credentials"),
+		Long: `Ask for the Plaid client ID, secret, environment, countries and language, check the credentials with Plaid, and save them under [plaid] in the config file, which only you can read. Only those settings are changed, in place; the rest of the config file, comments included, is kept as it is.
+
+Afterwards, plaid-cli offers to link your first institution.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			path := viper.ConfigFileUsed()
+			if path == "" {
+				path = filepath.Join(app.DataDir, "config.toml")
+			}
+
+			environment := strings.ToLower(viper.GetString("plaid.environment"))
+			if environment != "production" {
+				environment = "sandbox"
+			}
+			config, err := PromptInitConfig(InitConfig{
+				ClientID:    viper.GetString("plaid.client_id"),
+				Environment: environment,
+				Countries:   viper.GetStringSlice("plaid.countries"),
+				Language:    viper.GetString("plaid.language"),
+			})
+			if err != nil {
+				Fatal(err)
+			}
+
+			log.Println("Your client ID and secrets are on https://dashboard.plaid.com/team/keys.")
+			for {
+				config, err = PromptCredentials(config)
+				if err != nil {
+					Fatal(err)
+				}
+				err = CheckCredentials(NewCredentialsClient(config), config.CountryCodes())
+				if err == nil {
+					break
+				}
+				if _, isPlaidErr := AsPlaidError(err); !isPlaidErr {
+					Fatal(err)
+				}
+				log.Printf("⚠️  Plaid didn't accept those credentials for %s: %v\n", config.Environment, NormalizeError(err))
+			}
+			log.Printf("Plaid accepted the credentials for %s.\n", config.Environment)
+
+			if app.DryRun {
+				log.Printf("Dry run: would save the configuration to %s\n", path)
+				return
+			}
+			err = WriteInitConfig(path, config)
+			if err != nil {
+				Fatal(err)
+			}
+			log.Printf("Saved the configuration to %s.\n", path)
+			for _, env := range []string{"PLAID_CLIENT_ID", "PLAID_SECRET", "PLAID_ENVIRONMENT"} {
+				if os.Getenv(env) != "" {
+					log.Printf("⚠️  %s is set in your environment, and takes precedence over the config file.\n", env)
+				}
+			}
+
+			link, err := Confirm(T("Link an institution now"))
+			if err != nil {
+				Fatal(err)
+			}
+			if !link {
+				log.Println("Run `plaid-cli item link` when you're ready to link an institution.")
+				return
+			}
+			executable, err := os.Executable()
+			if err != nil {
+				Fatal(err)
+			}
+			linkCmd := exec.Command(executable, "item", "link")
+			linkCmd.Stdin = os.Stdin
+			linkCmd.Stdout = os.Stdout
+			linkCmd.Stderr = os.Stderr
+			err = linkCmd.Run()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.ExitCode())
+			}
+			if err != nil {
+				Fatal(err)
+			}
+		},
+	}
+
+	var authCheckOutputFormat string
+	authCheckCommand := &cobra.Command{
+		Use:   "auth-check",
+		Short: T("Check the Plaid credentials and which products they can use"),
+		Long: `Check that the client ID and secret are valid for the configured environment, and which products the Plaid account is enabled for in the configured countries.
+
+Products are checked by creating a link token for each, without opening Link: transactions, auth, identity, investments, liabilities and assets, and any others in plaid.products. Exits with code 3 if the credentials are invalid or a product in plaid.products isn't enabled.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := AppFrom(cmd)
+			environment := strings.ToLower(viper.GetString("plaid.environment"))
+			if app.DryRun {
+				log.Printf("Dry run: would check the credentials for %s and create a link token for each product\n", environment)
+				return
+			}
+
+			err := CheckCredentials(app.Client, app.Countries)
+			if err != nil {
+				if _, isPlaidErr := AsPlaidError(err); isPlaidErr {
+					log.Printf("⚠️  The client ID and secret aren't valid for %s. Check them at https://dashboard.plaid.com/team/keys.\n", environment)
+				}
+				Fatal(err)
+			}
+
+			toCheck := authCheckProducts
+			for _, product := range app.Products {
+				if !slices.Contains(toCheck, product) {
+					toCheck = append(toCheck, product)
+				}
+			}
+			checks, err := CheckProducts(app.Linker, toCheck)
+			if err != nil {
+				Fatal(err)
+			}
+			if known, _ := CheckPlaidLanguage(viper.GetString("plaid.language")); !known {
+				log.Printf("⚠️  %s isn't a language plaid-cli lists for Plaid Link. The link tokens created for the products below show whether Plaid accepts it.\n", viper.GetString("plaid.language"))
+			}
+
+			err = WriteAuthCheck(os.Stdout, AuthCheck{Environment: environment, Products: checks}, authCheckOutputFormat)
+			if err != nil {
+				Fatal(err)
+			}
+			for _, check := range checks {
+				if !check.Enabled && slices.Contains(app.Products, plaid.Products(check.Product)) {
+					log.Printf("⚠️  %s is in plaid.products but isn't enabled. Request access at https://dashboard.plaid.com/overview.\n", check.Product)
+					os.Exit(ExitAuth)
+				}
+			}
+		},
+	}
+	authCheckCommand.Flags().StringVarP(&authCheckOutputFormat, "output-format", "o", "table", "Output format (json or table)")
+
+	var docsDirFlag string
+	var docsFormatFlag string
+	genDocsCommand := &cobra.Command{
+		Use:         "gen-docs",
+		Short:       "Generate man pages or markdown docs for every command",
+		Args:        cobra.NoArgs,
+		Hidden:      true,
+		Annotations: map[string]string{standaloneAnnotation: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := GenerateDocs(cmd.Root(), docsDirFlag, docsFormatFlag)
+			if err != nil {
+				Fatal(err)
+			}
+			log.Printf("Wrote %s docs to %s", docsFormatFlag, docsDirFlag)
+		},
+	}
+	genDocsCommand.Flags().StringVar(&docsDirFlag, "dir", "docs", "Directory to write the docs to")
+	genDocsCommand.Flags().StringVar(&docsFormatFlag, "format", "markdown", "Docs format (man or markdown)")
+
+	itemCommand.AddCommand(itemsCommand)
+	itemCommand.AddCommand(linkCommand)
+	itemCommand.AddCommand(relinkCommand)
+	itemCommand.AddCommand(reconsentCommand)
+	itemCommand.AddCommand(aliasCommand)
+	itemCommand.AddCommand(aliasesCommand)
+	itemCommand.AddCommand(tokensCommand)
+	itemCommand.AddCommand(insitutionCommand)
+
+	transactionsCommand.AddCommand(categoriesCommand)
+	transactionsCommand.AddCommand(enrichCommand)
+	transactionsCommand.AddCommand(ignoreCommand)
+	transactionsCommand.AddCommand(importCommand)
+	transactionsCommand.AddCommand(schemaCommand)
+	transactionsCommand.AddCommand(splitCommand)
+
+	exportCommand.AddCommand(pushCommand)
+	exportCommand.AddCommand(mapAccountsCommand)
+
+	reportCommand.AddCommand(subscriptionsCommand)
+
+	AddCommandGroups(rootCommand)
+	AddGroupedCommands(rootCommand, groupInstitutions, itemCommand, accountsCommand, balancesCommand, manualCommand, sandboxCommand)
+	AddGroupedCommands(rootCommand, groupTransactions, transactionsCommand, exportCommand, reportCommand)
+	AddGroupedCommands(rootCommand, groupProducts, assetsCommand, incomeCommand, transferCommand, paymentCommand)
+	AddGroupedCommands(rootCommand, groupAutomation, batchCommand, daemonCommand, serveCommand, webhooksCommand)
+	AddGroupedCommands(rootCommand, groupSetup, initCommand, configCommand, authCheckCommand, auditCommand, historyCommand, purgeCommand, debugBundleCommand, versionCommand, genDocsCommand)
+
+	// The flat commands that moved into namespaces.
+	AddFlatAlias(rootCommand, "items", itemsCommand)
+	AddFlatAlias(rootCommand, linkCommand.Use, linkCommand)
+	AddFlatAlias(rootCommand, relinkCommand.Use, relinkCommand)
+	AddFlatAlias(rootCommand, reconsentCommand.Use, reconsentCommand)
+	AddFlatAlias(rootCommand, aliasCommand.Use, aliasCommand)
+	AddFlatAlias(rootCommand, aliasesCommand.Use, aliasesCommand)
+	AddFlatAlias(rootCommand, tokensCommand.Use, tokensCommand)
+	AddFlatAlias(rootCommand, insitutionCommand.Use, insitutionCommand)
+	AddFlatAlias(rootCommand, categoriesCommand.Use, categoriesCommand)
+	AddFlatAlias(rootCommand, enrichCommand.Use, enrichCommand)
+	AddFlatAlias(rootCommand, ignoreCommand.Use, ignoreCommand)
+	AddFlatAlias(rootCommand, importCommand.Use, importCommand)
+	AddFlatAlias(rootCommand, splitCommand.Use, splitCommand)
+	AddFlatAlias(rootCommand, pushCommand.Use, pushCommand)
+	AddFlatAlias(rootCommand, mapAccountsCommand.Use, mapAccountsCommand)
+	AddFlatAlias(rootCommand, subscriptionsCommand.Use, subscriptionsCommand)
+	schemaAlias := AddFlatAlias(rootCommand, "schema transactions", schemaCommand)
+	schemaAlias.Args = cobra.ExactArgs(1)
+	schemaAlias.ValidArgs = []string{"transactions"}
+	schemaAlias.Run = func(cmd *cobra.Command, args []string) {
+		if args[0] != "transactions" {
+			FatalUsage(fmt.Sprintf("Unknown schema %q. Only transactions has a schema.", args[0]))
 		}
-		os.Exit(1)
+		schemaCommand.Run(cmd, nil)
 	}
-	if !viper.IsSet("plaid.secret") {
-		log.Println("⚠️ PLAID_SECRET not set. Please see the configuration instructions below.")
-		err = rootCommand.Help()
-		if err != nil {
-			log.Fatalln(err)
+
+	rootCommand.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return UsageError{msg: err.Error()}
+	})
+
+	return rootCommand
+}
+
+// maxPaginationRestarts is how many times AllTransactions and
+// SyncTransactions start over when the transactions change at Plaid while
+// they're paging through them.
+const maxPaginationRestarts = 3
+
+// AllTransactions fetches every page of transactions matching req. If the
+// total changes between pages, such as when the institution posts new
+// transactions mid-fetch, offsets no longer line up, so it starts again from
+// the first page rather than returning a mix of before and after.
+func AllTransactions(req plaid.TransactionsGetRequest, client *plaid.PlaidApiService) ([]plaid_cli.Transaction, error) {
+	for restarts := 0; ; restarts++ {
+		transactions, drifted, err := transactionPages(req, client)
+		if err != nil || !drifted {
+			return transactions, err
+		}
+
+		if restarts == maxPaginationRestarts {
+			log.Printf("⚠️  Transactions kept changing at Plaid while they were being fetched, so some may be missing. Run the command again once the institution has finished updating.")
+			return transactions, nil
 		}
-		os.Exit(1)
+		log.Printf("Transactions changed at Plaid while they were being fetched. Fetching them again.")
 	}
+}
 
-	err = rootCommand.Execute()
-	if err != nil {
-		log.Fatalln(err)
+// MaxTransactionsPageSize is the most transactions Plaid returns per page.
+const MaxTransactionsPageSize = 500
+
+// TransactionsPageSize is the number of transactions to request per page,
+// from --page-size or cli.page_size.
+func TransactionsPageSize() int32 {
+	return int32(viper.GetInt("cli.page_size"))
+}
+
+// maxTransactionPages is how many pages fetching total transactions should
+// take, with room to spare.
+func maxTransactionPages(total int32, count int32) int {
+	if count <= 0 {
+		count = 100
 	}
+	return int((total+count-1)/count) + 10
 }
 
-func AllTransactions(req plaid.TransactionsGetRequest, client *plaid.PlaidApiService) ([]plaid.Transaction, error) {
-	var transactions []plaid.Transaction
+// transactionPages pages through the transactions matching req. drifted
+// reports that the total changed, or that pages ran out before reaching it.
+func transactionPages(req plaid.TransactionsGetRequest, client *plaid.PlaidApiService) (transactions []plaid_cli.Transaction, drifted bool, err error) {
+	// Offsets are advanced on a copy, so a restart begins at the caller's.
+	options := req.GetOptions()
+	req.Options = &options
+	offset := options.GetOffset()
 
+	seen := make(map[string]bool)
+	total := int32(-1)
+	pages := 0
 	ctx := context.Background()
-	apiReq := client.TransactionsGet(ctx)
-	apiReq = apiReq.TransactionsGetRequest(req)
-	res, _, err := apiReq.Execute()
-	if err != nil {
-		return transactions, err
-	}
-	transactions = append(transactions, res.Transactions...)
+	for {
+		// Plaid's responses should end the loop long before this, but a
+		// misbehaving one mustn't keep it going forever.
+		if total >= 0 && pages > maxTransactionPages(total, options.GetCount()) {
+			return transactions, false, fmt.Errorf("gave up after %d pages of transactions, more than the %d reported should need", pages, total)
+		}
+		pages++
 
-	for len(transactions) < int(res.TotalTransactions) {
-		offset := *req.Options.Offset + *req.Options.Count
-		req.Options.Offset = &offset
-		apiReq = client.TransactionsGet(ctx)
+		options.Offset = &offset
+		apiReq := client.TransactionsGet(ctx)
 		apiReq = apiReq.TransactionsGetRequest(req)
-		res, _, err = apiReq.Execute()
+		res, _, err := apiReq.Execute()
 		if err != nil {
-			return transactions, err
+			return transactions, false, err
 		}
 
-		transactions = append(transactions, res.Transactions...)
-	}
+		if total == -1 {
+			total = res.TotalTransactions
+		} else if res.TotalTransactions != total {
+			return transactions, true, nil
+		}
+
+		for _, tx := range res.Transactions {
+			// A shifted page can repeat transactions from the last one.
+			if !seen[tx.TransactionId] {
+				seen[tx.TransactionId] = true
+				transactions = append(transactions, plaid_cli.TransactionFromPlaid(tx))
+			}
+		}
 
-	return transactions, nil
+		offset += int32(len(res.Transactions))
+		if offset >= total {
+			return transactions, false, nil
+		}
+		if len(res.Transactions) == 0 {
+			return transactions, true, nil
+		}
+	}
 }
 
-func WithRelinkOnAuthError(itemID string, linker *plaid_cli.Linker, action func() error) error {
-	err := action()
-	pe, convertErr := plaid.ToPlaidError(err)
-	if convertErr != nil {
-		return errors.Join(err, convertErr)
+// PlaidErrorCode returns the Plaid error code for err, or an empty string if
+// err is not an error returned by the Plaid API.
+func PlaidErrorCode(err error) string {
+	if err == nil {
+		return ""
 	}
-	if pe.ErrorCode == "ITEM_LOGIN_REQUIRED" {
-		log.Println("Login expired. Relinking...")
 
-		port := viper.GetString("link.port")
+	pe, ok := AsPlaidError(err)
+	if !ok {
+		return ""
+	}
 
-		err = linker.Relink(itemID, port)
+	return pe.ErrorCode
+}
 
-		if err != nil {
+// WaitForProduct re-runs action while Plaid reports that a product's data is
+// still being prepared, backing off between attempts until timeout elapses.
+func WaitForProduct(timeout time.Duration, action func() error) error {
+	deadline := time.Now().Add(timeout)
+	delay := time.Second
+
+	for {
+		err := action()
+		if PlaidErrorCode(err) != "PRODUCT_NOT_READY" {
+			return err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
 			return err
 		}
+		if delay > remaining {
+			delay = remaining
+		}
 
-		log.Println("Re-running action...")
+		log.Printf("Plaid is still preparing data for this institution. Retrying in %s...\n", delay.Round(time.Second))
+		time.Sleep(delay)
 
-		err = action()
+		delay *= 2
+		if delay > 30*time.Second {
+			delay = 30 * time.Second
+		}
 	}
-
-	return err
 }
 
+// TransactionSerializer writes transactions in an output format. Serializers
+// write transactions ordered by date, then transaction ID, so exports of the
+// same data are byte-for-byte identical and diff cleanly.
 type TransactionSerializer interface {
-	serialize(txs []plaid.Transaction) ([]byte, error)
+	serialize(w io.Writer, txs []plaid_cli.Transaction) error
+	// annotateItems labels each transaction with the name of its item, looked
+	// up by account ID, when transactions from several items are merged.
+	annotateItems(accountItems map[string]string)
+	// annotateAccounts labels each transaction with a readable description
+	// of its account, looked up by account ID.
+	annotateAccounts(accountLabels map[string]string)
+	// annotateOwners labels each transaction with the household member whose
+	// account it's in, looked up by account ID.
+	annotateOwners(accountOwners map[string]string)
+	// addColumns adds optional groups of fields, chosen with --columns.
+	addColumns(columns []ExtraColumn)
+}
+
+type annotations struct {
+	accountItems  map[string]string
+	accountLabels map[string]string
+	accountOwners map[string]string
+	columns       []ExtraColumn
+}
+
+func (a *annotations) annotateItems(accountItems map[string]string) {
+	a.accountItems = accountItems
+}
+
+func (a *annotations) annotateAccounts(accountLabels map[string]string) {
+	a.accountLabels = accountLabels
+}
+
+func (a *annotations) annotateOwners(accountOwners map[string]string) {
+	a.accountOwners = accountOwners
+}
+
+func (a *annotations) addColumns(columns []ExtraColumn) {
+	a.columns = columns
+}
+
+func (a *annotations) annotating() bool {
+	return a.accountItems != nil || a.accountLabels != nil || a.accountOwners != nil || len(a.columns) > 0
+}
+
+// annotated returns tx as a JSON object with "item", "account" and "owner"
+// fields and any extra columns added.
+func (a *annotations) annotated(tx plaid_cli.Transaction) (interface{}, error) {
+	if !a.annotating() {
+		return tx, nil
+	}
+
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return nil, err
+	}
+	if a.accountItems != nil {
+		fields["item"] = a.accountItems[tx.AccountID]
+	}
+	if a.accountLabels != nil {
+		fields["account"] = a.accountLabels[tx.AccountID]
+	}
+	if a.accountOwners != nil {
+		fields["owner"] = a.accountOwners[tx.AccountID]
+	}
+	for _, column := range a.columns {
+		for i, value := range column.Values(tx) {
+			fields[column.Fields[i]] = value
+		}
+	}
+	return fields, nil
 }
 
 func NewTransactionSerializer(t string) (TransactionSerializer, error) {
@@ -569,42 +4253,96 @@ func NewTransactionSerializer(t string) (TransactionSerializer, error) {
 		return &CSVSerializer{}, nil
 	case "json":
 		return &JSONSerializer{}, nil
+	case "ndjson":
+		return &NDJSONSerializer{}, nil
 	default:
 		return nil, fmt.Errorf("invalid output format: %s", t)
 	}
 }
 
-type CSVSerializer struct{}
+// SortTransactions returns a copy of txs ordered by date, then transaction ID,
+// then category. Plaid doesn't guarantee the order in which transactions are
+// returned. The parts of a split transaction share its date and ID, so parts
+// in the same category keep the order ApplySplits gave them.
+func SortTransactions(txs []plaid_cli.Transaction) []plaid_cli.Transaction {
+	sorted := make([]plaid_cli.Transaction, len(txs))
+	copy(sorted, txs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Date != sorted[j].Date {
+			return sorted[i].Date < sorted[j].Date
+		}
+		if sorted[i].TransactionID != sorted[j].TransactionID {
+			return sorted[i].TransactionID < sorted[j].TransactionID
+		}
+		return TransactionCategory(sorted[i]) < TransactionCategory(sorted[j])
+	})
+	return sorted
+}
 
-func (w *CSVSerializer) serialize(txs []plaid.Transaction) ([]byte, error) {
-	var records [][]string
-	for _, tx := range txs {
-		sanitizedName := strings.ReplaceAll(tx.Name, ",", "")
-		records = append(records, []string{tx.Date, fmt.Sprintf("%f", tx.Amount), sanitizedName})
-	}
+type CSVSerializer struct {
+	annotations
+	// NoHeader omits the header row, e.g. when appending to an existing
+	// export.
+	NoHeader bool
+}
 
-	b := bytes.NewBufferString("")
-	writer := csv.NewWriter(b)
-	err := writer.Write([]string{"Date", "Amount", "Description"})
-	if err != nil {
-		return nil, err
+func (s *CSVSerializer) serialize(w io.Writer, txs []plaid_cli.Transaction) error {
+	writer := csv.NewWriter(w)
+	if !s.NoHeader {
+		header := []string{"Date", "Amount", "Description"}
+		if s.accountItems != nil {
+			header = append(header, "Item")
+		}
+		if s.accountLabels != nil {
+			header = append(header, "Account")
+		}
+		if s.accountOwners != nil {
+			header = append(header, "Owner")
+		}
+		for _, column := range s.columns {
+			header = append(header, column.Headers...)
+		}
+		err := writer.Write(header)
+		if err != nil {
+			return err
+		}
 	}
-	err = writer.WriteAll(records)
-	if err != nil {
-		return nil, err
+
+	for _, tx := range SortTransactions(txs) {
+		sanitizedName := strings.ReplaceAll(tx.Name, ",", "")
+		record := []string{tx.Date, plaid_cli.MoneyFromFloat(tx.Amount).String(), sanitizedName}
+		if s.accountItems != nil {
+			record = append(record, s.accountItems[tx.AccountID])
+		}
+		if s.accountLabels != nil {
+			record = append(record, s.accountLabels[tx.AccountID])
+		}
+		if s.accountOwners != nil {
+			record = append(record, s.accountOwners[tx.AccountID])
+		}
+		for _, column := range s.columns {
+			for _, value := range column.Values(tx) {
+				record = append(record, formatCell(value))
+			}
+		}
+		err := writer.Write(record)
+		if err != nil {
+			return err
+		}
 	}
 
-	return b.Bytes(), err
+	writer.Flush()
+	return writer.Error()
 }
 
 func SetAlias(data *plaid_cli.Data, itemID string, alias string) error {
 	if _, ok := data.Tokens[itemID]; !ok {
-		return fmt.Errorf("no access token found for item ID `%s`. Try re-linking your account with `plaid-cli link`", itemID)
+		return fmt.Errorf("no access token found for item ID `%s`. Try re-linking your account with `plaid-cli item link`", itemID)
 	}
 
 	data.Aliases[alias] = itemID
 	data.BackAliases[itemID] = alias
-	err := data.Save()
+	err := data.SaveAliases()
 	if err != nil {
 		return err
 	}
@@ -614,8 +4352,45 @@ func SetAlias(data *plaid_cli.Data, itemID string, alias string) error {
 	return nil
 }
 
-type JSONSerializer struct{}
+type JSONSerializer struct {
+	annotations
+}
+
+func (s *JSONSerializer) serialize(w io.Writer, txs []plaid_cli.Transaction) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if !s.annotating() {
+		return encoder.Encode(SortTransactions(txs))
+	}
+
+	var annotated []interface{}
+	for _, tx := range SortTransactions(txs) {
+		v, err := s.annotated(tx)
+		if err != nil {
+			return err
+		}
+		annotated = append(annotated, v)
+	}
+	return encoder.Encode(annotated)
+}
+
+// NDJSONSerializer writes one transaction per line, which keeps large exports
+// easy to stream and process line by line.
+type NDJSONSerializer struct {
+	annotations
+}
 
-func (w *JSONSerializer) serialize(txs []plaid.Transaction) ([]byte, error) {
-	return json.MarshalIndent(txs, "", "  ")
+func (s *NDJSONSerializer) serialize(w io.Writer, txs []plaid_cli.Transaction) error {
+	encoder := json.NewEncoder(w)
+	for _, tx := range SortTransactions(txs) {
+		v, err := s.annotated(tx)
+		if err != nil {
+			return err
+		}
+		err = encoder.Encode(v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
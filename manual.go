@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// manualItemName labels manual accounts wherever accounts are listed by
+// institution.
+const manualItemName = "Manual"
+
+// ManualAccountID returns the account ID for a manual account named name,
+// which may already start with manual:.
+func ManualAccountID(name string) (string, error) {
+	id := strings.TrimSpace(name)
+	if !strings.HasPrefix(id, manualAccountPrefix) {
+		id = manualAccountPrefix + id
+	}
+	return id, ValidateManualAccount(id)
+}
+
+// isLiability reports whether balances of accounts of accountType are owed
+// rather than owned. Plaid reports what's owed on credit cards and loans as
+// a positive balance.
+func isLiability(accountType string) bool {
+	return accountType == plaid_cli.AccountTypeCredit || accountType == plaid_cli.AccountTypeLoan
+}
+
+// SetManualBalance records a manual account's balance on day, creating the
+// account if it's new. accountType and currency are only changed if given.
+func SetManualBalance(data *plaid_cli.Data, id string, balance plaid_cli.Money, day time.Time, accountType string, currency string) error {
+	if accountType != "" {
+		if _, err := plaid.NewAccountTypeFromValue(accountType); err != nil {
+			return fmt.Errorf("invalid account type %q. Use depository, investment, credit, loan or other", accountType)
+		}
+	}
+
+	history, ok := data.BalanceHistory[id]
+	if !ok {
+		history = plaid_cli.AccountHistory{
+			Name:     strings.TrimPrefix(id, manualAccountPrefix),
+			Type:     plaid_cli.AccountTypeOther,
+			Balances: make(map[string]plaid_cli.Money),
+		}
+	}
+	if accountType != "" {
+		history.Type = accountType
+	}
+	if currency != "" {
+		history.Currency = strings.ToUpper(currency)
+	}
+	history.Balances[day.Format("2006-01-02")] = balance
+
+	data.BalanceHistory[id] = history
+	return data.SaveBalanceHistory()
+}
+
+// RemoveManualAccount forgets a manual account and its balances.
+func RemoveManualAccount(data *plaid_cli.Data, id string) error {
+	if _, ok := data.BalanceHistory[id]; !ok {
+		return fmt.Errorf("no manual account %q. Run `plaid-cli manual list` to see them", id)
+	}
+	delete(data.BalanceHistory, id)
+	return data.SaveBalanceHistory()
+}
+
+// RecordBalances adds itemID's accounts' current balances to the balance
+// history for day, replacing any recorded earlier that day.
+func RecordBalances(data *plaid_cli.Data, itemID string, accounts []plaid_cli.Account, day time.Time) error {
+	for _, account := range accounts {
+		current := account.Balances.Current
+		if current == nil {
+			continue
+		}
+
+		history := data.BalanceHistory[account.AccountID]
+		if history.Balances == nil {
+			history.Balances = make(map[string]plaid_cli.Money)
+		}
+		history.Name = account.Name
+		history.Item = itemID
+		history.Type = account.Type
+		history.Currency = plaid_cli.Value(account.Balances.ISOCurrencyCode)
+		history.Balances[day.Format("2006-01-02")] = plaid_cli.MoneyFromFloat(*current)
+		data.BalanceHistory[account.AccountID] = history
+	}
+	return data.SaveBalanceHistory()
+}
+
+// latestBalance returns the last balance recorded on or before day, which
+// is YYYY-MM-DD.
+func latestBalance(history plaid_cli.AccountHistory, day string) (plaid_cli.Money, string, bool) {
+	var latest string
+	for d := range history.Balances {
+		if d <= day && d > latest {
+			latest = d
+		}
+	}
+	if latest == "" {
+		return 0, "", false
+	}
+	return history.Balances[latest], latest, true
+}
+
+// ManualAccounts returns the manual accounts with their latest balances, as
+// accounts of a single institution so they can be listed with linked ones.
+func ManualAccounts(data *plaid_cli.Data) ItemAccounts {
+	var ids []string
+	for id, history := range data.BalanceHistory {
+		if history.Item == "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	today := time.Now().Format("2006-01-02")
+	item := ItemAccounts{Item: manualItemName, Accounts: []plaid_cli.Account{}}
+	for _, id := range ids {
+		history := data.BalanceHistory[id]
+		balance, _, ok := latestBalance(history, today)
+		if !ok {
+			continue
+		}
+
+		account := plaid_cli.Account{
+			AccountID: id,
+			Name:      history.Name,
+			Type:      history.Type,
+		}
+		account.Balances.Current = plaid_cli.Ptr(balance.Float64())
+		if history.Currency != "" {
+			account.Balances.ISOCurrencyCode = plaid_cli.Ptr(history.Currency)
+		}
+		item.Accounts = append(item.Accounts, account)
+	}
+	return item
+}
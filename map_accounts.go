@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/manifoldco/promptui"
+)
+
+// dontPush is the choice for leaving an account unmapped.
+const dontPush = "Don't push"
+
+// ChooseAccountMapping asks, for each Plaid account in items, which of
+// destinations its transactions are pushed to, starting from the current
+// mapping, and returns the new mapping keyed by Plaid account ID. Accounts
+// that shouldn't be pushed are mapped to "", so they stay unmapped even if
+// the config file maps them.
+func ChooseAccountMapping(target string, items []ItemAccounts, destinations []PushAccount, current map[string]string) (map[string]string, error) {
+	choices := []string{dontPush}
+	for _, destination := range destinations {
+		choices = append(choices, destination.Name)
+	}
+
+	mapping := make(map[string]string)
+	for _, item := range items {
+		for _, account := range item.Accounts {
+			cursor := 0
+			for i, destination := range destinations {
+				if destination.ID == current[strings.ToLower(account.AccountID)] {
+					cursor = i + 1
+				}
+			}
+
+			prompt := promptui.Select{
+				Label:     fmt.Sprintf("%s account for %s (%s)", target, AccountLabel(account), item.Item),
+				Items:     choices,
+				CursorPos: cursor,
+				Size:      10,
+				Searcher: func(input string, index int) bool {
+					return strings.Contains(strings.ToLower(choices[index]), strings.ToLower(input))
+				},
+			}
+			i, _, err := prompt.Run()
+			if err != nil {
+				return nil, err
+			}
+			mapping[account.AccountID] = ""
+			if i > 0 {
+				mapping[account.AccountID] = destinations[i-1].ID
+			}
+		}
+	}
+	return mapping, nil
+}
+
+// SaveAccountMapping records mapping as the accounts mapped for target,
+// keeping what's mapped for accounts not in it.
+func SaveAccountMapping(data *plaid_cli.Data, target string, mapping map[string]string) error {
+	if data.AccountMappings[target] == nil {
+		data.AccountMappings[target] = make(map[string]string)
+	}
+	for accountID, account := range mapping {
+		data.AccountMappings[target][accountID] = account
+	}
+	return data.SaveAccountMappings()
+}
+
+// WriteAccountMapping writes each Plaid account in items beside the account
+// in destinations it's mapped to.
+func WriteAccountMapping(w io.Writer, target string, items []ItemAccounts, destinations []PushAccount, mapping map[string]string) error {
+	names := make(map[string]string)
+	for _, destination := range destinations {
+		names[destination.ID] = destination.Name
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, err := fmt.Fprintf(tw, "ITEM\tPLAID ACCOUNT\t%s ACCOUNT\n", strings.ToUpper(target))
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		for _, account := range item.Accounts {
+			destination := "-"
+			if id := mapping[account.AccountID]; id != "" {
+				destination = names[id]
+				if destination == "" {
+					destination = id
+				}
+			}
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\n", item.Item, AccountLabel(account), destination)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Flush()
+}
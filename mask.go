@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Sensitive values, such as access tokens, account and routing numbers and
+// identity data, are masked in output unless the user asks to see them with
+// --unmask and confirms at a terminal. Output that isn't going to a terminal
+// is always masked, so they don't end up in files or logs by accident,
+// unless --unmask=force.
+const (
+	unmaskConfirm = "confirm"
+	unmaskForce   = "force"
+)
+
+// maskedVisible is how many characters of a masked value are left visible,
+// enough to tell values apart.
+const maskedVisible = 4
+
+// MaskPolicy decides whether sensitive values are shown in full. Every
+// command that outputs them goes through it.
+type MaskPolicy struct {
+	// Unmask is set by --unmask: empty, confirm or force.
+	Unmask string
+
+	decided  bool
+	unmasked bool
+}
+
+// AddUnmaskFlag registers --unmask on cmd and its subcommands.
+func AddUnmaskFlag(cmd *cobra.Command, policy *MaskPolicy) {
+	cmd.PersistentFlags().StringVar(&policy.Unmask, "unmask", "", "Show access tokens and other sensitive values in full, after confirming. Use --unmask=force to skip confirmation and unmask output that isn't going to a terminal")
+	cmd.PersistentFlags().Lookup("unmask").NoOptDefVal = unmaskConfirm
+}
+
+// Unmasked reports whether sensitive values, described by what, should be
+// shown in full. The user is asked once per run.
+func (p *MaskPolicy) Unmasked(what string) (bool, error) {
+	if p.decided {
+		return p.unmasked, nil
+	}
+
+	switch p.Unmask {
+	case "":
+	case unmaskForce:
+		p.unmasked = true
+	case unmaskConfirm:
+		if !isInteractive() || !stdoutIsTerminal() {
+			log.Printf("⚠️  Masking %s because output isn't going to a terminal. Use --unmask=force to unmask them anyway.\n", T(what))
+			break
+		}
+		confirmed, err := Confirm(T("Show %s in full", T(what)))
+		if err != nil {
+			return false, err
+		}
+		p.unmasked = confirmed
+	default:
+		return false, fmt.Errorf("invalid --unmask %q. Use --unmask to confirm at a terminal, or --unmask=force", p.Unmask)
+	}
+
+	p.decided = true
+	return p.unmasked, nil
+}
+
+// Mask returns value in full if the policy unmasks what, and otherwise with
+// all but its last few characters hidden.
+func (p *MaskPolicy) Mask(what string, value string) (string, error) {
+	unmasked, err := p.Unmasked(what)
+	if err != nil || unmasked {
+		return value, err
+	}
+	return MaskValue(value), nil
+}
+
+// MaskValue hides all but the last few characters of value. Short values
+// are hidden entirely.
+func MaskValue(value string) string {
+	if len(value) <= 2*maskedVisible {
+		return strings.Repeat("•", len(value))
+	}
+	return strings.Repeat("•", 8) + value[len(value)-maskedVisible:]
+}
+
+// stdoutIsTerminal reports whether output is going to a terminal rather than
+// a pipe or file.
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// largestTransactionsCount is how many of the month's biggest outgoing
+// transactions the monthly report lists.
+const largestTransactionsCount = 10
+
+// MonthlyReport is a statement-style summary of a single month.
+type MonthlyReport struct {
+	Month       string               `json:"month"`
+	GeneratedAt time.Time            `json:"generated_at"`
+	Balances    []MonthlyBalance     `json:"balances"`
+	Income      plaid_cli.Money      `json:"income"`
+	Spending    plaid_cli.Money      `json:"spending"`
+	Net         plaid_cli.Money      `json:"net"`
+	Categories  []CategorySpend      `json:"categories"`
+	Largest     []MonthlyTransaction `json:"largest_transactions"`
+	// ComparedTo is the month categories are compared with, if any, and
+	// PreviousSpending what was spent in it.
+	ComparedTo       string           `json:"compared_to,omitempty"`
+	PreviousSpending *plaid_cli.Money `json:"previous_spending,omitempty"`
+}
+
+// MonthlyBalance is an account's balance when the report was generated.
+type MonthlyBalance struct {
+	Item     string   `json:"item"`
+	Account  string   `json:"account"`
+	Type     string   `json:"type"`
+	Current  *float64 `json:"current"`
+	Currency string   `json:"currency"`
+}
+
+type CategorySpend struct {
+	Category string          `json:"category"`
+	Total    plaid_cli.Money `json:"total"`
+	Percent  float64         `json:"percent"`
+	Change   *Change         `json:"change,omitempty"`
+}
+
+type MonthlyTransaction struct {
+	Date     string          `json:"date"`
+	Merchant string          `json:"merchant"`
+	Category string          `json:"category"`
+	Amount   plaid_cli.Money `json:"amount"`
+}
+
+// ParseMonth parses a month in YYYY-MM form and returns its first and last
+// days. An empty month means the previous calendar month.
+func ParseMonth(month string, now time.Time) (time.Time, time.Time, error) {
+	var start time.Time
+	if month == "" {
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0)
+	} else {
+		var err error
+		start, err = time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid month %q. Use YYYY-MM, e.g. 2024-05", month)
+		}
+	}
+
+	return start, start.AddDate(0, 1, -1), nil
+}
+
+// TransactionCategory returns the primary personal finance category of tx.
+func TransactionCategory(tx plaid_cli.Transaction) string {
+	if pfc := tx.PersonalFinanceCategory; pfc != nil {
+		return pfc.Primary
+	}
+	return "UNCATEGORIZED"
+}
+
+// isTransfer reports whether tx moves money between the user's own accounts,
+// which would otherwise be counted as both income and spending.
+func isTransfer(tx plaid_cli.Transaction) bool {
+	pfc := tx.PersonalFinanceCategory
+	if pfc == nil {
+		return false
+	}
+	return pfc.Primary == "TRANSFER_IN" ||
+		pfc.Primary == "TRANSFER_OUT" ||
+		pfc.Detailed == "LOAN_PAYMENTS_CREDIT_CARD_PAYMENT"
+}
+
+func BuildMonthlyReport(month time.Time, items []ItemAccounts, txs []plaid_cli.Transaction, now time.Time) MonthlyReport {
+	report := MonthlyReport{
+		Month:       month.Format("2006-01"),
+		GeneratedAt: now,
+	}
+
+	for _, item := range items {
+		for _, account := range item.Accounts {
+			report.Balances = append(report.Balances, MonthlyBalance{
+				Item:     item.Item,
+				Account:  account.Name,
+				Type:     account.Type,
+				Current:  account.Balances.Current,
+				Currency: plaid_cli.Value(account.Balances.ISOCurrencyCode),
+			})
+		}
+	}
+
+	byCategory := make(map[string]plaid_cli.Money)
+	var outflows []plaid_cli.Transaction
+	for _, tx := range txs {
+		if tx.Pending || isTransfer(tx) {
+			continue
+		}
+
+		if tx.Amount < 0 {
+			report.Income -= plaid_cli.MoneyFromFloat(tx.Amount)
+			continue
+		}
+
+		report.Spending += plaid_cli.MoneyFromFloat(tx.Amount)
+		byCategory[TransactionCategory(tx)] += plaid_cli.MoneyFromFloat(tx.Amount)
+		outflows = append(outflows, tx)
+	}
+	report.Net = report.Income - report.Spending
+
+	for category, total := range byCategory {
+		spend := CategorySpend{Category: category, Total: total}
+		if report.Spending > 0 {
+			spend.Percent = total.Float64() / report.Spending.Float64() * 100
+		}
+		report.Categories = append(report.Categories, spend)
+	}
+	sort.Slice(report.Categories, func(i, j int) bool {
+		if report.Categories[i].Total != report.Categories[j].Total {
+			return report.Categories[i].Total > report.Categories[j].Total
+		}
+		return report.Categories[i].Category < report.Categories[j].Category
+	})
+
+	outflows = SortTransactions(outflows)
+	sort.SliceStable(outflows, func(i, j int) bool {
+		return outflows[i].Amount > outflows[j].Amount
+	})
+	if len(outflows) > largestTransactionsCount {
+		outflows = outflows[:largestTransactionsCount]
+	}
+	for _, tx := range outflows {
+		report.Largest = append(report.Largest, MonthlyTransaction{
+			Date:     tx.Date,
+			Merchant: MerchantName(tx),
+			Category: TransactionCategory(tx),
+			Amount:   plaid_cli.MoneyFromFloat(tx.Amount),
+		})
+	}
+
+	return report
+}
+
+func WriteMonthlyReport(w io.Writer, report MonthlyReport, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "html":
+		t, err := template.New("monthly").Funcs(template.FuncMap{
+			"money": func(v plaid_cli.Money) string {
+				return fmt.Sprintf("%.2f", v)
+			},
+			"optionalMoney": formatOptionalAmount,
+			"change":        formatChange,
+			"category":      humanizeCategory,
+			"month": func(m string) string {
+				t, err := time.Parse("2006-01", m)
+				if err != nil {
+					return m
+				}
+				return t.Format("January 2006")
+			},
+		}).Parse(monthlyReportTemplate)
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, report)
+	case "pdf":
+		return fmt.Errorf("PDF output isn't supported. Write an HTML report and print it to PDF from a browser")
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+// humanizeCategory turns FOOD_AND_DRINK into "Food and drink".
+func humanizeCategory(category string) string {
+	s := strings.ToLower(strings.ReplaceAll(category, "_", " "))
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+var monthlyReportTemplate string = `<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <title>{{ month .Month }} statement</title>
+    <style>
+    body {
+	font-family: Arial, Helvetica, sans-serif;
+	color: #222;
+	max-width: 50em;
+	margin: 2em auto;
+	padding: 0 1em;
+    }
+    h1 {
+	margin-bottom: 0;
+    }
+    .generated {
+	color: #777;
+	margin-top: 0.2em;
+    }
+    table {
+	border-collapse: collapse;
+	width: 100%;
+	margin-bottom: 2em;
+    }
+    th, td {
+	text-align: left;
+	padding: 0.3em 0.5em;
+	border-bottom: 1px solid #ddd;
+    }
+    td.amount, th.amount {
+	text-align: right;
+	font-variant-numeric: tabular-nums;
+    }
+    .summary {
+	display: flex;
+	gap: 1em;
+	margin: 2em 0;
+    }
+    .summary > div {
+	flex: 1;
+	background-color: #f4f4f4;
+	border-radius: 8px;
+	padding: 1em;
+    }
+    .summary .value {
+	font-size: 1.6em;
+	font-weight: bold;
+    }
+    .bar {
+	fill: #008000;
+    }
+    </style>
+  </head>
+  <body>
+    <h1>{{ month .Month }}</h1>
+    <p class="generated">Generated by plaid-cli on {{ .GeneratedAt.Format "2006-01-02 15:04" }}</p>
+
+    <div class="summary">
+      <div><div>Income</div><div class="value">{{ money .Income }}</div></div>
+      <div><div>Spending</div><div class="value">{{ money .Spending }}</div></div>
+      <div><div>Net</div><div class="value">{{ money .Net }}</div></div>
+    </div>
+    {{ if .ComparedTo }}
+    <p class="generated">Compared with {{ month .ComparedTo }}, when spending was {{ money .PreviousSpending }}. ▲ marks the largest increases.</p>
+    {{ end }}
+
+    <h2>Spending by category</h2>
+    {{ if .Categories }}
+    <svg width="100%" height="{{ len .Categories }}em" viewBox="0 0 100 {{ len .Categories }}" preserveAspectRatio="none" role="img" aria-label="Spending by category">
+      {{ range $i, $c := .Categories }}
+      <rect class="bar" x="0" y="{{ $i }}" width="{{ printf "%.2f" $c.Percent }}" height="0.8"><title>{{ category $c.Category }}: {{ money $c.Total }}</title></rect>
+      {{ end }}
+    </svg>
+    <table>
+      <tr><th>Category</th><th class="amount">Total</th><th class="amount">Share</th>{{ if $.ComparedTo }}<th class="amount">Change</th>{{ end }}</tr>
+      {{ range .Categories }}
+      <tr><td>{{ category .Category }}</td><td class="amount">{{ money .Total }}</td><td class="amount">{{ printf "%.1f" .Percent }}%</td>{{ if $.ComparedTo }}<td class="amount">{{ change .Change }}</td>{{ end }}</tr>
+      {{ end }}
+    </table>
+    {{ else }}
+    <p>No spending this month.</p>
+    {{ end }}
+
+    <h2>Largest transactions</h2>
+    <table>
+      <tr><th>Date</th><th>Merchant</th><th>Category</th><th class="amount">Amount</th></tr>
+      {{ range .Largest }}
+      <tr><td>{{ .Date }}</td><td>{{ .Merchant }}</td><td>{{ category .Category }}</td><td class="amount">{{ money .Amount }}</td></tr>
+      {{ end }}
+    </table>
+
+    <h2>Balances</h2>
+    <p class="generated">As of {{ .GeneratedAt.Format "2006-01-02" }}</p>
+    <table>
+      <tr><th>Institution</th><th>Account</th><th>Type</th><th class="amount">Balance</th><th>Currency</th></tr>
+      {{ range .Balances }}
+      <tr><td>{{ .Item }}</td><td>{{ .Account }}</td><td>{{ .Type }}</td><td class="amount">{{ optionalMoney .Current }}</td><td>{{ .Currency }}</td></tr>
+      {{ end }}
+    </table>
+  </body>
+</html>
+`
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// Commands are grouped in help by what they work with, and most live under a
+// namespace: item, transactions, export, report, sandbox and webhooks. The
+// flat commands they used to be, such as `plaid-cli link`, still work as
+// hidden aliases, so existing scripts and cron jobs keep running.
+const (
+	groupInstitutions = "institutions"
+	groupTransactions = "transactions"
+	groupProducts     = "products"
+	groupAutomation   = "automation"
+	groupSetup        = "setup"
+)
+
+// AddCommandGroups adds the help groups to root. Commands choose theirs with
+// GroupID.
+func AddCommandGroups(root *cobra.Command) {
+	root.AddGroup(
+		&cobra.Group{ID: groupInstitutions, Title: T("Institutions and accounts:")},
+		&cobra.Group{ID: groupTransactions, Title: T("Transactions and reports:")},
+		&cobra.Group{ID: groupProducts, Title: T("Plaid products:")},
+		&cobra.Group{ID: groupAutomation, Title: T("Automation:")},
+		&cobra.Group{ID: groupSetup, Title: T("Setup and troubleshooting:")},
+	)
+	root.SetHelpCommandGroupID(groupSetup)
+	root.SetCompletionCommandGroupID(groupSetup)
+}
+
+// AddGroupedCommands adds cmds to root under the help group groupID.
+func AddGroupedCommands(root *cobra.Command, groupID string, cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		cmd.GroupID = groupID
+		root.AddCommand(cmd)
+	}
+}
+
+// AddFlatAlias adds a hidden command to root, named use, that runs cmd with
+// the same arguments and flags. It stands in for the flat command cmd was
+// before it moved into a namespace, so cmd must already have been added to
+// its parent.
+func AddFlatAlias(root *cobra.Command, use string, cmd *cobra.Command) *cobra.Command {
+	alias := flatAlias(use, cmd)
+	alias.Hidden = true
+	root.AddCommand(alias)
+	return alias
+}
+
+func flatAlias(use string, cmd *cobra.Command) *cobra.Command {
+	alias := &cobra.Command{
+		Use:               use,
+		Short:             cmd.Short,
+		Long:              cmd.Long,
+		Args:              cmd.Args,
+		ValidArgs:         cmd.ValidArgs,
+		ValidArgsFunction: cmd.ValidArgsFunction,
+		Annotations:       cmd.Annotations,
+		Deprecated:        fmt.Sprintf("use '%s' instead", cmd.CommandPath()),
+		PreRun:            cmd.PreRun,
+		Run:               cmd.Run,
+	}
+	// The flags themselves are shared, so values parsed for the alias are
+	// the ones cmd reads, as are bindings to config keys such as link.port.
+	alias.Flags().AddFlagSet(cmd.Flags())
+	alias.PersistentFlags().AddFlagSet(cmd.PersistentFlags())
+
+	for _, sub := range cmd.Commands() {
+		alias.AddCommand(flatAlias(sub.Use, sub))
+	}
+	return alias
+}
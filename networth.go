@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// NetWorth is what was owned and owed on a day.
+type NetWorth struct {
+	Date        string          `json:"date"`
+	Assets      plaid_cli.Money `json:"assets"`
+	Liabilities plaid_cli.Money `json:"liabilities"`
+	NetWorth    plaid_cli.Money `json:"net_worth"`
+}
+
+// NetWorthHistory returns net worth on each day since from that a balance
+// was recorded, linked or manual, leaving out ignored accounts. Each account
+// counts with the last balance recorded for it on or before the day.
+// Balances in different currencies are added up as they are.
+func NetWorthHistory(data *plaid_cli.Data, from time.Time, ignored plaid_cli.Ignored) []NetWorth {
+	start := from.Format("2006-01-02")
+	days := make(map[string]bool)
+	for id, history := range data.BalanceHistory {
+		if _, ok := ignored.Accounts[id]; ok {
+			continue
+		}
+		for day := range history.Balances {
+			if day >= start {
+				days[day] = true
+			}
+		}
+	}
+
+	var history []NetWorth
+	for _, day := range sortedKeys(days) {
+		point := NetWorth{Date: day}
+		for id, account := range data.BalanceHistory {
+			if _, ok := ignored.Accounts[id]; ok {
+				continue
+			}
+			balance, _, ok := latestBalance(account, day)
+			if !ok {
+				continue
+			}
+			if isLiability(account.Type) {
+				point.Liabilities += balance
+			} else {
+				point.Assets += balance
+			}
+		}
+		point.NetWorth = point.Assets - point.Liabilities
+		history = append(history, point)
+	}
+	return history
+}
+
+func WriteNetWorth(w io.Writer, history []NetWorth, format string) error {
+	switch format {
+	case "json":
+		if history == nil {
+			history = []NetWorth{}
+		}
+		b, err := json.MarshalIndent(history, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write([]string{"Date", "Assets", "Liabilities", "Net Worth"})
+		if err != nil {
+			return err
+		}
+		for _, p := range history {
+			err = writer.Write([]string{p.Date, fmt.Sprintf("%.2f", p.Assets), fmt.Sprintf("%.2f", p.Liabilities), fmt.Sprintf("%.2f", p.NetWorth)})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "DATE\tASSETS\tLIABILITIES\tNET WORTH")
+		if err != nil {
+			return err
+		}
+		for _, p := range history {
+			_, err = fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.2f\n", p.Date, p.Assets, p.Liabilities, p.NetWorth)
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+const (
+	// AlertEvent is something the user needs to act on, such as an item
+	// whose login has expired.
+	AlertEvent = "alert"
+	// NewTransactionEvent is a transaction that appeared since the last
+	// check.
+	NewTransactionEvent = "new_transaction"
+)
+
+// Event is something the daemon tells the user about.
+type Event struct {
+	Kind    string    `json:"kind"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Item    string    `json:"item"`
+	Time    time.Time `json:"time"`
+	// Transaction is set for new transaction events.
+	Transaction *plaid_cli.Transaction `json:"transaction,omitempty"`
+}
+
+// Notifier delivers events somewhere the user will see them.
+type Notifier interface {
+	Name() string
+	Notify(event Event) error
+}
+
+// NotifiersFromViper returns a notifier for each target configured under
+// [notify] in the config file.
+func NotifiersFromViper() ([]Notifier, error) {
+	var notifiers []Notifier
+
+	if topic := viper.GetString("notify.ntfy.topic"); topic != "" {
+		server := viper.GetString("notify.ntfy.server")
+		if server == "" {
+			server = "https://ntfy.sh"
+		}
+		notifiers = append(notifiers, &NtfyNotifier{
+			Server: strings.TrimSuffix(server, "/"),
+			Topic:  topic,
+			Token:  viper.GetString("notify.ntfy.token"),
+		})
+	}
+
+	if token := viper.GetString("notify.pushover.token"); token != "" {
+		user := viper.GetString("notify.pushover.user")
+		if user == "" {
+			return nil, ConfigError{msg: "⚠️  notify.pushover.user is not set. Configure [notify.pushover] in plaid-cli's config file with your Pushover user key."}
+		}
+		notifiers = append(notifiers, &PushoverNotifier{Token: token, User: user})
+	}
+
+	if webhookURL := viper.GetString("notify.webhook.url"); webhookURL != "" {
+		webhook := &WebhookNotifier{
+			URL:    webhookURL,
+			Secret: viper.GetString("notify.webhook.secret"),
+		}
+		if tmpl := viper.GetString("notify.webhook.template"); tmpl != "" {
+			t, err := template.New("webhook").Funcs(template.FuncMap{"json": jsonValue}).Parse(tmpl)
+			if err != nil {
+				return nil, ConfigError{msg: fmt.Sprintf("⚠️  notify.webhook.template is invalid: %v", err)}
+			}
+			webhook.Template = t
+		}
+		notifiers = append(notifiers, webhook)
+	}
+
+	return notifiers, nil
+}
+
+// NotifyAll sends event to every notifier, carrying on past failures so one
+// broken target doesn't silence the rest.
+func NotifyAll(notifiers []Notifier, event Event) error {
+	var failed []string
+	for _, n := range notifiers {
+		err := n.Notify(event)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", n.Name(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("sending notifications failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// NtfyNotifier publishes events to an ntfy (https://ntfy.sh) topic.
+type NtfyNotifier struct {
+	Server string
+	Topic  string
+	// Token is an access token for protected topics.
+	Token string
+}
+
+func (n *NtfyNotifier) Name() string {
+	return "ntfy"
+}
+
+func (n *NtfyNotifier) Notify(event Event) error {
+	req, err := http.NewRequest(http.MethodPost, n.Server+"/"+url.PathEscape(n.Topic), strings.NewReader(event.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", event.Title)
+	if event.Kind == AlertEvent {
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "warning")
+	} else {
+		req.Header.Set("Tags", "moneybag")
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+
+	return sendNotification(req)
+}
+
+// PushoverNotifier sends events as Pushover (https://pushover.net) messages.
+type PushoverNotifier struct {
+	Token string
+	User  string
+}
+
+const pushoverURL = "https://api.pushover.net/1/messages.json"
+
+func (p *PushoverNotifier) Name() string {
+	return "pushover"
+}
+
+func (p *PushoverNotifier) Notify(event Event) error {
+	form := url.Values{
+		"token":   {p.Token},
+		"user":    {p.User},
+		"title":   {event.Title},
+		"message": {event.Message},
+	}
+	if event.Kind == AlertEvent {
+		form.Set("priority", "1")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, pushoverURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return sendNotification(req)
+}
+
+func sendNotification(req *http.Request) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// WebhookNotifier POSTs events as JSON to a URL, for automation platforms
+// such as IFTTT and Zapier.
+type WebhookNotifier struct {
+	URL string
+	// Secret, if set, is used to sign each payload with HMAC-SHA256. The
+	// hex-encoded signature is sent in the X-Plaid-CLI-Signature header as
+	// "sha256=<signature>".
+	Secret string
+	// Template, if set, renders the payload from the event instead of
+	// sending the event itself.
+	Template *template.Template
+}
+
+const webhookSignatureHeader = "X-Plaid-CLI-Signature"
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n *WebhookNotifier) Notify(event Event) error {
+	payload, err := n.payload(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signPayload(n.Secret, payload))
+	}
+
+	return sendNotification(req)
+}
+
+func (n *WebhookNotifier) payload(event Event) ([]byte, error) {
+	if n.Template == nil {
+		return json.Marshal(event)
+	}
+
+	var buf bytes.Buffer
+	err := n.Template.Execute(&buf, event)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("notify.webhook.template produced invalid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// jsonValue encodes v as JSON, so templates can safely embed event fields
+// in a payload, e.g. {"value1": {{ json .Title }}}.
+func jsonValue(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// When an institution moves from screen-scraped logins to OAuth, Plaid lists
+// the OAuth version as a separate institution, and items linked the old way
+// stop working at a cutoff unless they're relinked through Link with a
+// redirect URI. A week before the cutoff, Plaid sends a PENDING_DISCONNECT
+// webhook with reason INSTITUTION_MIGRATION.
+const oauthMigrationNotice = 7 * 24 * time.Hour
+
+// OAuthMigration describes what's known about an item's institution moving
+// to OAuth.
+type OAuthMigration struct {
+	// OAuthInstitutionID is an OAuth institution with the same name as the
+	// item's, which may be its OAuth version. A matching name alone doesn't
+	// mean the item has to move.
+	OAuthInstitutionID string `json:"oauth_institution_id,omitempty"`
+	// Deadline is when Plaid will disconnect the item, if it has said with
+	// a PENDING_DISCONNECT webhook. Only then is the item known to have to
+	// be relinked.
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// oauthInstitution looks for what may be the OAuth version of a non-OAuth
+// institution: another institution with the same name whose metadata says
+// it logs in with OAuth. It returns an empty string if there isn't one.
+func oauthInstitution(client *plaid.PlaidApiService, institution plaid.Institution, countries []plaid.CountryCode) (string, error) {
+	if institution.Oauth || institution.Name == "" {
+		return "", nil
+	}
+
+	options := plaid.NewInstitutionsSearchRequestOptions()
+	options.SetOauth(true)
+	req := plaid.NewInstitutionsSearchRequest(institution.Name, countries)
+	req.SetOptions(*options)
+	res, _, err := client.InstitutionsSearch(context.Background()).InstitutionsSearchRequest(*req).Execute()
+	if err != nil {
+		return "", NormalizeError(err)
+	}
+
+	for _, candidate := range res.Institutions {
+		if candidate.Oauth && candidate.InstitutionId != institution.InstitutionId && strings.EqualFold(candidate.Name, institution.Name) {
+			return candidate.InstitutionId, nil
+		}
+	}
+	return "", nil
+}
+
+// PendingDisconnects returns when Plaid will disconnect items because their
+// institution is migrating, keyed by item ID, from the PENDING_DISCONNECT
+// webhooks stored by `webhooks listen`. Cutoffs already past are left out:
+// by then the item reports an error itself.
+func PendingDisconnects(store *WebhookStore, now time.Time) (map[string]time.Time, error) {
+	webhooks, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	deadlines := make(map[string]time.Time)
+	for _, webhook := range webhooks {
+		if webhook.Type != "ITEM" || webhook.Code != "PENDING_DISCONNECT" || webhook.Item == "" {
+			continue
+		}
+		var fields struct {
+			Reason string `json:"reason"`
+		}
+		err := json.Unmarshal([]byte(webhook.Body), &fields)
+		if err != nil || fields.Reason != "INSTITUTION_MIGRATION" {
+			continue
+		}
+		deadline := webhook.ReceivedAt.Add(oauthMigrationNotice)
+		if deadline.After(now) {
+			deadlines[webhook.Item] = deadline
+		}
+	}
+	return deadlines, nil
+}
+
+// WarnOAuthMigrations warns about items that Plaid will disconnect because
+// their institution is moving to OAuth, and mentions the ones whose
+// institution may have an OAuth version.
+func WarnOAuthMigrations(items []ItemInfo) {
+	for _, item := range items {
+		if item.OAuthMigration == nil {
+			continue
+		}
+		name := item.ItemID
+		if item.Alias != "" {
+			name = item.Alias
+		}
+		if item.OAuthMigration.Deadline != nil {
+			log.Printf("⚠️  %s is moving to OAuth, and Plaid will disconnect %s on %s. Run 'plaid-cli item link %s --tunnel' to relink it before then.\n", item.Institution, name, item.OAuthMigration.Deadline.Local().Format("2006-01-02"), name)
+		} else {
+			log.Printf("%s may have an OAuth version (%s). If Plaid says it will disconnect %s, run 'plaid-cli item link %s --tunnel' to relink it.\n", item.Institution, item.OAuthMigration.OAuthInstitutionID, name, name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/cobra"
+)
+
+// OutputOptions control where and how a command writes its results.
+type OutputOptions struct {
+	// Path is the file or s3:// or gs:// URL to write to. Empty or "-"
+	// means stdout.
+	Path string
+	// Compress is the compression to apply: "gzip", "zstd" or "none". If
+	// empty, it is inferred from Path's extension.
+	Compress string
+	// EncryptTo is an age recipient or GPG key to encrypt the output for.
+	EncryptTo string
+}
+
+// AddOutputFlags registers the flags that populate opts on cmd.
+func AddOutputFlags(cmd *cobra.Command, opts *OutputOptions) {
+	cmd.Flags().StringVarP(&opts.Path, "output-file", "O", "", "Write output to this file (or s3:// or gs:// URL) instead of stdout")
+	cmd.Flags().StringVar(&opts.Compress, "compress", "", "Compress output with gzip or zstd (inferred from a .gz or .zst output file by default)")
+	cmd.Flags().StringVar(&opts.EncryptTo, "encrypt-to", "", "Encrypt output for this age recipient or GPG key")
+}
+
+func (o OutputOptions) toStdout() bool {
+	return o.Path == "" || o.Path == "-"
+}
+
+func (o OutputOptions) compression() (string, error) {
+	switch o.Compress {
+	case "gzip", "zstd", "none":
+		return o.Compress, nil
+	case "":
+		// tx.csv.gz.age is compressed, then encrypted.
+		path := o.Path
+		for _, ext := range []string{".age", ".gpg", ".asc"} {
+			path = strings.TrimSuffix(path, ext)
+		}
+		switch {
+		case strings.HasSuffix(path, ".gz"):
+			return "gzip", nil
+		case strings.HasSuffix(path, ".zst"):
+			return "zstd", nil
+		default:
+			return "none", nil
+		}
+	default:
+		return "", fmt.Errorf("invalid compression: %s", o.Compress)
+	}
+}
+
+// WriteOutput calls write with a writer for the configured destination.
+// Files are written to a temporary file alongside the destination and
+// renamed into place once write succeeds, so readers never see a partially
+// written export.
+func WriteOutput(opts OutputOptions, write func(w io.Writer) error) (err error) {
+	compression, err := opts.compression()
+	if err != nil {
+		return err
+	}
+
+	if opts.toStdout() {
+		bw := bufio.NewWriter(os.Stdout)
+		err = writeEncoded(bw, compression, opts.EncryptTo, write)
+		return errors.Join(err, bw.Flush())
+	}
+
+	if isObjectStoragePath(opts.Path) {
+		return writeObject(opts, compression, write)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(opts.Path), "."+filepath.Base(opts.Path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	bw := bufio.NewWriter(f)
+	err = writeEncoded(bw, compression, opts.EncryptTo, write)
+	if err != nil {
+		return err
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), opts.Path)
+}
+
+// writeObject streams output to an s3:// or gs:// destination. Like local
+// files, the object is only created once write succeeds.
+func writeObject(opts OutputOptions, compression string, write func(w io.Writer) error) error {
+	ow, err := newObjectWriter(context.Background(), opts.Path)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(ow)
+	err = writeEncoded(bw, compression, opts.EncryptTo, write)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		ow.Abort(err)
+		return err
+	}
+
+	return ow.Commit()
+}
+
+// writeEncoded compresses and then, if encryptTo is set, encrypts the output
+// of write before it reaches w.
+func writeEncoded(w io.Writer, compression string, encryptTo string, write func(w io.Writer) error) error {
+	if encryptTo == "" {
+		return writeCompressed(w, compression, write)
+	}
+
+	ew, err := encryptWriter(w, encryptTo)
+	if err != nil {
+		return err
+	}
+
+	err = writeCompressed(ew, compression, write)
+	return errors.Join(err, ew.Close())
+}
+
+func writeCompressed(w io.Writer, compression string, write func(w io.Writer) error) error {
+	var cw io.WriteCloser
+	switch compression {
+	case "gzip":
+		cw = gzip.NewWriter(w)
+	case "zstd":
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		cw = zw
+	default:
+		return write(w)
+	}
+
+	err := write(cw)
+	return errors.Join(err, cw.Close())
+}
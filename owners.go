@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// ItemOwner returns who an item was tagged as belonging to with `item
+// set-owner`, if anyone.
+func ItemOwner(data *plaid_cli.Data, itemID string) string {
+	return data.Owners[itemID]
+}
+
+// SetItemOwner tags an item as belonging to owner, or removes its owner if
+// owner is empty.
+func SetItemOwner(data *plaid_cli.Data, itemID string, owner string) error {
+	if owner == "" {
+		delete(data.Owners, itemID)
+	} else {
+		data.Owners[itemID] = owner
+	}
+	err := data.SaveOwners()
+	if err != nil {
+		return err
+	}
+
+	if owner == "" {
+		log.Printf("Removed the owner of %s.", ItemName(data, itemID))
+	} else {
+		log.Printf("%s now belongs to %s.", ItemName(data, itemID), owner)
+	}
+	return nil
+}
+
+// anyOwner reports whether any account in owners has an owner.
+func anyOwner(owners map[string]string) bool {
+	for _, owner := range owners {
+		if owner != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"log"
+)
+
+// PartialResults decides what happens when fetching fails partway through.
+// By default the command fails and emits nothing, so a script never mistakes
+// half the data for all of it. With --allow-partial, whatever was fetched is
+// emitted, with a warning, and the command exits with ExitPartialSuccess.
+type PartialResults struct {
+	Allow bool
+	errs  []error
+}
+
+// Tolerate reports whether the command can carry on past err, recording it
+// if so.
+func (p *PartialResults) Tolerate(err error) bool {
+	if p == nil || !p.Allow {
+		return false
+	}
+	log.Printf("⚠️  %v. Continuing with what was fetched (--allow-partial).", err)
+	p.errs = append(p.errs, err)
+	return true
+}
+
+// Err returns a PartialError for everything tolerated, to pass to Fatal once
+// output has been written.
+func (p *PartialResults) Err() error {
+	if p == nil || len(p.errs) == 0 {
+		return nil
+	}
+	return PartialError{Err: errors.Join(p.errs...)}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+)
+
+// defaultDataDir is where plaid-cli keeps its config and data unless
+// cli.data_dir says otherwise: ~/.plaid-cli, or %APPDATA%\plaid-cli on
+// Windows. Windows users who already have a ~/.plaid-cli keep using it.
+func defaultDataDir() string {
+	home := homeDir()
+	legacy := filepath.Join(home, ".plaid-cli")
+
+	if runtime.GOOS != "windows" {
+		return legacy
+	}
+
+	_, err := os.Stat(legacy)
+	if err == nil {
+		return legacy
+	}
+
+	appData := os.Getenv("APPDATA")
+	if appData == "" {
+		return legacy
+	}
+	return filepath.Join(appData, "plaid-cli")
+}
+
+// defaultTokenKeyFile is where the key access tokens are signed with is kept
+// unless cli.token_key_file says otherwise: plaid-cli/tokens.key in the
+// user's config directory (~/.config on Linux), or in %LOCALAPPDATA% on
+// Windows, since the data directory is usually in %APPDATA%.
+func defaultTokenKeyFile() string {
+	dir, err := os.UserConfigDir()
+	if runtime.GOOS == "windows" {
+		dir = os.Getenv("LOCALAPPDATA")
+	}
+	if err != nil || dir == "" {
+		dir = filepath.Join(homeDir(), ".config")
+	}
+	return filepath.Join(dir, "plaid-cli", "tokens.key")
+}
+
+// homeDir returns the current user's home directory, falling back to $HOME
+// (or %USERPROFILE% on Windows) when the user database can't be read, as in
+// some containers.
+func homeDir() string {
+	usr, err := user.Current()
+	if err == nil && usr.HomeDir != "" {
+		return usr.HomeDir
+	}
+
+	home, err := os.UserHomeDir()
+	if err == nil {
+		return home
+	}
+	return "."
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+type RecipientOptions struct {
+	Name         string
+	IBAN         string
+	BACSAccount  string
+	BACSSortCode string
+}
+
+func NewRecipientCreateRequest(opts RecipientOptions) *plaid.PaymentInitiationRecipientCreateRequest {
+	req := plaid.NewPaymentInitiationRecipientCreateRequest(opts.Name)
+	if opts.IBAN != "" {
+		req.SetIban(opts.IBAN)
+	}
+	if opts.BACSAccount != "" || opts.BACSSortCode != "" {
+		bacs := plaid.RecipientBACSNullable{}
+		bacs.SetAccount(opts.BACSAccount)
+		bacs.SetSortCode(opts.BACSSortCode)
+		req.SetBacs(bacs)
+	}
+	return req
+}
+
+func CreateRecipient(client *plaid.PlaidApiService, req *plaid.PaymentInitiationRecipientCreateRequest) (plaid.PaymentInitiationRecipientCreateResponse, error) {
+	apiReq := client.PaymentInitiationRecipientCreate(context.Background())
+	apiReq = apiReq.PaymentInitiationRecipientCreateRequest(*req)
+	res, _, err := apiReq.Execute()
+	return res, err
+}
+
+// ParsePaymentAmount parses the amount of a payment, which must be more
+// than zero, in whole cents or pence.
+func ParsePaymentAmount(amount string) (plaid_cli.Money, error) {
+	value, err := plaid_cli.ParseMoney(amount)
+	if err != nil {
+		return 0, err
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("the amount to pay must be more than 0, not %s", amount)
+	}
+	if value.Round(2) != value {
+		return 0, fmt.Errorf("the amount to pay can have at most 2 decimal places, not %s", amount)
+	}
+	return value, nil
+}
+
+func NewPaymentCreateRequest(recipientID string, reference string, amount plaid_cli.Money, currency string) (*plaid.PaymentInitiationPaymentCreateRequest, error) {
+	cur, err := plaid.NewPaymentAmountCurrencyFromValue(strings.ToUpper(currency))
+	if err != nil {
+		return nil, err
+	}
+
+	paymentAmount := plaid.NewPaymentAmount(*cur, amount.Float64())
+	return plaid.NewPaymentInitiationPaymentCreateRequest(recipientID, reference, *paymentAmount), nil
+}
+
+func CreatePayment(client *plaid.PlaidApiService, req *plaid.PaymentInitiationPaymentCreateRequest) (plaid.PaymentInitiationPaymentCreateResponse, error) {
+	apiReq := client.PaymentInitiationPaymentCreate(context.Background())
+	apiReq = apiReq.PaymentInitiationPaymentCreateRequest(*req)
+	res, _, err := apiReq.Execute()
+	return res, err
+}
+
+func GetPayment(client *plaid.PlaidApiService, paymentID string) (plaid.PaymentInitiationPaymentGetResponse, error) {
+	req := plaid.NewPaymentInitiationPaymentGetRequest(paymentID)
+	apiReq := client.PaymentInitiationPaymentGet(context.Background())
+	apiReq = apiReq.PaymentInitiationPaymentGetRequest(*req)
+	res, _, err := apiReq.Execute()
+	return res, err
+}
+
+func ListPayments(client *plaid.PlaidApiService, count int32) ([]plaid.PaymentInitiationPayment, error) {
+	req := plaid.NewPaymentInitiationPaymentListRequest()
+	req.SetCount(count)
+
+	apiReq := client.PaymentInitiationPaymentList(context.Background())
+	apiReq = apiReq.PaymentInitiationPaymentListRequest(*req)
+	res, _, err := apiReq.Execute()
+	return res.Payments, err
+}
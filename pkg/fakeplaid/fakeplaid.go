@@ -0,0 +1,391 @@
+// Package fakeplaid is a fake of the Plaid API that serves a fixed
+// institution, item, accounts and transactions. plaid-cli's golden tests run
+// against it, and it can stand in for Plaid anywhere plaid-cli is pointed at
+// it with PLAID_BASE_URL.
+package fakeplaid
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+const (
+	// AccessToken is the access token of the fake's item.
+	AccessToken = "access-sandbox-fake"
+	// PublicToken is exchanged for AccessToken.
+	PublicToken = "public-sandbox-fake"
+	// ItemID is the ID of the fake's item.
+	ItemID = "item-fake"
+	// InstitutionID is the ID of the fake's institution.
+	InstitutionID = "ins_fake"
+	// LinkToken is the token every link token request is given.
+	LinkToken = "link-sandbox-fake"
+)
+
+// Updated is when the fake's item last updated its transactions.
+var Updated = time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+
+// Item is an item the fake serves, with its accounts and transactions.
+type Item struct {
+	Item         plaid.Item
+	Accounts     []plaid.AccountBase
+	Transactions []plaid.Transaction
+}
+
+// Server is a fake Plaid API. Each request must carry a client ID and
+// secret, though any will do, and is answered from Items, keyed by access
+// token. Endpoints the fake doesn't implement return Plaid's NOT_FOUND
+// error.
+type Server struct {
+	Institution plaid.Institution
+	Items       map[string]*Item
+	// WebhookKeys are the keys /webhook_verification_key/get serves, keyed
+	// by key ID.
+	WebhookKeys map[string]plaid.JWKPublicKey
+
+	mu       sync.Mutex
+	requests int
+}
+
+// New returns a fake serving the fixture item, at AccessToken.
+func New() *Server {
+	institution := plaid.NewInstitutionWithDefaults()
+	institution.InstitutionId = InstitutionID
+	institution.Name = "First Platypus Bank"
+	institution.Products = []plaid.Products{plaid.PRODUCTS_TRANSACTIONS, plaid.PRODUCTS_AUTH}
+	institution.CountryCodes = []plaid.CountryCode{plaid.COUNTRYCODE_US}
+	institution.RoutingNumbers = []string{}
+
+	return &Server{
+		Institution: *institution,
+		Items:       map[string]*Item{AccessToken: FixtureItem()},
+		WebhookKeys: map[string]plaid.JWKPublicKey{},
+	}
+}
+
+// WebhookKey returns key as Plaid serves the keys it signs webhooks with,
+// for adding to WebhookKeys.
+func WebhookKey(kid string, key *ecdsa.PublicKey, created time.Time) plaid.JWKPublicKey {
+	coordinate := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	x := key.X.FillBytes(make([]byte, 32))
+	y := key.Y.FillBytes(make([]byte, 32))
+	return *plaid.NewJWKPublicKey("ES256", "P-256", kid, "EC", "sig", coordinate(x), coordinate(y), int32(created.Unix()), *plaid.NewNullableInt32(nil))
+}
+
+// FixtureItem returns the item New serves: a checking account and a credit
+// card, with a month of transactions between them and a subscription
+// charged to the card since November.
+func FixtureItem() *Item {
+	item := plaid.NewItemWithDefaults()
+	item.ItemId = ItemID
+	item.SetInstitutionId(InstitutionID)
+	item.SetProducts([]plaid.Products{plaid.PRODUCTS_TRANSACTIONS})
+	item.AvailableProducts = []plaid.Products{plaid.PRODUCTS_AUTH}
+	item.BilledProducts = []plaid.Products{plaid.PRODUCTS_TRANSACTIONS}
+	item.Webhook.Set(nil)
+	item.Error.Set(nil)
+	item.ConsentExpirationTime.Set(nil)
+	item.UpdateType = "background"
+
+	return &Item{
+		Item: *item,
+		Accounts: []plaid.AccountBase{
+			account("acc-checking", "Plaid Checking", "0000", plaid.ACCOUNTTYPE_DEPOSITORY, plaid.ACCOUNTSUBTYPE_CHECKING, 110, 100),
+			account("acc-credit", "Plaid Credit Card", "3333", plaid.ACCOUNTTYPE_CREDIT, plaid.ACCOUNTSUBTYPE_CREDIT_CARD, 410, 1590),
+		},
+		Transactions: []plaid.Transaction{
+			transaction("tx-netflix-1", "acc-credit", "2023-11-15", 15.49, "Netflix, Inc.", "Netflix", "ENTERTAINMENT", "ENTERTAINMENT_TV_AND_MOVIES"),
+			transaction("tx-netflix-2", "acc-credit", "2023-12-15", 15.49, "Netflix, Inc.", "Netflix", "ENTERTAINMENT", "ENTERTAINMENT_TV_AND_MOVIES"),
+			transaction("tx-1", "acc-checking", "2024-01-03", 4.5, "Blue Bottle Coffee", "Blue Bottle", "FOOD_AND_DRINK", "FOOD_AND_DRINK_COFFEE"),
+			transaction("tx-2", "acc-checking", "2024-01-05", -2500, "ACME CORP PAYROLL", "", "INCOME", "INCOME_WAGES"),
+			transaction("tx-3", "acc-credit", "2024-01-10", 89.99, "Uber Eats", "Uber Eats", "FOOD_AND_DRINK", "FOOD_AND_DRINK_RESTAURANT"),
+			transaction("tx-4", "acc-credit", "2024-01-15", 15.49, "Netflix, Inc.", "Netflix", "ENTERTAINMENT", "ENTERTAINMENT_TV_AND_MOVIES"),
+			transaction("tx-5", "acc-checking", "2024-01-20", 500, "Credit card payment", "", "LOAN_PAYMENTS", "LOAN_PAYMENTS_CREDIT_CARD_PAYMENT"),
+			transaction("tx-6", "acc-checking", "2024-01-31", 1200, "Rent", "", "RENT_AND_UTILITIES", "RENT_AND_UTILITIES_RENT"),
+		},
+	}
+}
+
+func account(id string, name string, mask string, accountType plaid.AccountType, subtype plaid.AccountSubtype, current float64, available float64) plaid.AccountBase {
+	balances := plaid.NewAccountBalanceWithDefaults()
+	balances.SetCurrent(current)
+	balances.SetAvailable(available)
+	balances.SetIsoCurrencyCode("USD")
+	balances.Limit.Set(nil)
+	balances.UnofficialCurrencyCode.Set(nil)
+
+	a := plaid.NewAccountBaseWithDefaults()
+	a.AccountId = id
+	a.Balances = *balances
+	a.SetMask(mask)
+	a.Name = name
+	a.SetOfficialName(name)
+	a.Type = accountType
+	a.SetSubtype(subtype)
+	return *a
+}
+
+func transaction(id string, accountID string, date string, amount float64, name string, merchant string, primary string, detailed string) plaid.Transaction {
+	tx := plaid.NewTransactionWithDefaults()
+	tx.TransactionId = id
+	tx.AccountId = accountID
+	tx.Date = date
+	tx.SetAuthorizedDate(date)
+	tx.Amount = amount
+	tx.Name = name
+	if merchant != "" {
+		tx.SetMerchantName(merchant)
+	}
+	tx.SetIsoCurrencyCode("USD")
+	tx.PaymentChannel = "online"
+	tx.SetPersonalFinanceCategory(*plaid.NewPersonalFinanceCategory(primary, detailed))
+	return *tx
+}
+
+// request holds the fields of the requests the fake serves.
+type request struct {
+	AccessToken   string `json:"access_token"`
+	PublicToken   string `json:"public_token"`
+	InstitutionID string `json:"institution_id"`
+	Query         string `json:"query"`
+	StartDate     string `json:"start_date"`
+	EndDate       string `json:"end_date"`
+	Cursor        string `json:"cursor"`
+	Webhook       string `json:"webhook"`
+	KeyID         string `json:"key_id"`
+	Count         int32  `json:"count"`
+	Offset        int32  `json:"offset"`
+	Options       struct {
+		AccountIDs []string `json:"account_ids"`
+		Count      int32    `json:"count"`
+		Offset     int32    `json:"offset"`
+		OAuth      *bool    `json:"oauth"`
+	} `json:"options"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := s.requestID()
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, requestID, plaid.PLAIDERRORTYPE_INVALID_REQUEST, "INVALID_HTTP_METHOD", "only POST is supported")
+		return
+	}
+	if r.Header.Get("PLAID-CLIENT-ID") == "" || r.Header.Get("PLAID-SECRET") == "" {
+		writeError(w, http.StatusBadRequest, requestID, plaid.PLAIDERRORTYPE_INVALID_INPUT, "INVALID_API_KEYS", "invalid client_id or secret provided")
+		return
+	}
+
+	var req request
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, requestID, plaid.PLAIDERRORTYPE_INVALID_REQUEST, "INVALID_BODY", err.Error())
+		return
+	}
+
+	switch r.URL.Path {
+	case "/link/token/create":
+		writeJSON(w, plaid.NewLinkTokenCreateResponse(LinkToken, Updated.Add(4*time.Hour), requestID))
+		return
+	case "/item/public_token/exchange":
+		if req.PublicToken != PublicToken {
+			writeError(w, http.StatusBadRequest, requestID, plaid.PLAIDERRORTYPE_INVALID_INPUT, "INVALID_PUBLIC_TOKEN", "provided public token is in an invalid format")
+			return
+		}
+		writeJSON(w, plaid.NewItemPublicTokenExchangeResponse(AccessToken, ItemID, requestID))
+		return
+	case "/institutions/get":
+		writeJSON(w, plaid.NewInstitutionsGetResponse([]plaid.Institution{s.Institution}, 1, requestID))
+		return
+	case "/institutions/search":
+		var institutions []plaid.Institution
+		matches := strings.Contains(strings.ToLower(s.Institution.Name), strings.ToLower(req.Query))
+		if matches && (req.Options.OAuth == nil || *req.Options.OAuth == s.Institution.Oauth) {
+			institutions = append(institutions, s.Institution)
+		}
+		writeJSON(w, plaid.NewInstitutionsSearchResponse(institutions, requestID))
+		return
+	case "/sandbox/public_token/create":
+		if req.InstitutionID != s.Institution.InstitutionId {
+			writeError(w, http.StatusBadRequest, requestID, plaid.PLAIDERRORTYPE_INVALID_INPUT, "INVALID_INSTITUTION", "invalid institution_id provided")
+			return
+		}
+		writeJSON(w, plaid.NewSandboxPublicTokenCreateResponse(PublicToken, requestID))
+		return
+	case "/institutions/get_by_id":
+		if req.InstitutionID != s.Institution.InstitutionId {
+			writeError(w, http.StatusBadRequest, requestID, plaid.PLAIDERRORTYPE_INVALID_INPUT, "INVALID_INSTITUTION", "invalid institution_id provided")
+			return
+		}
+		writeJSON(w, plaid.NewInstitutionsGetByIdResponse(s.Institution, requestID))
+		return
+	case "/webhook_verification_key/get":
+		s.mu.Lock()
+		key, ok := s.WebhookKeys[req.KeyID]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusBadRequest, requestID, plaid.PLAIDERRORTYPE_INVALID_INPUT, "INVALID_WEBHOOK_VERIFICATION_KEY_ID", "invalid key_id provided")
+			return
+		}
+		writeJSON(w, plaid.NewWebhookVerificationKeyGetResponse(key, requestID))
+		return
+	}
+
+	s.mu.Lock()
+	item, ok := s.Items[req.AccessToken]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusBadRequest, requestID, plaid.PLAIDERRORTYPE_INVALID_INPUT, "INVALID_ACCESS_TOKEN", "provided access token is in an invalid format")
+		return
+	}
+
+	switch r.URL.Path {
+	case "/accounts/get", "/accounts/balance/get":
+		writeJSON(w, plaid.NewAccountsGetResponse(item.Accounts, item.Item, requestID))
+	case "/item/get":
+		s.mu.Lock()
+		res := plaid.NewItemGetResponse(item.Item, requestID)
+		s.mu.Unlock()
+		status := plaid.NewItemStatusNullableWithDefaults()
+		transactions := plaid.NewItemStatusTransactionsWithDefaults()
+		transactions.SetLastSuccessfulUpdate(Updated)
+		status.SetTransactions(*transactions)
+		res.SetStatus(*status)
+		writeJSON(w, res)
+	case "/item/remove":
+		s.mu.Lock()
+		delete(s.Items, req.AccessToken)
+		s.mu.Unlock()
+		writeJSON(w, plaid.NewItemRemoveResponse(requestID))
+	case "/item/webhook/update":
+		s.mu.Lock()
+		item.Item.SetWebhook(req.Webhook)
+		s.mu.Unlock()
+		writeJSON(w, plaid.NewItemWebhookUpdateResponse(item.Item, requestID))
+	case "/sandbox/item/reset_login":
+		s.ResetLogin(req.AccessToken)
+		writeJSON(w, plaid.NewSandboxItemResetLoginResponse(true, requestID))
+	case "/transactions/get":
+		s.transactionsGet(w, requestID, item, req)
+	case "/transactions/sync":
+		s.transactionsSync(w, requestID, item, req)
+	default:
+		writeError(w, http.StatusNotFound, requestID, plaid.PLAIDERRORTYPE_INVALID_REQUEST, "NOT_FOUND", fmt.Sprintf("%s isn't implemented by the fake", r.URL.Path))
+	}
+}
+
+func (s *Server) transactionsGet(w http.ResponseWriter, requestID string, item *Item, req request) {
+	var matched []plaid.Transaction
+	for _, tx := range sortedTransactions(item) {
+		if tx.Date < req.StartDate || tx.Date > req.EndDate {
+			continue
+		}
+		if len(req.Options.AccountIDs) > 0 && !slices.Contains(req.Options.AccountIDs, tx.AccountId) {
+			continue
+		}
+		matched = append(matched, tx)
+	}
+
+	count := req.Options.Count
+	if count == 0 {
+		count = 100
+	}
+	page := []plaid.Transaction{}
+	for i := req.Options.Offset; i < int32(len(matched)) && i < req.Options.Offset+count; i++ {
+		page = append(page, matched[i])
+	}
+	writeJSON(w, plaid.NewTransactionsGetResponse(item.Accounts, page, int32(len(matched)), item.Item, requestID))
+}
+
+// transactionsSync serves transactions in pages of count. Cursors are the
+// number of transactions already sent.
+func (s *Server) transactionsSync(w http.ResponseWriter, requestID string, item *Item, req request) {
+	txs := sortedTransactions(item)
+
+	start := 0
+	if req.Cursor != "" {
+		var err error
+		start, err = strconv.Atoi(req.Cursor)
+		if err != nil || start > len(txs) {
+			writeError(w, http.StatusBadRequest, requestID, plaid.PLAIDERRORTYPE_INVALID_INPUT, "INVALID_FIELD", "cursor is invalid")
+			return
+		}
+	}
+	count := int(req.Count)
+	if count == 0 {
+		count = 100
+	}
+	end := min(start+count, len(txs))
+
+	added := append([]plaid.Transaction{}, txs[start:end]...)
+	res := plaid.NewTransactionsSyncResponse(plaid.TRANSACTIONSUPDATESTATUS_HISTORICAL_UPDATE_COMPLETE, item.Accounts, added, []plaid.Transaction{}, []plaid.RemovedTransaction{}, strconv.Itoa(end), end < len(txs), requestID)
+	writeJSON(w, res)
+}
+
+// ResetLogin makes the item at accessToken need the user to log in again,
+// as /sandbox/item/reset_login does.
+func (s *Server) ResetLogin(accessToken string) {
+	loginRequired := plaid.NewPlaidErrorWithDefaults()
+	loginRequired.ErrorType = plaid.PLAIDERRORTYPE_ITEM_ERROR
+	loginRequired.ErrorCode = "ITEM_LOGIN_REQUIRED"
+	loginRequired.ErrorMessage = "the login details of this item have changed (credentials, MFA, or required user action) and a user login is required to update this information"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if item, ok := s.Items[accessToken]; ok {
+		item.Item.SetError(*loginRequired)
+	}
+}
+
+// FinishUpdate clears the error of the item at accessToken, as the user
+// logging in again through Link's update mode does. Link runs in the
+// browser, so there's no endpoint for it.
+func (s *Server) FinishUpdate(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if item, ok := s.Items[accessToken]; ok {
+		item.Item.Error.Set(nil)
+	}
+}
+
+func sortedTransactions(item *Item) []plaid.Transaction {
+	txs := append([]plaid.Transaction{}, item.Transactions...)
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].Date != txs[j].Date {
+			return txs[i].Date < txs[j].Date
+		}
+		return txs[i].TransactionId < txs[j].TransactionId
+	})
+	return txs
+}
+
+func (s *Server) requestID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	return fmt.Sprintf("fake-%d", s.requests)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, requestID string, errorType plaid.PlaidErrorType, code string, message string) {
+	plaidErr := plaid.NewPlaidError(errorType, code, message, *plaid.NewNullableString(nil))
+	plaidErr.SetRequestId(requestID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(plaidErr)
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package plaid_cli
+
+import "errors"
+
+var errDPAPIUnavailable = errors.New("DPAPI token encryption is only available on Windows")
+
+func dpapiProtect(b []byte) ([]byte, error) {
+	return nil, errDPAPIUnavailable
+}
+
+func dpapiUnprotect(b []byte) ([]byte, error) {
+	return nil, errDPAPIUnavailable
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package plaid_cli
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// dpapiProtect encrypts b with the Windows Data Protection API, so that only
+// the current Windows user can decrypt it.
+func dpapiProtect(b []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptProtectData(newDataBlob(b), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	return takeDataBlob(&out), nil
+}
+
+func dpapiUnprotect(b []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptUnprotectData(newDataBlob(b), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	return takeDataBlob(&out), nil
+}
+
+func newDataBlob(b []byte) *windows.DataBlob {
+	if len(b) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(b)), Data: &b[0]}
+}
+
+// takeDataBlob copies out memory allocated by DPAPI and frees it.
+func takeDataBlob(blob *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+	return append([]byte(nil), unsafe.Slice(blob.Data, blob.Size)...)
+}
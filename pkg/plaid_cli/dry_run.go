@@ -0,0 +1,37 @@
+package plaid_cli
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// ErrDryRun is returned in place of performing a mutating request when dry
+// run mode is enabled.
+var ErrDryRun = errors.New("dry run: request not sent")
+
+// PrintDryRun logs the request that would be sent to a Plaid endpoint, with
+// access tokens redacted.
+func PrintDryRun(endpoint string, req interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return err
+	}
+	if _, ok := fields["access_token"]; ok {
+		fields["access_token"] = "REDACTED"
+	}
+
+	b, err = json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Dry run: would call %s with:\n%s\n", endpoint, string(b))
+	return nil
+}
@@ -2,12 +2,18 @@ package plaid_cli
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"text/template"
+	"time"
 
 	"github.com/plaid/plaid-go/v26/plaid"
 	"github.com/skratchdot/open-golang/open"
@@ -15,7 +21,9 @@ import (
 
 const clientName = "plaid-cli"
 
-var products = []plaid.Products{
+// DefaultProducts are the products requested when linking an institution
+// unless others are configured.
+var DefaultProducts = []plaid.Products{
 	plaid.PRODUCTS_TRANSACTIONS,
 	plaid.PRODUCTS_AUTH,
 }
@@ -26,8 +34,20 @@ type Linker struct {
 	Errors        chan error
 	Client        *plaid.PlaidApiService
 	Data          *Data
-	countries     []plaid.CountryCode
-	lang          string
+	// DryRun makes the linker print link token requests instead of
+	// sending them.
+	DryRun bool
+	// PublicURL, if set, is where this machine's link server can be reached
+	// from outside it, such as a tunnel. Link is given PublicURL/oauth as its
+	// redirect URI, so institutions that log in with OAuth can send the user
+	// back. Link itself is still opened on localhost.
+	PublicURL string
+	// Resume makes Link and Relink reuse the link token of a session that
+	// was interrupted, if it's still valid, rather than starting afresh.
+	Resume    bool
+	countries []plaid.CountryCode
+	lang      string
+	products  []plaid.Products
 }
 
 type TokenPair struct {
@@ -36,101 +56,378 @@ type TokenPair struct {
 }
 
 func (l *Linker) Relink(itemID string, port string) error {
-	token := l.Data.Tokens[itemID]
-	hostname, err := os.Hostname()
+	token, ok := l.Data.Tokens[itemID]
+	if !ok {
+		return fmt.Errorf("no access token for item %s. Run `plaid-cli item link` to link it", itemID)
+	}
+	req, err := l.newLinkTokenRequest()
 	if err != nil {
 		return err
 	}
-
-	ctx := context.Background()
-	usr := *plaid.NewLinkTokenCreateRequestUser(hostname)
-	req := plaid.NewLinkTokenCreateRequest(clientName, l.lang, l.countries, usr)
-	req.SetProducts(products)
+	req.SetProducts(l.products)
 	req.SetAccessToken(token)
-	// might need to add redirection for oauth
-	apiReq := l.Client.LinkTokenCreate(ctx)
-	apiReq = apiReq.LinkTokenCreateRequest(*req)
-	// consider wrapping http resp for errors
-	resp, _, err := apiReq.Execute()
+	l.setRedirectURI(req)
+
+	linkToken, err := l.sessionLinkToken(itemID, req)
+	if err != nil {
+		return err
+	}
+	err = l.relink(port, linkToken)
 	if err != nil {
 		return err
 	}
-	return l.relink(port, resp.LinkToken)
+	return l.finishSession(itemID)
 }
 
 func (l *Linker) Link(port string) (*TokenPair, error) {
-	hostname, err := os.Hostname()
+	req, err := l.newLinkTokenRequest()
 	if err != nil {
 		return nil, err
 	}
+	req.SetProducts(l.products)
+	l.setRedirectURI(req)
 
-	ctx := context.Background()
-	usr := *plaid.NewLinkTokenCreateRequestUser(hostname)
-	req := plaid.NewLinkTokenCreateRequest(clientName, l.lang, l.countries, usr)
-	req.SetProducts(products)
-	// might need to add redirection for oauth
-	apiReq := l.Client.LinkTokenCreate(ctx)
-	apiReq = apiReq.LinkTokenCreateRequest(*req)
-	// consider wrapping http resp for errors
-	resp, _, err := apiReq.Execute()
+	linkToken, err := l.sessionLinkToken("", req)
 	if err != nil {
 		return nil, err
 	}
 
-	return l.link(port, resp.LinkToken)
+	pair, err := l.link(port, linkToken)
+	if err != nil {
+		return nil, err
+	}
+	return pair, l.finishSession("")
 }
 
 func (l *Linker) link(port string, linkToken string) (*TokenPair, error) {
-	log.Printf("Starting Plaid Link on port %s...\n", port)
+	publicToken, err := l.publicToken(port, linkToken)
+	if err != nil {
+		return nil, err
+	}
 
-	go func() {
-		http.HandleFunc("/link", handleLink(l, linkToken))
-		err := http.ListenAndServe(fmt.Sprintf(":%s", port), nil)
+	res, err := l.exchange(publicToken)
+	if err != nil {
+		return nil, err
+	}
+
+	pair := &TokenPair{
+		ItemID:      res.ItemId,
+		AccessToken: res.AccessToken,
+	}
+
+	return pair, nil
+}
+
+// LinkSandbox links a sandbox institution without opening Link, by having
+// Plaid create a public token for it directly. It only works in the sandbox
+// environment.
+func (l *Linker) LinkSandbox(institutionID string) (*TokenPair, error) {
+	req := plaid.NewSandboxPublicTokenCreateRequest(institutionID, l.products)
+	if l.DryRun {
+		err := PrintDryRun("/sandbox/public_token/create", req)
 		if err != nil {
-			l.Errors <- err
+			return nil, err
 		}
-	}()
+		return nil, ErrDryRun
+	}
 
-	url := fmt.Sprintf("http://localhost:%s/link", port)
-	log.Printf("Your browser should open automatically. If it doesn't, please visit %s to continue linking!", url)
-	err := open.Run(url)
+	apiReq := l.Client.SandboxPublicTokenCreate(context.Background())
+	apiReq = apiReq.SandboxPublicTokenCreateRequest(*req)
+	created, _, err := apiReq.Execute()
 	if err != nil {
-		log.Printf("Failed to open browser: %v\n", err)
+		return nil, err
 	}
 
-	select {
-	case err := <-l.Errors:
+	res, err := l.exchange(created.PublicToken)
+	if err != nil {
 		return nil, err
-	case publicToken := <-l.Results:
+	}
+	return &TokenPair{
+		ItemID:      res.ItemId,
+		AccessToken: res.AccessToken,
+	}, nil
+}
+
+// LinkBankIncome runs Plaid Link in Bank Income mode for the user identified
+// by userToken. Income data is associated with the user rather than with an
+// item, so there is no access token to exchange for.
+func (l *Linker) LinkBankIncome(port string, userToken string, days int32) error {
+	req, err := l.newLinkTokenRequest()
+	if err != nil {
+		return err
+	}
+	req.SetProducts([]plaid.Products{plaid.PRODUCTS_INCOME_VERIFICATION})
+	req.SetUserToken(userToken)
+
+	incomeVerification := plaid.NewLinkTokenCreateRequestIncomeVerification()
+	incomeVerification.SetIncomeSourceTypes([]plaid.IncomeVerificationSourceType{plaid.INCOMEVERIFICATIONSOURCETYPE_BANK})
+	incomeVerification.SetBankIncome(*plaid.NewLinkTokenCreateRequestIncomeVerificationBankIncome(days))
+	req.SetIncomeVerification(*incomeVerification)
+	l.setRedirectURI(req)
+
+	linkToken, err := l.createLinkToken(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.publicToken(port, linkToken)
+	return err
+}
+
+// LinkPaymentInitiation runs Plaid Link so the user can authorise the
+// payment identified by paymentID with their bank.
+func (l *Linker) LinkPaymentInitiation(port string, paymentID string) error {
+	req, err := l.newLinkTokenRequest()
+	if err != nil {
+		return err
+	}
+	req.SetProducts([]plaid.Products{plaid.PRODUCTS_PAYMENT_INITIATION})
+
+	paymentInitiation := plaid.NewLinkTokenCreateRequestPaymentInitiation()
+	paymentInitiation.SetPaymentId(paymentID)
+	req.SetPaymentInitiation(*paymentInitiation)
+	l.setRedirectURI(req)
+
+	linkToken, err := l.createLinkToken(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.publicToken(port, linkToken)
+	return err
+}
+
+// CreateLinkToken creates a link token for products without opening Link.
+// Plaid refuses products the account hasn't been enabled for, so this shows
+// which ones are.
+func (l *Linker) CreateLinkToken(products []plaid.Products) (string, error) {
+	req, err := l.newLinkTokenRequest()
+	if err != nil {
+		return "", err
+	}
+	req.SetProducts(products)
+	return l.createLinkToken(req)
+}
+
+func (l *Linker) newLinkTokenRequest() (*plaid.LinkTokenCreateRequest, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	usr := *plaid.NewLinkTokenCreateRequestUser(hostname)
+	return plaid.NewLinkTokenCreateRequest(clientName, l.lang, l.countries, usr), nil
+}
+
+// setRedirectURI sends OAuth institutions back to the link page at
+// PublicURL. Plaid only redirects to URIs registered in its dashboard.
+func (l *Linker) setRedirectURI(req *plaid.LinkTokenCreateRequest) {
+	if l.PublicURL != "" {
+		req.SetRedirectUri(strings.TrimSuffix(l.PublicURL, "/") + "/oauth")
+	}
+}
+
+func (l *Linker) createLinkToken(req *plaid.LinkTokenCreateRequest) (string, error) {
+	resp, err := l.createLinkTokenResponse(req)
+	return resp.LinkToken, err
+}
 
-		res, err := l.exchange(publicToken)
+func (l *Linker) createLinkTokenResponse(req *plaid.LinkTokenCreateRequest) (plaid.LinkTokenCreateResponse, error) {
+	if l.DryRun {
+		err := PrintDryRun("/link/token/create", req)
 		if err != nil {
-			return nil, err
+			return plaid.LinkTokenCreateResponse{}, err
 		}
+		return plaid.LinkTokenCreateResponse{}, ErrDryRun
+	}
+
+	apiReq := l.Client.LinkTokenCreate(context.Background())
+	apiReq = apiReq.LinkTokenCreateRequest(*req)
+	resp, _, err := apiReq.Execute()
+	return resp, err
+}
 
-		pair := &TokenPair{
-			ItemID:      res.ItemId,
-			AccessToken: res.AccessToken,
+// pendingLinkMargin is how long a pending link token must still be valid for
+// to be resumed, so it doesn't expire while the user is in Link.
+const pendingLinkMargin = 10 * time.Minute
+
+// sessionLinkToken returns the link token for a Link session for key, the
+// item ID being relinked or "" for a new link. Link tokens are valid for
+// about four hours, so with Resume the token of an interrupted session is
+// reused if it's still valid. Otherwise a new one is created, and kept until
+// the session finishes.
+func (l *Linker) sessionLinkToken(key string, req *plaid.LinkTokenCreateRequest) (string, error) {
+	if l.Resume {
+		pending, ok := l.Data.PendingLinks[key]
+		switch {
+		case !ok:
+			log.Println("There's no interrupted Link session to resume. Starting a new one.")
+		case time.Until(pending.Expiration) < pendingLinkMargin:
+			log.Println("The interrupted Link session has expired. Starting a new one.")
+		case pending.RedirectURI != req.GetRedirectUri():
+			log.Println("The interrupted Link session used a different redirect URI. Starting a new one.")
+		case l.DryRun:
+			log.Printf("Dry run: would resume the Link session started at %s.\n", pending.CreatedAt.Local().Format("15:04"))
+			return "", ErrDryRun
+		default:
+			log.Printf("Resuming the Link session started at %s.\n", pending.CreatedAt.Local().Format("15:04"))
+			return pending.LinkToken, nil
 		}
+	}
+
+	resp, err := l.createLinkTokenResponse(req)
+	if err != nil {
+		return "", err
+	}
 
-		return pair, nil
+	l.Data.PendingLinks[key] = PendingLink{
+		LinkToken:   resp.LinkToken,
+		Expiration:  resp.Expiration,
+		RedirectURI: req.GetRedirectUri(),
+		CreatedAt:   time.Now(),
 	}
+	err = l.Data.SavePendingLinks()
+	if err != nil {
+		return "", err
+	}
+	return resp.LinkToken, nil
 }
 
-func (l *Linker) relink(port string, linkToken string) error {
+// finishSession forgets the link token of a finished session for key.
+func (l *Linker) finishSession(key string) error {
+	if _, ok := l.Data.PendingLinks[key]; !ok {
+		return nil
+	}
+	delete(l.Data.PendingLinks, key)
+	return l.Data.SavePendingLinks()
+}
+
+func (l *Linker) publicToken(port string, linkToken string) (string, error) {
 	log.Printf("Starting Plaid Link on port %s...\n", port)
 
+	secret, err := newSessionSecret()
+	if err != nil {
+		return "", err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/link", handleLink(l, linkToken, secret, false))
+	if l.PublicURL != "" {
+		// OAuth institutions redirect to /oauth through the tunnel. It only
+		// sends the browser back to localhost, where the rest of the
+		// session happens, so nothing else can be reached from outside.
+		mux.HandleFunc("/oauth", handleOAuthRedirect(port))
+		mux.HandleFunc("/oauth/resume", handleLink(l, linkToken, secret, true))
+	}
+	stop, err := l.serve(port, mux)
+	if err != nil {
+		return "", err
+	}
+	defer stop()
+
+	url := fmt.Sprintf("http://localhost:%s/link?session=%s", port, secret)
+	log.Printf("Your browser should open automatically. If it doesn't, please visit %s to continue linking!", url)
+	err = open.Run(url)
+	if err != nil {
+		log.Printf("Failed to open browser: %v\n", err)
+	}
+
+	select {
+	case err := <-l.Errors:
+		return "", err
+	case publicToken := <-l.Results:
+		return publicToken, nil
+	}
+}
+
+// serve serves mux on localhost:port until the returned function is called.
+// Each session has a server of its own, so sessions can follow one another
+// in the same run.
+func (l *Linker) serve(port string, mux *http.ServeMux) (func(), error) {
+	// Only listen on localhost. The page is for this machine's browser,
+	// and listening on every interface makes Windows ask for firewall
+	// access.
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%s", port))
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: mux}
 	go func() {
-		http.HandleFunc("/relink", handleRelink(l, linkToken))
-		err := http.ListenAndServe(fmt.Sprintf(":%s", port), nil)
-		if err != nil {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			l.Errors <- err
 		}
 	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
+
+const sessionCookie = "plaid_cli_session"
+
+// newSessionSecret makes the secret that ties a Link session to the browser
+// it was opened in.
+func newSessionSecret() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// sessionAuthorized reports whether r comes from the browser the session was
+// opened in. That browser is given the secret in the URL it opens, and keeps
+// it in a cookie. Anyone else who can reach the server, through a tunnel,
+// doesn't have it.
+func sessionAuthorized(w http.ResponseWriter, r *http.Request, secret string) bool {
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("session")), []byte(secret)) == 1 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    secret,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return true
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	return err == nil && subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(secret)) == 1
+}
+
+// handleOAuthRedirect sends a browser that an OAuth institution redirected
+// to the tunnel back to the link page on localhost, keeping the OAuth state
+// Plaid added to the URL.
+func handleOAuthRedirect(port string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		url := fmt.Sprintf("http://localhost:%s/oauth/resume?%s", port, r.URL.RawQuery)
+		http.Redirect(w, r, url, http.StatusFound)
+	}
+}
 
-	url := fmt.Sprintf("http://localhost:%s/relink", port)
+func (l *Linker) relink(port string, linkToken string) error {
+	log.Printf("Starting Plaid Link on port %s...\n", port)
+
+	secret, err := newSessionSecret()
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/relink", handleRelink(l, linkToken, secret, false))
+	if l.PublicURL != "" {
+		mux.HandleFunc("/oauth", handleOAuthRedirect(port))
+		mux.HandleFunc("/oauth/resume", handleRelink(l, linkToken, secret, true))
+	}
+	stop, err := l.serve(port, mux)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	url := fmt.Sprintf("http://localhost:%s/relink?session=%s", port, secret)
 	log.Printf("Your browser should open automatically. If it doesn't, please visit %s to continue linking!", url)
-	err := open.Run(url)
+	err = open.Run(url)
 	if err != nil {
 		log.Printf("Failed to open browser: %v\n", err)
 	}
@@ -151,7 +448,11 @@ func (l *Linker) exchange(publicToken string) (plaid.ItemPublicTokenExchangeResp
 	return res, err
 }
 
-func NewLinker(data *Data, client *plaid.PlaidApiService, countries []plaid.CountryCode, lang string) *Linker {
+func NewLinker(data *Data, client *plaid.PlaidApiService, countries []plaid.CountryCode, lang string, products []plaid.Products) *Linker {
+	if len(products) == 0 {
+		products = DefaultProducts
+	}
+
 	return &Linker{
 		Results:       make(chan string),
 		RelinkResults: make(chan bool),
@@ -160,11 +461,21 @@ func NewLinker(data *Data, client *plaid.PlaidApiService, countries []plaid.Coun
 		Data:          data,
 		countries:     countries,
 		lang:          lang,
+		products:      products,
 	}
 }
 
-func handleLink(linker *Linker, linkToken string) func(w http.ResponseWriter, r *http.Request) {
+// handleLink serves the link page, and receives the public token from it.
+// With oauth set, the page continues a Link session that an OAuth
+// institution has redirected back to. Only the browser the session was
+// opened in is served.
+func handleLink(linker *Linker, linkToken string, secret string, oauth bool) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !sessionAuthorized(w, r, secret) {
+			http.Error(w, "This Link session was opened in another browser.", http.StatusForbidden)
+			return
+		}
+
 		switch r.Method {
 		case http.MethodGet:
 			t := template.New("link")
@@ -173,6 +484,9 @@ func handleLink(linker *Linker, linkToken string) func(w http.ResponseWriter, r
 			d := LinkTmplData{
 				LinkToken: linkToken,
 			}
+			if oauth {
+				d.ReceivedRedirectURI = linker.receivedRedirectURI(r)
+			}
 			err := t.Execute(w, d)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -205,15 +519,32 @@ func handleLink(linker *Linker, linkToken string) func(w http.ResponseWriter, r
 }
 
 type LinkTmplData struct {
-	LinkToken string
+	LinkToken           string
+	ReceivedRedirectURI string
 }
 
 type RelinkTmplData struct {
-	LinkToken string
+	LinkToken           string
+	ReceivedRedirectURI string
 }
 
-func handleRelink(linker *Linker, linkToken string) func(w http.ResponseWriter, r *http.Request) {
+// receivedRedirectURI is the URI an OAuth institution redirected r's
+// browser to, through the tunnel, before it was sent on to localhost. Link
+// checks it against the registered one, so it's given the tunnel's.
+func (l *Linker) receivedRedirectURI(r *http.Request) string {
+	return strings.TrimSuffix(l.PublicURL, "/") + "/oauth?" + r.URL.RawQuery
+}
+
+// handleRelink serves the relink page, and hears from it when Link in update
+// mode is done. Like handleLink, only the browser the session was opened in
+// is served.
+func handleRelink(linker *Linker, linkToken string, secret string, oauth bool) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !sessionAuthorized(w, r, secret) {
+			http.Error(w, "This Link session was opened in another browser.", http.StatusForbidden)
+			return
+		}
+
 		switch r.Method {
 		case http.MethodGet:
 			t := template.New("relink")
@@ -222,6 +553,9 @@ func handleRelink(linker *Linker, linkToken string) func(w http.ResponseWriter,
 			d := RelinkTmplData{
 				LinkToken: linkToken,
 			}
+			if oauth {
+				d.ReceivedRedirectURI = linker.receivedRedirectURI(r)
+			}
 			err := t.Execute(w, d)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -278,6 +612,9 @@ var linkTemplate = `<html>
      (function($) {
        var handler = Plaid.create({
 	 token: '{{ .LinkToken }}',
+	 {{- if .ReceivedRedirectURI }}
+	 receivedRedirectUri: '{{ js .ReceivedRedirectURI }}',
+	 {{- end }}
 	 onSuccess: function(public_token, metadata) {
 	   // Send the public_token to your app server.
 	   // The metadata object contains info about the institution the
@@ -342,6 +679,9 @@ var relinkTemplate string = `<html>
      (function($) {
        var handler = Plaid.create({
 	 token: '{{ .LinkToken }}',
+	 {{- if .ReceivedRedirectURI }}
+	 receivedRedirectUri: '{{ js .ReceivedRedirectURI }}',
+	 {{- end }}
 	 onSuccess: (public_token, metadata) => {
 	   // You do not need to repeat the /item/public_token/exchange
 	   // process when a user uses Link in update mode.
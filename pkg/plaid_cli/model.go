@@ -0,0 +1,326 @@
+package plaid_cli
+
+import (
+	"time"
+
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// Transactions, accounts and items are converted from plaid-go's models as
+// soon as they're fetched, and everything else in plaid-cli, from the
+// formatters to the files in the data directory, uses these types instead.
+// A new major version of plaid-go then only changes the conversions below.
+//
+// Their JSON is Plaid's, with fields in the same order plaid-go writes
+// them, so data saved before these types existed still loads and output
+// doesn't change.
+
+// Account types, as Plaid names them.
+const (
+	AccountTypeBrokerage  = "brokerage"
+	AccountTypeCredit     = "credit"
+	AccountTypeDepository = "depository"
+	AccountTypeInvestment = "investment"
+	AccountTypeLoan       = "loan"
+	AccountTypeOther      = "other"
+)
+
+// Transaction is a transaction from Plaid, or imported or split by
+// plaid-cli.
+type Transaction struct {
+	AccountID                      string                   `json:"account_id"`
+	AccountOwner                   *string                  `json:"account_owner"`
+	Amount                         float64                  `json:"amount"`
+	AuthorizedDate                 *string                  `json:"authorized_date"`
+	AuthorizedDatetime             *time.Time               `json:"authorized_datetime"`
+	Category                       []string                 `json:"category,omitempty"`
+	CategoryID                     *string                  `json:"category_id"`
+	CheckNumber                    *string                  `json:"check_number,omitempty"`
+	Counterparties                 []Counterparty           `json:"counterparties,omitempty"`
+	Date                           string                   `json:"date"`
+	Datetime                       *time.Time               `json:"datetime"`
+	ISOCurrencyCode                *string                  `json:"iso_currency_code"`
+	Location                       Location                 `json:"location"`
+	LogoURL                        *string                  `json:"logo_url,omitempty"`
+	MerchantEntityID               *string                  `json:"merchant_entity_id,omitempty"`
+	MerchantName                   *string                  `json:"merchant_name,omitempty"`
+	Name                           string                   `json:"name"`
+	OriginalDescription            *string                  `json:"original_description,omitempty"`
+	PaymentChannel                 string                   `json:"payment_channel"`
+	PaymentMeta                    PaymentMeta              `json:"payment_meta"`
+	Pending                        bool                     `json:"pending"`
+	PendingTransactionID           *string                  `json:"pending_transaction_id"`
+	PersonalFinanceCategory        *PersonalFinanceCategory `json:"personal_finance_category,omitempty"`
+	PersonalFinanceCategoryIconURL *string                  `json:"personal_finance_category_icon_url,omitempty"`
+	TransactionCode                *string                  `json:"transaction_code"`
+	TransactionID                  string                   `json:"transaction_id"`
+	TransactionType                *string                  `json:"transaction_type,omitempty"`
+	UnofficialCurrencyCode         *string                  `json:"unofficial_currency_code"`
+	Website                        *string                  `json:"website,omitempty"`
+}
+
+// Location is where a transaction happened, as far as Plaid knows.
+type Location struct {
+	Address     *string  `json:"address"`
+	City        *string  `json:"city"`
+	Country     *string  `json:"country"`
+	Lat         *float64 `json:"lat"`
+	Lon         *float64 `json:"lon"`
+	PostalCode  *string  `json:"postal_code"`
+	Region      *string  `json:"region"`
+	StoreNumber *string  `json:"store_number"`
+}
+
+// PaymentMeta is what Plaid knows about a transaction's payment.
+type PaymentMeta struct {
+	ByOrderOf        *string `json:"by_order_of"`
+	Payee            *string `json:"payee"`
+	Payer            *string `json:"payer"`
+	PaymentMethod    *string `json:"payment_method"`
+	PaymentProcessor *string `json:"payment_processor"`
+	PPDID            *string `json:"ppd_id"`
+	Reason           *string `json:"reason"`
+	ReferenceNumber  *string `json:"reference_number"`
+}
+
+// PersonalFinanceCategory is a transaction's category in Plaid's personal
+// finance taxonomy.
+type PersonalFinanceCategory struct {
+	ConfidenceLevel *string `json:"confidence_level,omitempty"`
+	Detailed        string  `json:"detailed"`
+	Primary         string  `json:"primary"`
+}
+
+// Counterparty is a merchant or other party to a transaction.
+type Counterparty struct {
+	ConfidenceLevel *string `json:"confidence_level,omitempty"`
+	EntityID        *string `json:"entity_id,omitempty"`
+	LogoURL         *string `json:"logo_url"`
+	Name            string  `json:"name"`
+	Type            string  `json:"type"`
+	Website         *string `json:"website"`
+}
+
+// Account is an account at a linked institution, or a manual account.
+type Account struct {
+	AccountID           string         `json:"account_id"`
+	Balances            AccountBalance `json:"balances"`
+	HolderCategory      *string        `json:"holder_category,omitempty"`
+	Mask                *string        `json:"mask"`
+	Name                string         `json:"name"`
+	OfficialName        *string        `json:"official_name"`
+	PersistentAccountID *string        `json:"persistent_account_id,omitempty"`
+	Subtype             *string        `json:"subtype"`
+	Type                string         `json:"type"`
+	VerificationStatus  *string        `json:"verification_status,omitempty"`
+}
+
+// AccountBalance is an account's balances when it was fetched.
+type AccountBalance struct {
+	Available              *float64   `json:"available"`
+	Current                *float64   `json:"current"`
+	ISOCurrencyCode        *string    `json:"iso_currency_code"`
+	LastUpdatedDatetime    *time.Time `json:"last_updated_datetime,omitempty"`
+	Limit                  *float64   `json:"limit"`
+	UnofficialCurrencyCode *string    `json:"unofficial_currency_code"`
+}
+
+// Item is a login at an institution.
+type Item struct {
+	AvailableProducts     []string   `json:"available_products"`
+	BilledProducts        []string   `json:"billed_products"`
+	ConsentExpirationTime *time.Time `json:"consent_expiration_time"`
+	ConsentedProducts     []string   `json:"consented_products,omitempty"`
+	// ErrorCode is the error the item is in, such as ITEM_LOGIN_REQUIRED.
+	ErrorCode     *string  `json:"error_code,omitempty"`
+	InstitutionID *string  `json:"institution_id,omitempty"`
+	ItemID        string   `json:"item_id"`
+	Products      []string `json:"products,omitempty"`
+	UpdateType    string   `json:"update_type"`
+	Webhook       *string  `json:"webhook"`
+	// LastTransactionsUpdate is when Plaid last successfully updated the
+	// item's transactions. It comes from the status /item/get returns
+	// alongside the item.
+	LastTransactionsUpdate *time.Time `json:"last_transactions_update,omitempty"`
+}
+
+// Value returns what p points to, or the zero value if p is nil.
+func Value[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
+
+// Ptr returns a pointer to v.
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+func TransactionFromPlaid(tx plaid.Transaction) Transaction {
+	converted := Transaction{
+		AccountID:                      tx.AccountId,
+		AccountOwner:                   tx.AccountOwner.Get(),
+		Amount:                         tx.Amount,
+		AuthorizedDate:                 tx.AuthorizedDate.Get(),
+		AuthorizedDatetime:             tx.AuthorizedDatetime.Get(),
+		Category:                       tx.Category,
+		CategoryID:                     tx.CategoryId.Get(),
+		CheckNumber:                    tx.CheckNumber.Get(),
+		Date:                           tx.Date,
+		Datetime:                       tx.Datetime.Get(),
+		ISOCurrencyCode:                tx.IsoCurrencyCode.Get(),
+		Location:                       locationFromPlaid(tx.Location),
+		LogoURL:                        tx.LogoUrl.Get(),
+		MerchantEntityID:               tx.MerchantEntityId.Get(),
+		MerchantName:                   tx.MerchantName.Get(),
+		Name:                           tx.Name,
+		OriginalDescription:            tx.OriginalDescription.Get(),
+		PaymentChannel:                 tx.PaymentChannel,
+		PaymentMeta:                    paymentMetaFromPlaid(tx.PaymentMeta),
+		Pending:                        tx.Pending,
+		PendingTransactionID:           tx.PendingTransactionId.Get(),
+		PersonalFinanceCategoryIconURL: tx.PersonalFinanceCategoryIconUrl,
+		TransactionID:                  tx.TransactionId,
+		TransactionType:                tx.TransactionType,
+		UnofficialCurrencyCode:         tx.UnofficialCurrencyCode.Get(),
+		Website:                        tx.Website.Get(),
+	}
+	if code := tx.TransactionCode.Get(); code != nil {
+		converted.TransactionCode = Ptr(string(*code))
+	}
+	if pfc := tx.PersonalFinanceCategory.Get(); pfc != nil {
+		converted.PersonalFinanceCategory = &PersonalFinanceCategory{
+			ConfidenceLevel: pfc.ConfidenceLevel.Get(),
+			Detailed:        pfc.Detailed,
+			Primary:         pfc.Primary,
+		}
+	}
+	if tx.Counterparties != nil {
+		converted.Counterparties = []Counterparty{}
+		for _, c := range *tx.Counterparties {
+			converted.Counterparties = append(converted.Counterparties, Counterparty{
+				ConfidenceLevel: c.ConfidenceLevel.Get(),
+				EntityID:        c.EntityId.Get(),
+				LogoURL:         c.LogoUrl.Get(),
+				Name:            c.Name,
+				Type:            string(c.Type),
+				Website:         c.Website.Get(),
+			})
+		}
+	}
+	return converted
+}
+
+func TransactionsFromPlaid(txs []plaid.Transaction) []Transaction {
+	converted := make([]Transaction, 0, len(txs))
+	for _, tx := range txs {
+		converted = append(converted, TransactionFromPlaid(tx))
+	}
+	return converted
+}
+
+func locationFromPlaid(l plaid.Location) Location {
+	return Location{
+		Address:     l.Address.Get(),
+		City:        l.City.Get(),
+		Country:     l.Country.Get(),
+		Lat:         l.Lat.Get(),
+		Lon:         l.Lon.Get(),
+		PostalCode:  l.PostalCode.Get(),
+		Region:      l.Region.Get(),
+		StoreNumber: l.StoreNumber.Get(),
+	}
+}
+
+func paymentMetaFromPlaid(m plaid.PaymentMeta) PaymentMeta {
+	return PaymentMeta{
+		ByOrderOf:        m.ByOrderOf.Get(),
+		Payee:            m.Payee.Get(),
+		Payer:            m.Payer.Get(),
+		PaymentMethod:    m.PaymentMethod.Get(),
+		PaymentProcessor: m.PaymentProcessor.Get(),
+		PPDID:            m.PpdId.Get(),
+		Reason:           m.Reason.Get(),
+		ReferenceNumber:  m.ReferenceNumber.Get(),
+	}
+}
+
+func AccountFromPlaid(account plaid.AccountBase) Account {
+	converted := Account{
+		AccountID: account.AccountId,
+		Balances: AccountBalance{
+			Available:              account.Balances.Available.Get(),
+			Current:                account.Balances.Current.Get(),
+			ISOCurrencyCode:        account.Balances.IsoCurrencyCode.Get(),
+			LastUpdatedDatetime:    account.Balances.LastUpdatedDatetime.Get(),
+			Limit:                  account.Balances.Limit.Get(),
+			UnofficialCurrencyCode: account.Balances.UnofficialCurrencyCode.Get(),
+		},
+		Mask:                account.Mask.Get(),
+		Name:                account.Name,
+		OfficialName:        account.OfficialName.Get(),
+		PersistentAccountID: account.PersistentAccountId,
+		Type:                string(account.Type),
+		VerificationStatus:  account.VerificationStatus,
+	}
+	if category := account.HolderCategory.Get(); category != nil {
+		converted.HolderCategory = Ptr(string(*category))
+	}
+	if subtype := account.Subtype.Get(); subtype != nil {
+		converted.Subtype = Ptr(string(*subtype))
+	}
+	return converted
+}
+
+func AccountsFromPlaid(accounts []plaid.AccountBase) []Account {
+	converted := make([]Account, 0, len(accounts))
+	for _, account := range accounts {
+		converted = append(converted, AccountFromPlaid(account))
+	}
+	return converted
+}
+
+func ItemFromPlaid(item plaid.Item) Item {
+	converted := Item{
+		AvailableProducts:     productNames(item.AvailableProducts),
+		BilledProducts:        productNames(item.BilledProducts),
+		ConsentExpirationTime: item.ConsentExpirationTime.Get(),
+		InstitutionID:         item.InstitutionId.Get(),
+		ItemID:                item.ItemId,
+		UpdateType:            item.UpdateType,
+		Webhook:               item.Webhook.Get(),
+	}
+	if item.Products != nil {
+		converted.Products = productNames(*item.Products)
+	}
+	if item.ConsentedProducts != nil {
+		converted.ConsentedProducts = productNames(*item.ConsentedProducts)
+	}
+	if itemErr := item.Error.Get(); itemErr != nil {
+		converted.ErrorCode = Ptr(itemErr.ErrorCode)
+	}
+	return converted
+}
+
+// ItemFromPlaidResponse converts the item in an /item/get response, with
+// its status.
+func ItemFromPlaidResponse(res plaid.ItemGetResponse) Item {
+	converted := ItemFromPlaid(res.Item)
+	status := res.GetStatus()
+	if transactions, ok := status.GetTransactionsOk(); ok && transactions != nil {
+		if t, ok := transactions.GetLastSuccessfulUpdateOk(); ok && t != nil {
+			converted.LastTransactionsUpdate = t
+		}
+	}
+	return converted
+}
+
+func productNames(products []plaid.Products) []string {
+	names := make([]string, 0, len(products))
+	for _, p := range products {
+		names = append(names, string(p))
+	}
+	return names
+}
@@ -0,0 +1,194 @@
+package plaid_cli
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// moneyPlaces is the number of decimal places Money keeps: enough for the
+// cryptocurrency amounts Plaid returns, as well as cents.
+const moneyPlaces = 8
+
+const moneyScale = 100_000_000
+
+// Money is an amount of money in hundred-millionths, so that totals are
+// exact: summing many transactions never gives 1023.9999999 rather than
+// 1024. Amounts can be added, subtracted and compared as integers.
+//
+// Money is written to JSON as a number, and formats with %f like a float,
+// but rounded from the exact decimal.
+type Money int64
+
+// MoneyFromFloat converts an amount from Plaid, taking the shortest decimal
+// that reads back as f, which is the decimal Plaid sent.
+func MoneyFromFloat(f float64) Money {
+	m, err := ParseMoney(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		// Only NaN and infinities can't be parsed.
+		return 0
+	}
+	return m
+}
+
+// MoneyFromFloat32 converts an amount Plaid's client gives as a float32,
+// taking the shortest decimal that reads back as f.
+func MoneyFromFloat32(f float32) Money {
+	m, err := ParseMoney(strconv.FormatFloat(float64(f), 'f', -1, 32))
+	if err != nil {
+		return 0
+	}
+	return m
+}
+
+// ParseMoney parses a decimal amount such as -12.5. Digits past Money's
+// places are rounded.
+func ParseMoney(s string) (Money, error) {
+	digits, negative := strings.CutPrefix(s, "-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" || strings.ContainsAny(whole+fraction, "+-") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	roundUp := false
+	if len(fraction) > moneyPlaces {
+		roundUp = fraction[moneyPlaces] >= '5'
+		fraction = fraction[:moneyPlaces]
+	}
+	fraction += strings.Repeat("0", moneyPlaces-len(fraction))
+
+	n, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if roundUp {
+		n++
+	}
+	if negative {
+		n = -n
+	}
+	return Money(n), nil
+}
+
+// Float64 returns m as a float, for calculations such as percentages that
+// don't need to be exact.
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// Abs returns the absolute value of m.
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Div divides m by n, rounding half away from zero, e.g. for averages.
+func (m Money) Div(n int) Money {
+	if n == 0 {
+		return 0
+	}
+	return Money(math.Round(float64(m) / float64(n)))
+}
+
+// Mul multiplies m by f, rounding to Money's places, e.g. to convert a
+// weekly cost to a monthly one.
+func (m Money) Mul(f float64) Money {
+	return Money(math.Round(float64(m) * f))
+}
+
+// Round rounds m to places decimal places, half away from zero.
+func (m Money) Round(places int) Money {
+	if places >= moneyPlaces {
+		return m
+	}
+	unit := Money(math.Pow10(moneyPlaces - places))
+	rounded := (m.Abs() + unit/2) / unit * unit
+	if m < 0 {
+		return -rounded
+	}
+	return rounded
+}
+
+// String returns m as a decimal with at least two places, and more only if
+// m has them, e.g. 4.50, -2500.00 or 0.00012345.
+func (m Money) String() string {
+	s := m.decimal(moneyPlaces)
+	s = strings.TrimRight(s, "0")
+	if dot := strings.IndexByte(s, '.'); len(s)-dot-1 < 2 {
+		s += strings.Repeat("0", 2-(len(s)-dot-1))
+	}
+	return s
+}
+
+// decimal returns m rounded to places decimal places.
+func (m Money) decimal(places int) string {
+	rounded := m.Round(places)
+	sign := ""
+	if rounded < 0 {
+		sign = "-"
+	}
+	abs := uint64(rounded.Abs())
+	whole := abs / moneyScale
+	if places <= 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	fraction := fmt.Sprintf("%0*d", moneyPlaces, abs%moneyScale)
+	if places < moneyPlaces {
+		fraction = fraction[:places]
+	}
+	return fmt.Sprintf("%s%d.%s", sign, whole, fraction+strings.Repeat("0", max(0, places-moneyPlaces)))
+}
+
+// Format makes %f (and %.2f and so on) round m exactly, like a float would be
+// rounded if it were exact. %v and %s use String.
+func (m Money) Format(f fmt.State, verb rune) {
+	var s string
+	switch verb {
+	case 'f', 'F':
+		places, ok := f.Precision()
+		if !ok {
+			places = 6
+		}
+		s = m.decimal(places)
+	case 'v', 's':
+		s = m.String()
+	default:
+		fmt.Fprintf(f, "%%!%c(Money=%s)", verb, m.String())
+		return
+	}
+	if f.Flag('+') && !strings.HasPrefix(s, "-") {
+		s = "+" + s
+	}
+	if width, ok := f.Width(); ok && len(s) < width {
+		padding := strings.Repeat(" ", width-len(s))
+		if f.Flag('-') {
+			s += padding
+		} else {
+			s = padding + s
+		}
+	}
+	fmt.Fprint(f, s)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a number, or a decimal string. Numbers that were
+// written as floats, possibly with an exponent, are read as floats.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		f, floatErr := strconv.ParseFloat(s, 64)
+		if floatErr != nil {
+			return err
+		}
+		parsed = MoneyFromFloat(f)
+	}
+	*m = parsed
+	return nil
+}
@@ -3,42 +3,339 @@ package plaid_cli
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type Data struct {
-	DataDir     string
+	DataDir string
+	// Environment is the Plaid environment this data belongs to. Each
+	// environment's tokens and related state are stored separately, so an
+	// item linked in one can never be used against another.
+	Environment string
 	Tokens      map[string]string
+	// TokenEncryption is how access tokens are encrypted at rest: "none" or
+	// "dpapi" (Windows only). Tokens are read back in whichever form they
+	// were saved in.
+	TokenEncryption string
+	// tokensEncryption is how the tokens on disk are currently encrypted.
+	tokensEncryption string
+	// TokenKeyFile is where the key access tokens are signed with is kept.
+	// It belongs outside DataDir, so that someone who can change the tokens
+	// can't also sign them.
+	TokenKeyFile string
+	// ReadOnly stops access tokens from being written, for read-only mode.
+	ReadOnly bool
+	// external is set for data loaded with LoadDataReadOnly, whose
+	// directory is never written to.
+	external    bool
 	Aliases     map[string]string
 	BackAliases map[string]string
+	// AssetReports maps asset report IDs to their asset report tokens.
+	AssetReports map[string]string
+	// UserToken identifies this plaid-cli installation to Plaid's
+	// user-based products such as Bank Income.
+	UserToken string
+	// TransferEventCursor is the ID of the last transfer event seen by
+	// 'transfer events sync'.
+	TransferEventCursor int32
+	// ConsentExpirations maps item IDs to the time the user's consent for
+	// that item expires, for institutions that require periodic consent.
+	ConsentExpirations map[string]time.Time
+	// Exports tracks incremental exports, keyed by item ID and destination.
+	Exports map[string]ExportState
+	// Ignored lists transactions and accounts excluded from reports and
+	// exports.
+	Ignored Ignored
+	// Splits maps transaction IDs to the categorized parts they have been
+	// split into.
+	Splits map[string][]SplitPart
+	// DaemonCursors maps item IDs to the transactions sync cursor the daemon
+	// last checked for new transactions at.
+	DaemonCursors map[string]string
+	// AccountCache maps item IDs to the accounts last fetched for them, so
+	// accounts can be listed without calling Plaid.
+	AccountCache map[string]CachedAccounts
+	// Owners maps item IDs to who they belong to, for joint finances.
+	Owners map[string]string
+	// SavingsHistory maps months (YYYY-MM) to their income and spending, so
+	// past months aren't fetched again for each savings rate report.
+	SavingsHistory map[string]SavingsMonth
+	// Imported maps manual accounts, such as manual:cash, to transactions
+	// imported into them from files, so they appear in reports alongside
+	// transactions from Plaid.
+	Imported map[string][]Transaction
+	// BalanceHistory maps account IDs to their balances over time, for net
+	// worth. Manual accounts, such as manual:house, are kept only here.
+	BalanceHistory map[string]AccountHistory
+	// PushJournal maps push targets, such as ynab, to transactions that
+	// failed to push to them, so they can be retried.
+	PushJournal map[string][]PushFailure
+	// Pushed maps push targets to the external IDs of the transactions
+	// pushed to them, so pushing again never sends one twice.
+	Pushed map[string]map[string]PushedTransaction
+	// AccountMappings maps push targets to the destination account for each
+	// Plaid account ID, as chosen with `map-accounts`.
+	AccountMappings map[string]map[string]string
+	// WebhookKeys maps key IDs to the keys Plaid signs webhooks with, so
+	// each is only fetched once.
+	WebhookKeys map[string]WebhookKey
+	// PendingLinks maps item IDs being relinked, or "" for a new link, to
+	// the link token of a Link session that hasn't finished, so it can be
+	// resumed with `link --resume`.
+	PendingLinks map[string]PendingLink
 }
 
-func LoadData(dataDir string) (*Data, error) {
-	err := os.MkdirAll(filepath.Join(dataDir, "data"), os.ModePerm)
+// PendingLink is a link token for a Link session that hasn't finished.
+type PendingLink struct {
+	LinkToken  string    `json:"link_token"`
+	Expiration time.Time `json:"expiration"`
+	// RedirectURI is the OAuth redirect URI the token was created with, if
+	// any. Resuming from another URI would break OAuth logins.
+	RedirectURI string    `json:"redirect_uri,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WebhookKey is a P-256 public key Plaid signs webhooks with.
+type WebhookKey struct {
+	// X and Y are the key's coordinates, base64url encoded.
+	X         string    `json:"x"`
+	Y         string    `json:"y"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiredAt is when Plaid stopped signing with the key, if it has.
+	ExpiredAt *time.Time `json:"expired_at,omitempty"`
+	FetchedAt time.Time  `json:"fetched_at"`
+}
+
+// PushedTransaction is a transaction that was pushed to a budgeting tool.
+type PushedTransaction struct {
+	TransactionID string    `json:"transaction_id"`
+	PushedAt      time.Time `json:"pushed_at"`
+}
+
+// PushFailure is a transaction that failed to push to a budgeting tool.
+type PushFailure struct {
+	Transaction Transaction `json:"transaction"`
+	// Account is the destination account it was pushed to.
+	Account  string    `json:"account"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+	Attempts int       `json:"attempts"`
+}
+
+// AccountHistory is an account's balance as recorded on each day.
+type AccountHistory struct {
+	Name string `json:"name"`
+	// Item is the item the account belongs to, or empty for a manual
+	// account.
+	Item     string `json:"item,omitempty"`
+	Type     string `json:"type"`
+	Currency string `json:"currency,omitempty"`
+	// Balances maps days (YYYY-MM-DD) to the last balance seen on them.
+	Balances map[string]Money `json:"balances"`
+}
+
+// SavingsMonth is a month's income and spending.
+type SavingsMonth struct {
+	Income   Money `json:"income"`
+	Spending Money `json:"spending"`
+	// Signature identifies the items and rules the totals were worked out
+	// with, so they're worked out again if either changes.
+	Signature string `json:"signature"`
+}
+
+// CachedAccounts are an item's accounts as of UpdatedAt. Balances in them
+// are only as current as that.
+type CachedAccounts struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	Accounts  []Account `json:"accounts"`
+	// Missing are accounts Plaid used to return for the item but no longer
+	// does, because they were closed or deselected when relinking.
+	Missing []MissingAccount `json:"missing,omitempty"`
+}
+
+// MissingAccount is an account as it was last returned by Plaid.
+type MissingAccount struct {
+	Account      Account   `json:"account"`
+	MissingSince time.Time `json:"missing_since"`
+	// Archived accounts are left out of reports and exports, like ignored
+	// ones.
+	Archived bool `json:"archived,omitempty"`
+}
+
+// SplitPart is a portion of a transaction's amount assigned to a category.
+type SplitPart struct {
+	Amount   Money  `json:"amount"`
+	Category string `json:"category"`
+}
+
+// Ignored maps ignored transaction and account IDs to when they were
+// ignored.
+type Ignored struct {
+	Transactions map[string]time.Time `json:"transactions"`
+	Accounts     map[string]time.Time `json:"accounts"`
+}
+
+// ExportState records how far an incremental export has progressed.
+type ExportState struct {
+	Item              string    `json:"item"`
+	Destination       string    `json:"destination"`
+	Cursor            string    `json:"cursor"`
+	LastTransactionID string    `json:"last_transaction_id,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func LoadData(dataDir string, environment string, tokenKeyFile string) (*Data, error) {
+	data := &Data{
+		DataDir:      dataDir,
+		Environment:  environment,
+		TokenKeyFile: tokenKeyFile,
+		BackAliases:  make(map[string]string),
+	}
+
+	err := os.MkdirAll(data.dir(), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = data.load()
 	if err != nil {
 		return nil, err
 	}
+	return data, nil
+}
 
+// LoadDataReadOnly loads someone else's data, such as a household member's,
+// without writing anything to dataDir: no directories or files are created,
+// and changes, such as accounts cached as they're fetched, are only kept in
+// memory. Access tokens can't be saved at all.
+func LoadDataReadOnly(dataDir string, environment string) (*Data, error) {
 	data := &Data{
 		DataDir:     dataDir,
+		Environment: environment,
 		BackAliases: make(map[string]string),
+		ReadOnly:    true,
+		external:    true,
+	}
+	err := data.load()
+	if err != nil {
+		return nil, err
 	}
+	return data, nil
+}
 
-	data.loadTokens()
-	data.loadAliases()
+func (d *Data) load() error {
+	err := d.loadTokens()
+	if err != nil {
+		return err
+	}
+	err = d.migrateTokenKey()
+	if err != nil {
+		return err
+	}
+	err = d.loadAliases()
+	if err != nil {
+		return err
+	}
+	d.loadAssetReports()
+	d.loadUserToken()
+	d.loadTransferEventCursor()
+	d.loadConsentExpirations()
+	d.loadExports()
+	d.loadIgnored()
+	d.loadSplits()
+	d.loadDaemonCursors()
+	d.loadAccountCache()
+	d.loadOwners()
+	d.loadSavingsHistory()
+	d.loadImported()
+	d.loadBalanceHistory()
+	d.loadPushJournal()
+	d.loadPushed()
+	d.loadAccountMappings()
+	d.loadWebhookKeys()
+	d.loadPendingLinks()
 
-	return data, nil
+	return nil
+}
+
+// dir is where the data for d's environment is stored.
+func (d *Data) dir() string {
+	return filepath.Join(d.DataDir, "data", d.Environment)
+}
+
+// MigrateLegacyData moves data files stored before environments were kept
+// separate into environment's directory, unless it already exists. Legacy
+// tokens belong to whichever environment was configured when they were
+// saved, so callers must only pass the configured environment, never one
+// chosen for a single command.
+func MigrateLegacyData(dataDir string, environment string) error {
+	environmentDir := filepath.Join(dataDir, "data", environment)
+	_, err := os.Stat(environmentDir)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	files, err := legacyDataFiles(dataDir)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	err = os.MkdirAll(environmentDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	legacyDir := filepath.Join(dataDir, "data")
+	for _, name := range files {
+		err = os.Rename(filepath.Join(legacyDir, name), filepath.Join(environmentDir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Moved existing data to %s. Data for each Plaid environment is now kept separately.", environmentDir)
+
+	return nil
 }
 
-func (d *Data) loadAliases() {
+// HasLegacyData reports whether data files stored before environments were
+// kept separate are still waiting to be migrated.
+func HasLegacyData(dataDir string) (bool, error) {
+	files, err := legacyDataFiles(dataDir)
+	return len(files) > 0, err
+}
+
+func legacyDataFiles(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dataDir, "data"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && filepath.Ext(entry.Name()) == ".json" {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
+
+// loadAliases loads aliases. A missing file means there are none, but one
+// that can't be parsed is an error: carrying on without aliases would make
+// every command that names an institution fail.
+func (d *Data) loadAliases() error {
 	aliases := make(map[string]string)
 	filePath := d.aliasesPath()
-	err := load(filePath, &aliases)
+	err := d.readFile(filePath, &aliases)
 	if err != nil {
-		log.Printf("Error loading aliases from %s. Assuming empty tokens.", d.aliasesPath())
+		return corruptFileError(filePath, err)
 	}
 
 	d.Aliases = aliases
@@ -46,30 +343,376 @@ func (d *Data) loadAliases() {
 	for alias, itemID := range aliases {
 		d.BackAliases[itemID] = alias
 	}
+	return nil
+}
+
+// corruptFileError describes a data file that exists but can't be read,
+// pointing to the backup taken when it was last saved if there is one.
+func corruptFileError(filePath string, err error) error {
+	backupPath := filePath + ".bak"
+	if _, statErr := os.Stat(backupPath); statErr == nil {
+		return fmt.Errorf("%s is corrupted: %w. The previous version is in %s; check it and copy it over %s to restore it", filePath, err, backupPath, filePath)
+	}
+	return fmt.Errorf("%s is corrupted: %w. Fix or restore it from your own backups, or move it aside to start again", filePath, err)
 }
 
 func (d *Data) tokensPath() string {
-	return filepath.Join(d.DataDir, "data", "tokens.json")
+	return filepath.Join(d.dir(), "tokens.json")
+}
+
+func (d *Data) dpapiTokensPath() string {
+	return filepath.Join(d.dir(), "tokens.dpapi")
 }
 
 func (d *Data) aliasesPath() string {
-	return filepath.Join(d.DataDir, "data", "aliases.json")
+	return filepath.Join(d.dir(), "aliases.json")
+}
+
+func (d *Data) assetReportsPath() string {
+	return filepath.Join(d.dir(), "asset_reports.json")
+}
+
+func (d *Data) loadAssetReports() {
+	reports := make(map[string]string)
+	filePath := d.assetReportsPath()
+	err := d.readFile(filePath, &reports)
+	if err != nil {
+		log.Printf("Error loading asset reports from %s. Assuming no asset reports.", d.assetReportsPath())
+	}
+
+	d.AssetReports = reports
+}
+
+func (d *Data) userTokenPath() string {
+	return filepath.Join(d.dir(), "user_token.json")
+}
+
+func (d *Data) loadUserToken() {
+	filePath := d.userTokenPath()
+	err := d.readFile(filePath, &d.UserToken)
+	if err != nil {
+		log.Printf("Error loading user token from %s. Assuming no user token.", d.userTokenPath())
+	}
+}
+
+func (d *Data) transferEventCursorPath() string {
+	return filepath.Join(d.dir(), "transfer_event_cursor.json")
+}
+
+func (d *Data) loadTransferEventCursor() {
+	filePath := d.transferEventCursorPath()
+	err := d.readFile(filePath, &d.TransferEventCursor)
+	if err != nil {
+		log.Printf("Error loading transfer event cursor from %s. Syncing from the first event.", d.transferEventCursorPath())
+	}
+}
+
+func (d *Data) consentExpirationsPath() string {
+	return filepath.Join(d.dir(), "consent_expirations.json")
+}
+
+func (d *Data) loadConsentExpirations() {
+	expirations := make(map[string]time.Time)
+	filePath := d.consentExpirationsPath()
+	err := d.readFile(filePath, &expirations)
+	if err != nil {
+		log.Printf("Error loading consent expirations from %s. Assuming no consent expirations.", d.consentExpirationsPath())
+	}
+
+	d.ConsentExpirations = expirations
+}
+
+func (d *Data) exportsPath() string {
+	return filepath.Join(d.dir(), "exports.json")
+}
+
+func (d *Data) loadExports() {
+	exports := make(map[string]ExportState)
+	filePath := d.exportsPath()
+	err := d.readFile(filePath, &exports)
+	if err != nil {
+		log.Printf("Error loading export state from %s. Assuming no previous exports.", d.exportsPath())
+	}
+
+	d.Exports = exports
+}
+
+func (d *Data) ignoredPath() string {
+	return filepath.Join(d.dir(), "ignored.json")
+}
+
+func (d *Data) loadIgnored() {
+	var ignored Ignored
+	filePath := d.ignoredPath()
+	err := d.readFile(filePath, &ignored)
+	if err != nil {
+		log.Printf("Error loading ignored transactions and accounts from %s. Assuming nothing is ignored.", d.ignoredPath())
+	}
+
+	if ignored.Transactions == nil {
+		ignored.Transactions = make(map[string]time.Time)
+	}
+	if ignored.Accounts == nil {
+		ignored.Accounts = make(map[string]time.Time)
+	}
+
+	d.Ignored = ignored
+}
+
+func (d *Data) splitsPath() string {
+	return filepath.Join(d.dir(), "splits.json")
+}
+
+func (d *Data) daemonCursorsPath() string {
+	return filepath.Join(d.dir(), "daemon_cursors.json")
+}
+
+func (d *Data) loadDaemonCursors() {
+	cursors := make(map[string]string)
+	filePath := d.daemonCursorsPath()
+	err := d.readFile(filePath, &cursors)
+	if err != nil {
+		log.Printf("Error loading daemon cursors from %s. Assuming no previous checks.", d.daemonCursorsPath())
+	}
+
+	d.DaemonCursors = cursors
+}
+
+func (d *Data) accountCachePath() string {
+	return filepath.Join(d.dir(), "accounts.json")
+}
+
+func (d *Data) loadAccountCache() {
+	cache := make(map[string]CachedAccounts)
+	filePath := d.accountCachePath()
+	err := d.readFile(filePath, &cache)
+	if err != nil {
+		log.Printf("Error loading cached accounts from %s. Assuming no cached accounts.", d.accountCachePath())
+	}
+
+	d.AccountCache = cache
+}
+
+func (d *Data) ownersPath() string {
+	return filepath.Join(d.dir(), "owners.json")
+}
+
+func (d *Data) loadOwners() {
+	owners := make(map[string]string)
+	filePath := d.ownersPath()
+	err := d.readFile(filePath, &owners)
+	if err != nil {
+		log.Printf("Error loading item owners from %s. Assuming no owners.", d.ownersPath())
+	}
+
+	d.Owners = owners
+}
+
+func (d *Data) savingsHistoryPath() string {
+	return filepath.Join(d.dir(), "savings_history.json")
+}
+
+func (d *Data) loadSavingsHistory() {
+	history := make(map[string]SavingsMonth)
+	filePath := d.savingsHistoryPath()
+	err := d.readFile(filePath, &history)
+	if err != nil {
+		log.Printf("Error loading savings history from %s. Assuming no history.", d.savingsHistoryPath())
+	}
+
+	d.SavingsHistory = history
+}
+
+func (d *Data) importedPath() string {
+	return filepath.Join(d.dir(), "imported_transactions.json")
+}
+
+func (d *Data) loadImported() {
+	imported := make(map[string][]Transaction)
+	filePath := d.importedPath()
+	err := d.readFile(filePath, &imported)
+	if err != nil {
+		log.Printf("Error loading imported transactions from %s. Assuming none.", d.importedPath())
+	}
+
+	d.Imported = imported
+}
+
+func (d *Data) balanceHistoryPath() string {
+	return filepath.Join(d.dir(), "balance_history.json")
+}
+
+func (d *Data) loadBalanceHistory() {
+	history := make(map[string]AccountHistory)
+	filePath := d.balanceHistoryPath()
+	err := d.readFile(filePath, &history)
+	if err != nil {
+		log.Printf("Error loading balance history from %s. Assuming no history.", d.balanceHistoryPath())
+	}
+
+	d.BalanceHistory = history
+}
+
+func (d *Data) pushJournalPath() string {
+	return filepath.Join(d.dir(), "push_journal.json")
 }
 
-func (d *Data) loadTokens() {
-	tokens := make(map[string]string)
-	filePath := d.tokensPath()
-	err := load(filePath, &tokens)
+func (d *Data) loadPushJournal() {
+	journal := make(map[string][]PushFailure)
+	filePath := d.pushJournalPath()
+	err := d.readFile(filePath, &journal)
 	if err != nil {
-		log.Printf("Error loading tokens from %s. Assuming empty tokens.", d.tokensPath())
+		log.Printf("Error loading the push journal from %s. Assuming no failed pushes.", d.pushJournalPath())
 	}
 
-	d.Tokens = tokens
+	d.PushJournal = journal
 }
 
-func load(filePath string, v interface{}) (err error) {
+func (d *Data) pushedPath() string {
+	return filepath.Join(d.dir(), "pushed.json")
+}
+
+func (d *Data) loadPushed() {
+	pushed := make(map[string]map[string]PushedTransaction)
+	filePath := d.pushedPath()
+	err := d.readFile(filePath, &pushed)
+	if err != nil {
+		log.Printf("Error loading pushed transactions from %s. Assuming none were pushed.", d.pushedPath())
+	}
+
+	d.Pushed = pushed
+}
+
+func (d *Data) accountMappingsPath() string {
+	return filepath.Join(d.dir(), "account_mappings.json")
+}
+
+func (d *Data) loadAccountMappings() {
+	mappings := make(map[string]map[string]string)
+	filePath := d.accountMappingsPath()
+	err := d.readFile(filePath, &mappings)
+	if err != nil {
+		log.Printf("Error loading account mappings from %s. Assuming none were made.", d.accountMappingsPath())
+	}
+
+	d.AccountMappings = mappings
+}
+
+func (d *Data) webhookKeysPath() string {
+	return filepath.Join(d.dir(), "webhook_keys.json")
+}
+
+func (d *Data) loadWebhookKeys() {
+	keys := make(map[string]WebhookKey)
+	filePath := d.webhookKeysPath()
+	err := d.readFile(filePath, &keys)
+	if err != nil {
+		log.Printf("Error loading webhook verification keys from %s. Assuming none were fetched.", d.webhookKeysPath())
+	}
+
+	d.WebhookKeys = keys
+}
+
+func (d *Data) pendingLinksPath() string {
+	return filepath.Join(d.dir(), "pending_links.json")
+}
+
+func (d *Data) loadPendingLinks() {
+	links := make(map[string]PendingLink)
+	filePath := d.pendingLinksPath()
+	err := d.readFile(filePath, &links)
+	if err != nil {
+		log.Printf("Error loading pending Link sessions from %s. Assuming there are none.", d.pendingLinksPath())
+	}
+
+	d.PendingLinks = links
+}
+
+func (d *Data) loadSplits() {
+	splits := make(map[string][]SplitPart)
+	filePath := d.splitsPath()
+	err := d.readFile(filePath, &splits)
+	if err != nil {
+		log.Printf("Error loading split transactions from %s. Assuming no splits.", d.splitsPath())
+	}
+
+	d.Splits = splits
+}
+
+// loadTokens loads access tokens, checking them against the manifest. If
+// they fail the check, the backup taken when they were last saved is used
+// instead.
+func (d *Data) loadTokens() error {
+	d.Tokens = make(map[string]string)
+
+	path := d.tokensPath()
+	if _, err := os.Stat(d.dpapiTokensPath()); err == nil {
+		path = d.dpapiTokensPath()
+	}
+	d.tokensEncryption = tokenFileEncryption(path)
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	manifest, err := d.loadTokenManifest()
+	if err != nil {
+		return err
+	}
+
+	tokens, err := d.readTokenFile(path, manifest.Tokens)
+	if err == nil {
+		d.Tokens = tokens
+		return nil
+	}
+
+	if manifest.Backup == nil {
+		return fmt.Errorf("%s can't be read: %w. There is no backup to fall back to; restore it from your own backups, or move it aside and link your institutions again", path, err)
+	}
+	backupPath := filepath.Join(d.dir(), manifest.Backup.File)
+	backup, backupErr := d.readTokenFile(backupPath, manifest.Backup.HMAC)
+	if backupErr != nil {
+		return fmt.Errorf("%s can't be read: %v. The backup %s can't be read either: %v. Restore them from your own backups, or move them aside and link your institutions again", path, err, backupPath, backupErr)
+	}
+
+	log.Printf("⚠️  %s can't be read: %v. Using the backup %s from the previous save, so the most recent change to your tokens may be missing.", path, err, backupPath)
+	d.Tokens = backup
+	d.tokensEncryption = tokenFileEncryption(backupPath)
+	return nil
+}
+
+// SetTokenEncryption sets how access tokens are encrypted at rest, saving
+// them again if they are currently stored differently.
+func (d *Data) SetTokenEncryption(encryption string) error {
+	switch encryption {
+	case "", "none":
+		encryption = "none"
+	case "dpapi":
+	default:
+		return fmt.Errorf("unknown token encryption %q. Use none or dpapi", encryption)
+	}
+
+	d.TokenEncryption = encryption
+	if d.tokensEncryption == encryption || d.ReadOnly {
+		return nil
+	}
+	return d.SaveTokens()
+}
+
+func (d *Data) readFile(filePath string, v interface{}) (err error) {
+	if d.external {
+		b, err := os.ReadFile(filePath)
+		if errors.Is(err, os.ErrNotExist) || err == nil && len(b) == 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(b, v)
+	}
+
 	var f *os.File
-	f, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0755)
+	f, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
 		return err
 	}
@@ -84,6 +727,11 @@ func load(filePath string, v interface{}) (err error) {
 		return err
 	}
 
+	// A freshly created file has nothing in it yet.
+	if len(b) == 0 {
+		return nil
+	}
+
 	err = json.Unmarshal(b, v)
 	return err
 }
@@ -102,31 +750,269 @@ func (d *Data) Save() error {
 	return nil
 }
 
+// ForgetItem removes an item's access token and everything stored about it.
+// Its transactions are still kept wherever they were exported to.
+func (d *Data) ForgetItem(itemID string) error {
+	delete(d.Tokens, itemID)
+	if alias, ok := d.BackAliases[itemID]; ok {
+		delete(d.Aliases, alias)
+		delete(d.BackAliases, itemID)
+	}
+	delete(d.ConsentExpirations, itemID)
+	for key, state := range d.Exports {
+		if state.Item == itemID {
+			delete(d.Exports, key)
+		}
+	}
+	delete(d.DaemonCursors, itemID)
+	delete(d.AccountCache, itemID)
+	delete(d.Owners, itemID)
+	delete(d.PendingLinks, itemID)
+	for id, history := range d.BalanceHistory {
+		if history.Item == itemID {
+			delete(d.BalanceHistory, id)
+		}
+	}
+
+	for _, save := range []func() error{
+		d.Save,
+		d.SaveConsentExpirations,
+		d.SaveExports,
+		d.SaveDaemonCursors,
+		d.SaveAccountCache,
+		d.SaveOwners,
+		d.SaveBalanceHistory,
+		d.SavePendingLinks,
+	} {
+		err := save()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrReadOnly is returned when saving access tokens in read-only mode.
+var ErrReadOnly = errors.New("plaid-cli is in read-only mode, so access tokens can't be changed")
+
+// SaveTokens saves access tokens, first backing up the tokens currently on
+// disk if they're intact, and records their HMAC in the manifest.
 func (d *Data) SaveTokens() error {
-	return save(d.Tokens, d.tokensPath())
+	if d.ReadOnly {
+		return ErrReadOnly
+	}
+
+	b, err := json.Marshal(d.Tokens)
+	if err != nil {
+		return err
+	}
+
+	path, stalePath := d.tokensPath(), d.dpapiTokensPath()
+	if d.TokenEncryption == "dpapi" {
+		b, err = dpapiProtect(b)
+		if err != nil {
+			return err
+		}
+		path, stalePath = d.dpapiTokensPath(), d.tokensPath()
+	}
+
+	err = d.migrateTokenKey()
+	if err != nil {
+		return err
+	}
+	key, err := d.tokenKey(true)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := d.loadTokenManifest()
+	if err != nil {
+		// A damaged manifest is replaced below, but its backup can't be
+		// trusted.
+		manifest = tokenManifest{}
+	}
+
+	currentPath := d.tokensPath()
+	if d.tokensEncryption == "dpapi" {
+		currentPath = d.dpapiTokensPath()
+	}
+	if current, err := os.ReadFile(currentPath); err == nil && len(current) > 0 {
+		if _, err := d.readTokenFile(currentPath, manifest.Tokens); err == nil {
+			backupPath := currentPath + ".bak"
+			err = writeTokenFile(backupPath, current)
+			if err != nil {
+				return err
+			}
+			manifest.Backup = &tokenFileEntry{File: filepath.Base(backupPath), HMAC: tokenHMAC(key, current)}
+		}
+	}
+
+	err = writeTokenFile(path, b)
+	if err != nil {
+		return err
+	}
+	d.tokensEncryption = tokenFileEncryption(path)
+
+	manifest.Tokens = tokenHMAC(key, b)
+	err = d.save(manifest, d.tokenManifestPath())
+	if err != nil {
+		return err
+	}
+
+	return removeIfExists(stalePath)
+}
+
+func removeIfExists(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
 }
 
 func (d *Data) SaveAliases() error {
-	return save(d.Aliases, d.aliasesPath())
+	if d.external {
+		return nil
+	}
+	err := backup(d.aliasesPath())
+	if err != nil {
+		return err
+	}
+	return d.save(d.Aliases, d.aliasesPath())
+}
+
+// backup copies filePath to filePath.bak if it exists and holds valid JSON,
+// so a save that goes wrong can be undone.
+func backup(filePath string) error {
+	b, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 || !json.Valid(b) {
+		return nil
+	}
+	return os.WriteFile(filePath+".bak", b, 0600)
+}
+
+func (d *Data) SaveAssetReports() error {
+	return d.save(d.AssetReports, d.assetReportsPath())
+}
+
+func (d *Data) SaveUserToken() error {
+	return d.save(d.UserToken, d.userTokenPath())
+}
+
+func (d *Data) SaveTransferEventCursor() error {
+	return d.save(d.TransferEventCursor, d.transferEventCursorPath())
+}
+
+func (d *Data) SaveConsentExpirations() error {
+	return d.save(d.ConsentExpirations, d.consentExpirationsPath())
+}
+
+func (d *Data) SaveExports() error {
+	return d.save(d.Exports, d.exportsPath())
+}
+
+func (d *Data) SaveIgnored() error {
+	return d.save(d.Ignored, d.ignoredPath())
+}
+
+func (d *Data) SaveSplits() error {
+	return d.save(d.Splits, d.splitsPath())
 }
 
-func save(v interface{}, filePath string) (err error) {
+func (d *Data) SaveDaemonCursors() error {
+	return d.save(d.DaemonCursors, d.daemonCursorsPath())
+}
+
+func (d *Data) SaveAccountCache() error {
+	return d.save(d.AccountCache, d.accountCachePath())
+}
+
+func (d *Data) SaveOwners() error {
+	return d.save(d.Owners, d.ownersPath())
+}
+
+func (d *Data) SaveSavingsHistory() error {
+	return d.save(d.SavingsHistory, d.savingsHistoryPath())
+}
+
+func (d *Data) SaveImported() error {
+	return d.save(d.Imported, d.importedPath())
+}
+
+func (d *Data) SaveBalanceHistory() error {
+	return d.save(d.BalanceHistory, d.balanceHistoryPath())
+}
+
+func (d *Data) SavePushJournal() error {
+	return d.save(d.PushJournal, d.pushJournalPath())
+}
+
+func (d *Data) SavePushed() error {
+	return d.save(d.Pushed, d.pushedPath())
+}
+
+func (d *Data) SaveAccountMappings() error {
+	return d.save(d.AccountMappings, d.accountMappingsPath())
+}
+
+func (d *Data) SaveWebhookKeys() error {
+	return d.save(d.WebhookKeys, d.webhookKeysPath())
+}
+
+func (d *Data) SavePendingLinks() error {
+	return d.save(d.PendingLinks, d.pendingLinksPath())
+}
+
+func (d *Data) save(v interface{}, filePath string) error {
+	if d.external {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filePath, b)
+}
+
+// writeFileAtomic replaces filePath with b. It writes a temporary file in the
+// same directory, syncs it and renames it over filePath, so a crash leaves
+// either the old contents or the new, never a truncated file. Files written
+// by older versions were readable by everyone; data files hold access
+// tokens, so the new file is only readable by the user.
+func writeFileAtomic(filePath string, b []byte) (err error) {
 	var f *os.File
-	f, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0755)
+	f, err = os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
 	if err != nil {
 		return err
 	}
 	defer func() {
-		closeErr := f.Close()
-		err = errors.Join(err, closeErr)
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
 	}()
 
-	var b []byte
-	b, err = json.Marshal(v)
+	err = f.Chmod(0600)
 	if err != nil {
 		return err
 	}
-
 	_, err = f.Write(b)
-	return err
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filePath)
 }
@@ -0,0 +1,219 @@
+package plaid_cli
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tokenManifest records an HMAC of the tokens file and of its backup, so
+// corruption or an edit is caught when they're loaded rather than silently
+// losing tokens. The key is kept at TokenKeyFile, outside the data directory,
+// so that being able to change the tokens isn't enough to sign them again.
+type tokenManifest struct {
+	Tokens string          `json:"tokens"`
+	Backup *tokenFileEntry `json:"backup,omitempty"`
+}
+
+// tokenFileEntry is a file holding tokens and its expected HMAC.
+type tokenFileEntry struct {
+	File string `json:"file"`
+	HMAC string `json:"hmac"`
+}
+
+func (d *Data) tokenManifestPath() string {
+	return filepath.Join(d.dir(), "tokens.manifest.json")
+}
+
+// tokenKeyPath is where the key tokens are signed with is kept. Data loaded
+// without a TokenKeyFile, such as another household member's, uses the key
+// older versions kept in the data directory.
+func (d *Data) tokenKeyPath() string {
+	if d.TokenKeyFile != "" {
+		return d.TokenKeyFile
+	}
+	return d.legacyTokenKeyPath()
+}
+
+// legacyTokenKeyPath is where versions of plaid-cli before TokenKeyFile kept
+// the key, alongside the tokens.
+func (d *Data) legacyTokenKeyPath() string {
+	return filepath.Join(d.dir(), "tokens.key")
+}
+
+// loadTokenManifest returns the manifest, or an empty one if tokens were
+// last saved by a version of plaid-cli that didn't write one.
+func (d *Data) loadTokenManifest() (tokenManifest, error) {
+	var manifest tokenManifest
+	b, err := os.ReadFile(d.tokenManifestPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(b, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("%s is corrupted: %w", d.tokenManifestPath(), err)
+	}
+	return manifest, nil
+}
+
+// tokenKey returns the key tokens are signed with, creating one if create is
+// set and there isn't one yet.
+func (d *Data) tokenKey(create bool) ([]byte, error) {
+	key, err := readTokenKey(d.tokenKeyPath())
+	if err == nil || !errors.Is(err, os.ErrNotExist) || !create {
+		return key, err
+	}
+
+	key = make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(d.tokenKeyPath()), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(d.tokenKeyPath(), []byte(hex.EncodeToString(key)), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// verificationKeyPath is the key the tokens on disk were signed with: the
+// one in the data directory until migrateTokenKey moves it out, otherwise
+// the one at tokenKeyPath.
+func (d *Data) verificationKeyPath() string {
+	if _, err := os.Stat(d.legacyTokenKeyPath()); err == nil {
+		return d.legacyTokenKeyPath()
+	}
+	return d.tokenKeyPath()
+}
+
+func readTokenKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimSpace(string(b)))
+}
+
+// migrateTokenKey signs the tokens and their backup again with the key at
+// TokenKeyFile, if they were signed with a key kept in the data directory by
+// an older version, and then deletes that key. Files that don't match their
+// old HMAC keep it, so they're still reported as damaged.
+func (d *Data) migrateTokenKey() error {
+	if d.external || d.TokenKeyFile == "" {
+		return nil
+	}
+	legacyKey, err := readTokenKey(d.legacyTokenKeyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s to move it to %s: %w", d.legacyTokenKeyPath(), d.TokenKeyFile, err)
+	}
+
+	manifest, err := d.loadTokenManifest()
+	if err != nil {
+		return err
+	}
+	key, err := d.tokenKey(true)
+	if err != nil {
+		return err
+	}
+
+	resign := func(path string, oldHMAC string) string {
+		b, err := os.ReadFile(path)
+		if err != nil || !hmac.Equal([]byte(tokenHMAC(legacyKey, b)), []byte(oldHMAC)) {
+			return oldHMAC
+		}
+		return tokenHMAC(key, b)
+	}
+	if manifest.Tokens != "" {
+		path := d.tokensPath()
+		if d.tokensEncryption == "dpapi" {
+			path = d.dpapiTokensPath()
+		}
+		manifest.Tokens = resign(path, manifest.Tokens)
+	}
+	if manifest.Backup != nil {
+		manifest.Backup.HMAC = resign(filepath.Join(d.dir(), manifest.Backup.File), manifest.Backup.HMAC)
+	}
+
+	err = d.save(manifest, d.tokenManifestPath())
+	if err != nil {
+		return err
+	}
+	return os.Remove(d.legacyTokenKeyPath())
+}
+
+func tokenHMAC(key []byte, b []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readTokenFile reads and decodes the tokens in path, checking them against
+// expectedHMAC unless it's empty.
+func (d *Data) readTokenFile(path string, expectedHMAC string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedHMAC != "" {
+		key, err := readTokenKey(d.verificationKeyPath())
+		switch {
+		case errors.Is(err, os.ErrNotExist) && d.external:
+			// Another user's key isn't kept with their data, so their
+			// tokens can only be checked by decoding them.
+		case err != nil:
+			return nil, fmt.Errorf("reading %s to verify it: %w", d.verificationKeyPath(), err)
+		case !hmac.Equal([]byte(tokenHMAC(key, b)), []byte(expectedHMAC)):
+			return nil, errors.New("its contents don't match the HMAC plaid-cli recorded when it saved them, so it was damaged or edited since")
+		}
+	}
+
+	tokens := make(map[string]string)
+	// Files written by older versions could be empty.
+	if len(b) == 0 && expectedHMAC == "" {
+		return tokens, nil
+	}
+
+	if tokenFileEncryption(path) == "dpapi" {
+		b, err = dpapiUnprotect(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = json.Unmarshal(b, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// tokenFileEncryption is how the tokens in path, or its backup, are
+// encrypted.
+func tokenFileEncryption(path string) string {
+	if strings.HasPrefix(filepath.Base(path), "tokens.dpapi") {
+		return "dpapi"
+	}
+	return "none"
+}
+
+// writeTokenFile replaces path with b without ever leaving it half written.
+func writeTokenFile(path string, b []byte) error {
+	return writeFileAtomic(path, b)
+}
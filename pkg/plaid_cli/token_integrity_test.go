@@ -0,0 +1,184 @@
+package plaid_cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// saveTestTokens saves each of saves in turn as the tokens in dataDir,
+// signed with the key at keyFile.
+func saveTestTokens(t *testing.T, dataDir string, keyFile string, saves ...map[string]string) {
+	t.Helper()
+	for _, tokens := range saves {
+		data, err := LoadData(dataDir, "sandbox", keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data.Tokens = tokens
+		err = data.SaveTokens()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadTokens(t *testing.T) {
+	previous := map[string]string{"item-1": "access-sandbox-1"}
+	latest := map[string]string{"item-1": "access-sandbox-1", "item-2": "access-sandbox-2"}
+
+	truncate := func(t *testing.T, dir string) {
+		t.Helper()
+		path := filepath.Join(dir, "tokens.json")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, b[:len(b)/2], 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit := func(t *testing.T, dir string) {
+		t.Helper()
+		b, err := json.Marshal(map[string]string{"item-1": "access-sandbox-edited"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "tokens.json"), b, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	mismatchHMAC := func(t *testing.T, dir string) {
+		t.Helper()
+		path := filepath.Join(dir, "tokens.manifest.json")
+		var manifest tokenManifest
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal(b, &manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest.Tokens = tokenHMAC([]byte("another key"), []byte("other tokens"))
+		b, err = json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, b, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		saves   []map[string]string
+		damage  func(t *testing.T, dir string)
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "intact",
+			saves: []map[string]string{previous, latest},
+			want:  latest,
+		},
+		{
+			name:   "truncated, backup is used",
+			saves:  []map[string]string{previous, latest},
+			damage: truncate,
+			want:   previous,
+		},
+		{
+			name:   "edited, backup is used",
+			saves:  []map[string]string{previous, latest},
+			damage: edit,
+			want:   previous,
+		},
+		{
+			name:   "HMAC mismatch, backup is used",
+			saves:  []map[string]string{previous, latest},
+			damage: mismatchHMAC,
+			want:   previous,
+		},
+		{
+			name:    "truncated without a backup",
+			saves:   []map[string]string{latest},
+			damage:  truncate,
+			wantErr: true,
+		},
+		{
+			name:    "HMAC mismatch without a backup",
+			saves:   []map[string]string{latest},
+			damage:  mismatchHMAC,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			keyFile := filepath.Join(t.TempDir(), "tokens.key")
+			saveTestTokens(t, dataDir, keyFile, test.saves...)
+			if test.damage != nil {
+				test.damage(t, filepath.Join(dataDir, "data", "sandbox"))
+			}
+
+			data, err := LoadData(dataDir, "sandbox", keyFile)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("loaded %v, want an error", data.Tokens)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data.Tokens, test.want) {
+				t.Errorf("got tokens %v, want %v", data.Tokens, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadTokensMovesLegacyKey(t *testing.T) {
+	dataDir := t.TempDir()
+	previous := map[string]string{"item-1": "access-sandbox-1"}
+	latest := map[string]string{"item-1": "access-sandbox-1", "item-2": "access-sandbox-2"}
+	// Versions before cli.token_key_file kept the key in the data directory.
+	saveTestTokens(t, dataDir, "", previous, latest)
+	legacyKey := filepath.Join(dataDir, "data", "sandbox", "tokens.key")
+	if _, err := os.Stat(legacyKey); err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "tokens.key")
+	data, err := LoadData(dataDir, "sandbox", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data.Tokens, latest) {
+		t.Errorf("got tokens %v, want %v", data.Tokens, latest)
+	}
+	if _, err := os.Stat(legacyKey); !os.IsNotExist(err) {
+		t.Errorf("the key in the data directory wasn't removed: %v", err)
+	}
+
+	// The backup was signed again too, so it's still used if the tokens
+	// are damaged.
+	err = os.WriteFile(filepath.Join(dataDir, "data", "sandbox", "tokens.json"), []byte("{"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = LoadData(dataDir, "sandbox", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data.Tokens, previous) {
+		t.Errorf("got tokens %v, want the backup %v", data.Tokens, previous)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// confirmsAnnotation marks mutating commands that ask for confirmation
+// themselves, describing what they'll do, so they aren't asked about twice.
+const confirmsAnnotation = "confirms"
+
+// ProductionGuard asks for confirmation before commands change state at Plaid
+// in production, where they affect real accounts and money. Sandbox runs
+// aren't affected. The user is asked once per run, however many institutions
+// the command changes.
+type ProductionGuard struct {
+	// Yes is set by --yes, and skips confirmation.
+	Yes bool
+	// Environment is the Plaid environment in use.
+	Environment string
+
+	confirmed bool
+}
+
+// AddYesFlag registers --yes on cmd and its subcommands.
+func AddYesFlag(cmd *cobra.Command, guard *ProductionGuard) {
+	cmd.PersistentFlags().BoolVarP(&guard.Yes, "yes", "y", false, "Don't ask for confirmation before changing state at Plaid, in production or for transfers and payments")
+}
+
+// Require asks the user to confirm what, e.g. a command's path, before it
+// changes state at Plaid in production. It returns false if the user
+// declines. When stdin isn't a terminal, --yes is required.
+func (g *ProductionGuard) Require(what string) (bool, error) {
+	if g.Environment != "production" || g.Yes || g.confirmed {
+		return true, nil
+	}
+	if !isInteractive() {
+		return false, fmt.Errorf("'%s' changes state at Plaid in production. Run it at a terminal to confirm, or use --yes", what)
+	}
+	return g.Confirm(T("Run '%s' against production", what))
+}
+
+// Confirm asks the user to confirm an action in any environment, unless
+// --yes was given. Once confirmed, Require doesn't ask again.
+func (g *ProductionGuard) Confirm(label string) (bool, error) {
+	if g.Yes {
+		return true, nil
+	}
+	confirmed, err := Confirm(label)
+	if err != nil {
+		return false, err
+	}
+	g.confirmed = confirmed
+	return confirmed, nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// pushBatchSize is how many transactions are sent to a push target at once.
+const pushBatchSize = 100
+
+// PushRecord is a transaction to push, with the account it goes to in the
+// budgeting tool.
+type PushRecord struct {
+	Transaction plaid_cli.Transaction
+	Account     string
+}
+
+// PushTarget sends transactions to a budgeting tool.
+type PushTarget interface {
+	Name() string
+	// Accounts lists the accounts transactions can be pushed to.
+	Accounts() ([]PushAccount, error)
+	// Push sends records, returning an error for each one: nil if it was
+	// pushed, or was already there.
+	Push(records []PushRecord) []error
+}
+
+// PushAccount is an account in a budgeting tool.
+type PushAccount struct {
+	ID   string
+	Name string
+}
+
+// PushTargets are the budgeting tools transactions can be pushed to.
+var PushTargets = []string{"ynab", "firefly", "lunchmoney"}
+
+// PushTargetFromViper returns the target named name, configured under
+// [push.<name>] in the config file.
+func PushTargetFromViper(name string) (PushTarget, error) {
+	key := "push." + name
+	var target PushTarget
+	switch name {
+	case "ynab":
+		budgetID := viper.GetString(key + ".budget_id")
+		if budgetID == "" {
+			return nil, ConfigError{msg: "⚠️  push.ynab.budget_id is not set. Configure [push.ynab] in plaid-cli's config file with the ID of the budget to push to."}
+		}
+		url := viper.GetString(key + ".url")
+		if url == "" {
+			url = ynabURL
+		}
+		target = &YNABTarget{URL: url, Token: viper.GetString(key + ".token"), BudgetID: budgetID}
+	case "firefly":
+		url := viper.GetString(key + ".url")
+		if url == "" {
+			return nil, ConfigError{msg: "⚠️  push.firefly.url is not set. Configure [push.firefly] in plaid-cli's config file with your Firefly III URL."}
+		}
+		target = &FireflyTarget{URL: url, Token: viper.GetString(key + ".token")}
+	case "lunchmoney":
+		url := viper.GetString(key + ".url")
+		if url == "" {
+			url = lunchMoneyURL
+		}
+		target = &LunchMoneyTarget{URL: url, Token: viper.GetString(key + ".token")}
+	default:
+		return nil, fmt.Errorf("unknown push target %q. Use one of: ynab, firefly, lunchmoney", name)
+	}
+
+	if viper.GetString(key+".token") == "" {
+		return nil, ConfigError{msg: fmt.Sprintf("⚠️  %s.token is not set. Configure [%s] in plaid-cli's config file with an API token.", key, key)}
+	}
+	return target, nil
+}
+
+// PushAccountMapping returns the destination account for each Plaid account
+// pushed to target, keyed by lowercased account ID. Mappings chosen with
+// `map-accounts`, including choosing not to push an account, take precedence
+// over ones in [push.<target>.accounts] in the config file.
+func PushAccountMapping(data *plaid_cli.Data, target string) (map[string]string, error) {
+	accounts := accountMapping(data, target)
+	if len(accounts) == 0 {
+		return nil, ConfigError{msg: fmt.Sprintf("⚠️  No accounts are mapped for %s. Run `plaid-cli export map-accounts %s` to choose where each account's transactions go.", target, target)}
+	}
+	return accounts, nil
+}
+
+func accountMapping(data *plaid_cli.Data, target string) map[string]string {
+	// Viper lowercases keys, so account IDs are lowercased throughout.
+	accounts := viper.GetStringMapString("push." + target + ".accounts")
+	for accountID, account := range data.AccountMappings[target] {
+		if account == "" {
+			delete(accounts, strings.ToLower(accountID))
+			continue
+		}
+		accounts[strings.ToLower(accountID)] = account
+	}
+	return accounts
+}
+
+// PushRecords returns the posted transactions in txs that belong to a mapped
+// account. Pending transactions are left until they post, since their
+// amounts and descriptions can still change.
+func PushRecords(txs []plaid_cli.Transaction, accounts map[string]string) []PushRecord {
+	var records []PushRecord
+	unmapped := 0
+	for _, tx := range SortTransactions(txs) {
+		if tx.Pending {
+			continue
+		}
+		account, ok := accounts[strings.ToLower(tx.AccountID)]
+		if !ok {
+			unmapped++
+			continue
+		}
+		records = append(records, PushRecord{Transaction: tx, Account: account})
+	}
+	if unmapped > 0 {
+		log.Printf("Skipped %d transactions in accounts that aren't mapped.", unmapped)
+	}
+	return records
+}
+
+// externalIDVersion is part of every external ID, so the way IDs are derived
+// can change without new IDs matching old ones.
+const externalIDVersion = "plaid1"
+
+// externalID is the idempotency key a transaction is pushed with, which
+// targets use to recognize a transaction they already have (YNAB's
+// import_id, Firefly III's and Lunch Money's external_id). It's derived from
+// the Plaid transaction ID alone, so it's the same however often, and from
+// whichever machine, the transaction is pushed, and short enough for YNAB's
+// 36-character import IDs.
+//
+// When a pending transaction posts, Plaid gives the posted transaction a new
+// ID, and points back to the pending one with pending_transaction_id.
+// Pending transactions are never pushed, so the posted one is the only one
+// pushed and there's nothing for its ID to collide with. The pending ID isn't
+// used, because Plaid can post one pending transaction as several, which
+// would then share an ID.
+func externalID(tx plaid_cli.Transaction) string {
+	sum := sha256.Sum256([]byte(tx.TransactionID))
+	return externalIDVersion + ":" + hex.EncodeToString(sum[:])[:29]
+}
+
+// PushResult counts what a push did.
+type PushResult struct {
+	Pushed int
+	// AlreadyPushed were skipped because they'd been pushed before.
+	AlreadyPushed int
+	Failed        int
+}
+
+// Push sends records to target in batches, skipping ones pushed before, so
+// pushing again is always safe. Pushed transactions are remembered in
+// data.Pushed as each batch succeeds. If plaid-cli is interrupted before
+// they're remembered, the target recognizes them by their external ID when
+// they're pushed again.
+//
+// Records that fail are recorded in the push journal, so
+// `push --retry-failed` can send them again, and ones that succeed are
+// cleared from it. The journal is saved after every batch, so failures are
+// remembered even if plaid-cli is interrupted.
+func Push(data *plaid_cli.Data, target PushTarget, records []PushRecord, now time.Time) (PushResult, error) {
+	var result PushResult
+	if data.Pushed[target.Name()] == nil {
+		data.Pushed[target.Name()] = make(map[string]plaid_cli.PushedTransaction)
+	}
+	pushed := data.Pushed[target.Name()]
+
+	var pending []PushRecord
+	for _, record := range records {
+		id := externalID(record.Transaction)
+		previous, ok := pushed[id]
+		switch {
+		case !ok:
+			pending = append(pending, record)
+		case previous.TransactionID == record.Transaction.TransactionID:
+			result.AlreadyPushed++
+			clearPushFailure(data, target.Name(), record.Transaction.TransactionID)
+		default:
+			// Two transaction IDs with the same external ID would need a
+			// hash collision, but if it happens the second must not be
+			// mistaken for the first.
+			result.Failed++
+			recordPushFailure(data, target.Name(), record, fmt.Errorf("external ID %s was already used for transaction %s", id, previous.TransactionID), now)
+		}
+	}
+
+	for start := 0; start < len(pending); start += pushBatchSize {
+		batch := pending[start:min(start+pushBatchSize, len(pending))]
+		errs := target.Push(batch)
+
+		for i, record := range batch {
+			if errs[i] == nil {
+				result.Pushed++
+				pushed[externalID(record.Transaction)] = plaid_cli.PushedTransaction{TransactionID: record.Transaction.TransactionID, PushedAt: now}
+				clearPushFailure(data, target.Name(), record.Transaction.TransactionID)
+				continue
+			}
+			result.Failed++
+			recordPushFailure(data, target.Name(), record, errs[i], now)
+		}
+
+		err := data.SavePushed()
+		if err != nil {
+			return result, err
+		}
+		err = data.SavePushJournal()
+		if err != nil {
+			return result, err
+		}
+	}
+	if len(pending) == 0 {
+		err := data.SavePushJournal()
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if result.Failed > 0 {
+		return result, PartialError{Err: fmt.Errorf("%d of %d transactions failed to push to %s and were recorded in the push journal. Run `plaid-cli export push %s --retry-failed` to retry them", result.Failed, len(records), target.Name(), target.Name())}
+	}
+	return result, nil
+}
+
+// FailedPushes returns the records that failed to push to target, oldest
+// first.
+func FailedPushes(data *plaid_cli.Data, target string) []PushRecord {
+	failures := append([]plaid_cli.PushFailure{}, data.PushJournal[target]...)
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].Transaction.Date < failures[j].Transaction.Date
+	})
+
+	var records []PushRecord
+	for _, failure := range failures {
+		records = append(records, PushRecord{Transaction: failure.Transaction, Account: failure.Account})
+	}
+	return records
+}
+
+func recordPushFailure(data *plaid_cli.Data, target string, record PushRecord, err error, now time.Time) {
+	journal := data.PushJournal[target]
+	for i, failure := range journal {
+		if failure.Transaction.TransactionID == record.Transaction.TransactionID {
+			journal[i].Transaction = record.Transaction
+			journal[i].Account = record.Account
+			journal[i].Error = err.Error()
+			journal[i].FailedAt = now
+			journal[i].Attempts++
+			return
+		}
+	}
+	data.PushJournal[target] = append(journal, plaid_cli.PushFailure{
+		Transaction: record.Transaction,
+		Account:     record.Account,
+		Error:       err.Error(),
+		FailedAt:    now,
+		Attempts:    1,
+	})
+}
+
+func clearPushFailure(data *plaid_cli.Data, target string, transactionID string) {
+	journal := keep(data.PushJournal[target], func(failure plaid_cli.PushFailure) bool {
+		return failure.Transaction.TransactionID != transactionID
+	})
+	if len(journal) == 0 {
+		delete(data.PushJournal, target)
+		return
+	}
+	data.PushJournal[target] = journal
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+const (
+	ynabURL       = "https://api.ynab.com/v1"
+	lunchMoneyURL = "https://dev.lunchmoney.app/v1"
+)
+
+// pushRequest sends body, if it's set, as JSON to a budgeting tool's API and
+// decodes the response into out, if it's set.
+func pushRequest(method string, endpoint string, token string, body interface{}, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(b)
+	}
+
+	timeout := viper.GetDuration("cli.request_timeout")
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 300 {
+		return pushStatusError{host: req.URL.Host, status: res.Status, code: res.StatusCode, body: strings.TrimSpace(string(b))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+type pushStatusError struct {
+	host   string
+	status string
+	code   int
+	body   string
+}
+
+func (e pushStatusError) Error() string {
+	body := e.body
+	if len(body) > 512 {
+		body = body[:512] + "…"
+	}
+	return fmt.Sprintf("%s returned %s: %s", e.host, e.status, body)
+}
+
+// sameError returns err for each of n records, for APIs that accept or
+// reject a batch as a whole.
+func sameError(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// YNABTarget pushes transactions to a YNAB (https://ynab.com) budget.
+type YNABTarget struct {
+	URL      string
+	Token    string
+	BudgetID string
+}
+
+func (t *YNABTarget) Name() string {
+	return "ynab"
+}
+
+// Accounts lists the budget's open accounts.
+func (t *YNABTarget) Accounts() ([]PushAccount, error) {
+	var res struct {
+		Data struct {
+			Accounts []struct {
+				ID      string `json:"id"`
+				Name    string `json:"name"`
+				Closed  bool   `json:"closed"`
+				Deleted bool   `json:"deleted"`
+			} `json:"accounts"`
+		} `json:"data"`
+	}
+	endpoint := fmt.Sprintf("%s/budgets/%s/accounts", strings.TrimSuffix(t.URL, "/"), url.PathEscape(t.BudgetID))
+	err := pushRequest(http.MethodGet, endpoint, t.Token, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []PushAccount
+	for _, account := range res.Data.Accounts {
+		if account.Closed || account.Deleted {
+			continue
+		}
+		accounts = append(accounts, PushAccount{ID: account.ID, Name: account.Name})
+	}
+	return accounts, nil
+}
+
+type ynabTransaction struct {
+	AccountID string `json:"account_id"`
+	Date      string `json:"date"`
+	// Amount is in milliunits, negative for money going out.
+	Amount    int64  `json:"amount"`
+	PayeeName string `json:"payee_name"`
+	Cleared   string `json:"cleared"`
+	Approved  bool   `json:"approved"`
+	ImportID  string `json:"import_id"`
+}
+
+// Push creates the transactions in the budget. YNAB skips ones whose import
+// ID it has seen before.
+func (t *YNABTarget) Push(records []PushRecord) []error {
+	var transactions []ynabTransaction
+	for _, record := range records {
+		tx := record.Transaction
+		payee := plaid_cli.Value(tx.MerchantName)
+		if payee == "" {
+			payee = tx.Name
+		}
+		transactions = append(transactions, ynabTransaction{
+			AccountID: record.Account,
+			Date:      tx.Date,
+			Amount:    int64(math.Round(-tx.Amount * 1000)),
+			PayeeName: truncate(payee, 200),
+			Cleared:   "cleared",
+			ImportID:  externalID(tx),
+		})
+	}
+
+	endpoint := fmt.Sprintf("%s/budgets/%s/transactions", strings.TrimSuffix(t.URL, "/"), url.PathEscape(t.BudgetID))
+	err := pushRequest(http.MethodPost, endpoint, t.Token, map[string]interface{}{"transactions": transactions}, nil)
+	return sameError(len(records), err)
+}
+
+// FireflyTarget pushes transactions to a Firefly III
+// (https://www.firefly-iii.org) instance.
+type FireflyTarget struct {
+	URL   string
+	Token string
+}
+
+func (t *FireflyTarget) Name() string {
+	return "firefly"
+}
+
+// Accounts lists Firefly III's active asset and liability accounts, which
+// are the accounts withdrawals can come from and deposits go to.
+func (t *FireflyTarget) Accounts() ([]PushAccount, error) {
+	var accounts []PushAccount
+	for _, accountType := range []string{"asset", "liabilities"} {
+		for page := 1; ; page++ {
+			var res struct {
+				Data []struct {
+					ID         string `json:"id"`
+					Attributes struct {
+						Name   string `json:"name"`
+						Active bool   `json:"active"`
+					} `json:"attributes"`
+				} `json:"data"`
+				Meta struct {
+					Pagination struct {
+						TotalPages int `json:"total_pages"`
+					} `json:"pagination"`
+				} `json:"meta"`
+			}
+			endpoint := fmt.Sprintf("%s/api/v1/accounts?type=%s&page=%d", strings.TrimSuffix(t.URL, "/"), accountType, page)
+			err := pushRequest(http.MethodGet, endpoint, t.Token, nil, &res)
+			if err != nil {
+				return nil, err
+			}
+			for _, account := range res.Data {
+				if account.Attributes.Active {
+					accounts = append(accounts, PushAccount{ID: account.ID, Name: account.Attributes.Name})
+				}
+			}
+			if page >= res.Meta.Pagination.TotalPages {
+				break
+			}
+		}
+	}
+	return accounts, nil
+}
+
+type fireflyTransaction struct {
+	Type            string `json:"type"`
+	Date            string `json:"date"`
+	Amount          string `json:"amount"`
+	Description     string `json:"description"`
+	SourceID        string `json:"source_id,omitempty"`
+	SourceName      string `json:"source_name,omitempty"`
+	DestinationID   string `json:"destination_id,omitempty"`
+	DestinationName string `json:"destination_name,omitempty"`
+	CurrencyCode    string `json:"currency_code,omitempty"`
+	CategoryName    string `json:"category_name,omitempty"`
+	ExternalID      string `json:"external_id"`
+}
+
+// Push creates each transaction in Firefly III, one request each, since
+// Firefly creates a transaction group per request. Money going out of a
+// mapped asset account is a withdrawal to the merchant; money coming in is a
+// deposit from it. Transactions Firefly reports as duplicates count as
+// pushed.
+func (t *FireflyTarget) Push(records []PushRecord) []error {
+	endpoint := strings.TrimSuffix(t.URL, "/") + "/api/v1/transactions"
+	errs := make([]error, len(records))
+	for i, record := range records {
+		tx := record.Transaction
+		counterparty := plaid_cli.Value(tx.MerchantName)
+		if counterparty == "" {
+			counterparty = tx.Name
+		}
+
+		split := fireflyTransaction{
+			Date:         tx.Date,
+			Amount:       fmt.Sprintf("%.2f", math.Abs(tx.Amount)),
+			Description:  tx.Name,
+			CurrencyCode: plaid_cli.Value(tx.ISOCurrencyCode),
+			ExternalID:   externalID(tx),
+		}
+		if category := TransactionCategory(tx); category != "UNCATEGORIZED" {
+			split.CategoryName = category
+		}
+		if tx.Amount >= 0 {
+			split.Type = "withdrawal"
+			split.SourceID = record.Account
+			split.DestinationName = counterparty
+		} else {
+			split.Type = "deposit"
+			split.SourceName = counterparty
+			split.DestinationID = record.Account
+		}
+
+		body := map[string]interface{}{
+			"error_if_duplicate_hash": true,
+			"apply_rules":             true,
+			"transactions":            []fireflyTransaction{split},
+		}
+		err := pushRequest(http.MethodPost, endpoint, t.Token, body, nil)
+		if statusErr, ok := err.(pushStatusError); ok && statusErr.code == http.StatusUnprocessableEntity && strings.Contains(statusErr.body, "Duplicate of transaction") {
+			err = nil
+		}
+		errs[i] = err
+	}
+	return errs
+}
+
+// LunchMoneyTarget pushes transactions to Lunch Money
+// (https://lunchmoney.app).
+type LunchMoneyTarget struct {
+	URL   string
+	Token string
+}
+
+func (t *LunchMoneyTarget) Name() string {
+	return "lunchmoney"
+}
+
+// Accounts lists Lunch Money's open manually managed assets, which are what
+// transactions are inserted into by asset ID.
+func (t *LunchMoneyTarget) Accounts() ([]PushAccount, error) {
+	var res struct {
+		Assets []struct {
+			ID          int64  `json:"id"`
+			Name        string `json:"name"`
+			DisplayName string `json:"display_name"`
+			ClosedOn    string `json:"closed_on"`
+		} `json:"assets"`
+	}
+	err := pushRequest(http.MethodGet, strings.TrimSuffix(t.URL, "/")+"/assets", t.Token, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []PushAccount
+	for _, asset := range res.Assets {
+		if asset.ClosedOn != "" {
+			continue
+		}
+		name := asset.DisplayName
+		if name == "" {
+			name = asset.Name
+		}
+		accounts = append(accounts, PushAccount{ID: strconv.FormatInt(asset.ID, 10), Name: name})
+	}
+	return accounts, nil
+}
+
+type lunchMoneyTransaction struct {
+	Date string `json:"date"`
+	// Amount is positive for money going out, as Plaid's is.
+	Amount     string `json:"amount"`
+	Payee      string `json:"payee"`
+	Currency   string `json:"currency,omitempty"`
+	AssetID    int64  `json:"asset_id"`
+	Status     string `json:"status"`
+	ExternalID string `json:"external_id"`
+}
+
+// Push inserts the transactions into Lunch Money, which skips ones with an
+// external ID it has seen before in the same account.
+func (t *LunchMoneyTarget) Push(records []PushRecord) []error {
+	errs := make([]error, len(records))
+	var transactions []lunchMoneyTransaction
+	var sent []int
+	for i, record := range records {
+		assetID, err := strconv.ParseInt(record.Account, 10, 64)
+		if err != nil {
+			errs[i] = fmt.Errorf("invalid Lunch Money asset ID %q: asset IDs are numbers", record.Account)
+			continue
+		}
+		tx := record.Transaction
+		payee := plaid_cli.Value(tx.MerchantName)
+		if payee == "" {
+			payee = tx.Name
+		}
+		transactions = append(transactions, lunchMoneyTransaction{
+			Date:       tx.Date,
+			Amount:     fmt.Sprintf("%.2f", tx.Amount),
+			Payee:      payee,
+			Currency:   strings.ToLower(plaid_cli.Value(tx.ISOCurrencyCode)),
+			AssetID:    assetID,
+			Status:     "uncleared",
+			ExternalID: externalID(tx),
+		})
+		sent = append(sent, i)
+	}
+	if len(transactions) == 0 {
+		return errs
+	}
+
+	body := map[string]interface{}{
+		"transactions":      transactions,
+		"apply_rules":       true,
+		"skip_duplicates":   true,
+		"debit_as_negative": false,
+	}
+	var res struct {
+		Error []string `json:"error"`
+	}
+	err := pushRequest(http.MethodPost, strings.TrimSuffix(t.URL, "/")+"/transactions", t.Token, body, &res)
+	if err == nil && len(res.Error) > 0 {
+		err = fmt.Errorf("Lunch Money rejected the transactions: %s", strings.Join(res.Error, "; "))
+	}
+	for _, i := range sent {
+		errs[i] = err
+	}
+	return errs
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
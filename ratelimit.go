@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+// defaultRateLimits are the requests per minute plaid-cli allows itself for
+// each item, by product. They match Plaid's production limits, which are
+// also per item; set rate_limit.<product> in the config file to change one,
+// or to 0 to turn it off.
+var defaultRateLimits = map[string]int{
+	"transactions": 30,
+	"balance":      5,
+	"accounts":     15,
+	"auth":         15,
+	"identity":     15,
+	"investments":  15,
+	"liabilities":  15,
+	"item":         15,
+}
+
+// rateLimitProducts maps endpoint prefixes to the product whose limit they
+// count against. The first match wins.
+var rateLimitProducts = []struct {
+	prefix  string
+	product string
+}{
+	{"/accounts/balance/", "balance"},
+	{"/accounts/", "accounts"},
+	{"/transactions/", "transactions"},
+	{"/auth/", "auth"},
+	{"/identity/", "identity"},
+	{"/investments/", "investments"},
+	{"/liabilities/", "liabilities"},
+	{"/item/", "item"},
+}
+
+// RateLimitsFromViper returns the per-item requests per minute for each
+// product, with any overrides from the config file applied.
+func RateLimitsFromViper() (map[string]int, error) {
+	limits := make(map[string]int)
+	for product, limit := range defaultRateLimits {
+		limits[product] = limit
+	}
+	for product := range viper.GetStringMap("rate_limit") {
+		if _, ok := defaultRateLimits[product]; !ok {
+			return nil, ConfigError{msg: fmt.Sprintf("⚠️  Unknown product %q in rate_limit. Rate limits can be set for: %s", product, strings.Join(rateLimitedProducts(), ", "))}
+		}
+		limits[product] = viper.GetInt("rate_limit." + product)
+	}
+	return limits, nil
+}
+
+// rateLimitTransport holds back requests that would exceed the rate limit
+// for their item and product, so fan-outs across many items and the daemon
+// never trip RATE_LIMIT_EXCEEDED.
+type rateLimitTransport struct {
+	base   http.RoundTripper
+	limits map[string]int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func NewRateLimitTransport(base http.RoundTripper, limits map[string]int) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitTransport{base: base, limits: limits, limiters: make(map[string]*rate.Limiter)}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	product := rateLimitProduct(req.URL.Path)
+	limit := t.limits[product]
+	token := requestAccessToken(req)
+	if product == "" || limit <= 0 || token == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	limiter := t.limiter(product+" "+token, limit)
+	reservation := limiter.Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		if delay > 2*time.Second {
+			log.Printf("Waiting %s to stay within Plaid's %s rate limit.", delay.Round(time.Second), product)
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			reservation.Cancel()
+			return nil, req.Context().Err()
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// limiter returns the bucket for key. Plaid counts requests per minute, so
+// the burst plus a minute's refill never exceeds limit.
+func (t *rateLimitTransport) limiter(key string, limit int) *rate.Limiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if l, ok := t.limiters[key]; ok {
+		return l
+	}
+	burst := limit / 3
+	if burst < 1 {
+		burst = 1
+	}
+	perMinute := limit - burst
+	if perMinute < 1 {
+		perMinute = 1
+	}
+	l := rate.NewLimiter(rate.Every(time.Minute/time.Duration(perMinute)), burst)
+	t.limiters[key] = l
+	return l
+}
+
+func rateLimitedProducts() []string {
+	var products []string
+	for product := range defaultRateLimits {
+		products = append(products, product)
+	}
+	sort.Strings(products)
+	return products
+}
+
+func rateLimitProduct(path string) string {
+	for _, p := range rateLimitProducts {
+		if strings.HasPrefix(path, p.prefix) {
+			return p.product
+		}
+	}
+	return ""
+}
+
+// requestAccessToken returns the access token a Plaid request is made with,
+// if any, without consuming the request body.
+func requestAccessToken(req *http.Request) string {
+	if req.Body == nil || req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+
+	var fields struct {
+		AccessToken string `json:"access_token"`
+	}
+	if json.NewDecoder(body).Decode(&fields) != nil {
+		return ""
+	}
+	return fields.AccessToken
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+	"github.com/spf13/viper"
+)
+
+// relinkErrorCodes are the Plaid errors that the user can fix by logging in
+// to their institution again through Link's update mode, with a description
+// of what went wrong. The descriptions are translated with T.
+var relinkErrorCodes = map[string]string{
+	"ITEM_LOGIN_REQUIRED":      "login expired",
+	"ITEM_LOCKED":              "account is locked after too many failed login attempts",
+	"INVALID_UPDATED_USERNAME": "username changed",
+}
+
+// NeedsRelink reports whether err can be fixed by relinking the item.
+func NeedsRelink(err error) bool {
+	_, ok := relinkErrorCodes[PlaidErrorCode(err)]
+	return ok
+}
+
+// ItemClient makes Plaid requests on behalf of linked items. Every command
+// that uses an item's access token should go through Do, so that expired
+// logins are handled the same way everywhere.
+type ItemClient struct {
+	*plaid.PlaidApiService
+	Data   *plaid_cli.Data
+	Linker *plaid_cli.Linker
+	// History, if set, records the items used in the command history.
+	History *History
+}
+
+func NewItemClient(client *plaid.PlaidApiService, data *plaid_cli.Data, linker *plaid_cli.Linker) *ItemClient {
+	return &ItemClient{
+		PlaidApiService: client,
+		Data:            data,
+		Linker:          linker,
+	}
+}
+
+// Do calls action with the item's access token, relinking the item and
+// calling action again if Plaid says the user needs to log in. Without a
+// Linker, as for another household member's items, action is only called
+// once.
+func (c *ItemClient) Do(itemID string, action func(token string) error) error {
+	c.History.UseItem(itemID)
+	do := func() error {
+		// Relinking can replace the token, so it's looked up each time.
+		token, err := ItemToken(c.Data, itemID)
+		if err != nil {
+			return err
+		}
+		return NormalizeError(action(token))
+	}
+	if c.Linker == nil {
+		return do()
+	}
+	return WithRelinkOnAuthError(itemID, c.Linker, do)
+}
+
+// WithRelinkOnAuthError runs action and, if the item needs the user to log in
+// again, relinks it and runs action once more. Relinking opens a browser, so
+// it's skipped when cli.auto_relink is off (--no-relink) or nobody is at the
+// terminal to confirm it.
+func WithRelinkOnAuthError(itemID string, linker *plaid_cli.Linker, action func() error) error {
+	err := action()
+	if !NeedsRelink(err) {
+		return err
+	}
+
+	name := ItemName(linker.Data, itemID)
+	problem := T(relinkErrorCodes[PlaidErrorCode(err)])
+	if !viper.GetBool("cli.auto_relink") || !isInteractive() {
+		return fmt.Errorf("%s: %w", T("%s: %s. Run `plaid-cli item relink %s` to log in again", name, problem, name), err)
+	}
+
+	ok, promptErr := Confirm(T("%s: %s. Open a browser to log in again", name, problem))
+	if promptErr != nil {
+		return promptErr
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", T("%s: %s and relinking was declined", name, problem), err)
+	}
+
+	port := viper.GetString("link.port")
+	relinkErr := linker.Relink(itemID, port)
+	if relinkErr != nil {
+		return fmt.Errorf("%s: %w", T("relinking %s failed", name), relinkErr)
+	}
+
+	log.Println(T("Re-running action..."))
+
+	err = action()
+	if NeedsRelink(err) {
+		problem = T(relinkErrorCodes[PlaidErrorCode(err)])
+		return fmt.Errorf("%s: %w", T("%s: %s even after relinking. Run `plaid-cli item relink %s` to try again", name, problem, name), err)
+	}
+
+	return err
+}
+
+// RelinkResult is what `plaid-cli item relink` did for an item.
+type RelinkResult struct {
+	ItemID string
+	// Problem is the error Plaid reported for the item before relinking, or
+	// empty if it was healthy.
+	Problem string
+	// Relinked reports whether the item was relinked and Plaid no longer
+	// reports a problem that relinking fixes.
+	Relinked bool
+	Err      error
+}
+
+// ItemProblem checks an item with /item/get and returns the error code Plaid
+// reports for it, or an empty string if it's healthy.
+func ItemProblem(client *plaid.PlaidApiService, data *plaid_cli.Data, itemID string) (string, error) {
+	token, err := ItemToken(data, itemID)
+	if err != nil {
+		return "", err
+	}
+	item, err := GetItem(client, token)
+	if err != nil {
+		err = NormalizeError(err)
+		// Only an item error is a problem with the item. Others, such as a
+		// rate limit or an invalid access token, mean it couldn't be
+		// checked.
+		if plaidErr, ok := AsPlaidError(err); ok && plaidErr.ErrorType == plaid.PLAIDERRORTYPE_ITEM_ERROR {
+			return plaidErr.ErrorCode, nil
+		}
+		return "", err
+	}
+	return plaid_cli.Value(item.ErrorCode), nil
+}
+
+// RelinkItems checks each item's status and relinks the ones whose login
+// needs fixing, then checks them again to confirm they were fixed. Healthy
+// items, and items with problems relinking can't fix, are left alone. A
+// failure doesn't stop the rest.
+func RelinkItems(client *plaid.PlaidApiService, linker *plaid_cli.Linker, itemIDs []string, port string) []RelinkResult {
+	var results []RelinkResult
+	for _, itemID := range itemIDs {
+		result := RelinkResult{ItemID: itemID}
+		result.Problem, result.Err = ItemProblem(client, linker.Data, itemID)
+		if result.Err == nil && isRelinkable(result.Problem) {
+			result.Err = relinkItem(client, linker, itemID, port)
+			result.Relinked = result.Err == nil
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func isRelinkable(problem string) bool {
+	_, ok := relinkErrorCodes[problem]
+	return ok
+}
+
+func relinkItem(client *plaid.PlaidApiService, linker *plaid_cli.Linker, itemID string, port string) error {
+	name := ItemName(linker.Data, itemID)
+	log.Println(T("Relinking %s...", name))
+	err := linker.Relink(itemID, port)
+	if err != nil {
+		return err
+	}
+
+	problem, err := ItemProblem(client, linker.Data, itemID)
+	if err != nil {
+		return err
+	}
+	if isRelinkable(problem) {
+		return fmt.Errorf("%s even after relinking", T(relinkErrorCodes[problem]))
+	}
+	return nil
+}
+
+// RelinkError summarizes failed relinks as an error, or nil if there were
+// none. Some failing makes it a PartialError.
+func RelinkError(results []RelinkResult) error {
+	var failed int
+	for _, r := range results {
+		if r.Err != nil && !errors.Is(r.Err, plaid_cli.ErrDryRun) {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return nil
+	case failed == len(results):
+		return fmt.Errorf("relinking failed for all %d institutions", failed)
+	default:
+		return PartialError{Err: fmt.Errorf("relinking failed for %d of %d institutions", failed, len(results))}
+	}
+}
+
+// WriteRelinkResults writes a table of which items were fixed, which were
+// healthy and which couldn't be fixed by relinking.
+func WriteRelinkResults(w io.Writer, data *plaid_cli.Data, results []RelinkResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "ITEM	PROBLEM	STATUS	ERROR")
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		problem := r.Problem
+		if problem == "" {
+			problem = "-"
+		}
+		status := ""
+		message := ""
+		switch {
+		case errors.Is(r.Err, plaid_cli.ErrDryRun):
+			status = "would relink"
+		case r.Err != nil:
+			status = "failed"
+			message = r.Err.Error()
+		case r.Relinked:
+			status = "fixed"
+		case r.Problem == "":
+			status = "healthy"
+		default:
+			status = "skipped"
+			message = "relinking doesn't fix this problem"
+		}
+		_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", ItemName(data, r.ItemID), problem, status, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
+
+// isInteractive reports whether stdin is a terminal, so the user can answer
+// prompts.
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+var periodPattern = regexp.MustCompile(`^(\d+)([dwmy])$`)
+
+// ParsePeriod parses a look-back period such as 30d, 6w, 12m or 1y and
+// returns the date that far before now.
+func ParsePeriod(period string, now time.Time) (time.Time, error) {
+	matches := periodPattern.FindStringSubmatch(period)
+	if matches == nil {
+		return time.Time{}, fmt.Errorf("invalid period %q. Use a number followed by d, w, m or y, e.g. 12m", period)
+	}
+
+	n, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch matches[2] {
+	case "d":
+		return now.AddDate(0, 0, -n), nil
+	case "w":
+		return now.AddDate(0, 0, -7*n), nil
+	case "m":
+		return now.AddDate(0, -n, 0), nil
+	default:
+		return now.AddDate(-n, 0, 0), nil
+	}
+}
+
+// ReportTransactions fetches the transactions between from and to for each
+// item. If partial allows it, items that fail are skipped and transactions
+// fetched before a failure are kept.
+func ReportTransactions(client *ItemClient, itemIDs []string, from time.Time, to time.Time, partial *PartialResults) ([]plaid_cli.Transaction, error) {
+	var transactions []plaid_cli.Transaction
+	for _, itemID := range itemIDs {
+		err := client.Do(itemID, func(token string) error {
+			req := plaid.NewTransactionsGetRequest(token, from.Format("2006-01-02"), to.Format("2006-01-02"))
+			// Reports group spending by category.
+			req.SetOptions(TransactionRequestOptions{PersonalFinanceCategory: true}.Options())
+
+			txs, err := AllTransactions(*req, client.PlaidApiService)
+			if err != nil && !(len(txs) > 0 && partial.Tolerate(fmt.Errorf("%s: fetched %d transactions before: %w", ItemName(client.Data, itemID), len(txs), err))) {
+				return err
+			}
+
+			transactions = append(transactions, txs...)
+			return nil
+		})
+		if err != nil {
+			err = fmt.Errorf("%s: %w", ItemName(client.Data, itemID), err)
+			if partial.Tolerate(err) {
+				continue
+			}
+			return transactions, err
+		}
+	}
+
+	return transactions, nil
+}
+
+// productUnavailableCodes are the Plaid errors returned when an item can't
+// provide a product at all, such as a checking-only bank asked for investment
+// holdings.
+var productUnavailableCodes = map[string]bool{
+	"ADDITIONAL_CONSENT_REQUIRED": true,
+	"INVALID_PRODUCT":             true,
+	"NO_ACCOUNTS":                 true,
+	"NO_INVESTMENT_ACCOUNTS":      true,
+	"NO_LIABILITY_ACCOUNTS":       true,
+	"PRODUCTS_NOT_SUPPORTED":      true,
+}
+
+// IsProductUnavailable reports whether err means an item doesn't support the
+// requested product, so reports across all items can skip it.
+func IsProductUnavailable(err error) bool {
+	return productUnavailableCodes[PlaidErrorCode(err)]
+}
+
+// MerchantSpend is the spending at a single merchant over a report's period.
+type MerchantSpend struct {
+	// Owner is set when spending is grouped by owner.
+	Owner            string          `json:"owner,omitempty"`
+	Merchant         string          `json:"merchant"`
+	Total            plaid_cli.Money `json:"total"`
+	TransactionCount int             `json:"transaction_count"`
+	Average          plaid_cli.Money `json:"average"`
+	// Change is set when spending is compared with an earlier period.
+	Change *Change `json:"change,omitempty"`
+}
+
+var merchantNoisePattern = regexp.MustCompile(`[#*]|\S*\d\S*`)
+
+// MerchantName returns Plaid's merchant name for tx, or a cleaned version of
+// the raw description with store numbers and other noise removed.
+func MerchantName(tx plaid_cli.Transaction) string {
+	if name := plaid_cli.Value(tx.MerchantName); name != "" {
+		return name
+	}
+
+	cleaned := merchantNoisePattern.ReplaceAllString(tx.Name, " ")
+	cleaned = strings.Join(strings.Fields(cleaned), " ")
+	if cleaned == "" {
+		return tx.Name
+	}
+	return cleaned
+}
+
+// MerchantSpending totals outgoing transactions by merchant, largest total
+// first. Incoming transactions such as refunds and income are ignored. If
+// owners maps account IDs to their owners, spending is totalled separately
+// for each owner, ordered by owner.
+func MerchantSpending(txs []plaid_cli.Transaction, owners map[string]string) []MerchantSpend {
+	type key struct{ owner, merchant string }
+	byMerchant := make(map[key]*MerchantSpend)
+	for _, tx := range txs {
+		if tx.Amount <= 0 {
+			continue
+		}
+
+		k := key{owner: owners[tx.AccountID], merchant: MerchantName(tx)}
+		spend, ok := byMerchant[k]
+		if !ok {
+			spend = &MerchantSpend{Owner: k.owner, Merchant: k.merchant}
+			byMerchant[k] = spend
+		}
+		spend.Total += plaid_cli.MoneyFromFloat(tx.Amount)
+		spend.TransactionCount++
+	}
+
+	var spending []MerchantSpend
+	for _, spend := range byMerchant {
+		spend.Average = spend.Total.Div(spend.TransactionCount)
+		spending = append(spending, *spend)
+	}
+
+	sort.Slice(spending, func(i, j int) bool {
+		if spending[i].Owner != spending[j].Owner {
+			return spending[i].Owner < spending[j].Owner
+		}
+		if spending[i].Total != spending[j].Total {
+			return spending[i].Total > spending[j].Total
+		}
+		return spending[i].Merchant < spending[j].Merchant
+	})
+
+	return spending
+}
+
+// TopMerchants keeps the n merchants with the most spending, for each owner
+// if spending is grouped by owner.
+func TopMerchants(spending []MerchantSpend, n int) []MerchantSpend {
+	if n <= 0 {
+		return spending
+	}
+	var top []MerchantSpend
+	counts := make(map[string]int)
+	for _, s := range spending {
+		if counts[s.Owner] < n {
+			top = append(top, s)
+			counts[s.Owner]++
+		}
+	}
+	return top
+}
+
+func WriteMerchantSpending(w io.Writer, spending []MerchantSpend, format string, byOwner bool) error {
+	compared := len(spending) > 0 && spending[0].Change != nil
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(spending, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "csv":
+		writer := csv.NewWriter(w)
+		header := []string{"Merchant", "Total", "Transactions", "Average"}
+		if byOwner {
+			header = append([]string{"Owner"}, header...)
+		}
+		if compared {
+			header = append(header, "Previous", "Change", "Change %", "Largest Increase")
+		}
+		err := writer.Write(header)
+		if err != nil {
+			return err
+		}
+		for _, s := range spending {
+			record := []string{
+				s.Merchant,
+				fmt.Sprintf("%.2f", s.Total),
+				strconv.Itoa(s.TransactionCount),
+				fmt.Sprintf("%.2f", s.Average),
+			}
+			if byOwner {
+				record = append([]string{s.Owner}, record...)
+			}
+			if compared {
+				percent := ""
+				if s.Change.Percent != nil {
+					percent = fmt.Sprintf("%.1f", *s.Change.Percent)
+				}
+				record = append(record,
+					fmt.Sprintf("%.2f", s.Change.Previous),
+					fmt.Sprintf("%.2f", s.Change.Change),
+					percent,
+					strconv.FormatBool(s.Change.LargestIncrease),
+				)
+			}
+			err = writer.Write(record)
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		header := "MERCHANT\tTOTAL\tTRANSACTIONS\tAVERAGE"
+		if byOwner {
+			header = "OWNER\t" + header
+		}
+		if compared {
+			header += "\tPREVIOUS\tCHANGE"
+		}
+		_, err := fmt.Fprintln(tw, header)
+		if err != nil {
+			return err
+		}
+		for _, s := range spending {
+			if byOwner {
+				_, err = fmt.Fprintf(tw, "%s\t", s.Owner)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = fmt.Fprintf(tw, "%s\t%.2f\t%d\t%.2f", s.Merchant, s.Total, s.TransactionCount, s.Average)
+			if err != nil {
+				return err
+			}
+			if compared {
+				_, err = fmt.Fprintf(tw, "\t%.2f\t%s", s.Change.Previous, formatChange(s.Change))
+				if err != nil {
+					return err
+				}
+			}
+			_, err = fmt.Fprintln(tw)
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
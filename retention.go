@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+	"github.com/spf13/viper"
+)
+
+// PurgeSummary counts the local data a purge removed, or would remove.
+type PurgeSummary struct {
+	// Transactions are imported transactions.
+	Transactions int
+	// Balances are days of recorded balances, with cached accounts'
+	// balances counted per item.
+	Balances      int
+	SavingsMonths int
+	AuditEntries  int
+}
+
+func (s PurgeSummary) String() string {
+	return fmt.Sprintf("%d imported transactions, %d recorded balances, %d months of savings history and %d audit log entries", s.Transactions, s.Balances, s.SavingsMonths, s.AuditEntries)
+}
+
+// PurgeTransactions removes imported transactions dated before cutoff, and
+// the savings history of months before it. With dryRun set they're only
+// counted. Nothing is saved unless something was removed.
+func PurgeTransactions(data *plaid_cli.Data, cutoff time.Time, dryRun bool, summary *PurgeSummary) error {
+	before := *summary
+	day := cutoff.Format("2006-01-02")
+	for account, txs := range data.Imported {
+		kept := keep(txs, func(tx plaid_cli.Transaction) bool { return tx.Date >= day })
+		summary.Transactions += len(txs) - len(kept)
+		if !dryRun {
+			data.Imported[account] = kept
+		}
+	}
+
+	month := cutoff.Format("2006-01")
+	for m := range data.SavingsHistory {
+		if m < month {
+			summary.SavingsMonths++
+			if !dryRun {
+				delete(data.SavingsHistory, m)
+			}
+		}
+	}
+
+	if dryRun || *summary == before {
+		return nil
+	}
+	err := data.SaveImported()
+	if err != nil {
+		return err
+	}
+	return data.SaveSavingsHistory()
+}
+
+// PurgeBalances removes balances recorded before cutoff, and cached accounts
+// last fetched before it. With dryRun set they're only counted. Nothing is
+// saved unless something was removed.
+func PurgeBalances(data *plaid_cli.Data, cutoff time.Time, dryRun bool, summary *PurgeSummary) error {
+	before := *summary
+	day := cutoff.Format("2006-01-02")
+	for id, history := range data.BalanceHistory {
+		for d := range history.Balances {
+			if d < day {
+				summary.Balances++
+				if !dryRun {
+					delete(history.Balances, d)
+				}
+			}
+		}
+		// Manual accounts are kept, without balances, until they're
+		// removed.
+		if !dryRun && len(history.Balances) == 0 && history.Item != "" {
+			delete(data.BalanceHistory, id)
+		}
+	}
+
+	for itemID, cached := range data.AccountCache {
+		if cached.UpdatedAt.Before(cutoff) {
+			summary.Balances++
+			if !dryRun {
+				delete(data.AccountCache, itemID)
+			}
+		}
+	}
+
+	if dryRun || *summary == before {
+		return nil
+	}
+	err := data.SaveBalanceHistory()
+	if err != nil {
+		return err
+	}
+	return data.SaveAccountCache()
+}
+
+// ApplyRetention purges imported transactions and recorded balances older
+// than retention.transactions and retention.balances in the config file, if
+// set, returning what was removed. The audit log has its own setting,
+// cli.audit_retention_days.
+func ApplyRetention(data *plaid_cli.Data, now time.Time) (PurgeSummary, error) {
+	var summary PurgeSummary
+	if period := viper.GetString("retention.transactions"); period != "" {
+		cutoff, err := ParsePeriod(period, now)
+		if err != nil {
+			return summary, ConfigError{msg: fmt.Sprintf("⚠️  Invalid retention.transactions: %v.", err)}
+		}
+		err = PurgeTransactions(data, cutoff, false, &summary)
+		if err != nil {
+			return summary, err
+		}
+	}
+	if period := viper.GetString("retention.balances"); period != "" {
+		cutoff, err := ParsePeriod(period, now)
+		if err != nil {
+			return summary, ConfigError{msg: fmt.Sprintf("⚠️  Invalid retention.balances: %v.", err)}
+		}
+		err = PurgeBalances(data, cutoff, false, &summary)
+		if err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// RemoveItem removes an item at Plaid with /item/remove, which stops
+// billing for it and invalidates its access token, then forgets it locally.
+func RemoveItem(client *plaid.PlaidApiService, data *plaid_cli.Data, itemID string) error {
+	token, err := ItemToken(data, itemID)
+	if err != nil {
+		return err
+	}
+
+	req := plaid.NewItemRemoveRequest(token)
+	_, _, err = client.ItemRemove(context.Background()).ItemRemoveRequest(*req).Execute()
+	if err != nil {
+		return NormalizeError(err)
+	}
+
+	log.Printf("Removed %s at Plaid.", ItemName(data, itemID))
+	return data.ForgetItem(itemID)
+}
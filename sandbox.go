@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// DefaultSandboxInstitution is First Platypus Bank, Plaid's sandbox
+// institution that supports every product.
+const DefaultSandboxInstitution = "ins_109508"
+
+// RequireSandbox returns an error unless environment is the sandbox. The
+// sandbox commands use endpoints that only exist there.
+func RequireSandbox(environment string) error {
+	if environment != "sandbox" {
+		return fmt.Errorf("sandbox commands only work in the sandbox environment, not %s. Use --environment sandbox", environment)
+	}
+	return nil
+}
+
+// ResetSandboxLogin puts a sandbox item into the ITEM_LOGIN_REQUIRED state,
+// as if its login had expired, so relinking can be tried out.
+func ResetSandboxLogin(client *plaid.PlaidApiService, data *plaid_cli.Data, itemID string, dryRun bool) error {
+	token, ok := data.Tokens[itemID]
+	if !ok {
+		return fmt.Errorf("no access token for item %s", itemID)
+	}
+	req := plaid.NewSandboxItemResetLoginRequest(token)
+	if dryRun {
+		return plaid_cli.PrintDryRun("/sandbox/item/reset_login", req)
+	}
+	_, _, err := client.SandboxItemResetLogin(context.Background()).SandboxItemResetLoginRequest(*req).Execute()
+	return err
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// IncomeRules decide which money coming in counts as income, rather than
+// refunds or money moved from another of the user's accounts.
+type IncomeRules struct {
+	// Categories are personal finance categories counted as income, matched
+	// as CategoryExclusions describes.
+	Categories []string
+	// Matches are text that, found in an inflow's merchant name or
+	// description in any case, makes it income whatever its category.
+	Matches []string
+}
+
+// IncomeRulesFromViper returns the rules set under [savings_rate] in the
+// config file: income_categories, which defaults to Plaid's INCOME category,
+// and income_matches.
+func IncomeRulesFromViper() IncomeRules {
+	return IncomeRules{
+		Categories: normalizeCategories(viper.GetStringSlice("savings_rate.income_categories")),
+		Matches:    viper.GetStringSlice("savings_rate.income_matches"),
+	}
+}
+
+// IsIncome reports whether tx is income.
+func (r IncomeRules) IsIncome(tx plaid_cli.Transaction) bool {
+	if tx.Amount >= 0 {
+		return false
+	}
+	if inCategories(tx, r.Categories) {
+		return true
+	}
+	for _, match := range r.Matches {
+		if containsFold(tx.Name, match) || containsFold(plaid_cli.Value(tx.MerchantName), match) {
+			return true
+		}
+	}
+	return false
+}
+
+// SavingsRate is how much of a month's income was saved.
+type SavingsRate struct {
+	Month    string          `json:"month"`
+	Income   plaid_cli.Money `json:"income"`
+	Spending plaid_cli.Money `json:"spending"`
+	Saved    plaid_cli.Money `json:"saved"`
+	// Rate is the percentage of income saved, or nil without any income.
+	Rate *float64 `json:"rate"`
+}
+
+// MonthlySavings totals income and spending by month. Spending is money
+// going out, except transfers between the user's own accounts; inflows
+// that aren't income don't count at all.
+func MonthlySavings(txs []plaid_cli.Transaction, rules IncomeRules) map[string]plaid_cli.SavingsMonth {
+	months := make(map[string]plaid_cli.SavingsMonth)
+	for _, tx := range txs {
+		if tx.Pending || len(tx.Date) < 7 {
+			continue
+		}
+		month := tx.Date[:7]
+		totals := months[month]
+		if rules.IsIncome(tx) {
+			totals.Income -= plaid_cli.MoneyFromFloat(tx.Amount)
+		} else if tx.Amount > 0 && !isTransfer(tx) {
+			totals.Spending += plaid_cli.MoneyFromFloat(tx.Amount)
+		}
+		months[month] = totals
+	}
+	return months
+}
+
+// SavingsOptions are what savings rates are worked out with.
+type SavingsOptions struct {
+	Rules      IncomeRules
+	Exclusions CategoryExclusions
+	// IncludeIgnored includes what members have ignored.
+	IncludeIgnored bool
+	// Refresh works out every month again instead of using the history.
+	Refresh bool
+}
+
+// signature identifies the members, their items and the options savings
+// were worked out with.
+func (o SavingsOptions) signature(members []HouseholdMember) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q", o.Rules.Categories, o.Rules.Matches, []string(o.Exclusions))
+	for _, member := range members {
+		ids := append([]string{}, member.ItemIDs...)
+		sort.Strings(ids)
+		ignored := ActiveIgnores(member.Client.Data, o.IncludeIgnored)
+		fmt.Fprintf(h, " %q %q %q %q %t", member.Name, ids, sortedKeys(ignored.Accounts), sortedKeys(ignored.Transactions), member.Imported)
+		splits := member.Client.Data.Splits
+		for _, id := range sortedKeys(splits) {
+			fmt.Fprintf(h, " %q %v", id, splits[id])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// savingsSettleDays is how long after a month ends its savings are
+// remembered.
+const savingsSettleDays = 10
+
+// SavingsRates returns the savings rate for each of the count months before
+// now's, across members' items and imported transactions. Months in the
+// first member's SavingsHistory that were worked out with the same members,
+// items and options are reused; the rest are fetched together, and
+// remembered if they ended at least savingsSettleDays ago.
+func SavingsRates(members []HouseholdMember, count int, now time.Time, opts SavingsOptions, partial *PartialResults) ([]SavingsRate, error) {
+	data := members[0].Client.Data
+	signature := opts.signature(members)
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+
+	var months []time.Time
+	var missing []time.Time
+	worked := make(map[string]plaid_cli.SavingsMonth)
+	for i := count; i >= 1; i-- {
+		month := thisMonth.AddDate(0, -i, 0)
+		months = append(months, month)
+		cached, ok := data.SavingsHistory[month.Format("2006-01")]
+		if opts.Refresh || !ok || cached.Signature != signature {
+			missing = append(missing, month)
+		}
+	}
+
+	if len(missing) > 0 {
+		from := missing[0]
+		to := missing[len(missing)-1].AddDate(0, 1, -1)
+		txs, _, err := HouseholdTransactions(members, from, to, opts.IncludeIgnored, partial)
+		if err != nil {
+			return nil, err
+		}
+		fetched := MonthlySavings(opts.Exclusions.Filter(ApplySplits(HouseholdSplits(members), txs)), opts.Rules)
+		for _, month := range missing {
+			key := month.Format("2006-01")
+			totals := fetched[key]
+			totals.Signature = signature
+			worked[key] = totals
+			// Transactions from the end of a month can take days to post,
+			// so a month is only remembered once they have had time to.
+			if !now.Before(month.AddDate(0, 1, savingsSettleDays)) {
+				data.SavingsHistory[key] = totals
+			}
+		}
+		// Months with missing transactions would be remembered wrong.
+		if partial.Err() == nil {
+			err = data.SaveSavingsHistory()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var rates []SavingsRate
+	for _, month := range months {
+		totals, ok := worked[month.Format("2006-01")]
+		if !ok {
+			totals = data.SavingsHistory[month.Format("2006-01")]
+		}
+		rate := SavingsRate{
+			Month:    month.Format("2006-01"),
+			Income:   totals.Income,
+			Spending: totals.Spending,
+			Saved:    totals.Income - totals.Spending,
+		}
+		if totals.Income > 0 {
+			r := rate.Saved.Float64() / totals.Income.Float64() * 100
+			rate.Rate = &r
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// overallSavingsRate is the savings rate across all of rates' months.
+func overallSavingsRate(rates []SavingsRate) *float64 {
+	var income, saved plaid_cli.Money
+	for _, r := range rates {
+		income += r.Income
+		saved += r.Saved
+	}
+	if income <= 0 {
+		return nil
+	}
+	rate := saved.Float64() / income.Float64() * 100
+	return &rate
+}
+
+func formatRate(rate *float64) string {
+	if rate == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.1f%%", *rate)
+}
+
+func WriteSavingsRates(w io.Writer, rates []SavingsRate, format string) error {
+	switch format {
+	case "json":
+		if rates == nil {
+			rates = []SavingsRate{}
+		}
+		b, err := json.MarshalIndent(rates, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write([]string{"Month", "Income", "Spending", "Saved", "Rate"})
+		if err != nil {
+			return err
+		}
+		for _, r := range rates {
+			rate := ""
+			if r.Rate != nil {
+				rate = fmt.Sprintf("%.1f", *r.Rate)
+			}
+			err = writer.Write([]string{r.Month, fmt.Sprintf("%.2f", r.Income), fmt.Sprintf("%.2f", r.Spending), fmt.Sprintf("%.2f", r.Saved), rate})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "MONTH\tINCOME\tSPENDING\tSAVED\tRATE\t")
+		if err != nil {
+			return err
+		}
+		for _, r := range rates {
+			// A bar of one block per 5% saved shows the trend at a glance.
+			bar := ""
+			if r.Rate != nil && *r.Rate > 0 {
+				bar = strings.Repeat("█", int(*r.Rate/5))
+			}
+			_, err = fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.2f\t%s\t%s\n", r.Month, r.Income, r.Spending, r.Saved, formatRate(r.Rate), bar)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(tw, "Overall\t\t\t\t%s\t\n", formatRate(overallSavingsRate(rates)))
+		if err != nil {
+			return err
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// decimalPattern matches decimal strings such as coordinates in --typed
+// output, and moneyPattern amounts, which have two to eight places.
+const (
+	decimalPattern = `^-?[0-9]+(\.[0-9]+)?$`
+	moneyPattern   = `^-?[0-9]+\.[0-9]{2,8}$`
+)
+
+// SchemaOptions are the flags that change which fields transactions are
+// written with.
+type SchemaOptions struct {
+	// Item adds "item", as when transactions from several institutions are
+	// merged.
+	Item bool
+	// Account adds "account", with --with-account-details.
+	Account bool
+	// Owner adds "owner", when items are tagged with owners.
+	Owner bool
+	// Columns are the extra columns added with --columns.
+	Columns []ExtraColumn
+	// Typed describes --typed output.
+	Typed bool
+}
+
+// annotations returns the names of the annotation fields opts adds, in the
+// order CSV output writes them.
+func (o SchemaOptions) annotations() []string {
+	var names []string
+	if o.Item {
+		names = append(names, "item")
+	}
+	if o.Account {
+		names = append(names, "account")
+	}
+	if o.Owner {
+		names = append(names, "owner")
+	}
+	return names
+}
+
+// schemaFormats are the formats of string fields that aren't free text.
+var schemaFormats = map[string]string{
+	"date":            "date",
+	"authorized_date": "date",
+}
+
+// TransactionSchema returns a JSON Schema describing transactions written in
+// format (json, ndjson or csv) with opts. JSON output is an array of
+// transactions and NDJSON a transaction per line. CSV rows are described as
+// arrays of strings, one per column, in order.
+func TransactionSchema(format string, opts SchemaOptions) (map[string]interface{}, error) {
+	var schema map[string]interface{}
+	switch {
+	case opts.Typed && format == "ndjson":
+		schema = typedObjectSchema(opts)
+		schema["description"] = "Each line of the file is a transaction."
+	case opts.Typed && format == "csv":
+		schema = typedRowSchema(opts)
+	case opts.Typed:
+		return nil, fmt.Errorf("--typed output must be csv or ndjson, not %s", format)
+	case format == "json":
+		schema = map[string]interface{}{
+			"type":  "array",
+			"items": transactionObjectSchema(opts),
+		}
+	case format == "ndjson":
+		schema = transactionObjectSchema(opts)
+		schema["description"] = "Each line of the file is a transaction."
+	case format == "csv":
+		schema = transactionRowSchema(opts)
+	default:
+		return nil, fmt.Errorf("invalid output format: %s", format)
+	}
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = fmt.Sprintf("plaid-cli transactions (%s)", format)
+	if opts.Typed {
+		schema["title"] = fmt.Sprintf("plaid-cli transactions (typed %s)", format)
+	}
+	return schema, nil
+}
+
+// transactionObjectSchema describes a transaction as JSON output writes it:
+// Plaid's fields, plus flat fields for annotations and extra columns.
+func transactionObjectSchema(opts SchemaOptions) map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(plaid_cli.Transaction{}), "")
+
+	annotations := opts.annotations()
+	if len(annotations) == 0 && len(opts.Columns) == 0 {
+		return schema
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	required := schema["required"].([]string)
+	for _, name := range annotations {
+		properties[name] = map[string]interface{}{"type": "string"}
+		required = append(required, name)
+	}
+	for _, column := range opts.Columns {
+		for i, field := range column.Fields {
+			properties[field] = columnSchema(column, i)
+			required = append(required, field)
+		}
+	}
+	schema["required"] = required
+	return schema
+}
+
+func columnSchema(column ExtraColumn, i int) map[string]interface{} {
+	if column.Nullable {
+		return map[string]interface{}{"type": []string{column.Types[i], "null"}}
+	}
+	return map[string]interface{}{"type": column.Types[i]}
+}
+
+// transactionRowSchema describes a CSV row. Every cell is a string: amounts
+// are written with two to eight decimal places, other numbers with six, and
+// missing values as empty cells.
+func transactionRowSchema(opts SchemaOptions) map[string]interface{} {
+	number := map[string]interface{}{"type": "string", "pattern": `^-?[0-9]+\.[0-9]{6}$`}
+	columns := []interface{}{
+		map[string]interface{}{"title": "Date", "type": "string", "format": "date"},
+		map[string]interface{}{"title": "Amount", "type": "string", "pattern": moneyPattern},
+		map[string]interface{}{"title": "Description", "type": "string"},
+	}
+	for _, name := range opts.annotations() {
+		columns = append(columns, map[string]interface{}{"title": strings.ToUpper(name[:1]) + name[1:], "type": "string"})
+	}
+	for _, column := range opts.Columns {
+		for i, header := range column.Headers {
+			cell := map[string]interface{}{"type": "string"}
+			if column.Types[i] == "number" {
+				cell = number
+				if column.Nullable {
+					cell = map[string]interface{}{"type": "string", "pattern": `^(-?[0-9]+\.[0-9]{6})?$`}
+				}
+			}
+			columns = append(columns, withTitle(header, cell))
+		}
+	}
+
+	return map[string]interface{}{
+		"description": "Each CSV row, after the header row, as an array of its cells.",
+		"type":        "array",
+		"prefixItems": columns,
+		"items":       false,
+		"minItems":    len(columns),
+	}
+}
+
+// typedColumns returns the columns of --typed output written with opts.
+func (o SchemaOptions) typedColumns() []typedColumn {
+	var a annotations
+	if o.Item {
+		a.annotateItems(map[string]string{})
+	}
+	if o.Account {
+		a.annotateAccounts(map[string]string{})
+	}
+	if o.Owner {
+		a.annotateOwners(map[string]string{})
+	}
+	a.addColumns(o.Columns)
+	return a.typedColumns()
+}
+
+// typedValueSchema describes the JSON values of a typed column.
+func typedValueSchema(column typedColumn) map[string]interface{} {
+	var schema map[string]interface{}
+	switch column.Type {
+	case "DATE":
+		schema = map[string]interface{}{"type": "string", "format": "date"}
+	case "TIMESTAMPTZ":
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case typedAmountType:
+		schema = map[string]interface{}{"type": "string", "pattern": moneyPattern}
+	case "BOOLEAN":
+		schema = map[string]interface{}{"type": "boolean"}
+	case "DOUBLE":
+		schema = map[string]interface{}{"type": "number"}
+	default:
+		schema = map[string]interface{}{"type": "string"}
+	}
+	if column.Nullable {
+		schema["type"] = []string{schema["type"].(string), "null"}
+	}
+	return schema
+}
+
+// typedObjectSchema describes a line of typed NDJSON. Every column is
+// written, as null if it has no value.
+func typedObjectSchema(opts SchemaOptions) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for _, column := range opts.typedColumns() {
+		properties[column.Name] = withTitle(column.Type, typedValueSchema(column))
+		required = append(required, column.Name)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// typedRowSchema describes a row of typed CSV, titling each cell with its
+// header.
+func typedRowSchema(opts SchemaOptions) map[string]interface{} {
+	var columns []interface{}
+	for _, column := range opts.typedColumns() {
+		columns = append(columns, withTitle(column.Name+":"+column.Type, typedCellSchema(column)))
+	}
+
+	return map[string]interface{}{
+		"description": "Each CSV row, after the header row, as an array of its cells.",
+		"type":        "array",
+		"prefixItems": columns,
+		"items":       false,
+		"minItems":    len(columns),
+	}
+}
+
+// typedCellSchema describes a typed CSV cell. Cells of nullable columns are
+// empty when NULL.
+func typedCellSchema(column typedColumn) map[string]interface{} {
+	var cell map[string]interface{}
+	switch column.Type {
+	case "DATE":
+		cell = map[string]interface{}{"type": "string", "format": "date"}
+	case "TIMESTAMPTZ":
+		cell = map[string]interface{}{"type": "string", "format": "date-time"}
+	case typedAmountType:
+		cell = map[string]interface{}{"type": "string", "pattern": moneyPattern}
+	case "DOUBLE":
+		cell = map[string]interface{}{"type": "string", "pattern": decimalPattern}
+	case "BOOLEAN":
+		cell = map[string]interface{}{"enum": []string{"true", "false"}}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+	if column.Nullable {
+		return map[string]interface{}{"anyOf": []interface{}{cell, map[string]interface{}{"const": ""}}}
+	}
+	return cell
+}
+
+func withTitle(title string, schema map[string]interface{}) map[string]interface{} {
+	titled := map[string]interface{}{"title": title}
+	for k, v := range schema {
+		titled[k] = v
+	}
+	return titled
+}
+
+// typeSchema describes how encoding/json writes values of t. Pointers are
+// nullable, and fields tagged omitempty aren't required.
+func typeSchema(t reflect.Type, name string) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		schema := typeSchema(t.Elem(), name)
+		if types, ok := schema["type"].(string); ok {
+			schema["type"] = []string{types, "null"}
+		}
+		return schema
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		schema := map[string]interface{}{"type": "string"}
+		if format, ok := schemaFormats[name]; ok {
+			schema["format"] = format
+		}
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		// A nil slice is written as null.
+		return map[string]interface{}{
+			"type":  []string{"array", "null"},
+			"items": typeSchema(t.Elem(), ""),
+		}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			fieldName, options, _ := strings.Cut(tag, ",")
+			if fieldName == "" {
+				fieldName = field.Name
+			}
+			property := typeSchema(field.Type, fieldName)
+			if strings.Contains(options, "omitempty") {
+				// Empty slices are omitted rather than written as null.
+				if field.Type.Kind() == reflect.Slice {
+					property["type"] = "array"
+				}
+			} else {
+				required = append(required, fieldName)
+			}
+			properties[fieldName] = property
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// WriteSchema writes schema as indented JSON.
+func WriteSchema(w io.Writer, schema map[string]interface{}) error {
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// Server serves balances and transactions over HTTP in the formats Grafana's
+// SimpleJSON and Infinity datasources expect, so a Grafana instance can chart
+// them directly.
+//
+// SimpleJSON datasources use:
+//
+//	GET  /         health check
+//	POST /search   available targets
+//	POST /query    time series of balances, or a table of transactions
+//
+// Infinity datasources, or anything else that reads JSON, can use:
+//
+//	GET /api/balances?from=2024-01-01&to=2024-06-30
+//	GET /api/transactions?from=2024-01-01&to=2024-06-30
+type Server struct {
+	Client  *ItemClient
+	ItemIDs []string
+	// Token, if set, must be sent as a bearer token with every request.
+	Token string
+	// CacheTTL is how long data fetched from Plaid is reused, since Grafana
+	// refreshes dashboards far more often than bank data changes.
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]snapshot
+}
+
+// snapshot is the data for a period, fetched from Plaid at one time.
+type snapshot struct {
+	fetched      time.Time
+	accounts     []itemAccount
+	transactions []plaid_cli.Transaction
+	accountItems map[string]string
+}
+
+type itemAccount struct {
+	item    string
+	account plaid_cli.Account
+}
+
+const (
+	balancesTarget     = "balances"
+	transactionsTarget = "transactions"
+)
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleHealth)
+	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/query", s.handleQuery)
+	mux.HandleFunc("/api/balances", s.handleAPIBalances)
+	mux.HandleFunc("/api/transactions", s.handleAPITransactions)
+	return s.authenticate(mux)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	to := truncateDay(time.Now())
+	snap, err := s.snapshot(to.AddDate(0, 0, -1))
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+
+	targets := []string{balancesTarget, transactionsTarget}
+	for _, a := range snap.accounts {
+		targets = append(targets, balancesTarget+":"+accountTargetName(a))
+	}
+	writeJSON(w, targets)
+}
+
+// grafanaQuery is the part of a SimpleJSON /query request plaid-cli uses.
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+		Type   string `json:"type"`
+	} `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var query grafanaQuery
+	err := json.NewDecoder(r.Body).Decode(&query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	from := truncateDay(query.Range.From)
+	to := truncateDay(query.Range.To)
+	snap, err := s.snapshot(from)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+
+	var results []interface{}
+	for _, target := range query.Targets {
+		switch {
+		case target.Target == transactionsTarget || target.Type == "table":
+			results = append(results, transactionsTable(snap, from, to))
+		case target.Target == balancesTarget:
+			for _, a := range snap.accounts {
+				results = append(results, balanceSeries(a, snap, from, to))
+			}
+		case strings.HasPrefix(target.Target, balancesTarget+":"):
+			name := strings.TrimPrefix(target.Target, balancesTarget+":")
+			for _, a := range snap.accounts {
+				if accountTargetName(a) == name {
+					results = append(results, balanceSeries(a, snap, from, to))
+				}
+			}
+		}
+	}
+
+	if results == nil {
+		results = []interface{}{}
+	}
+	writeJSON(w, results)
+}
+
+func (s *Server) handleAPIBalances(w http.ResponseWriter, r *http.Request) {
+	from, to, err := apiRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := s.snapshot(from)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+
+	balances := []DailyBalance{}
+	for _, a := range snap.accounts {
+		balances = append(balances, ReconstructBalances(a.item, a.account, snap.transactions, from, to)...)
+	}
+	writeJSON(w, balances)
+}
+
+func (s *Server) handleAPITransactions(w http.ResponseWriter, r *http.Request) {
+	from, to, err := apiRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := s.snapshot(from)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+
+	serializer := &JSONSerializer{}
+	serializer.annotateItems(snap.accountItems)
+	w.Header().Set("Content-Type", "application/json")
+	err = serializer.serialize(w, transactionsBetween(snap.transactions, from, to))
+	if err != nil {
+		log.Printf("Error writing transactions: %v", err)
+	}
+}
+
+// snapshot returns balances and the transactions posted since from, fetching
+// them from Plaid unless a recent enough copy is cached.
+func (s *Server) snapshot(from time.Time) (snapshot, error) {
+	key := from.Format("2006-01-02")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache == nil {
+		s.cache = make(map[string]snapshot)
+	}
+	if snap, ok := s.cache[key]; ok && time.Since(snap.fetched) < s.CacheTTL {
+		return snap, nil
+	}
+
+	data := s.Client.Data
+	ignored := ActiveIgnores(data, false)
+	snap := snapshot{fetched: time.Now(), accountItems: make(map[string]string)}
+	for _, itemID := range s.ItemIDs {
+		var accounts []plaid_cli.Account
+		err := s.Client.Do(itemID, func(token string) error {
+			var err error
+			accounts, err = GetBalances(s.Client.PlaidApiService, token)
+			return err
+		})
+		if err != nil {
+			return snapshot{}, fmt.Errorf("%s: %w", ItemName(data, itemID), err)
+		}
+
+		name := ItemName(data, itemID)
+		for _, account := range FilterAccounts(ignored, accounts) {
+			snap.accounts = append(snap.accounts, itemAccount{item: name, account: account})
+			snap.accountItems[account.AccountID] = name
+		}
+
+		txs, err := ReportTransactions(s.Client, []string{itemID}, from, time.Now(), nil)
+		if err != nil {
+			return snapshot{}, err
+		}
+		snap.transactions = append(snap.transactions, FilterTransactions(ignored, txs)...)
+	}
+
+	sort.Slice(snap.accounts, func(i, j int) bool {
+		return accountTargetName(snap.accounts[i]) < accountTargetName(snap.accounts[j])
+	})
+
+	s.cache[key] = snap
+	return snap, nil
+}
+
+func balanceSeries(a itemAccount, snap snapshot, from time.Time, to time.Time) grafanaSeries {
+	series := grafanaSeries{Target: accountTargetName(a), Datapoints: [][2]float64{}}
+	for _, b := range ReconstructBalances(a.item, a.account, snap.transactions, from, to) {
+		day, _ := time.Parse("2006-01-02", b.Date)
+		series.Datapoints = append(series.Datapoints, [2]float64{b.Balance.Float64(), float64(day.UnixMilli())})
+	}
+	return series
+}
+
+func transactionsTable(snap snapshot, from time.Time, to time.Time) grafanaTable {
+	table := grafanaTable{
+		Type: "table",
+		Columns: []grafanaColumn{
+			{Text: "Time", Type: "time"},
+			{Text: "Item", Type: "string"},
+			{Text: "Description", Type: "string"},
+			{Text: "Category", Type: "string"},
+			{Text: "Amount", Type: "number"},
+		},
+		Rows: [][]interface{}{},
+	}
+
+	for _, tx := range SortTransactions(transactionsBetween(snap.transactions, from, to)) {
+		day, _ := time.Parse("2006-01-02", tx.Date)
+		category := ""
+		if pfc := tx.PersonalFinanceCategory; pfc != nil {
+			category = pfc.Primary
+		}
+		table.Rows = append(table.Rows, []interface{}{day.UnixMilli(), snap.accountItems[tx.AccountID], tx.Name, category, tx.Amount})
+	}
+	return table
+}
+
+func transactionsBetween(txs []plaid_cli.Transaction, from time.Time, to time.Time) []plaid_cli.Transaction {
+	first := from.Format("2006-01-02")
+	last := to.Format("2006-01-02")
+
+	var between []plaid_cli.Transaction
+	for _, tx := range txs {
+		if tx.Date >= first && tx.Date <= last {
+			between = append(between, tx)
+		}
+	}
+	return between
+}
+
+func accountTargetName(a itemAccount) string {
+	return a.item + "/" + AccountLabel(a.account)
+}
+
+// apiRange reads the from and to query parameters, defaulting to the last
+// 30 days.
+func apiRange(r *http.Request) (time.Time, time.Time, error) {
+	to := truncateDay(time.Now())
+	from := to.AddDate(0, 0, -30)
+
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = time.Parse("2006-01-02", v)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from date %q. Use YYYY-MM-DD", v)
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, err = time.Parse("2006-01-02", v)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to date %q. Use YYYY-MM-DD", v)
+		}
+	}
+	return from, to, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+func writeServerError(w http.ResponseWriter, err error) {
+	log.Printf("Error fetching data from Plaid: %v", err)
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
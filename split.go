@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// ParseSplitParts parses AMOUNT=CATEGORY arguments. Categories that name one
+// of Plaid's primary personal finance categories, in any case, are
+// normalized so they group with Plaid's own categorization in reports.
+func ParseSplitParts(args []string) ([]plaid_cli.SplitPart, error) {
+	categories, err := Categories()
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []plaid_cli.SplitPart
+	for _, arg := range args {
+		amountStr, category, ok := strings.Cut(arg, "=")
+		category = strings.TrimSpace(category)
+		if !ok || category == "" {
+			return nil, fmt.Errorf("invalid split %q. Use AMOUNT=CATEGORY, e.g. 40=Groceries", arg)
+		}
+
+		amount, err := plaid_cli.ParseMoney(strings.TrimSpace(amountStr))
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("invalid split amount %q. Amounts must be positive numbers", amountStr)
+		}
+
+		for _, c := range categories {
+			if strings.EqualFold(c.Primary, category) {
+				category = c.Primary
+				break
+			}
+		}
+
+		parts = append(parts, plaid_cli.SplitPart{Amount: amount, Category: category})
+	}
+
+	return parts, nil
+}
+
+// ApplySplits replaces each split transaction with one transaction per part,
+// categorized as the part says. Any amount not covered by the parts stays
+// with the original transaction and category. Splits whose parts add up to
+// more than the transaction are left unapplied with a warning.
+func ApplySplits(splits map[string][]plaid_cli.SplitPart, txs []plaid_cli.Transaction) []plaid_cli.Transaction {
+	if len(splits) == 0 {
+		return txs
+	}
+
+	var applied []plaid_cli.Transaction
+	for _, tx := range txs {
+		parts, ok := splits[tx.TransactionID]
+		if !ok {
+			applied = append(applied, tx)
+			continue
+		}
+
+		var total plaid_cli.Money
+		for _, part := range parts {
+			total += part.Amount
+		}
+
+		// Amounts are compared to the cent.
+		remainder := plaid_cli.MoneyFromFloat(tx.Amount).Abs() - total
+		if remainder.Round(2) < 0 {
+			log.Printf("⚠️  Split parts for transaction %s add up to %.2f, more than its amount of %.2f. Ignoring the split.", tx.TransactionID, total, plaid_cli.MoneyFromFloat(tx.Amount).Abs())
+			applied = append(applied, tx)
+			continue
+		}
+
+		sign := plaid_cli.Money(1)
+		if tx.Amount < 0 {
+			sign = -1
+		}
+
+		for _, part := range parts {
+			split := tx
+			split.Amount = (sign * part.Amount).Float64()
+			split.PersonalFinanceCategory = &plaid_cli.PersonalFinanceCategory{Primary: part.Category, Detailed: part.Category}
+			applied = append(applied, split)
+		}
+
+		if remainder.Round(2) > 0 {
+			rest := tx
+			rest.Amount = (sign * remainder).Float64()
+			applied = append(applied, rest)
+		}
+	}
+
+	return applied
+}
+
+// splitLookback is how far back a transaction being split is looked for.
+// Plaid keeps up to two years of transaction history.
+const splitLookback = 2
+
+// FindTransaction looks for the transaction with ID id among the imported
+// transactions and the last two years of transactions for itemIDs.
+func FindTransaction(client *ItemClient, itemIDs []string, id string, now time.Time, partial *PartialResults) (plaid_cli.Transaction, error) {
+	from := now.AddDate(-splitLookback, 0, 0)
+	txs := ImportedTransactions(client.Data, from, now)
+	for _, tx := range txs {
+		if tx.TransactionID == id {
+			return tx, nil
+		}
+	}
+
+	txs, err := ReportTransactions(client, itemIDs, from, now, partial)
+	if err != nil {
+		return plaid_cli.Transaction{}, err
+	}
+	for _, tx := range txs {
+		if tx.TransactionID == id {
+			return tx, nil
+		}
+	}
+	return plaid_cli.Transaction{}, fmt.Errorf("no transaction with ID %s in the last %d years. Check the ID with `plaid-cli transactions`", id, splitLookback)
+}
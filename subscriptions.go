@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// Subscription is a recurring outgoing payment that still appears to be
+// active.
+type Subscription struct {
+	Merchant    string          `json:"merchant"`
+	AccountID   string          `json:"account_id"`
+	Frequency   string          `json:"frequency"`
+	Amount      plaid_cli.Money `json:"amount"`
+	MonthlyCost plaid_cli.Money `json:"monthly_cost"`
+	LastDate    string          `json:"last_date"`
+	NextDate    string          `json:"next_expected_date"`
+	Source      string          `json:"source"`
+	// Owner is who the account belongs to, for household reports.
+	Owner string `json:"owner,omitempty"`
+}
+
+// GetRecurringOutflows returns the outgoing streams Plaid has detected for an
+// item.
+func GetRecurringOutflows(client *plaid.PlaidApiService, token string) ([]plaid.TransactionStream, error) {
+	req := plaid.NewTransactionsRecurringGetRequest(token)
+	apiReq := client.TransactionsRecurringGet(context.Background())
+	apiReq = apiReq.TransactionsRecurringGetRequest(*req)
+	res, _, err := apiReq.Execute()
+	if err != nil {
+		return nil, err
+	}
+	return res.OutflowStreams, nil
+}
+
+// PlaidSubscriptions converts Plaid's active outflow streams to subscriptions.
+func PlaidSubscriptions(streams []plaid.TransactionStream) []Subscription {
+	var subscriptions []Subscription
+	for _, stream := range streams {
+		if !stream.IsActive || stream.Status == plaid.TRANSACTIONSTREAMSTATUS_TOMBSTONED {
+			continue
+		}
+
+		last, err := time.Parse("2006-01-02", stream.LastDate)
+		if err != nil {
+			continue
+		}
+
+		merchant := stream.GetMerchantName()
+		if merchant == "" {
+			merchant = stream.Description
+		}
+
+		amount := plaid_cli.MoneyFromFloat(stream.LastAmount.GetAmount()).Abs()
+		frequency := string(stream.Frequency)
+		subscriptions = append(subscriptions, newSubscription(merchant, stream.AccountId, frequency, amount, last, "plaid"))
+	}
+	return subscriptions
+}
+
+// DetectSubscriptions looks for outgoing payments to the same merchant from
+// the same account at a regular interval and for a consistent amount.
+func DetectSubscriptions(txs []plaid_cli.Transaction, now time.Time) []Subscription {
+	type key struct{ merchant, account string }
+	groups := make(map[key][]plaid_cli.Transaction)
+	for _, tx := range txs {
+		if tx.Amount <= 0 || tx.Pending {
+			continue
+		}
+		k := key{MerchantName(tx), tx.AccountID}
+		groups[k] = append(groups[k], tx)
+	}
+
+	var subscriptions []Subscription
+	for k, group := range groups {
+		group = SortTransactions(group)
+
+		var dates []time.Time
+		var amounts []plaid_cli.Money
+		for _, tx := range group {
+			date, err := time.Parse("2006-01-02", tx.Date)
+			if err != nil {
+				continue
+			}
+			dates = append(dates, date)
+			amounts = append(amounts, plaid_cli.MoneyFromFloat(tx.Amount))
+		}
+
+		frequency, ok := detectFrequency(dates)
+		if !ok || !consistentAmounts(amounts) {
+			continue
+		}
+
+		last := dates[len(dates)-1]
+		sub := newSubscription(k.merchant, k.account, frequency, amounts[len(amounts)-1], last, "local")
+
+		// A subscription whose next charge is overdue by more than half its
+		// interval has probably been cancelled.
+		next, _ := time.Parse("2006-01-02", sub.NextDate)
+		if now.Sub(next) > time.Duration(frequencyDays(frequency)/2)*24*time.Hour {
+			continue
+		}
+
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return subscriptions
+}
+
+// MergeSubscriptions combines Plaid's streams with locally detected ones,
+// preferring Plaid's data when both found the same subscription.
+func MergeSubscriptions(fromPlaid []Subscription, detected []Subscription) []Subscription {
+	merged := append([]Subscription{}, fromPlaid...)
+
+	index := make(map[string]int, len(merged))
+	for i, s := range merged {
+		index[subscriptionKey(s)] = i
+	}
+
+	for _, s := range detected {
+		if i, ok := index[subscriptionKey(s)]; ok {
+			merged[i].Source = "plaid+local"
+			continue
+		}
+		merged = append(merged, s)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].MonthlyCost != merged[j].MonthlyCost {
+			return merged[i].MonthlyCost > merged[j].MonthlyCost
+		}
+		return merged[i].Merchant < merged[j].Merchant
+	})
+
+	return merged
+}
+
+func subscriptionKey(s Subscription) string {
+	return strings.ToLower(s.Merchant) + " " + s.AccountID
+}
+
+func newSubscription(merchant string, accountID string, frequency string, amount plaid_cli.Money, last time.Time, source string) Subscription {
+	s := Subscription{
+		Merchant:  merchant,
+		AccountID: accountID,
+		Frequency: frequency,
+		Amount:    amount,
+		LastDate:  last.Format("2006-01-02"),
+		Source:    source,
+	}
+
+	switch plaid.RecurringTransactionFrequency(frequency) {
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_WEEKLY:
+		s.MonthlyCost = amount.Mul(52.0 / 12).Round(2)
+		s.NextDate = last.AddDate(0, 0, 7).Format("2006-01-02")
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_BIWEEKLY:
+		s.MonthlyCost = amount.Mul(26.0 / 12).Round(2)
+		s.NextDate = last.AddDate(0, 0, 14).Format("2006-01-02")
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_SEMI_MONTHLY:
+		s.MonthlyCost = amount * 2
+		s.NextDate = last.AddDate(0, 0, 15).Format("2006-01-02")
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_MONTHLY:
+		s.MonthlyCost = amount
+		s.NextDate = last.AddDate(0, 1, 0).Format("2006-01-02")
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_ANNUALLY:
+		s.MonthlyCost = amount.Div(12).Round(2)
+		s.NextDate = last.AddDate(1, 0, 0).Format("2006-01-02")
+	}
+
+	return s
+}
+
+func frequencyDays(frequency string) int {
+	switch plaid.RecurringTransactionFrequency(frequency) {
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_WEEKLY:
+		return 7
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_BIWEEKLY:
+		return 14
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_SEMI_MONTHLY:
+		return 15
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_MONTHLY:
+		return 30
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_ANNUALLY:
+		return 365
+	default:
+		return 0
+	}
+}
+
+// detectFrequency classifies the gaps between dates. Every gap must fall in
+// the same range, and at least three charges are needed except for annual
+// subscriptions.
+func detectFrequency(dates []time.Time) (string, bool) {
+	if len(dates) < 2 {
+		return "", false
+	}
+
+	ranges := []struct {
+		frequency plaid.RecurringTransactionFrequency
+		min, max  int
+	}{
+		{plaid.RECURRINGTRANSACTIONFREQUENCY_WEEKLY, 6, 8},
+		{plaid.RECURRINGTRANSACTIONFREQUENCY_BIWEEKLY, 13, 15},
+		{plaid.RECURRINGTRANSACTIONFREQUENCY_MONTHLY, 27, 33},
+		{plaid.RECURRINGTRANSACTIONFREQUENCY_ANNUALLY, 355, 375},
+	}
+
+	for _, r := range ranges {
+		if len(dates) < 3 && r.frequency != plaid.RECURRINGTRANSACTIONFREQUENCY_ANNUALLY {
+			continue
+		}
+
+		matches := true
+		for i := 1; i < len(dates); i++ {
+			gap := int(dates[i].Sub(dates[i-1]).Hours() / 24)
+			if gap < r.min || gap > r.max {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return string(r.frequency), true
+		}
+	}
+
+	return "", false
+}
+
+// consistentAmounts reports whether every amount is within 20% of the most
+// recent one, which allows for price rises and currency conversion.
+func consistentAmounts(amounts []plaid_cli.Money) bool {
+	last := amounts[len(amounts)-1]
+	for _, amount := range amounts {
+		if (amount - last).Abs() > last.Mul(0.2) {
+			return false
+		}
+	}
+	return true
+}
+
+// LabelSubscriptionOwners sets each subscription's owner from owners, which
+// maps account IDs to who they belong to.
+func LabelSubscriptionOwners(subscriptions []Subscription, owners map[string]string) []Subscription {
+	for i, s := range subscriptions {
+		subscriptions[i].Owner = owners[s.AccountID]
+	}
+	return subscriptions
+}
+
+func WriteSubscriptions(w io.Writer, subscriptions []Subscription, format string, byOwner bool) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(subscriptions, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "csv":
+		writer := csv.NewWriter(w)
+		header := []string{"Merchant", "Account ID", "Frequency", "Amount", "Monthly Cost", "Last Date", "Next Expected Date", "Source"}
+		if byOwner {
+			header = append([]string{"Owner"}, header...)
+		}
+		err := writer.Write(header)
+		if err != nil {
+			return err
+		}
+		for _, s := range subscriptions {
+			record := []string{
+				s.Merchant,
+				s.AccountID,
+				s.Frequency,
+				fmt.Sprintf("%.2f", s.Amount),
+				fmt.Sprintf("%.2f", s.MonthlyCost),
+				s.LastDate,
+				s.NextDate,
+				s.Source,
+			}
+			if byOwner {
+				record = append([]string{s.Owner}, record...)
+			}
+			err = writer.Write(record)
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		header := "MERCHANT\tFREQUENCY\tAMOUNT\tMONTHLY\tLAST\tNEXT\tSOURCE"
+		if byOwner {
+			header = "OWNER\t" + header
+		}
+		_, err := fmt.Fprintln(tw, header)
+		if err != nil {
+			return err
+		}
+		var total plaid_cli.Money
+		for _, s := range subscriptions {
+			total += s.MonthlyCost
+			if byOwner {
+				_, err = fmt.Fprintf(tw, "%s\t", s.Owner)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%s\t%s\t%s\n", s.Merchant, s.Frequency, s.Amount, s.MonthlyCost, s.LastDate, s.NextDate, s.Source)
+			if err != nil {
+				return err
+			}
+		}
+		totalLine := "TOTAL\t\t\t%.2f\t\t\t\n"
+		if byOwner {
+			totalLine = "TOTAL\t\t\t\t%.2f\t\t\t\n"
+		}
+		_, err = fmt.Fprintf(tw, totalLine, total)
+		if err != nil {
+			return err
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+	"github.com/spf13/cobra"
+)
+
+// TransactionRequestOptions are the parts of a transactions request that
+// flags control, so Plaid does the work instead of plaid-cli fetching more
+// than it needs.
+type TransactionRequestOptions struct {
+	AccountIDs []string
+	// PersonalFinanceCategory asks Plaid to categorize each transaction.
+	PersonalFinanceCategory bool
+	// OriginalDescription asks Plaid for the description as the bank sent
+	// it, before Plaid cleaned it up.
+	OriginalDescription bool
+}
+
+// AddTransactionRequestFlags registers the flags that are sent to Plaid with
+// the request.
+func AddTransactionRequestFlags(cmd *cobra.Command, opts *TransactionRequestOptions) {
+	cmd.Flags().StringSliceVarP(&opts.AccountIDs, "account-id", "a", nil, "Fetch transactions for these account IDs only")
+	cmd.Flags().BoolVar(&opts.PersonalFinanceCategory, "with-category", false, "Ask Plaid to categorize each transaction (see --columns category)")
+	cmd.Flags().BoolVar(&opts.OriginalDescription, "with-original-description", false, "Ask Plaid for each transaction's description as the bank sent it (see --columns original_description)")
+}
+
+// Options returns the request options for the first page of transactions.
+func (o TransactionRequestOptions) Options() plaid.TransactionsGetRequestOptions {
+	count := TransactionsPageSize()
+	offset := int32(0)
+	options := plaid.TransactionsGetRequestOptions{
+		Count:  &count,
+		Offset: &offset,
+	}
+	if len(o.AccountIDs) > 0 {
+		options.SetAccountIds(o.AccountIDs)
+	}
+	if o.PersonalFinanceCategory {
+		options.SetIncludePersonalFinanceCategory(true)
+	}
+	if o.OriginalDescription {
+		options.SetIncludeOriginalDescription(true)
+	}
+	return options
+}
+
+// TransactionFilter selects transactions by the payment details banks attach
+// to checks and ACH payments. Empty fields match any transaction.
+type TransactionFilter struct {
+	CheckNumber     string
+	ReferenceNumber string
+	// Party matches the payer or payee, ignoring case.
+	Party string
+}
+
+func AddTransactionFilterFlags(cmd *cobra.Command, filter *TransactionFilter) {
+	cmd.Flags().StringVar(&filter.CheckNumber, "check-number", "", "Only include the check with this number")
+	cmd.Flags().StringVar(&filter.ReferenceNumber, "reference-number", "", "Only include payments with this reference number")
+	cmd.Flags().StringVar(&filter.Party, "party", "", "Only include payments whose payer or payee contains this text")
+}
+
+func (f TransactionFilter) Filter(txs []plaid_cli.Transaction) []plaid_cli.Transaction {
+	if f == (TransactionFilter{}) {
+		return txs
+	}
+
+	var filtered []plaid_cli.Transaction
+	for _, tx := range txs {
+		if f.CheckNumber != "" && plaid_cli.Value(tx.CheckNumber) != f.CheckNumber {
+			continue
+		}
+		if f.ReferenceNumber != "" && plaid_cli.Value(tx.PaymentMeta.ReferenceNumber) != f.ReferenceNumber {
+			continue
+		}
+		if f.Party != "" && !containsFold(plaid_cli.Value(tx.PaymentMeta.Payer), f.Party) && !containsFold(plaid_cli.Value(tx.PaymentMeta.Payee), f.Party) {
+			continue
+		}
+		filtered = append(filtered, tx)
+	}
+	return filtered
+}
+
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/manifoldco/promptui"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// Confirm asks the user to confirm an action. It returns false if the user
+// declines rather than an error.
+func Confirm(label string) (bool, error) {
+	prompt := promptui.Prompt{
+		Label:     label,
+		IsConfirm: true,
+	}
+
+	_, err := prompt.Run()
+	if errors.Is(err, promptui.ErrAbort) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type TransferAuthorizationOptions struct {
+	AccountID string
+	Type      string
+	Network   string
+	Amount    string
+	ACHClass  string
+	LegalName string
+}
+
+func NewTransferAuthorizationRequest(token string, opts TransferAuthorizationOptions) (*plaid.TransferAuthorizationCreateRequest, error) {
+	transferType, err := plaid.NewTransferTypeFromValue(opts.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	network, err := plaid.NewTransferNetworkFromValue(opts.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	user := plaid.NewTransferAuthorizationUserInRequest(opts.LegalName)
+	req := plaid.NewTransferAuthorizationCreateRequest(token, opts.AccountID, *transferType, *network, opts.Amount, *user)
+
+	if opts.ACHClass != "" {
+		achClass, err := plaid.NewACHClassFromValue(opts.ACHClass)
+		if err != nil {
+			return nil, err
+		}
+		req.SetAchClass(*achClass)
+	}
+
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+	req.SetIdempotencyKey(key)
+
+	return req, nil
+}
+
+func CreateTransferAuthorization(client *plaid.PlaidApiService, req *plaid.TransferAuthorizationCreateRequest) (plaid.TransferAuthorization, error) {
+	apiReq := client.TransferAuthorizationCreate(context.Background())
+	apiReq = apiReq.TransferAuthorizationCreateRequest(*req)
+	res, _, err := apiReq.Execute()
+	return res.Authorization, err
+}
+
+func NewTransferCreateRequest(token string, accountID string, authorizationID string, description string) (*plaid.TransferCreateRequest, error) {
+	req := plaid.NewTransferCreateRequest(token, accountID, authorizationID, description)
+
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+	req.SetIdempotencyKey(key)
+
+	return req, nil
+}
+
+func CreateTransfer(client *plaid.PlaidApiService, req *plaid.TransferCreateRequest) (plaid.Transfer, error) {
+	apiReq := client.TransferCreate(context.Background())
+	apiReq = apiReq.TransferCreateRequest(*req)
+	res, _, err := apiReq.Execute()
+	return res.Transfer, err
+}
+
+func ListTransfers(client *plaid.PlaidApiService, count int32) ([]plaid.Transfer, error) {
+	req := plaid.NewTransferListRequest()
+	req.SetCount(count)
+
+	apiReq := client.TransferList(context.Background())
+	apiReq = apiReq.TransferListRequest(*req)
+	res, _, err := apiReq.Execute()
+	return res.Transfers, err
+}
+
+func CancelTransfer(client *plaid.PlaidApiService, req *plaid.TransferCancelRequest) error {
+	apiReq := client.TransferCancel(context.Background())
+	apiReq = apiReq.TransferCancelRequest(*req)
+	_, _, err := apiReq.Execute()
+	return err
+}
+
+// SyncTransferEvents fetches all transfer events after afterID and records
+// the last seen event ID so the next sync only returns new events.
+func SyncTransferEvents(data *plaid_cli.Data, client *plaid.PlaidApiService, afterID int32) ([]plaid.TransferEvent, error) {
+	var events []plaid.TransferEvent
+
+	ctx := context.Background()
+	for {
+		req := plaid.NewTransferEventSyncRequest(afterID)
+		apiReq := client.TransferEventSync(ctx)
+		apiReq = apiReq.TransferEventSyncRequest(*req)
+		res, _, err := apiReq.Execute()
+		if err != nil {
+			return events, err
+		}
+
+		previousID := afterID
+		for _, event := range res.TransferEvents {
+			if event.EventId > afterID {
+				afterID = event.EventId
+			}
+		}
+		events = append(events, res.TransferEvents...)
+
+		if !res.HasMore {
+			break
+		}
+		// Asking again from the same event would get the same page back
+		// forever.
+		if afterID == previousID {
+			err = fmt.Errorf("Plaid reported more transfer events after event %d but returned none newer", afterID)
+			return events, errors.Join(err, saveTransferEventCursor(data, afterID))
+		}
+	}
+
+	return events, saveTransferEventCursor(data, afterID)
+}
+
+func saveTransferEventCursor(data *plaid_cli.Data, afterID int32) error {
+	data.TransferEventCursor = afterID
+	return data.SaveTransferEventCursor()
+}
+
+func describeTransfer(opts TransferAuthorizationOptions) string {
+	return T("Authorize a %s of %s via %s for account %s", opts.Type, opts.Amount, opts.Network, opts.AccountID)
+}
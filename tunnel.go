@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// AddTunnelFlag registers --tunnel on commands that serve something Plaid
+// has to reach.
+func AddTunnelFlag(cmd *cobra.Command, tunnel *string) {
+	cmd.Flags().StringVar(tunnel, "tunnel", "", "Make a public URL with ngrok, cloudflared or auto (whichever is installed)")
+	cmd.Flags().Lookup("tunnel").NoOptDefVal = "auto"
+}
+
+// TunnelProviders are the programs a tunnel can be started with, in the
+// order they're tried.
+var TunnelProviders = []string{"ngrok", "cloudflared"}
+
+// tunnelStartTimeout is how long a tunnel has to report its public URL.
+const tunnelStartTimeout = 30 * time.Second
+
+var cloudflaredURL = regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
+
+// Tunnel is a public HTTPS URL that forwards to a port on this machine, so
+// Plaid can reach a webhook receiver or OAuth redirect running locally.
+type Tunnel struct {
+	URL string
+	cmd *exec.Cmd
+}
+
+// StartTunnel starts a tunnel to localhost:port with provider, ngrok or
+// cloudflared, or whichever is installed if provider is "auto". ngrok uses
+// the reserved domain in tunnel.domain, if set, so the URL stays the same
+// between runs; cloudflared quick tunnels get a new URL each time.
+func StartTunnel(provider string, port string) (*Tunnel, error) {
+	if provider == "auto" {
+		for _, p := range TunnelProviders {
+			if _, err := exec.LookPath(p); err == nil {
+				provider = p
+				break
+			}
+		}
+		if provider == "auto" {
+			return nil, errors.New("neither ngrok nor cloudflared is installed. Install one of them to start a tunnel")
+		}
+	}
+
+	var cmd *exec.Cmd
+	var findURL func(line string) string
+	switch provider {
+	case "ngrok":
+		args := []string{"http", port, "--log", "stdout", "--log-format", "json"}
+		if domain := viper.GetString("tunnel.domain"); domain != "" {
+			args = append(args, "--domain", domain)
+		}
+		cmd = exec.Command("ngrok", args...)
+		findURL = ngrokURL
+	case "cloudflared":
+		cmd = exec.Command("cloudflared", "tunnel", "--no-autoupdate", "--url", "http://localhost:"+port)
+		findURL = func(line string) string { return cloudflaredURL.FindString(line) }
+	default:
+		return nil, fmt.Errorf("unknown tunnel provider %q. Use ngrok, cloudflared or auto", provider)
+	}
+
+	// ngrok logs to stdout as configured above, and cloudflared to stderr.
+	// Both are read for the URL and then drained, so the tunnel never
+	// blocks writing its log. If plaid-cli exits, the tunnel fails its next
+	// write and stops too.
+	r, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", provider, err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		w.CloseWithError(io.EOF)
+		exited <- err
+	}()
+
+	urls := make(chan string, 1)
+	// output is what was logged before the URL, for when there isn't one.
+	output := make(chan string, 1)
+	go func() {
+		var logged strings.Builder
+		scanner := bufio.NewScanner(r)
+		found := false
+		for scanner.Scan() {
+			if found {
+				continue
+			}
+			if url := findURL(scanner.Text()); url != "" {
+				found = true
+				urls <- url
+				continue
+			}
+			if logged.Len() < 2048 {
+				logged.WriteString(scanner.Text() + "\n")
+			}
+		}
+		output <- strings.TrimSpace(logged.String())
+		io.Copy(io.Discard, r)
+	}()
+
+	select {
+	case url := <-urls:
+		return &Tunnel{URL: url, cmd: cmd}, nil
+	case err := <-exited:
+		return nil, fmt.Errorf("%s exited before the tunnel started (%v): %s", provider, err, <-output)
+	case <-time.After(tunnelStartTimeout):
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("%s didn't start a tunnel within %s", provider, tunnelStartTimeout)
+	}
+}
+
+// ngrokURL returns the public URL from ngrok's "started tunnel" log line.
+func ngrokURL(line string) string {
+	var entry struct {
+		Msg string `json:"msg"`
+		URL string `json:"url"`
+	}
+	err := json.Unmarshal([]byte(line), &entry)
+	if err != nil || entry.Msg != "started tunnel" || !strings.HasPrefix(entry.URL, "https://") {
+		return ""
+	}
+	return entry.URL
+}
+
+// Close stops the tunnel.
+func (t *Tunnel) Close() error {
+	return t.cmd.Process.Kill()
+}
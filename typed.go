@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/cobra"
+)
+
+// Typed output is flat records with a fixed set of columns, each with a SQL
+// type, for loading into DuckDB or Pandas without guessing. Dates are ISO
+// 8601 and amounts are decimal strings, never floats.
+
+// typedColumn is a column of typed output.
+type typedColumn struct {
+	Name string
+	// Type is the column's DuckDB type.
+	Type     string
+	Nullable bool
+	// Value returns the column's value for tx: a string, bool, float64 or
+	// nil.
+	Value func(tx plaid_cli.Transaction) interface{}
+}
+
+// typedAmountType is wide enough for the amounts Plaid returns, including
+// cryptocurrencies' eight decimal places.
+const typedAmountType = "DECIMAL(28,8)"
+
+var typedTransactionColumns = []typedColumn{
+	{"transaction_id", "VARCHAR", false, func(tx plaid_cli.Transaction) interface{} {
+		return tx.TransactionID
+	}},
+	{"account_id", "VARCHAR", false, func(tx plaid_cli.Transaction) interface{} {
+		return tx.AccountID
+	}},
+	{"date", "DATE", false, func(tx plaid_cli.Transaction) interface{} {
+		return tx.Date
+	}},
+	{"authorized_date", "DATE", true, func(tx plaid_cli.Transaction) interface{} {
+		return nullableValue(tx.AuthorizedDate)
+	}},
+	{"datetime", "TIMESTAMPTZ", true, func(tx plaid_cli.Transaction) interface{} {
+		if tx.Datetime == nil {
+			return nil
+		}
+		return tx.Datetime.Format(time.RFC3339)
+	}},
+	{"amount", typedAmountType, false, func(tx plaid_cli.Transaction) interface{} {
+		return plaid_cli.MoneyFromFloat(tx.Amount).String()
+	}},
+	{"currency", "VARCHAR", true, func(tx plaid_cli.Transaction) interface{} {
+		if tx.ISOCurrencyCode != nil {
+			return *tx.ISOCurrencyCode
+		}
+		return nullableValue(tx.UnofficialCurrencyCode)
+	}},
+	{"description", "VARCHAR", false, func(tx plaid_cli.Transaction) interface{} {
+		return tx.Name
+	}},
+	{"merchant_name", "VARCHAR", true, func(tx plaid_cli.Transaction) interface{} {
+		return nullableValue(tx.MerchantName)
+	}},
+	{"pending", "BOOLEAN", false, func(tx plaid_cli.Transaction) interface{} {
+		return tx.Pending
+	}},
+}
+
+// typedColumns returns the columns of typed output: the fixed transaction
+// columns, then annotations and extra columns in the order CSV output adds
+// them.
+func (a *annotations) typedColumns() []typedColumn {
+	columns := append([]typedColumn{}, typedTransactionColumns...)
+	annotation := func(name string, values map[string]string) {
+		if values == nil {
+			return
+		}
+		columns = append(columns, typedColumn{name, "VARCHAR", false, func(tx plaid_cli.Transaction) interface{} {
+			return values[tx.AccountID]
+		}})
+	}
+	annotation("item", a.accountItems)
+	annotation("account", a.accountLabels)
+	annotation("owner", a.accountOwners)
+
+	for _, extra := range a.columns {
+		for i, field := range extra.Fields {
+			columnType := "VARCHAR"
+			if extra.Types[i] == "number" {
+				columnType = "DOUBLE"
+			}
+			columns = append(columns, typedColumn{field, columnType, extra.Nullable, func(tx plaid_cli.Transaction) interface{} {
+				return extra.Values(tx)[i]
+			}})
+		}
+	}
+	return columns
+}
+
+func typedCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// TypedCSVSerializer writes typed CSV. Each header is the column's name and
+// type, separated by a colon, e.g. amount:DECIMAL(28,8). Empty cells are
+// NULL.
+type TypedCSVSerializer struct {
+	annotations
+	// NoHeader omits the header row, e.g. when appending to an existing
+	// export.
+	NoHeader bool
+}
+
+func (s *TypedCSVSerializer) serialize(w io.Writer, txs []plaid_cli.Transaction) error {
+	columns := s.typedColumns()
+	writer := csv.NewWriter(w)
+	if !s.NoHeader {
+		var header []string
+		for _, column := range columns {
+			header = append(header, column.Name+":"+column.Type)
+		}
+		err := writer.Write(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tx := range SortTransactions(txs) {
+		var record []string
+		for _, column := range columns {
+			record = append(record, typedCell(column.Value(tx)))
+		}
+		err := writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// TypedNDJSONSerializer writes typed NDJSON. Every line has every column,
+// with null for missing values, so loaders see the same fields on each line.
+type TypedNDJSONSerializer struct {
+	annotations
+}
+
+func (s *TypedNDJSONSerializer) serialize(w io.Writer, txs []plaid_cli.Transaction) error {
+	columns := s.typedColumns()
+	encoder := json.NewEncoder(w)
+	for _, tx := range SortTransactions(txs) {
+		record := make(map[string]interface{}, len(columns))
+		for _, column := range columns {
+			record[column.Name] = column.Value(tx)
+		}
+		err := encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewTypedTransactionSerializer(t string) (TransactionSerializer, error) {
+	switch t {
+	case "csv":
+		return &TypedCSVSerializer{}, nil
+	case "ndjson":
+		return &TypedNDJSONSerializer{}, nil
+	default:
+		return nil, fmt.Errorf("--typed output must be csv or ndjson, not %s", t)
+	}
+}
+
+// AddTypedFlag registers --typed on commands that write transactions.
+func AddTypedFlag(cmd *cobra.Command, typed *bool) {
+	cmd.Flags().BoolVar(typed, "typed", false, "Write flat CSV or NDJSON with typed headers, ISO 8601 dates and decimal amounts, for DuckDB or Pandas")
+}
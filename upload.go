@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// objectWriter streams an export to object storage. The object only becomes
+// visible once Commit succeeds.
+type objectWriter interface {
+	io.Writer
+	Commit() error
+	Abort(err error)
+}
+
+func isObjectStoragePath(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// newObjectWriter opens a writer for an s3:// or gs:// URL using credentials
+// from the provider's standard credential chain.
+func newObjectWriter(ctx context.Context, path string) (objectWriter, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := u.Host
+	key := strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid object storage path %s: expected %s://bucket/key", path, u.Scheme)
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return newS3Writer(ctx, bucket, key)
+	case "gs":
+		return newGCSWriter(ctx, bucket, key)
+	default:
+		return nil, fmt.Errorf("unsupported object storage scheme: %s", u.Scheme)
+	}
+}
+
+type s3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func newS3Writer(ctx context.Context, bucket string, key string) (*s3Writer, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uploader := manager.NewUploader(s3.NewFromConfig(cfg))
+
+	pr, pw := io.Pipe()
+	w := &s3Writer{pw: pw, done: make(chan error, 1)}
+
+	go func() {
+		_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   pr,
+		})
+		_ = pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *s3Writer) Commit() error {
+	err := w.pw.Close()
+	if err != nil {
+		return err
+	}
+	return <-w.done
+}
+
+func (w *s3Writer) Abort(err error) {
+	_ = w.pw.CloseWithError(err)
+	<-w.done
+}
+
+type gcsWriter struct {
+	client *storage.Client
+	w      *storage.Writer
+	cancel context.CancelFunc
+}
+
+func newGCSWriter(ctx context.Context, bucket string, key string) (*gcsWriter, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := client.Bucket(bucket).Object(key).NewWriter(ctx)
+
+	return &gcsWriter{client: client, w: w, cancel: cancel}, nil
+}
+
+func (w *gcsWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+func (w *gcsWriter) Commit() error {
+	defer w.cancel()
+	err := w.w.Close()
+	if err != nil {
+		_ = w.client.Close()
+		return err
+	}
+	return w.client.Close()
+}
+
+func (w *gcsWriter) Abort(err error) {
+	// Cancelling the context before closing discards the upload.
+	w.cancel()
+	_ = w.w.Close()
+	_ = w.client.Close()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set at build time with -ldflags "-X main.version=... -X main.commit=...
+// -X main.date=...", which goreleaser does by default.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+const releasesURL = "https://api.github.com/repos/landakram/plaid-cli/releases/latest"
+
+// VersionInfo describes this build of plaid-cli.
+type VersionInfo struct {
+	Version        string `json:"version"`
+	Commit         string `json:"commit,omitempty"`
+	Date           string `json:"date,omitempty"`
+	GoVersion      string `json:"go_version"`
+	PlaidGoVersion string `json:"plaid_go_version,omitempty"`
+	// PlaidAPIVersion is the Plaid-Version requests are sent with.
+	PlaidAPIVersion string `json:"plaid_api_version"`
+}
+
+// BuildVersionInfo combines the ldflags set at release time with the module
+// and VCS information Go embeds in every build, so builds made with plain
+// `go build` or `go install` still report something useful.
+func BuildVersionInfo() VersionInfo {
+	info := VersionInfo{
+		Version:         version,
+		Commit:          commit,
+		Date:            date,
+		GoVersion:       runtime.Version(),
+		PlaidAPIVersion: PlaidAPIVersion(),
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	if info.Version == "dev" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+		info.Version = buildInfo.Main.Version
+	}
+
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = setting.Value
+			}
+		}
+	}
+
+	for _, dep := range buildInfo.Deps {
+		if dep.Path == "github.com/plaid/plaid-go/v26" {
+			info.PlaidGoVersion = dep.Version
+		}
+	}
+
+	return info
+}
+
+func WriteVersionInfo(w io.Writer, info VersionInfo) error {
+	_, err := fmt.Fprintf(w, "plaid-cli %s\n", info.Version)
+	if err != nil {
+		return err
+	}
+	if info.Commit != "" {
+		fmt.Fprintf(w, "  commit:   %s\n", info.Commit)
+	}
+	if info.Date != "" {
+		fmt.Fprintf(w, "  built:    %s\n", info.Date)
+	}
+	fmt.Fprintf(w, "  go:       %s\n", info.GoVersion)
+	if info.PlaidGoVersion != "" {
+		fmt.Fprintf(w, "  plaid-go: %s\n", info.PlaidGoVersion)
+	}
+	fmt.Fprintf(w, "  api:      %s\n", info.PlaidAPIVersion)
+	return nil
+}
+
+// LatestRelease returns the tag and URL of the latest plaid-cli release on
+// GitHub.
+func LatestRelease() (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releasesURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("checking for updates: GitHub returned %s", res.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&release)
+	if err != nil {
+		return "", "", err
+	}
+
+	return release.TagName, release.HTMLURL, nil
+}
+
+// newerVersion reports whether latest is a newer release than current. Both
+// must be plain vMAJOR.MINOR.PATCH releases; development builds and
+// pre-releases are never considered out of date.
+func newerVersion(current string, latest string) bool {
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+
+	for i := range c {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	var parsed [3]int
+
+	if strings.ContainsAny(v, "-+") {
+		return parsed, false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(parts) != 3 {
+		return parsed, false
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+
+	return parsed, true
+}
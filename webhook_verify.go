@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// webhookVerificationHeader is the header Plaid sends a webhook's signature
+// in, as a JWT.
+const webhookVerificationHeader = "Plaid-Verification"
+
+const (
+	// WebhookMaxAge is how long after it's signed a webhook is accepted, as
+	// Plaid recommends.
+	WebhookMaxAge = 5 * time.Minute
+	// webhookClockSkew is how far this machine's clock can be from Plaid's.
+	webhookClockSkew = time.Minute
+	// webhookKeyRefresh is how often a cached key is fetched again, to find
+	// out whether Plaid has expired it.
+	webhookKeyRefresh = 24 * time.Hour
+)
+
+// WebhookVerificationError means a webhook wasn't signed by Plaid, or not
+// recently enough.
+type WebhookVerificationError struct {
+	msg string
+}
+
+func (e WebhookVerificationError) Error() string {
+	return e.msg
+}
+
+func verificationErrorf(format string, args ...interface{}) error {
+	return WebhookVerificationError{msg: fmt.Sprintf(format, args...)}
+}
+
+// WebhookVerifier checks webhooks' signatures against Plaid's keys. Keys are
+// cached by key ID, so a key is fetched when Plaid starts signing with it,
+// and fetched again daily to find out when Plaid expires it.
+type WebhookVerifier struct {
+	Client *plaid.PlaidApiService
+	Data   *plaid_cli.Data
+	// Offline verifies with cached keys only.
+	Offline bool
+
+	mu sync.Mutex
+}
+
+// Verify checks that token, the JWT from a webhook's Plaid-Verification
+// header, was signed by Plaid for body, with a key that hadn't expired. If
+// maxAge is set, the webhook must also have been signed within maxAge of
+// now, allowing for clock skew.
+func (v *WebhookVerifier) Verify(body []byte, token string, now time.Time, maxAge time.Duration) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return verificationErrorf("the %s header isn't a JWT", webhookVerificationHeader)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeJWTPart(parts[0], &header)
+	if err != nil {
+		return err
+	}
+	// Checking the algorithm stops a forged JWT from choosing a weaker
+	// one, or none.
+	if header.Alg != "ES256" {
+		return verificationErrorf("the webhook is signed with %q rather than ES256", header.Alg)
+	}
+
+	key, err := v.key(header.Kid, now)
+	if err != nil {
+		return err
+	}
+	publicKey, err := webhookPublicKey(key)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return verificationErrorf("the webhook's signature is malformed")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(publicKey, digest[:], r, s) {
+		return verificationErrorf("the webhook's signature doesn't match Plaid's key %s", header.Kid)
+	}
+
+	var claims struct {
+		IssuedAt          int64  `json:"iat"`
+		RequestBodySHA256 string `json:"request_body_sha256"`
+	}
+	err = decodeJWTPart(parts[1], &claims)
+	if err != nil {
+		return err
+	}
+	issued := time.Unix(claims.IssuedAt, 0)
+	if key.ExpiredAt != nil && issued.After(*key.ExpiredAt) {
+		return verificationErrorf("the webhook was signed at %s with key %s, which Plaid expired at %s", issued.Format(time.RFC3339), header.Kid, key.ExpiredAt.Format(time.RFC3339))
+	}
+	if maxAge > 0 {
+		if issued.After(now.Add(webhookClockSkew)) {
+			return verificationErrorf("the webhook was signed in the future, at %s. Check this machine's clock", issued.Format(time.RFC3339))
+		}
+		if now.Sub(issued) > maxAge+webhookClockSkew {
+			return verificationErrorf("the webhook was signed at %s, more than %s ago", issued.Format(time.RFC3339), maxAge)
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(claims.RequestBodySHA256)) != 1 {
+		return verificationErrorf("the webhook's body isn't the one Plaid signed")
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return verificationErrorf("the %s header isn't a JWT: %v", webhookVerificationHeader, err)
+	}
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return verificationErrorf("the %s header isn't a JWT: %v", webhookVerificationHeader, err)
+	}
+	return nil
+}
+
+// key returns the key with ID kid, from the cache if it's there and was
+// fetched recently.
+func (v *WebhookVerifier) key(kid string, now time.Time) (plaid_cli.WebhookKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	cached, ok := v.Data.WebhookKeys[kid]
+	if ok && (v.Offline || cached.ExpiredAt != nil || now.Sub(cached.FetchedAt) < webhookKeyRefresh) {
+		return cached, nil
+	}
+	if v.Offline {
+		return cached, fmt.Errorf("Plaid's key %s isn't cached. Verify without --offline to fetch it", kid)
+	}
+
+	req := plaid.NewWebhookVerificationKeyGetRequest(kid)
+	res, _, err := v.Client.WebhookVerificationKeyGet(context.Background()).WebhookVerificationKeyGetRequest(*req).Execute()
+	if err != nil {
+		if pe, isPlaidErr := AsPlaidError(err); isPlaidErr && pe.ErrorType == "INVALID_INPUT" {
+			return cached, verificationErrorf("Plaid has no key %s: %s", kid, pe.ErrorMessage)
+		}
+		if ok {
+			log.Printf("⚠️  Failed to refresh Plaid's webhook key %s, so the cached one is used: %v", kid, NormalizeError(err))
+			return cached, nil
+		}
+		return cached, fmt.Errorf("failed to fetch Plaid's webhook key %s: %w", kid, err)
+	}
+
+	key := plaid_cli.WebhookKey{
+		X:         res.Key.X,
+		Y:         res.Key.Y,
+		CreatedAt: time.Unix(int64(res.Key.CreatedAt), 0).UTC(),
+		FetchedAt: now.UTC(),
+	}
+	if expired := res.Key.ExpiredAt.Get(); expired != nil {
+		expiredAt := time.Unix(int64(*expired), 0).UTC()
+		key.ExpiredAt = &expiredAt
+	}
+	if res.Key.Kty != "EC" || res.Key.Crv != "P-256" {
+		return key, fmt.Errorf("Plaid's key %s is a %s %s key, not a P-256 one", kid, res.Key.Kty, res.Key.Crv)
+	}
+
+	v.Data.WebhookKeys[kid] = key
+	return key, v.Data.SaveWebhookKeys()
+}
+
+func webhookPublicKey(key plaid_cli.WebhookKey) (*ecdsa.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(key.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+		return nil, fmt.Errorf("Plaid's key isn't a valid P-256 key")
+	}
+	return publicKey, nil
+}
+
+// CapturedWebhook reads a webhook saved to a file: either one stored by
+// `webhooks listen`, with its signature, or just its body, whose signature
+// is then token.
+func CapturedWebhook(b []byte, token string) ([]byte, string) {
+	var stored Webhook
+	err := json.Unmarshal(b, &stored)
+	if err == nil && stored.Body != "" && stored.Verification != "" {
+		if token == "" {
+			token = stored.Verification
+		}
+		return []byte(stored.Body), token
+	}
+	return b, token
+}
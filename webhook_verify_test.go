@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/fakeplaid"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+// signWebhook returns a Plaid-Verification JWT for body, signed with key at
+// issued.
+func signWebhook(t *testing.T, key *ecdsa.PrivateKey, alg string, kid string, issued time.Time, body []byte) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	sum := sha256.Sum256(body)
+	signed := encode(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." +
+		encode(map[string]interface{}{"iat": issued.Unix(), "request_body_sha256": hex.EncodeToString(sum[:])})
+
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func generateWebhookKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newTestWebhookVerifier returns a verifier with an empty key cache that
+// fetches keys from fake.
+func newTestWebhookVerifier(t *testing.T, fake *fakeplaid.Server) *WebhookVerifier {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	conf := plaid.NewConfiguration()
+	conf.AddDefaultHeader("PLAID-CLIENT-ID", "client")
+	conf.AddDefaultHeader("PLAID-SECRET", "secret")
+	conf.Servers = plaid.ServerConfigurations{{URL: server.URL}}
+
+	data, err := plaid_cli.LoadData(t.TempDir(), "sandbox", filepath.Join(t.TempDir(), "tokens.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &WebhookVerifier{Client: plaid.NewAPIClient(conf).PlaidApi, Data: data}
+}
+
+func TestWebhookVerifierVerify(t *testing.T) {
+	now := fakeplaid.Updated
+	body := []byte(`{"webhook_type":"TRANSACTIONS","webhook_code":"SYNC_UPDATES_AVAILABLE","item_id":"item-fake"}`)
+
+	current := generateWebhookKey(t)
+	expired := generateWebhookKey(t)
+	forger := generateWebhookKey(t)
+	expiredAt := int32(now.Add(-time.Hour).Unix())
+
+	fake := fakeplaid.New()
+	fake.WebhookKeys["current"] = fakeplaid.WebhookKey("current", &current.PublicKey, now.AddDate(0, -1, 0))
+	expiredKey := fakeplaid.WebhookKey("expired", &expired.PublicKey, now.AddDate(0, -2, 0))
+	expiredKey.ExpiredAt = *plaid.NewNullableInt32(&expiredAt)
+	fake.WebhookKeys["expired"] = expiredKey
+
+	tests := []struct {
+		name    string
+		token   string
+		body    []byte
+		maxAge  time.Duration
+		offline bool
+		// wantErr is part of the error Verify should return, or empty if
+		// the webhook should be accepted.
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			token:  signWebhook(t, current, "ES256", "current", now, body),
+			maxAge: WebhookMaxAge,
+		},
+		{
+			name:    "not a JWT",
+			token:   "not-a-jwt",
+			wantErr: "isn't a JWT",
+		},
+		{
+			name:    "wrong alg",
+			token:   signWebhook(t, current, "HS256", "current", now, body),
+			wantErr: `signed with "HS256" rather than ES256`,
+		},
+		{
+			name:    "alg none",
+			token:   signWebhook(t, current, "none", "current", now, body),
+			wantErr: `signed with "none" rather than ES256`,
+		},
+		{
+			name:    "signed with another key",
+			token:   signWebhook(t, forger, "ES256", "current", now, body),
+			wantErr: "signature doesn't match Plaid's key current",
+		},
+		{
+			name:    "malformed signature",
+			token:   signWebhook(t, current, "ES256", "current", now, body) + "!",
+			wantErr: "signature is malformed",
+		},
+		{
+			name:    "body hash mismatch",
+			token:   signWebhook(t, current, "ES256", "current", now, body),
+			body:    []byte(`{"webhook_type":"TRANSFER","webhook_code":"TRANSFER_EVENTS_UPDATE"}`),
+			wantErr: "body isn't the one Plaid signed",
+		},
+		{
+			name:    "unknown kid",
+			token:   signWebhook(t, current, "ES256", "unknown", now, body),
+			wantErr: "Plaid has no key unknown",
+		},
+		{
+			name:    "expired kid",
+			token:   signWebhook(t, expired, "ES256", "expired", now, body),
+			wantErr: "which Plaid expired at",
+		},
+		{
+			name:  "signed before its kid expired",
+			token: signWebhook(t, expired, "ES256", "expired", now.Add(-2*time.Hour), body),
+		},
+		{
+			name:   "within clock skew in the future",
+			token:  signWebhook(t, current, "ES256", "current", now.Add(webhookClockSkew/2), body),
+			maxAge: WebhookMaxAge,
+		},
+		{
+			name:    "beyond clock skew in the future",
+			token:   signWebhook(t, current, "ES256", "current", now.Add(2*webhookClockSkew), body),
+			maxAge:  WebhookMaxAge,
+			wantErr: "signed in the future",
+		},
+		{
+			name:   "older than max age within clock skew",
+			token:  signWebhook(t, current, "ES256", "current", now.Add(-WebhookMaxAge-webhookClockSkew/2), body),
+			maxAge: WebhookMaxAge,
+		},
+		{
+			name:    "older than max age",
+			token:   signWebhook(t, current, "ES256", "current", now.Add(-WebhookMaxAge-2*webhookClockSkew), body),
+			maxAge:  WebhookMaxAge,
+			wantErr: "more than 5m0s ago",
+		},
+		{
+			name:  "no max age",
+			token: signWebhook(t, current, "ES256", "current", now.AddDate(0, 0, -7), body),
+		},
+		{
+			name:    "offline cache miss",
+			token:   signWebhook(t, current, "ES256", "current", now, body),
+			offline: true,
+			wantErr: "key current isn't cached",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier := newTestWebhookVerifier(t, fake)
+			verifier.Offline = test.offline
+			webhookBody := body
+			if test.body != nil {
+				webhookBody = test.body
+			}
+
+			err := verifier.Verify(webhookBody, test.token, now, test.maxAge)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got error %v, want the webhook accepted", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("the webhook was accepted, want an error containing %q", test.wantErr)
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %q, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookVerifierKeyCache(t *testing.T) {
+	now := fakeplaid.Updated
+	body := []byte(`{"webhook_type":"ITEM","webhook_code":"WEBHOOK_UPDATE_ACKNOWLEDGED"}`)
+	key := generateWebhookKey(t)
+	served := fakeplaid.WebhookKey("rotated", &key.PublicKey, now.AddDate(0, -1, 0))
+	expiredAt := int32(now.Add(-time.Hour).Unix())
+	served.ExpiredAt = *plaid.NewNullableInt32(&expiredAt)
+	fake := fakeplaid.New()
+	fake.WebhookKeys["rotated"] = served
+
+	t.Run("fetched keys are cached for offline use", func(t *testing.T) {
+		verifier := newTestWebhookVerifier(t, fake)
+		token := signWebhook(t, key, "ES256", "rotated", now.Add(-2*time.Hour), body)
+		err := verifier.Verify(body, token, now, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := verifier.Data.WebhookKeys["rotated"]; !ok {
+			t.Fatal("the fetched key wasn't cached")
+		}
+
+		verifier.Offline = true
+		err = verifier.Verify(body, token, now, 0)
+		if err != nil {
+			t.Errorf("verifying offline with the cached key: %v", err)
+		}
+	})
+
+	t.Run("a day-old key is fetched again to find out it expired", func(t *testing.T) {
+		verifier := newTestWebhookVerifier(t, fake)
+		// The cached copy predates Plaid expiring the key.
+		cached := plaid_cli.WebhookKey{X: served.X, Y: served.Y, CreatedAt: now.AddDate(0, -1, 0), FetchedAt: now.Add(-webhookKeyRefresh - time.Hour)}
+		verifier.Data.WebhookKeys["rotated"] = cached
+
+		token := signWebhook(t, key, "ES256", "rotated", now, body)
+		err := verifier.Verify(body, token, now, 0)
+		if err == nil || !strings.Contains(err.Error(), "which Plaid expired at") {
+			t.Errorf("got error %v, want the key reported expired", err)
+		}
+	})
+
+	t.Run("a recently fetched key isn't fetched again", func(t *testing.T) {
+		verifier := newTestWebhookVerifier(t, fake)
+		cached := plaid_cli.WebhookKey{X: served.X, Y: served.Y, CreatedAt: now.AddDate(0, -1, 0), FetchedAt: now.Add(-time.Hour)}
+		verifier.Data.WebhookKeys["rotated"] = cached
+
+		token := signWebhook(t, key, "ES256", "rotated", now, body)
+		err := verifier.Verify(body, token, now, 0)
+		if err != nil {
+			t.Errorf("got error %v, want the cached key used", err)
+		}
+	})
+}
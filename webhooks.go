@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v26/plaid"
+)
+
+const (
+	// WebhookReceived webhooks haven't been handed to a hook, either because
+	// none is configured or because it hasn't run yet.
+	WebhookReceived = "received"
+	WebhookHandled  = "handled"
+	// WebhookFailed webhooks are dead letters: their hook failed, and they're
+	// kept for `webhooks replay`.
+	WebhookFailed = "failed"
+)
+
+// webhookHookTimeout is how long a hook can take to handle a webhook.
+const webhookHookTimeout = 5 * time.Minute
+
+// Webhook is a webhook received from Plaid.
+type Webhook struct {
+	ID         string    `json:"id"`
+	ReceivedAt time.Time `json:"received_at"`
+	Type       string    `json:"webhook_type"`
+	Code       string    `json:"webhook_code"`
+	Item       string    `json:"item_id,omitempty"`
+	// Body is the webhook exactly as Plaid sent it.
+	Body string `json:"body"`
+	// Verification is the JWT Plaid signed the webhook with, from its
+	// Plaid-Verification header.
+	Verification string `json:"verification,omitempty"`
+	Status       string `json:"status"`
+	Attempts     int    `json:"attempts"`
+	// Error is why the hook last failed.
+	Error string `json:"error,omitempty"`
+}
+
+// WebhookStore keeps every webhook received, one JSON file each, so none is
+// lost if it couldn't be handled when it arrived.
+type WebhookStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+// Receive stores a webhook Plaid sent, and the JWT it was signed with,
+// before anything else is done with it.
+func (s *WebhookStore) Receive(body []byte, verification string, now time.Time) (Webhook, error) {
+	var fields struct {
+		Type   string `json:"webhook_type"`
+		Code   string `json:"webhook_code"`
+		ItemID string `json:"item_id"`
+	}
+	err := json.Unmarshal(body, &fields)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("invalid webhook: %w", err)
+	}
+
+	id, err := newWebhookID(now)
+	if err != nil {
+		return Webhook{}, err
+	}
+	webhook := Webhook{
+		ID:           id,
+		ReceivedAt:   now.UTC(),
+		Type:         fields.Type,
+		Code:         fields.Code,
+		Item:         fields.ItemID,
+		Body:         string(body),
+		Verification: verification,
+		Status:       WebhookReceived,
+	}
+	return webhook, s.Save(webhook)
+}
+
+// newWebhookID returns an ID that sorts in the order webhooks arrived.
+func newWebhookID(now time.Time) (string, error) {
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return now.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b), nil
+}
+
+func (s *WebhookStore) path(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+func (s *WebhookStore) Save(webhook Webhook) error {
+	b, err := json.MarshalIndent(webhook, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(webhook.ID) + ".tmp"
+	err = os.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(webhook.ID))
+}
+
+func (s *WebhookStore) Get(id string) (Webhook, error) {
+	var webhook Webhook
+	if strings.ContainsAny(id, `/\`) {
+		return webhook, fmt.Errorf("invalid webhook ID %q", id)
+	}
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return webhook, fmt.Errorf("no webhook with ID %s. Run `plaid-cli webhooks list` to see the webhooks received", id)
+	}
+	if err != nil {
+		return webhook, err
+	}
+	err = json.Unmarshal(b, &webhook)
+	if err != nil {
+		return webhook, fmt.Errorf("%s: %w", s.path(id), err)
+	}
+	return webhook, nil
+}
+
+// List returns the webhooks received, oldest first.
+func (s *WebhookStore) List() ([]Webhook, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []Webhook
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		webhook, err := s.Get(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+// DeadLetters returns the webhooks whose hook failed, oldest first, along
+// with those still marked received longer than a hook can take before now:
+// plaid-cli stopped before handing them to a hook, or while it ran.
+func (s *WebhookStore) DeadLetters(now time.Time) ([]Webhook, error) {
+	webhooks, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	return keep(webhooks, func(webhook Webhook) bool {
+		stale := webhook.Status == WebhookReceived && now.Sub(webhook.ReceivedAt) > webhookHookTimeout
+		return webhook.Status == WebhookFailed || stale
+	}), nil
+}
+
+// Deliver runs hook for webhook and records how it went, keeping the webhook
+// as a dead letter if the hook fails.
+func (s *WebhookStore) Deliver(webhook Webhook, hook string) error {
+	webhook.Attempts++
+	err := RunWebhookHook(hook, webhook)
+	if err != nil {
+		webhook.Status = WebhookFailed
+		webhook.Error = err.Error()
+	} else {
+		webhook.Status = WebhookHandled
+		webhook.Error = ""
+	}
+	return errors.Join(err, s.Save(webhook))
+}
+
+// RunWebhookHook runs hook with the shell, with the webhook's body on stdin
+// and its ID, type, code and item in PLAID_WEBHOOK_ID, PLAID_WEBHOOK_TYPE,
+// PLAID_WEBHOOK_CODE and PLAID_ITEM_ID. The hook fails if it exits with a
+// non-zero status.
+func RunWebhookHook(hook string, webhook Webhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookHookTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(webhook.Body)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	cmd.Env = append(os.Environ(),
+		"PLAID_WEBHOOK_ID="+webhook.ID,
+		"PLAID_WEBHOOK_TYPE="+webhook.Type,
+		"PLAID_WEBHOOK_CODE="+webhook.Code,
+		"PLAID_ITEM_ID="+webhook.Item,
+	)
+	err := cmd.Run()
+	if err != nil {
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			return fmt.Errorf("`%s`: %w: %s", hook, err, truncate(output, 512))
+		}
+		return fmt.Errorf("`%s`: %w", hook, err)
+	}
+	return nil
+}
+
+// WebhookReceiver receives webhooks from Plaid, stores them, and then hands
+// them to a hook one at a time.
+type WebhookReceiver struct {
+	Store *WebhookStore
+	// Hook is the command each webhook is handed to, if any.
+	Hook string
+	// Verifier, if set, rejects webhooks that weren't signed by Plaid.
+	Verifier *WebhookVerifier
+
+	mu sync.Mutex
+}
+
+func (r *WebhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !json.Valid(body) {
+		http.Error(w, "invalid webhook", http.StatusBadRequest)
+		return
+	}
+	verification := req.Header.Get(webhookVerificationHeader)
+	if r.Verifier != nil {
+		err = r.Verifier.Verify(body, verification, time.Now(), WebhookMaxAge)
+		var verificationErr WebhookVerificationError
+		if errors.As(err, &verificationErr) {
+			log.Printf("⚠️  Rejected a webhook: %v", err)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("⚠️  Failed to verify a webhook: %v", err)
+			http.Error(w, "failed to verify webhook", http.StatusInternalServerError)
+			return
+		}
+	}
+	webhook, err := r.Store.Receive(body, verification, time.Now())
+	if err != nil {
+		log.Printf("⚠️  Failed to store a webhook: %v", err)
+		// Plaid retries webhooks that aren't acknowledged.
+		http.Error(w, "failed to store webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Received %s %s webhook %s", webhook.Type, webhook.Code, webhook.ID)
+	w.WriteHeader(http.StatusOK)
+
+	if r.Hook != "" {
+		// Plaid only waits a few seconds for a response, so the hook runs
+		// after it's acknowledged.
+		go r.deliver(webhook)
+	}
+}
+
+func (r *WebhookReceiver) deliver(webhook Webhook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.Store.Deliver(webhook, r.Hook)
+	if err != nil {
+		log.Printf("⚠️  Webhook %s failed and was kept for `plaid-cli webhooks replay %s`: %v", webhook.ID, webhook.ID, err)
+	}
+}
+
+// UpdateWebhook sets the URL Plaid sends an item's webhooks to.
+func UpdateWebhook(client *ItemClient, token string, webhookURL string, dryRun bool) error {
+	req := plaid.NewItemWebhookUpdateRequest(token)
+	req.SetWebhook(webhookURL)
+	if dryRun {
+		return plaid_cli.PrintDryRun("/item/webhook/update", req)
+	}
+	_, _, err := client.ItemWebhookUpdate(context.Background()).ItemWebhookUpdateRequest(*req).Execute()
+	return err
+}
+
+// RegisterWebhook sets webhookURL as the webhook for each of itemIDs.
+func RegisterWebhook(client *ItemClient, itemIDs []string, webhookURL string, dryRun bool) error {
+	for _, itemID := range itemIDs {
+		err := client.Do(itemID, func(token string) error {
+			return UpdateWebhook(client, token, webhookURL, dryRun)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to register the webhook for %s: %w", ItemName(client.Data, itemID), err)
+		}
+	}
+	return nil
+}
+
+// ParseWebhookURL checks that webhookURL is an absolute http or https URL
+// Plaid can send webhooks to.
+func ParseWebhookURL(webhookURL string) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid webhook URL %q. Use a full URL, e.g. https://example.com/plaid-webhook", webhookURL)
+	}
+	return u.String(), nil
+}
+
+// WebhookUpdateResult is whether `webhooks set` changed an item's webhook.
+type WebhookUpdateResult struct {
+	ItemID string
+	Err    error
+}
+
+// SetWebhooks sets webhookURL as the webhook for each of itemIDs, logging
+// progress as it goes. Unlike RegisterWebhook, a failure doesn't stop the
+// rest, so a migration can be finished by rerunning it for the failed items.
+func SetWebhooks(client *ItemClient, itemIDs []string, webhookURL string, dryRun bool) []WebhookUpdateResult {
+	var results []WebhookUpdateResult
+	for i, itemID := range itemIDs {
+		err := client.Do(itemID, func(token string) error {
+			return UpdateWebhook(client, token, webhookURL, dryRun)
+		})
+		name := ItemName(client.Data, itemID)
+		switch {
+		case err != nil:
+			log.Printf("[%d/%d] %s: %v", i+1, len(itemIDs), name, err)
+		case !dryRun:
+			log.Printf("[%d/%d] %s: webhook set to %s", i+1, len(itemIDs), name, webhookURL)
+		}
+		results = append(results, WebhookUpdateResult{ItemID: itemID, Err: err})
+	}
+	return results
+}
+
+// WebhookUpdateError summarizes failed updates as an error, or nil if there
+// were none. Some failing makes it a PartialError.
+func WebhookUpdateError(results []WebhookUpdateResult) error {
+	var failed int
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return nil
+	case failed == len(results):
+		return fmt.Errorf("setting the webhook failed for all %d institutions", failed)
+	default:
+		return PartialError{Err: fmt.Errorf("setting the webhook failed for %d of %d institutions", failed, len(results))}
+	}
+}
+
+func WriteWebhookUpdateResults(w io.Writer, data *plaid_cli.Data, results []WebhookUpdateResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "ITEM\tSTATUS\tERROR")
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		status := "ok"
+		message := ""
+		if r.Err != nil {
+			status = "failed"
+			message = r.Err.Error()
+		}
+		_, err = fmt.Fprintf(tw, "%s\t%s\t%s\n", ItemName(data, r.ItemID), status, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
+
+func WriteWebhooks(w io.Writer, webhooks []Webhook, format string) error {
+	switch format {
+	case "json":
+		if webhooks == nil {
+			webhooks = []Webhook{}
+		}
+		b, err := json.MarshalIndent(webhooks, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "ID\tRECEIVED\tTYPE\tCODE\tITEM\tSTATUS\tATTEMPTS\tERROR")
+		if err != nil {
+			return err
+		}
+		for _, webhook := range webhooks {
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", webhook.ID, webhook.ReceivedAt.Local().Format("2006-01-02 15:04:05"), webhook.Type, webhook.Code, webhook.Item, webhook.Status, webhook.Attempts, truncate(webhook.Error, 80))
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}